@@ -0,0 +1,25 @@
+package actor
+
+import "context"
+
+type contextKey int
+
+const actorKey contextKey = iota
+
+// Actor is who made a request, UserID is empty for internal callers and
+// anonymous requests
+type Actor struct {
+	UserID    string
+	RequestID string
+}
+
+// With returns a context carrying the actor of the request
+func With(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey, a)
+}
+
+// FromContext returns the actor of the context, the zero Actor if there is none
+func FromContext(ctx context.Context) Actor {
+	a, _ := ctx.Value(actorKey).(Actor)
+	return a
+}
@@ -0,0 +1,209 @@
+package users
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+)
+
+// AuditRedacted replaces the values of secret fields in the audit log
+const AuditRedacted = "[redacted]"
+
+// ErrAuditChainBroken is returned when a audit entry was modified or removed
+var ErrAuditChainBroken = errors.New("audit chain broken")
+
+// auditSecrets are the fields of a user whose values are never written to the log
+var auditSecrets = map[string]bool{
+	"password": true,
+}
+
+// auditIgnored are the fields of a user that change on their own and are not audited
+var auditIgnored = map[string]bool{
+	"updated_at": true,
+	"roles":      true,
+}
+
+// AuditEvent is a append-only record of a change of a user. Each entry stores
+// the hash of the previous entry of the same user, so any modification or
+// removal breaks the chain.
+type AuditEvent struct {
+	ID        int64           `json:"id" db:"id"`
+	UserID    string          `json:"user_id" db:"user_id"`
+	Action    string          `json:"action" db:"action"`
+	ActorID   string          `json:"actor_id" db:"actor_id"`
+	RequestID string          `json:"request_id" db:"request_id"`
+	Changes   json.RawMessage `json:"changes" db:"changes"`
+	PrevHash  string          `json:"prev_hash" db:"prev_hash"`
+	Hash      string          `json:"hash" db:"hash"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
+
+// AuditChange is the value of a field before and after a change
+type AuditChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// NewAuditEvent builds the entry of a change of the user, before is nil for
+// created users. Only the fields that changed are recorded, with the values
+// of secrets redacted.
+func NewAuditEvent(action string, before, after *User) (*AuditEvent, error) {
+	changes, err := diffUsers(before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuditEvent{
+		UserID:  after.ID,
+		Action:  action,
+		Changes: raw,
+		// the database keeps microseconds, the hash must survive the round trip
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}, nil
+}
+
+// Seal links the entry to the previous one of the user and computes its hash
+func (a *AuditEvent) Seal(prevHash string) {
+	a.PrevHash = prevHash
+	a.Hash = a.ComputeHash()
+}
+
+// ComputeHash returns the hex SHA-256 of the previous hash and the content of the entry
+func (a *AuditEvent) ComputeHash() string {
+	h := sha256.New()
+	for _, part := range []string{
+		a.PrevHash,
+		a.UserID,
+		a.Action,
+		a.ActorID,
+		a.RequestID,
+		a.CreatedAt.UTC().Format(time.RFC3339Nano),
+		string(a.Changes),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// VerifyAuditChain checks the entries of a user, oldest first, returning
+// ErrAuditChainBroken at the first entry whose hash or link does not match
+func VerifyAuditChain(ee []*AuditEvent) error {
+	prev := ""
+	for _, a := range ee {
+		if a.PrevHash != prev || a.Hash != a.ComputeHash() {
+			return fmt.Errorf("%w at entry %v", ErrAuditChainBroken, a.ID)
+		}
+		prev = a.Hash
+	}
+
+	return nil
+}
+
+// ToProto ...
+func (a *AuditEvent) ToProto() *pb.AuditEvent {
+	changes := make([]*AuditChange, 0)
+	json.Unmarshal(a.Changes, &changes)
+
+	res := &pb.AuditEvent{
+		Id:        a.ID,
+		UserId:    a.UserID,
+		Action:    a.Action,
+		ActorId:   a.ActorID,
+		RequestId: a.RequestID,
+		Changes:   make([]*pb.AuditChange, 0, len(changes)),
+		PrevHash:  a.PrevHash,
+		Hash:      a.Hash,
+		CreatedAt: a.CreatedAt.Unix(),
+	}
+
+	for _, c := range changes {
+		res.Changes = append(res.Changes, &pb.AuditChange{
+			Field:  c.Field,
+			Before: auditValue(c.Before),
+			After:  auditValue(c.After),
+		})
+	}
+
+	return res
+}
+
+// diffUsers returns the changed fields sorted by name
+func diffUsers(before, after *User) ([]*AuditChange, error) {
+	old, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(cur))
+	for f := range cur {
+		if !auditIgnored[f] && !reflect.DeepEqual(old[f], cur[f]) {
+			fields = append(fields, f)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := make([]*AuditChange, 0, len(fields))
+	for _, f := range fields {
+		c := &AuditChange{Field: f, Before: old[f], After: cur[f]}
+
+		if auditSecrets[f] {
+			c.Before, c.After = nil, AuditRedacted
+			if old[f] != nil && old[f] != "" {
+				c.Before = AuditRedacted
+			}
+		}
+
+		changes = append(changes, c)
+	}
+
+	return changes, nil
+}
+
+// auditFields returns the fields of the user by their json name, none for nil
+func auditFields(u *User) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if u == nil {
+		return fields, nil
+	}
+
+	b, err := json.Marshal(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, json.Unmarshal(b, &fields)
+}
+
+// auditValue renders a value of a change for the proto, null values are empty
+func auditValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+
+	b, _ := json.Marshal(v)
+	return strings.Trim(string(b), `"`)
+}
@@ -0,0 +1,20 @@
+package users
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidCredentials is returned when the email or the password are wrong
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authentication is the result of a authentication step. When MFARequired is
+// true the user must complete the second step with MFAToken and a code.
+type Authentication struct {
+	User        *User
+	AccessToken string
+	ExpiresAt   time.Time
+
+	MFARequired bool
+	MFAToken    string
+}
@@ -0,0 +1,7 @@
+package users
+
+import "errors"
+
+// ErrUnavailable is returned without querying while the database is
+// considered down, see the circuit breaker of the postgres store
+var ErrUnavailable = errors.New("database unavailable, try again later")
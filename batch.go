@@ -0,0 +1,18 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxBatchSize is the most users a batch RPC reads or creates at once
+const MaxBatchSize = 100
+
+var (
+	// ErrBatchTooLarge ...
+	ErrBatchTooLarge = fmt.Errorf("batch exceeds the max size of %v", MaxBatchSize)
+
+	// ErrBatchAborted is the result of the items of a all-or-nothing batch
+	// that did not fail themselves but were not applied because another did
+	ErrBatchAborted = errors.New("not applied, another item of the batch failed")
+)
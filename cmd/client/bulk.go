@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	"github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// bulkFormat returns the format of a import or export file, csv or jsonl,
+// from the extension of the file when it is not given
+func bulkFormat(format, file string) (string, error) {
+	if format == "" {
+		if strings.HasSuffix(strings.ToLower(file), ".csv") {
+			return "csv", nil
+		}
+		return "jsonl", nil
+	}
+
+	if format != "csv" && format != "jsonl" {
+		return "", fmt.Errorf("invalid format %v, must be csv or jsonl", format)
+	}
+
+	return format, nil
+}
+
+// Import creates the users of a CSV or JSON Lines file. CSV files need a
+// header with the email, name, last_name and password columns, JSON Lines
+// files a user per line. Rows before from_row are skipped, so a import
+// that stopped can be resumed from the row after its last_row.
+func Import(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing file param")
+	}
+
+	data := struct {
+		File    string `json:"file"`
+		Format  string `json:"format"`
+		DryRun  bool   `json:"dry_run"`
+		FromRow int64  `json:"from_row"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	format, err := bulkFormat(data.Format, data.File)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(data.File)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	stream, err := us.ImportUsers(requestContext())
+	if err != nil {
+		return "", err
+	}
+
+	// rows the client can not read are reported along with the ones the server rejects
+	invalid := make([]*pb.ImportRowError, 0)
+
+	send := func(row int64, u *users.User, err error) error {
+		if row < data.FromRow {
+			return nil
+		}
+
+		if err != nil {
+			invalid = append(invalid, &pb.ImportRowError{
+				Row:   row,
+				Error: &pb.Error{Code: 400, Message: err.Error()},
+			})
+			return nil
+		}
+
+		return stream.Send(&pb.ImportUsersRequest{
+			Row:    row,
+			Data:   &pb.User{Email: u.Email, Name: u.Name, LastName: u.LastName, Password: u.Password},
+			DryRun: data.DryRun,
+		})
+	}
+
+	if format == "csv" {
+		err = readCSVUsers(f, send)
+	} else {
+		err = readJSONLUsers(f, send)
+	}
+
+	if err != nil {
+		stream.CloseSend()
+		return "", err
+	}
+
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		return "", err
+	}
+
+	res.Failed += int32(len(invalid))
+	res.Errors = append(invalid, res.Errors...)
+
+	json, err := json.Marshal(res)
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// readCSVUsers calls fn with every row of the file, numbered from the header
+func readCSVUsers(r io.Reader, fn func(int64, *users.User, error) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("invalid CSV header: %v", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+
+	for _, name := range []string{"email", "name", "last_name", "password"} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("missing CSV column %v", name)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i := columns[name]; i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	for row := int64(2); ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return err
+			}
+
+			if err := fn(row, nil, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		u := &users.User{
+			Email:    field(record, "email"),
+			Name:     field(record, "name"),
+			LastName: field(record, "last_name"),
+			Password: field(record, "password"),
+		}
+
+		if err := fn(row, u, nil); err != nil {
+			return err
+		}
+	}
+}
+
+// readJSONLUsers calls fn with the user of every line of the file, blank lines are ignored
+func readJSONLUsers(r io.Reader, fn func(int64, *users.User, error) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for row := int64(1); scanner.Scan(); row++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		u := &users.User{}
+		if err := json.Unmarshal([]byte(line), u); err != nil {
+			if err := fn(row, nil, errors.New("invalid JSON")); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := fn(row, u, nil); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Export writes every user to a CSV or JSON Lines file, without passwords.
+// Given the after_id of a export that stopped the users after it are
+// appended to the file.
+func Export(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing file param")
+	}
+
+	data := struct {
+		File           string `json:"file"`
+		Format         string `json:"format"`
+		OrganizationID string `json:"organization_id"`
+		AfterID        string `json:"after_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	format, err := bulkFormat(data.Format, data.File)
+	if err != nil {
+		return "", err
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if data.AfterID != "" {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(data.File, flags, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	var cw *csv.Writer
+
+	if format == "csv" {
+		cw = csv.NewWriter(w)
+		if data.AfterID == "" {
+			cw.Write([]string{"id", "email", "name", "last_name", "email_verified_at", "mfa_enabled", "roles", "created_at", "updated_at"})
+		}
+	}
+
+	stream, err := us.ExportUsers(requestContext(), &pb.ExportUsersRequest{
+		OrganizationId: data.OrganizationID,
+		AfterId:        data.AfterID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	count := 0
+	lastID := data.AfterID
+
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+
+		if err == nil && res.GetError() != nil {
+			err = errors.New(res.GetError().GetMessage())
+		}
+
+		if err != nil {
+			if cw != nil {
+				cw.Flush()
+			}
+			w.Flush()
+			return "", fmt.Errorf("%v, resume with after_id %v", err, lastID)
+		}
+
+		u := res.GetData()
+
+		if cw != nil {
+			err = cw.Write([]string{
+				u.GetId(), u.GetEmail(), u.GetName(), u.GetLastName(),
+				csvTime(u.GetEmailVerifiedAt()), strconv.FormatBool(u.GetMfaEnabled()),
+				strings.Join(u.GetRoles(), ";"), csvTime(u.GetCreatedAt()), csvTime(u.GetUpdatedAt()),
+			})
+		} else {
+			var line []byte
+			if line, err = json.Marshal(u); err == nil {
+				_, err = w.Write(append(line, '\n'))
+			}
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		count++
+		lastID = u.GetId()
+	}
+
+	if cw != nil {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return "", err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+
+	json, err := json.Marshal(struct {
+		Exported int    `json:"exported"`
+		LastID   string `json:"last_id"`
+	}{count, lastID})
+
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// csvTime formats a unix time as RFC 3339, empty when it is not set
+func csvTime(t int64) string {
+	if t == 0 {
+		return ""
+	}
+	return time.Unix(t, 0).UTC().Format(time.RFC3339)
+}
@@ -6,14 +6,33 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
 	pb "github.com/frperezr/microservices-demo/pb"
 	"github.com/frperezr/microservices-demo/src/users-api"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
+// requestContext authenticates the request with USERS_ACCESS_TOKEN, which
+// also scopes it to the organization of the token, and makes it safe to
+// retry with USERS_IDEMPOTENCY_KEY, when they are set
+func requestContext() context.Context {
+	ctx := context.Background()
+
+	if token := os.Getenv("USERS_ACCESS_TOKEN"); token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+
+	if key := os.Getenv("USERS_IDEMPOTENCY_KEY"); key != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "idempotency-key", key)
+	}
+
+	return ctx
+}
+
 func main() {
 	flag.Parse()
 
@@ -73,6 +92,251 @@ func main() {
 		if err != nil {
 			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
 		}
+	case "list":
+		result, err = List(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "verifyEmail":
+		result, err = VerifyEmail(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "resendVerification":
+		result, err = ResendVerification(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "confirmEmailChange":
+		result, err = ConfirmEmailChange(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "revertEmailChange":
+		result, err = RevertEmailChange(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "authenticate":
+		result, err = Authenticate(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "enrollMFA":
+		result, err = EnrollMFA(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "confirmMFA":
+		result, err = ConfirmMFA(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "disableMFA":
+		result, err = DisableMFA(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "resetMFA":
+		result, err = ResetMFA(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "unlock":
+		result, err = Unlock(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "listRoles":
+		result, err = ListRoles(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "listUserRoles":
+		result, err = ListUserRoles(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "assignRole":
+		result, err = AssignRole(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "revokeRole":
+		result, err = RevokeRole(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "checkPermission":
+		result, err = CheckPermission(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "createOrganization":
+		result, err = CreateOrganization(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "getOrganization":
+		result, err = GetOrganization(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "listOrganizations":
+		result, err = ListOrganizations(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "setMemberRole":
+		result, err = SetMemberRole(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "removeMember":
+		result, err = RemoveMember(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "inviteMember":
+		result, err = InviteMember(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "acceptInvitation":
+		result, err = AcceptInvitation(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "createGroup":
+		result, err = CreateGroup(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "getGroup":
+		result, err = GetGroup(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "updateGroup":
+		result, err = UpdateGroup(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "deleteGroup":
+		result, err = DeleteGroup(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "listGroups":
+		result, err = ListGroups(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "addGroupMember":
+		result, err = AddGroupMember(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "removeGroupMember":
+		result, err = RemoveGroupMember(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "listGroupMembers":
+		result, err = ListGroupMembers(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "listUserGroups":
+		result, err = ListUserGroups(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "restore":
+		result, err = Restore(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "watchUsers":
+		result, err = WatchUsers(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "createWebhook":
+		result, err = CreateWebhook(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "getWebhook":
+		result, err = GetWebhook(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "listWebhooks":
+		result, err = ListWebhooks(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "updateWebhook":
+		result, err = UpdateWebhook(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "deleteWebhook":
+		result, err = DeleteWebhook(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "listWebhookDeliveries":
+		result, err = ListWebhookDeliveries(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "listWebhookAttempts":
+		result, err = ListWebhookAttempts(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "replayWebhookDelivery":
+		result, err = ReplayWebhookDelivery(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "listAuditEvents":
+		result, err = ListAuditEvents(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "getUserAsOf":
+		result, err = GetUserAsOf(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "listUserVersions":
+		result, err = ListUserVersions(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "batchGetUsers":
+		result, err = BatchGetUsers(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "batchCreateUsers":
+		result, err = BatchCreateUsers(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "import":
+		result, err = Import(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
+	case "export":
+		result, err = Export(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Print(fmt.Sprintf(`{"error": "%v"}`, err.Error()))
+		}
 	default:
 		fmt.Print(`{"error": "invalid command"}`)
 		os.Exit(1)
@@ -99,7 +363,7 @@ func GetByID(us pb.UserServiceClient, args []string) (string, error) {
 		return "", errors.New("invalid JSON")
 	}
 
-	res, err := us.GetByID(context.Background(), &pb.GetUserByIDRequest{
+	res, err := us.GetByID(requestContext(), &pb.GetUserByIDRequest{
 		Id: data.ID,
 	})
 
@@ -144,7 +408,7 @@ func GetByEmail(us pb.UserServiceClient, args []string) (string, error) {
 		return "", errors.New("invalid JSON")
 	}
 
-	res, err := us.GetByEmail(context.Background(), &pb.GetUserByEmailRequest{
+	res, err := us.GetByEmail(requestContext(), &pb.GetUserByEmailRequest{
 		Email: data.Email,
 	})
 
@@ -189,7 +453,7 @@ func Create(us pb.UserServiceClient, args []string) (string, error) {
 		return "", errors.New("invalid JSON")
 	}
 
-	res, err := us.Create(context.Background(), &pb.CreateUserRequest{
+	res, err := us.Create(requestContext(), &pb.CreateUserRequest{
 		Data: data.User.ToProto(),
 	})
 
@@ -226,7 +490,7 @@ func Update(us pb.UserServiceClient, args []string) (string, error) {
 		return "", errors.New("invalid JSON")
 	}
 
-	res, err := us.Update(context.Background(), &pb.UpdateUserRequest{
+	res, err := us.Update(requestContext(), &pb.UpdateUserRequest{
 		Data: data.User.ToProto(),
 	})
 
@@ -263,7 +527,7 @@ func Delete(us pb.UserServiceClient, args []string) (string, error) {
 		return "", errors.New("invalid JSON")
 	}
 
-	res, err := us.Delete(context.Background(), &pb.DeleteUserRequest{
+	res, err := us.Delete(requestContext(), &pb.DeleteUserRequest{
 		UserId: data.ID,
 	})
 
@@ -282,3 +546,1787 @@ func Delete(us pb.UserServiceClient, args []string) (string, error) {
 
 	return string(json), nil
 }
+
+// List returns users, optionally filtered by email verification status
+func List(us pb.UserServiceClient, args []string) (string, error) {
+	data := struct {
+		Limit    int32 `json:"limit"`
+		Offset   int32 `json:"offset"`
+		Verified *bool `json:"verified"`
+	}{}
+
+	if len(args) == 1 {
+		err := json.Unmarshal([]byte(args[0]), &data)
+		if err != nil {
+			return "", errors.New("invalid JSON")
+		}
+	}
+
+	verified := pb.VerifiedFilter_ANY
+	if data.Verified != nil {
+		if *data.Verified {
+			verified = pb.VerifiedFilter_VERIFIED
+		} else {
+			verified = pb.VerifiedFilter_UNVERIFIED
+		}
+	}
+
+	res, err := us.List(requestContext(), &pb.ListUsersRequest{
+		Limit:    data.Limit,
+		Offset:   data.Offset,
+		Verified: verified,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// VerifyEmail confirms the email of a user with the token sent to it
+func VerifyEmail(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing token param")
+	}
+
+	data := struct {
+		Token string `json:"token"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.VerifyEmail(requestContext(), &pb.VerifyEmailRequest{
+		Token: data.Token,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ResendVerification sends a new verification token to the email of a user
+func ResendVerification(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing email param")
+	}
+
+	data := struct {
+		Email string `json:"email"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ResendVerification(requestContext(), &pb.ResendVerificationRequest{
+		Email: data.Email,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	return `{"sent": true}`, nil
+}
+
+// ConfirmEmailChange applies a pending email change with the token sent to the new address
+func ConfirmEmailChange(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing token param")
+	}
+
+	data := struct {
+		Token string `json:"token"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ConfirmEmailChange(requestContext(), &pb.ConfirmEmailChangeRequest{
+		Token: data.Token,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// RevertEmailChange restores the previous email with the token sent to the old address
+func RevertEmailChange(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing token param")
+	}
+
+	data := struct {
+		Token string `json:"token"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.RevertEmailChange(requestContext(), &pb.RevertEmailChangeRequest{
+		Token: data.Token,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// Authenticate checks the credentials of a user, or completes the second step with a mfa token and code
+func Authenticate(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing credentials param")
+	}
+
+	data := struct {
+		Email          string `json:"email"`
+		Password       string `json:"password"`
+		MFAToken       string `json:"mfa_token"`
+		Code           string `json:"code"`
+		OrganizationID string `json:"organization_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.Authenticate(requestContext(), &pb.AuthenticateRequest{
+		Email:          data.Email,
+		Password:       data.Password,
+		MfaToken:       data.MFAToken,
+		Code:           data.Code,
+		OrganizationId: data.OrganizationID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res)
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// EnrollMFA starts the TOTP enrollment of a user
+func EnrollMFA(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing user_id param")
+	}
+
+	data := struct {
+		UserID string `json:"user_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.EnrollMFA(requestContext(), &pb.EnrollMFARequest{
+		UserId: data.UserID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res)
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ConfirmMFA enables MFA with a code of the authenticator app and returns the recovery codes
+func ConfirmMFA(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing user_id and code params")
+	}
+
+	data := struct {
+		UserID string `json:"user_id"`
+		Code   string `json:"code"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ConfirmMFA(requestContext(), &pb.ConfirmMFARequest{
+		UserId: data.UserID,
+		Code:   data.Code,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res)
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// DisableMFA turns off MFA with a TOTP or recovery code
+func DisableMFA(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing user_id and code params")
+	}
+
+	data := struct {
+		UserID string `json:"user_id"`
+		Code   string `json:"code"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.DisableMFA(requestContext(), &pb.DisableMFARequest{
+		UserId: data.UserID,
+		Code:   data.Code,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ResetMFA turns off MFA of a user without a code
+func ResetMFA(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing user_id param")
+	}
+
+	data := struct {
+		UserID string `json:"user_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ResetMFA(requestContext(), &pb.ResetMFARequest{
+		UserId: data.UserID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// Unlock clears the lock and failed logins of a user
+func Unlock(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing user_id param")
+	}
+
+	data := struct {
+		UserID string `json:"user_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.Unlock(requestContext(), &pb.UnlockUserRequest{
+		UserId: data.UserID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ListRoles returns the roles with their permissions
+func ListRoles(us pb.UserServiceClient, args []string) (string, error) {
+	res, err := us.ListRoles(requestContext(), &pb.ListRolesRequest{})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ListUserRoles returns the roles of a user
+func ListUserRoles(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing user_id param")
+	}
+
+	data := struct {
+		UserID string `json:"user_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ListUserRoles(requestContext(), &pb.ListUserRolesRequest{
+		UserId: data.UserID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res)
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// AssignRole grants a role to a user
+func AssignRole(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing user_id and role params")
+	}
+
+	data := struct {
+		UserID string `json:"user_id"`
+		Role   string `json:"role"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.AssignRole(requestContext(), &pb.AssignRoleRequest{
+		UserId: data.UserID,
+		Role:   data.Role,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// RevokeRole removes a role from a user
+func RevokeRole(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing user_id and role params")
+	}
+
+	data := struct {
+		UserID string `json:"user_id"`
+		Role   string `json:"role"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.RevokeRole(requestContext(), &pb.RevokeRoleRequest{
+		UserId: data.UserID,
+		Role:   data.Role,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// CheckPermission tells whether a user has a permission
+func CheckPermission(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing user_id and permission params")
+	}
+
+	data := struct {
+		UserID     string `json:"user_id"`
+		Permission string `json:"permission"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.CheckPermission(requestContext(), &pb.CheckPermissionRequest{
+		UserId:     data.UserID,
+		Permission: data.Permission,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res)
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// GetOrganization returns a organization by id
+func GetOrganization(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing id param")
+	}
+
+	data := struct {
+		ID string `json:"id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.GetOrganization(requestContext(), &pb.GetOrganizationRequest{
+		Id: data.ID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ListOrganizations returns the organizations of a user
+func ListOrganizations(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing user_id param")
+	}
+
+	data := struct {
+		UserID string `json:"user_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ListOrganizations(requestContext(), &pb.ListOrganizationsRequest{
+		UserId: data.UserID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// SetMemberRole changes the role of a member of a organization
+func SetMemberRole(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing organization_id, user_id and role params")
+	}
+
+	data := struct {
+		OrganizationID string `json:"organization_id"`
+		UserID         string `json:"user_id"`
+		Role           string `json:"role"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.SetMemberRole(requestContext(), &pb.SetMemberRoleRequest{
+		OrganizationId: data.OrganizationID,
+		UserId:         data.UserID,
+		Role:           data.Role,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// RemoveMember removes a user from a organization
+func RemoveMember(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing organization_id and user_id params")
+	}
+
+	data := struct {
+		OrganizationID string `json:"organization_id"`
+		UserID         string `json:"user_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.RemoveMember(requestContext(), &pb.RemoveMemberRequest{
+		OrganizationId: data.OrganizationID,
+		UserId:         data.UserID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res)
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// InviteMember invites a email to join a organization
+func InviteMember(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing invitation param")
+	}
+
+	data := struct {
+		OrganizationID string `json:"organization_id"`
+		Email          string `json:"email"`
+		Role           string `json:"role"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.InviteMember(requestContext(), &pb.InviteMemberRequest{
+		OrganizationId: data.OrganizationID,
+		Email:          data.Email,
+		Role:           data.Role,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// AcceptInvitation joins a organization with a invitation token
+func AcceptInvitation(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing token and user_id params")
+	}
+
+	data := struct {
+		Token  string `json:"token"`
+		UserID string `json:"user_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.AcceptInvitation(requestContext(), &pb.AcceptInvitationRequest{
+		Token:  data.Token,
+		UserId: data.UserID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// CreateOrganization makes a new organization owned by a user
+func CreateOrganization(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing organization param")
+	}
+
+	data := struct {
+		Name    string `json:"name"`
+		Slug    string `json:"slug"`
+		OwnerID string `json:"owner_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.CreateOrganization(requestContext(), &pb.CreateOrganizationRequest{
+		Data: &pb.Organization{
+			Name: data.Name,
+			Slug: data.Slug,
+		},
+		OwnerId: data.OwnerID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// CreateGroup makes a new group inside a organization
+func CreateGroup(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing group param")
+	}
+
+	data := struct {
+		OrganizationID string `json:"organization_id"`
+		Name           string `json:"name"`
+		Description    string `json:"description"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.CreateGroup(requestContext(), &pb.CreateGroupRequest{
+		Data: &pb.Group{
+			OrganizationId: data.OrganizationID,
+			Name:           data.Name,
+			Description:    data.Description,
+		},
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// GetGroup ...
+func GetGroup(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing id param")
+	}
+
+	data := struct {
+		ID string `json:"id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.GetGroup(requestContext(), &pb.GetGroupRequest{
+		Id: data.ID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// UpdateGroup ...
+func UpdateGroup(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing group param")
+	}
+
+	data := struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.UpdateGroup(requestContext(), &pb.UpdateGroupRequest{
+		Data: &pb.Group{
+			Id:          data.ID,
+			Name:        data.Name,
+			Description: data.Description,
+		},
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// DeleteGroup ...
+func DeleteGroup(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing id param")
+	}
+
+	data := struct {
+		ID string `json:"id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.DeleteGroup(requestContext(), &pb.DeleteGroupRequest{
+		Id: data.ID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res)
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ListGroups returns the groups of a organization
+func ListGroups(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing organization_id param")
+	}
+
+	data := struct {
+		OrganizationID string `json:"organization_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ListGroups(requestContext(), &pb.ListGroupsRequest{
+		OrganizationId: data.OrganizationID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// AddGroupMember adds a user or a nested group to a group
+func AddGroupMember(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing group_id and user_id or member_group_id params")
+	}
+
+	data := struct {
+		GroupID       string `json:"group_id"`
+		UserID        string `json:"user_id"`
+		MemberGroupID string `json:"member_group_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.AddGroupMember(requestContext(), &pb.AddGroupMemberRequest{
+		Data: &pb.GroupMember{
+			GroupId:       data.GroupID,
+			UserId:        data.UserID,
+			MemberGroupId: data.MemberGroupID,
+		},
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// RemoveGroupMember ...
+func RemoveGroupMember(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing group_id and user_id or member_group_id params")
+	}
+
+	data := struct {
+		GroupID       string `json:"group_id"`
+		UserID        string `json:"user_id"`
+		MemberGroupID string `json:"member_group_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.RemoveGroupMember(requestContext(), &pb.RemoveGroupMemberRequest{
+		Data: &pb.GroupMember{
+			GroupId:       data.GroupID,
+			UserId:        data.UserID,
+			MemberGroupId: data.MemberGroupID,
+		},
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res)
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ListGroupMembers returns the direct members of a group
+func ListGroupMembers(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing group_id param")
+	}
+
+	data := struct {
+		GroupID string `json:"group_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ListGroupMembers(requestContext(), &pb.ListGroupMembersRequest{
+		GroupId: data.GroupID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ListUserGroups returns the effective groups of a user
+func ListUserGroups(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing user_id param")
+	}
+
+	data := struct {
+		UserID string `json:"user_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ListUserGroups(requestContext(), &pb.ListUserGroupsRequest{
+		UserId: data.UserID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// Restore undoes the deletion of a user
+func Restore(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing user_id param")
+	}
+
+	data := struct {
+		UserID string `json:"user_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.Restore(requestContext(), &pb.RestoreUserRequest{
+		UserId: data.UserID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// WatchUsers prints the changes of the users as JSON lines until the stream ends
+func WatchUsers(us pb.UserServiceClient, args []string) (string, error) {
+	data := struct {
+		UserIDs     []string `json:"user_ids"`
+		Types       []string `json:"types"`
+		ResumeToken string   `json:"resume_token"`
+		Replay      bool     `json:"replay"`
+	}{}
+
+	if len(args) == 1 {
+		err := json.Unmarshal([]byte(args[0]), &data)
+		if err != nil {
+			return "", errors.New("invalid JSON")
+		}
+	}
+
+	stream, err := us.WatchUsers(requestContext(), &pb.WatchUsersRequest{
+		UserIds:     data.UserIDs,
+		Types:       data.Types,
+		ResumeToken: data.ResumeToken,
+		Replay:      data.Replay,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return "", nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if res.GetError() != nil {
+			return "", errors.New(res.GetError().GetMessage())
+		}
+
+		json, err := json.Marshal(res.GetData())
+		if err != nil {
+			return "", errors.New("cant marshal data")
+		}
+
+		fmt.Println(string(json))
+	}
+}
+
+// CreateWebhook subscribes a url to the user events of a organization
+func CreateWebhook(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing webhook param")
+	}
+
+	data := struct {
+		OrganizationID string   `json:"organization_id"`
+		URL            string   `json:"url"`
+		EventTypes     []string `json:"event_types"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.CreateWebhook(requestContext(), &pb.CreateWebhookRequest{
+		Data: &pb.Webhook{
+			OrganizationId: data.OrganizationID,
+			Url:            data.URL,
+			EventTypes:     data.EventTypes,
+		},
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// GetWebhook ...
+func GetWebhook(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing id param")
+	}
+
+	data := struct {
+		ID string `json:"id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.GetWebhook(requestContext(), &pb.GetWebhookRequest{
+		Id: data.ID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ListWebhooks returns the webhooks of a organization
+func ListWebhooks(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing organization_id param")
+	}
+
+	data := struct {
+		OrganizationID string `json:"organization_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ListWebhooks(requestContext(), &pb.ListWebhooksRequest{
+		OrganizationId: data.OrganizationID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// UpdateWebhook ...
+func UpdateWebhook(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing webhook param")
+	}
+
+	data := struct {
+		ID         string   `json:"id"`
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+		Active     bool     `json:"active"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.UpdateWebhook(requestContext(), &pb.UpdateWebhookRequest{
+		Data: &pb.Webhook{
+			Id:         data.ID,
+			Url:        data.URL,
+			EventTypes: data.EventTypes,
+			Active:     data.Active,
+		},
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// DeleteWebhook ...
+func DeleteWebhook(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing id param")
+	}
+
+	data := struct {
+		ID string `json:"id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.DeleteWebhook(requestContext(), &pb.DeleteWebhookRequest{
+		Id: data.ID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res)
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ListWebhookDeliveries returns the deliveries of a webhook
+func ListWebhookDeliveries(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing webhook_id param")
+	}
+
+	data := struct {
+		WebhookID string `json:"webhook_id"`
+		Status    string `json:"status"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ListWebhookDeliveries(requestContext(), &pb.ListWebhookDeliveriesRequest{
+		WebhookId: data.WebhookID,
+		Status:    data.Status,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ListWebhookAttempts returns the requests made for a delivery
+func ListWebhookAttempts(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing delivery_id param")
+	}
+
+	data := struct {
+		DeliveryID string `json:"delivery_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ListWebhookAttempts(requestContext(), &pb.ListWebhookAttemptsRequest{
+		DeliveryId: data.DeliveryID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ReplayWebhookDelivery sends a delivery again
+func ReplayWebhookDelivery(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing delivery_id param")
+	}
+
+	data := struct {
+		DeliveryID string `json:"delivery_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ReplayWebhookDelivery(requestContext(), &pb.ReplayWebhookDeliveryRequest{
+		DeliveryId: data.DeliveryID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ListAuditEvents returns the audit log of a user
+func ListAuditEvents(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing user_id param")
+	}
+
+	data := struct {
+		UserID string `json:"user_id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ListAuditEvents(requestContext(), &pb.ListAuditEventsRequest{
+		UserId: data.UserID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res)
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// GetUserAsOf returns the version of a user current at a unix time
+func GetUserAsOf(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing id and at params")
+	}
+
+	data := struct {
+		ID string `json:"id"`
+		At int64  `json:"at"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.GetUserAsOf(requestContext(), &pb.GetUserAsOfRequest{
+		Id: data.ID,
+		At: data.At,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// ListUserVersions returns every version of a user
+func ListUserVersions(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing id param")
+	}
+
+	data := struct {
+		ID string `json:"id"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.ListUserVersions(requestContext(), &pb.ListUserVersionsRequest{
+		Id: data.ID,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// BatchGetUsers returns the users found with the ids and the missing ids
+func BatchGetUsers(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing ids param")
+	}
+
+	data := struct {
+		IDs []string `json:"ids"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	res, err := us.BatchGetUsers(requestContext(), &pb.BatchGetUsersRequest{
+		Ids: data.IDs,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(struct {
+		Data       []*pb.User `json:"data"`
+		MissingIDs []string   `json:"missing_ids"`
+	}{res.GetData(), res.GetMissingIds()})
+
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
+
+// BatchCreateUsers creates the users, returning the result of each one
+func BatchCreateUsers(us pb.UserServiceClient, args []string) (string, error) {
+	if len(args) != 1 {
+		flag.Usage()
+		return "", errors.New("missing users param")
+	}
+
+	data := struct {
+		Users        []*users.User `json:"users"`
+		AllOrNothing bool          `json:"all_or_nothing"`
+	}{}
+
+	err := json.Unmarshal([]byte(args[0]), &data)
+	if err != nil {
+		return "", errors.New("invalid JSON")
+	}
+
+	uu := make([]*pb.User, 0, len(data.Users))
+	for _, u := range data.Users {
+		uu = append(uu, u.ToProto())
+	}
+
+	res, err := us.BatchCreateUsers(requestContext(), &pb.BatchCreateUsersRequest{
+		Data:         uu,
+		AllOrNothing: data.AllOrNothing,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if res.GetError() != nil {
+		return "", errors.New(res.GetError().GetMessage())
+	}
+
+	json, err := json.Marshal(res.GetData())
+	if err != nil {
+		return "", errors.New("cant marshal data")
+	}
+
+	return string(json), nil
+}
@@ -1,16 +1,37 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	pb "github.com/frperezr/microservices-demo/pb"
 
 	"github.com/frperezr/microservices-demo/src/users-api/database"
+	"github.com/frperezr/microservices-demo/src/users-api/database/cache"
+	"github.com/frperezr/microservices-demo/src/users-api/encryption"
+	"github.com/frperezr/microservices-demo/src/users-api/gateway"
+	"github.com/frperezr/microservices-demo/src/users-api/graph"
+	"github.com/frperezr/microservices-demo/src/users-api/idempotency"
+	"github.com/frperezr/microservices-demo/src/users-api/notifier"
+	"github.com/frperezr/microservices-demo/src/users-api/outbox"
 	userService "github.com/frperezr/microservices-demo/src/users-api/rpc/users"
+	"github.com/frperezr/microservices-demo/src/users-api/service"
+	"github.com/frperezr/microservices-demo/src/users-api/token"
+	"github.com/frperezr/microservices-demo/src/users-api/webhook"
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/cors"
+	"github.com/soheilhy/cmux"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/reflection"
 
 	_ "github.com/lib/pq"
@@ -18,25 +39,108 @@ import (
 
 func main() {
 	port := os.Getenv("PORT")
-	postgresDSN := os.Getenv("POSTGRES_DSN")
+	dsn := os.Getenv("DATABASE_DSN")
+	appURL := os.Getenv("APP_URL")
+	tokenSecret := os.Getenv("TOKEN_SECRET")
 
 	if port == "" {
 		log.Fatal("missing env variable PORT")
 	}
 
-	if postgresDSN == "" {
-		log.Fatal("missing env variable POSTGRES_DSN")
+	if dsn == "" {
+		// the name before SQLite and MySQL were supported
+		dsn = os.Getenv("POSTGRES_DSN")
 	}
 
-	postgresService, err := database.NewPostgres(postgresDSN)
+	if dsn == "" {
+		log.Fatal("missing env variable DATABASE_DSN")
+	}
+
+	if tokenSecret == "" {
+		log.Fatal("missing env variable TOKEN_SECRET")
+	}
+
+	mfaCipher := envCipher("MFA_ENCRYPTION_KEY")
+	webhookCipher := envCipher("WEBHOOK_ENCRYPTION_KEY")
+
+	if os.Getenv("WEBHOOK_ENCRYPTION_KEY") == os.Getenv("MFA_ENCRYPTION_KEY") {
+		log.Fatal("WEBHOOK_ENCRYPTION_KEY must not be MFA_ENCRYPTION_KEY")
+	}
+
+	dbStore, err := openStore(dsn)
+	if err != nil {
+		log.Fatalf("Failed connect to database: %v", err)
+	}
+
+	store, err := cachedStore(dbStore)
+	if err != nil {
+		log.Fatalf("Failed to create cache: %v", err)
+	}
+
+	userSvc := service.New(store, notifier.NewLog(appURL))
+	userSvc.Tokens = token.NewIssuer("users-api", []byte(tokenSecret))
+	userSvc.Cipher = mfaCipher
+	userSvc.WebhookCipher = webhookCipher
+
+	if database.Driver(dsn) == database.DriverPostgres {
+		if listener, err := database.NewPostgresListener(dsn); err != nil {
+			log.Println(fmt.Sprintf("Failed to listen outbox notifications, WatchUsers will poll: %v", err))
+		} else {
+			userSvc.Notifications = listener
+		}
+	}
+	userSvc.AccountLockout.Threshold = envInt("LOCKOUT_ACCOUNT_THRESHOLD", userSvc.AccountLockout.Threshold)
+	userSvc.IPLockout.Threshold = envInt("LOCKOUT_IP_THRESHOLD", userSvc.IPLockout.Threshold)
+
+	policy := userSvc.PasswordPolicy
+	policy.MinLength = envInt("PASSWORD_MIN_LENGTH", policy.MinLength)
+	policy.MaxLength = envInt("PASSWORD_MAX_LENGTH", policy.MaxLength)
+
+	if path := os.Getenv("PASSWORD_BLOCKLIST_FILE"); path != "" {
+		if err := policy.Blocklist.LoadFile(path); err != nil {
+			log.Fatalf("Failed to load password blocklist: %v", err)
+		}
+	}
+
+	if dir := os.Getenv("PASSWORD_BLOCKLIST_DIR"); dir != "" {
+		if err := policy.Blocklist.LoadRangeDir(dir); err != nil {
+			log.Fatalf("Failed to load password blocklist: %v", err)
+		}
+	}
+
+	sink, err := outboxSink(os.Getenv("OUTBOX_SINK"))
 	if err != nil {
-		log.Fatalf("Failed connect to postgres: %v", err)
+		log.Fatalf("Failed to create outbox sink: %v", err)
 	}
 
-	server := grpc.NewServer()
-	service := userService.New(postgresService)
+	// webhooks get their deliveries queued before the events go to the sink
+	sinks := outbox.Fanout{webhook.NewDispatcher(dbStore)}
+	if sink != nil {
+		sinks = append(sinks, sink)
+	}
 
-	pb.RegisterUserServiceServer(server, service)
+	relay := outbox.NewRelay(dbStore, sinks)
+	relay.BatchSize = envInt("OUTBOX_BATCH_SIZE", relay.BatchSize)
+	relay.MaxAttempts = envInt("OUTBOX_MAX_ATTEMPTS", relay.MaxAttempts)
+	go relay.Run(context.Background())
+
+	worker := webhook.NewWorker(dbStore, webhookCipher)
+	worker.MaxAttempts = envInt("WEBHOOK_MAX_ATTEMPTS", worker.MaxAttempts)
+	go worker.Run(context.Background())
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(userService.TenantInterceptor(userSvc.Tokens), userService.ActorInterceptor(userSvc.Tokens), userService.ConsistencyInterceptor),
+		grpc.ChainStreamInterceptor(userService.TenantStreamInterceptor(userSvc.Tokens), userService.ActorStreamInterceptor(userSvc.Tokens), userService.ConsistencyStreamInterceptor),
+	)
+	rpcService := userService.New(userSvc)
+
+	keys := idempotency.New(dbStore)
+	keys.TTL = time.Duration(envInt("IDEMPOTENCY_KEY_TTL_HOURS", int(keys.TTL.Hours()))) * time.Hour
+	keys.Lease = time.Duration(envInt("IDEMPOTENCY_KEY_LEASE_SECONDS", int(keys.Lease.Seconds()))) * time.Second
+	rpcService.Idempotency = keys
+	go keys.Run(context.Background())
+
+	pb.RegisterUserServiceServer(server, rpcService)
 	reflection.Register(server)
 
 	log.Println("Starting User service...")
@@ -48,7 +152,237 @@ func main() {
 
 	log.Println(fmt.Sprintf("User service, Listening on: %v", port))
 
-	if err := server.Serve(lis); err != nil {
+	// browsers reach the service over Connect and gRPC-Web on the same port
+	web := http.NewServeMux()
+	connectPath, connectHandler := rpcService.ConnectHandler(userSvc.Tokens)
+	web.Handle(connectPath, withCORS(connectHandler, http.MethodPost))
+	graphHandler := graph.NewHandler(userSvc)
+	graphHandler.Idempotency = keys
+	web.Handle("/graphql", withCORS(userService.HTTPScope(userSvc.Tokens, graphHandler), http.MethodPost))
+
+	httpPort := os.Getenv("HTTP_PORT")
+	if httpPort != "" {
+		// the gateway calls the gRPC server like any other client
+		conn, err := grpc.NewClient(fmt.Sprintf("localhost:%v", port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			log.Fatalf("Failed to create gateway client: %v", err)
+		}
+
+		rest := gateway.New(pb.NewUserServiceClient(conn))
+
+		if httpPort == port {
+			web.Handle("/v1/", withCORS(rest, restMethods...))
+		} else {
+			go func() {
+				log.Println(fmt.Sprintf("User REST gateway, Listening on: %v", httpPort))
+				if err := http.ListenAndServe(fmt.Sprintf(":%v", httpPort), withCORS(rest, restMethods...)); err != nil {
+					log.Fatalf("Fatal to serve: %v", err)
+				}
+			}()
+		}
+	}
+
+	// gRPC requests are told apart by their content-type, the rest is HTTP
+	m := cmux.New(lis)
+	grpcLis := m.MatchWithWriters(cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"))
+	httpLis := m.Match(cmux.Any())
+
+	go func() {
+		if err := server.Serve(grpcLis); err != nil {
+			log.Fatalf("Fatal to serve gRPC: %v", err)
+		}
+	}()
+
+	go func() {
+		if err := http.Serve(httpLis, web); err != nil {
+			log.Fatalf("Fatal to serve HTTP: %v", err)
+		}
+	}()
+
+	if err := m.Serve(); err != nil {
 		log.Fatalf("Fatal to serve: %v", err)
 	}
 }
+
+// restMethods are the methods of the routes of the REST gateway
+var restMethods = []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete}
+
+// withCORS allows the origins in CORS_ALLOWED_ORIGINS, comma separated, to
+// call the HTTP handler with the methods and the headers of the Connect and
+// gRPC-Web protocols. Any origin can not be allowed as the requests carry
+// access tokens.
+func withCORS(h http.Handler, methods ...string) http.Handler {
+	origins := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if origins == "" {
+		return h
+	}
+
+	allowed := strings.Split(origins, ",")
+	for _, origin := range allowed {
+		if strings.TrimSpace(origin) == "*" {
+			log.Fatal("CORS_ALLOWED_ORIGINS must list the origins, * is not allowed")
+		}
+	}
+
+	return cors.New(cors.Options{
+		AllowedOrigins: allowed,
+		AllowedMethods: methods,
+		AllowedHeaders: []string{
+			"Content-Type", "Connect-Protocol-Version", "Connect-Timeout-Ms", "Grpc-Timeout", "X-Grpc-Web", "X-User-Agent",
+			"Authorization", userService.RequestIDHeader, userService.IdempotencyKeyHeader, userService.ReadPrimaryHeader,
+		},
+		ExposedHeaders: []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin", userService.RequestIDHeader},
+		MaxAge:         7200,
+	}).Handler(h)
+}
+
+// openStore connects to the database of the DSN, see database.Driver. The
+// DB_* settings apply to Postgres and MySQL, replicas only to Postgres.
+func openStore(dsn string) (database.Store, error) {
+	opts := database.DefaultOptions()
+	opts.Pool.MaxOpenConns = dbEnvInt("MAX_OPEN_CONNS", opts.Pool.MaxOpenConns)
+	opts.Pool.MaxIdleConns = dbEnvInt("MAX_IDLE_CONNS", opts.Pool.MaxIdleConns)
+	opts.Pool.ConnMaxLifetime = time.Duration(dbEnvInt("CONN_MAX_LIFETIME_SECONDS", int(opts.Pool.ConnMaxLifetime.Seconds()))) * time.Second
+	opts.Pool.ConnMaxIdleTime = time.Duration(dbEnvInt("CONN_MAX_IDLE_TIME_SECONDS", int(opts.Pool.ConnMaxIdleTime.Seconds()))) * time.Second
+	opts.ConnectTimeout = time.Duration(dbEnvInt("CONNECT_TIMEOUT_SECONDS", int(opts.ConnectTimeout.Seconds()))) * time.Second
+	opts.Retry.Attempts = dbEnvInt("RETRY_ATTEMPTS", opts.Retry.Attempts)
+	opts.Breaker.Threshold = dbEnvInt("BREAKER_THRESHOLD", opts.Breaker.Threshold)
+	opts.Breaker.Cooldown = time.Duration(dbEnvInt("BREAKER_COOLDOWN_SECONDS", int(opts.Breaker.Cooldown.Seconds()))) * time.Second
+
+	dsns := os.Getenv("DB_REPLICA_DSNS")
+	if dsns == "" {
+		dsns = os.Getenv("POSTGRES_REPLICA_DSNS")
+	}
+
+	if dsns != "" {
+		if database.Driver(dsn) != database.DriverPostgres {
+			return nil, fmt.Errorf("replicas are only supported on Postgres")
+		}
+
+		replicas, err := database.NewPostgresReplicas(strings.Split(dsns, ","), opts.Pool)
+		if err != nil {
+			return nil, fmt.Errorf("replicas: %w", err)
+		}
+		opts.Replicas = replicas
+		go replicas.Run(context.Background())
+	}
+
+	return database.Open(dsn, opts)
+}
+
+// dbEnvInt returns the DB_ env variable of the setting as int, or the
+// POSTGRES_ one it replaced, or def if neither is set
+func dbEnvInt(name string, def int) int {
+	if os.Getenv("DB_"+name) != "" {
+		return envInt("DB_"+name, def)
+	}
+	return envInt("POSTGRES_"+name, def)
+}
+
+// cachedStore puts the cache in front of the store, with CACHE_SIZE users in
+// process and in Redis when REDIS_URL is set. A CACHE_SIZE of 0 disables it.
+// Without Redis the instances do not see the changes of each other, so the
+// cache is off unless CACHE_SIZE is set.
+func cachedStore(store database.Store) (database.Store, error) {
+	url := os.Getenv("REDIS_URL")
+	if url == "" && os.Getenv("CACHE_SIZE") == "" {
+		return store, nil
+	}
+
+	size := envInt("CACHE_SIZE", 10000)
+	if size == 0 {
+		return store, nil
+	}
+
+	var c cache.Cache = cache.NewLRU(size)
+
+	if url != "" {
+		opts, err := redis.ParseURL(url)
+		if err != nil {
+			return nil, err
+		}
+
+		// other instances change users too, the local copies must not live long
+		c = &cache.Tiered{
+			Local:    c,
+			Remote:   cache.NewRedis(redis.NewClient(opts)),
+			LocalTTL: time.Duration(envInt("CACHE_LOCAL_TTL_SECONDS", 5)) * time.Second,
+		}
+	}
+
+	cached := cache.NewStore(store, c)
+	cached.TTL = time.Duration(envInt("CACHE_TTL_SECONDS", int(cached.TTL.Seconds()))) * time.Second
+	cached.NegativeTTL = time.Duration(envInt("CACHE_NEGATIVE_TTL_SECONDS", int(cached.NegativeTTL.Seconds()))) * time.Second
+
+	return cached, nil
+}
+
+// envCipher returns the cipher of the base64 encoded 32 bytes key in the env variable
+func envCipher(name string) *encryption.AESGCM {
+	value := os.Getenv(name)
+	if value == "" {
+		log.Fatalf("missing env variable %v", name)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		log.Fatalf("Invalid %v: %v", name, err)
+	}
+
+	cipher, err := encryption.NewAESGCM(key)
+	if err != nil {
+		log.Fatalf("Invalid %v: %v", name, err)
+	}
+
+	return cipher
+}
+
+// envInt returns the env variable as int or def if it is not set
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("Invalid %v: %v", name, err)
+	}
+
+	return i
+}
+
+// outboxSink returns the sink the user events are published to, nil when they are only sent to webhooks
+func outboxSink(kind string) (outbox.Sink, error) {
+	switch kind {
+	case "", "stdout":
+		return outbox.NewStdoutSink(), nil
+	case "none":
+		return nil, nil
+	case "nats":
+		conn, err := nats.Connect(os.Getenv("NATS_URL"))
+		if err != nil {
+			return nil, err
+		}
+		return outbox.NewNATSSink(conn), nil
+	case "kafka":
+		brokers := os.Getenv("KAFKA_BROKERS")
+		if brokers == "" {
+			return nil, fmt.Errorf("missing env variable KAFKA_BROKERS")
+		}
+
+		topic := os.Getenv("KAFKA_TOPIC")
+		if topic == "" {
+			topic = "users"
+		}
+		return outbox.NewKafkaSink(strings.Split(brokers, ","), topic), nil
+	case "http":
+		url := os.Getenv("OUTBOX_HTTP_URL")
+		if url == "" {
+			return nil, fmt.Errorf("missing env variable OUTBOX_HTTP_URL")
+		}
+		return outbox.NewHTTPSink(url), nil
+	}
+
+	return nil, fmt.Errorf("unknown OUTBOX_SINK %q", kind)
+}
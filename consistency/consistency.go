@@ -0,0 +1,48 @@
+// Package consistency tells the store when a read must go to the primary
+// database instead of a replica, which may lag behind it.
+package consistency
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type contextKey int
+
+const (
+	sessionKey contextKey = iota
+	primaryKey
+)
+
+// session records whether a write was made with its context
+type session struct {
+	wrote atomic.Bool
+}
+
+// WithSession returns a context whose reads go to the primary once a write
+// was made with it, so a request reads its own writes
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey, &session{})
+}
+
+// Primary returns a context whose reads always go to the primary
+func Primary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey, true)
+}
+
+// MarkWrite records a write in the session of the context, if any
+func MarkWrite(ctx context.Context) {
+	if s, ok := ctx.Value(sessionKey).(*session); ok {
+		s.wrote.Store(true)
+	}
+}
+
+// ReadPrimary reports whether the reads of the context must go to the primary
+func ReadPrimary(ctx context.Context) bool {
+	if primary, _ := ctx.Value(primaryKey).(bool); primary {
+		return true
+	}
+
+	s, ok := ctx.Value(sessionKey).(*session)
+	return ok && s.wrote.Load()
+}
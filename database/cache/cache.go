@@ -0,0 +1,63 @@
+// Package cache keeps the users read by id and email close to the service,
+// see Store.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache holds values by key and scope, the scopes of a key are deleted
+// together. A nil value is a valid value, used to cache a miss.
+type Cache interface {
+	Get(ctx context.Context, key, scope string) ([]byte, bool, error)
+	Set(ctx context.Context, key, scope string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Tiered reads from Local first and from Remote on a miss, keeping what it
+// finds in Local for up to LocalTTL. Writes go to both.
+//
+// Remote is shared by every instance of the service but Local is not, so
+// LocalTTL bounds how long a instance can see a value another one changed.
+type Tiered struct {
+	Local    Cache
+	Remote   Cache
+	LocalTTL time.Duration
+}
+
+// Get ...
+func (t *Tiered) Get(ctx context.Context, key, scope string) ([]byte, bool, error) {
+	if value, ok, err := t.Local.Get(ctx, key, scope); err != nil || ok {
+		return value, ok, err
+	}
+
+	value, ok, err := t.Remote.Get(ctx, key, scope)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	return value, true, t.Local.Set(ctx, key, scope, value, t.LocalTTL)
+}
+
+// Set ...
+func (t *Tiered) Set(ctx context.Context, key, scope string, value []byte, ttl time.Duration) error {
+	if err := t.Remote.Set(ctx, key, scope, value, ttl); err != nil {
+		return err
+	}
+
+	if ttl > t.LocalTTL {
+		ttl = t.LocalTTL
+	}
+
+	return t.Local.Set(ctx, key, scope, value, ttl)
+}
+
+// Delete ...
+func (t *Tiered) Delete(ctx context.Context, keys ...string) error {
+	if err := t.Local.Delete(ctx, keys...); err != nil {
+		return err
+	}
+
+	return t.Remote.Delete(ctx, keys...)
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is a in process Cache of up to Size keys, the least recently used key
+// is evicted to make room for a new one
+type LRU struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	keys  map[string]*list.Element
+	now   func() time.Time
+}
+
+type lruEntry struct {
+	key    string
+	scopes map[string]lruValue
+}
+
+type lruValue struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU ...
+func NewLRU(size int) *LRU {
+	return &LRU{
+		size:  size,
+		order: list.New(),
+		keys:  make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+// Get ...
+func (c *LRU) Get(ctx context.Context, key, scope string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.keys[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := el.Value.(*lruEntry)
+
+	v, ok := entry.scopes[scope]
+	if !ok {
+		return nil, false, nil
+	}
+
+	if !c.now().Before(v.expires) {
+		delete(entry.scopes, scope)
+		if len(entry.scopes) == 0 {
+			c.remove(el)
+		}
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(el)
+	return v.value, true, nil
+}
+
+// Set ...
+func (c *LRU) Set(ctx context.Context, key, scope string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.keys[key]
+	if !ok {
+		el = c.order.PushFront(&lruEntry{key: key, scopes: make(map[string]lruValue)})
+		c.keys[key] = el
+	} else {
+		c.order.MoveToFront(el)
+	}
+
+	el.Value.(*lruEntry).scopes[scope] = lruValue{value: value, expires: c.now().Add(ttl)}
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+
+	return nil
+}
+
+// Delete ...
+func (c *LRU) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := c.keys[key]; ok {
+			c.remove(el)
+		}
+	}
+
+	return nil
+}
+
+func (c *LRU) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.keys, el.Value.(*lruEntry).key)
+}
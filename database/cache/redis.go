@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a Cache shared by every instance of the service. Each key is a
+// hash with a field per scope, the fields carry their own expiration since
+// Redis only expires whole keys.
+type Redis struct {
+	Client *redis.Client
+	Prefix string
+}
+
+// NewRedis ...
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{
+		Client: client,
+		Prefix: "users-api:",
+	}
+}
+
+// Get ...
+func (r *Redis) Get(ctx context.Context, key, scope string) ([]byte, bool, error) {
+	b, err := r.Client.HGet(ctx, r.Prefix+key, scope).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(b) < 8 || time.Now().UnixNano() >= int64(binary.BigEndian.Uint64(b)) {
+		return nil, false, nil
+	}
+
+	if len(b) == 8 {
+		return nil, true, nil
+	}
+
+	return b[8:], true, nil
+}
+
+// Set ...
+func (r *Redis) Set(ctx context.Context, key, scope string, value []byte, ttl time.Duration) error {
+	b := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint64(b, uint64(time.Now().Add(ttl).UnixNano()))
+	b = append(b, value...)
+
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, r.Prefix+key, scope, b)
+		pipe.Expire(ctx, r.Prefix+key, ttl)
+		return nil
+	})
+
+	return err
+}
+
+// Delete ...
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, r.Prefix+key)
+	}
+
+	return r.Client.Del(ctx, prefixed...).Err()
+}
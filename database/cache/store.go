@@ -0,0 +1,392 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/consistency"
+	"github.com/frperezr/microservices-demo/src/users-api/database"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultTTL is how long a user is cached
+	DefaultTTL = time.Minute
+
+	// DefaultNegativeTTL is how long a user that was not found is cached
+	DefaultNegativeTTL = 10 * time.Second
+)
+
+// Store is a database.Store that reads GetByID and GetByEmail through a
+// Cache. The methods that change users delete them from the cache after
+// the change, concurrent misses of the same user make a single query.
+//
+// Users are cached per tenant, since each tenant sees a different set of
+// users. Misses are always read from the primary database rather than the
+// replicas: the lag of a replica is not bounded, so a miss right after a
+// change could read the old row from a replica behind and cache it for TTL,
+// long after the change was invalidated. Emails are
+// cached as the id of their user, which is read through its own entry, so a
+// changed or deleted user is never returned by its old email.
+//
+// Reads whose context must go to the primary, see consistency.ReadPrimary,
+// skip the cache, a copy cached by another instance may be stale.
+//
+// Passwords are never cached, users read through the cache have an empty
+// Password. The reads that check it go to the primary.
+type Store struct {
+	database.Store
+
+	Cache       Cache
+	TTL         time.Duration
+	NegativeTTL time.Duration
+
+	group singleflight.Group
+
+	// generation changes on every invalidation, a query that started
+	// before one may have read the old row and is not cached
+	generation atomic.Uint64
+}
+
+// NewStore ...
+func NewStore(store database.Store, cache Cache) *Store {
+	return &Store{
+		Store:       store,
+		Cache:       cache,
+		TTL:         DefaultTTL,
+		NegativeTTL: DefaultNegativeTTL,
+	}
+}
+
+func idKey(id string) string {
+	return "users:id:" + id
+}
+
+func emailKey(email string) string {
+	return "users:email:" + email
+}
+
+// cacheScope returns the scope the users of the context are cached in,
+// false when the context has none and the store will fail
+func cacheScope(ctx context.Context) (string, bool) {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return id, true
+	}
+
+	if tenant.IsSystem(ctx) {
+		return "system", true
+	}
+
+	return "", false
+}
+
+// GetByID ...
+func (s *Store) GetByID(ctx context.Context, id string) (*user.User, error) {
+	scope, ok := cacheScope(ctx)
+	if !ok || id == "" || consistency.ReadPrimary(ctx) {
+		return s.Store.GetByID(ctx, id)
+	}
+
+	if value, ok := s.get(ctx, idKey(id), scope); ok {
+		return decodeUser(value)
+	}
+
+	v, err, _ := s.group.Do(scope+"|"+idKey(id), func() (interface{}, error) {
+		generation := s.generation.Load()
+
+		// the query is shared by every caller, one of them giving up must not
+		// fail the others. It goes to the primary, see Store.
+		u, err := s.Store.GetByID(consistency.Primary(context.WithoutCancel(ctx)), id)
+		if err == sql.ErrNoRows {
+			s.set(ctx, generation, idKey(id), scope, nil, s.NegativeTTL)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		s.setUser(ctx, generation, scope, u)
+		return u, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// callers modify the users they get, each one gets its own copy
+	u := *v.(*user.User)
+	u.Password = ""
+	return &u, nil
+}
+
+// GetByEmail ...
+func (s *Store) GetByEmail(ctx context.Context, email string) (*user.User, error) {
+	scope, ok := cacheScope(ctx)
+	if !ok || email == "" || consistency.ReadPrimary(ctx) {
+		return s.Store.GetByEmail(ctx, email)
+	}
+
+	if value, ok := s.get(ctx, emailKey(email), scope); ok {
+		if value == nil {
+			return nil, sql.ErrNoRows
+		}
+
+		u, err := s.GetByID(ctx, string(value))
+		if err == nil && strings.EqualFold(u.Email, email) {
+			return u, nil
+		}
+
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		// the user changed its email or was deleted since it was cached
+		s.delete(ctx, emailKey(email))
+	}
+
+	v, err, _ := s.group.Do(scope+"|"+emailKey(email), func() (interface{}, error) {
+		generation := s.generation.Load()
+
+		u, err := s.Store.GetByEmail(consistency.Primary(context.WithoutCancel(ctx)), email)
+		if err == sql.ErrNoRows {
+			s.set(ctx, generation, emailKey(email), scope, nil, s.NegativeTTL)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		s.setUser(ctx, generation, scope, u)
+		s.set(ctx, generation, emailKey(email), scope, []byte(u.ID), s.TTL)
+		return u, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	u := *v.(*user.User)
+	u.Password = ""
+	return &u, nil
+}
+
+func (s *Store) get(ctx context.Context, key, scope string) ([]byte, bool) {
+	value, ok, err := s.Cache.Get(ctx, key, scope)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][Cache][Error] reading %v: %v", key, err.Error()))
+		return nil, false
+	}
+
+	return value, ok
+}
+
+func (s *Store) set(ctx context.Context, generation uint64, key, scope string, value []byte, ttl time.Duration) {
+	if s.generation.Load() != generation {
+		return
+	}
+
+	if err := s.Cache.Set(ctx, key, scope, value, ttl); err != nil {
+		log.Println(fmt.Sprintf("[User Service][Cache][Error] writing %v: %v", key, err.Error()))
+	}
+}
+
+func (s *Store) setUser(ctx context.Context, generation uint64, scope string, u *user.User) {
+	cached := *u
+	cached.Password = ""
+
+	value, err := json.Marshal(&cached)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][Cache][Error] encoding user %v: %v", u.ID, err.Error()))
+		return
+	}
+
+	s.set(ctx, generation, idKey(u.ID), scope, value, s.TTL)
+}
+
+func (s *Store) delete(ctx context.Context, keys ...string) {
+	s.generation.Add(1)
+
+	if err := s.Cache.Delete(ctx, keys...); err != nil {
+		log.Println(fmt.Sprintf("[User Service][Cache][Error] deleting %v: %v", keys, err.Error()))
+	}
+}
+
+// decodeUser returns the cached user, nil is a user that was not found
+func decodeUser(value []byte) (*user.User, error) {
+	if value == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	u := &user.User{}
+	if err := json.Unmarshal(value, u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// invalidate deletes the users from the cache. Emails only need to be
+// deleted when they may be cached as not found, see GetByEmail.
+func (s *Store) invalidate(ctx context.Context, uu ...*user.User) {
+	keys := make([]string, 0, 3*len(uu))
+
+	for _, u := range uu {
+		if u == nil {
+			continue
+		}
+
+		if u.ID != "" {
+			keys = append(keys, idKey(u.ID))
+		}
+
+		if u.Email != "" {
+			keys = append(keys, emailKey(u.Email), emailKey(strings.ToLower(u.Email)))
+		}
+	}
+
+	s.delete(ctx, keys...)
+}
+
+// invalidateMember deletes a user that joined a tenant, which may have it
+// cached as not found by email
+func (s *Store) invalidateMember(ctx context.Context, userID string) {
+	u, err := s.Store.GetByID(tenant.WithSystem(ctx), userID)
+	if err != nil {
+		u = &user.User{ID: userID}
+	}
+
+	s.invalidate(ctx, u)
+}
+
+// Create ...
+func (s *Store) Create(ctx context.Context, u *user.User) error {
+	err := s.Store.Create(ctx, u)
+	s.invalidate(ctx, u)
+	return err
+}
+
+// BatchCreate ...
+func (s *Store) BatchCreate(ctx context.Context, uu []*user.User, atomic bool) ([]error, error) {
+	errs, err := s.Store.BatchCreate(ctx, uu, atomic)
+	s.invalidate(ctx, uu...)
+	return errs, err
+}
+
+// ImportUsers ...
+func (s *Store) ImportUsers(ctx context.Context, uu []*user.User, dryRun bool) ([]error, error) {
+	errs, err := s.Store.ImportUsers(ctx, uu, dryRun)
+	if !dryRun {
+		s.invalidate(ctx, uu...)
+	}
+	return errs, err
+}
+
+// Update ...
+func (s *Store) Update(ctx context.Context, u *user.User) error {
+	err := s.Store.Update(ctx, u)
+	s.invalidate(ctx, &user.User{ID: u.ID})
+	return err
+}
+
+// Delete ...
+func (s *Store) Delete(ctx context.Context, id string) error {
+	err := s.Store.Delete(ctx, id)
+	s.invalidate(ctx, &user.User{ID: id})
+	return err
+}
+
+// Restore ...
+func (s *Store) Restore(ctx context.Context, id string) (*user.User, error) {
+	u, err := s.Store.Restore(ctx, id)
+	s.invalidate(ctx, &user.User{ID: id}, u)
+	return u, err
+}
+
+// VerifyEmail ...
+func (s *Store) VerifyEmail(ctx context.Context, tokenHash string) (*user.User, error) {
+	u, err := s.Store.VerifyEmail(ctx, tokenHash)
+	s.invalidate(ctx, u)
+	return u, err
+}
+
+// ConfirmEmailChange ...
+func (s *Store) ConfirmEmailChange(ctx context.Context, tokenHash string) (*user.User, error) {
+	u, err := s.Store.ConfirmEmailChange(ctx, tokenHash)
+	s.invalidate(ctx, u)
+	return u, err
+}
+
+// RevertEmailChange ...
+func (s *Store) RevertEmailChange(ctx context.Context, revertTokenHash string) (*user.User, error) {
+	u, err := s.Store.RevertEmailChange(ctx, revertTokenHash)
+	s.invalidate(ctx, u)
+	return u, err
+}
+
+// ConfirmMFA ...
+func (s *Store) ConfirmMFA(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) (*user.User, error) {
+	u, err := s.Store.ConfirmMFA(ctx, userID, step, recoveryCodeHashes)
+	s.invalidate(ctx, &user.User{ID: userID})
+	return u, err
+}
+
+// DeleteMFA ...
+func (s *Store) DeleteMFA(ctx context.Context, userID string) (*user.User, error) {
+	u, err := s.Store.DeleteMFA(ctx, userID)
+	s.invalidate(ctx, &user.User{ID: userID})
+	return u, err
+}
+
+// RecordLoginFailure ...
+func (s *Store) RecordLoginFailure(ctx context.Context, userID string, at, windowStart time.Time) (int, error) {
+	n, err := s.Store.RecordLoginFailure(ctx, userID, at, windowStart)
+	s.invalidate(ctx, &user.User{ID: userID})
+	return n, err
+}
+
+// LockUser ...
+func (s *Store) LockUser(ctx context.Context, userID string, until time.Time) error {
+	err := s.Store.LockUser(ctx, userID, until)
+	s.invalidate(ctx, &user.User{ID: userID})
+	return err
+}
+
+// ResetLoginFailures ...
+func (s *Store) ResetLoginFailures(ctx context.Context, userID string) (*user.User, error) {
+	u, err := s.Store.ResetLoginFailures(ctx, userID)
+	s.invalidate(ctx, &user.User{ID: userID})
+	return u, err
+}
+
+// CreateOrganization ...
+func (s *Store) CreateOrganization(ctx context.Context, o *user.Organization, ownerID string) error {
+	err := s.Store.CreateOrganization(ctx, o, ownerID)
+	if err == nil {
+		s.invalidateMember(ctx, ownerID)
+	}
+	return err
+}
+
+// RemoveMember ...
+func (s *Store) RemoveMember(ctx context.Context, orgID, userID string) error {
+	err := s.Store.RemoveMember(ctx, orgID, userID)
+	s.invalidate(ctx, &user.User{ID: userID})
+	return err
+}
+
+// AcceptInvitation ...
+func (s *Store) AcceptInvitation(ctx context.Context, tokenHash, userID string) (*user.Membership, error) {
+	m, err := s.Store.AcceptInvitation(ctx, tokenHash, userID)
+	if err == nil {
+		s.invalidateMember(ctx, userID)
+	}
+	return m, err
+}
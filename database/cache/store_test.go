@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/consistency"
+	"github.com/frperezr/microservices-demo/src/users-api/database/sqlite"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestStores returns n instances of the cache in front of the same SQLite
+// database, sharing a miniredis, and a user created through the first one
+func newTestStores(t *testing.T, n int) ([]*Store, *miniredis.Miniredis, *user.User) {
+	t.Helper()
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Store.Close() })
+
+	mr := miniredis.RunT(t)
+
+	stores := make([]*Store, 0, n)
+	for i := 0; i < n; i++ {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+
+		stores = append(stores, NewStore(db, &Tiered{
+			Local:    NewLRU(100),
+			Remote:   NewRedis(client),
+			LocalTTL: time.Millisecond,
+		}))
+	}
+
+	u := &user.User{Email: "ada@acme.test", Name: "Ada", LastName: "Lovelace", Password: "hash of the password"}
+	if err := stores[0].Create(tenant.WithSystem(context.Background()), u); err != nil {
+		t.Fatal(err)
+	}
+
+	return stores, mr, u
+}
+
+func TestPasswordsAreNotCached(t *testing.T) {
+	stores, mr, u := newTestStores(t, 1)
+	ctx := tenant.WithSystem(context.Background())
+
+	for i := 0; i < 2; i++ {
+		cached, err := stores[0].GetByEmail(ctx, u.Email)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cached.ID != u.ID || cached.Password != "" {
+			t.Fatalf("GetByEmail #%v = %v with password %q, want the user without it", i+1, cached.ID, cached.Password)
+		}
+	}
+
+	value := mr.HGet("users-api:"+idKey(u.ID), "system")
+	if value == "" {
+		t.Fatal("the user is not cached in Redis")
+	}
+
+	if bytes.Contains([]byte(value), []byte(u.Password)) {
+		t.Fatal("the password is cached in Redis")
+	}
+
+	// the reads that check the password go to the primary
+	primary, err := stores[0].GetByID(consistency.Primary(ctx), u.ID)
+	if err != nil || primary.Password != u.Password {
+		t.Fatalf("GetByID from the primary = %q, %v, want the password", primary.Password, err)
+	}
+}
+
+func TestChangesAreSeenByTheOtherInstances(t *testing.T) {
+	stores, _, u := newTestStores(t, 2)
+	ctx := tenant.WithSystem(context.Background())
+
+	if _, err := stores[1].GetByID(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stores[0].Update(ctx, &user.User{ID: u.ID, Name: "Augusta"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// past the local copies of the second instance
+	time.Sleep(5 * time.Millisecond)
+
+	got, err := stores[1].GetByID(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Name != "Augusta" {
+		t.Fatalf("name = %v, want the change made by the other instance", got.Name)
+	}
+}
+
+func TestCachedUsersExpireInRedis(t *testing.T) {
+	stores, mr, u := newTestStores(t, 1)
+	ctx := tenant.WithSystem(context.Background())
+
+	if _, err := stores[0].GetByID(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl := mr.TTL("users-api:" + idKey(u.ID)); ttl <= 0 || ttl > stores[0].TTL {
+		t.Fatalf("ttl = %v, want up to %v", ttl, stores[0].TTL)
+	}
+
+	mr.FastForward(stores[0].TTL)
+
+	if mr.Exists("users-api:" + idKey(u.ID)) {
+		t.Fatal("the user is still cached after the TTL")
+	}
+}
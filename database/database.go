@@ -1,28 +1,237 @@
 package database
 
 import (
+	"context"
+	"strings"
+	"time"
+
 	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/database/mysql"
 	"github.com/frperezr/microservices-demo/src/users-api/database/postgres"
-	"github.com/jmoiron/sqlx"
+	"github.com/frperezr/microservices-demo/src/users-api/database/sqlite"
 )
 
 // Store ...
+//
+// Every method requires a tenant or the system scope in the context, see the
+// tenant package. Queries over users only see the members of the tenant.
 type Store interface {
-	GetByID(id string) (*user.User, error)
-	GetByEmail(email string) (*user.User, error)
-	Create(*user.User) error
-	Update(*user.User) error
-	Delete(id string) error
+	GetByID(ctx context.Context, id string) (*user.User, error)
+	GetByIDs(ctx context.Context, ids []string) ([]*user.User, error)
+	GetByEmail(ctx context.Context, email string) (*user.User, error)
+	Create(ctx context.Context, u *user.User) error
+	BatchCreate(ctx context.Context, uu []*user.User, atomic bool) ([]error, error)
+	ImportUsers(ctx context.Context, uu []*user.User, dryRun bool) ([]error, error)
+	ExportUsers(ctx context.Context, afterID string, limit uint64) ([]*user.User, error)
+	Update(ctx context.Context, u *user.User) error
+	Delete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) (*user.User, error)
+	List(ctx context.Context, opts *user.ListOptions) ([]*user.User, error)
+
+	CreateEmailVerification(ctx context.Context, v *user.EmailVerification) error
+	VerifyEmail(ctx context.Context, tokenHash string) (*user.User, error)
+
+	CreateEmailChange(ctx context.Context, c *user.EmailChange) error
+	ConfirmEmailChange(ctx context.Context, tokenHash string) (*user.User, error)
+	RevertEmailChange(ctx context.Context, revertTokenHash string) (*user.User, error)
+
+	SaveMFA(ctx context.Context, m *user.MFA) error
+	GetMFA(ctx context.Context, userID string) (*user.MFA, error)
+	ConfirmMFA(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) (*user.User, error)
+	UseMFAStep(ctx context.Context, userID string, step int64) error
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) error
+	DeleteMFA(ctx context.Context, userID string) (*user.User, error)
+
+	RecordLoginFailure(ctx context.Context, userID string, at, windowStart time.Time) (int, error)
+	LockUser(ctx context.Context, userID string, until time.Time) error
+	ResetLoginFailures(ctx context.Context, userID string) (*user.User, error)
+	GetIPBlockedUntil(ctx context.Context, ip string) (*time.Time, error)
+	RecordIPFailure(ctx context.Context, ip string, at, windowStart time.Time) (int, error)
+	BlockIP(ctx context.Context, ip string, until time.Time) error
+
+	ListRoles(ctx context.Context) ([]*user.Role, error)
+	GetUserRoles(ctx context.Context, userIDs ...string) (map[string][]string, error)
+	AssignRole(ctx context.Context, userID, role string) error
+	RevokeRole(ctx context.Context, userID, role string) error
+	HasPermission(ctx context.Context, userID, permission string) (bool, error)
+
+	CreateOrganization(ctx context.Context, o *user.Organization, ownerID string) error
+	GetOrganization(ctx context.Context, id string) (*user.Organization, error)
+	ListOrganizations(ctx context.Context, userID string) ([]*user.Organization, error)
+	GetMembership(ctx context.Context, orgID, userID string) (*user.Membership, error)
+	SetMemberRole(ctx context.Context, orgID, userID, role string) (*user.Membership, error)
+	RemoveMember(ctx context.Context, orgID, userID string) error
+	CreateInvitation(ctx context.Context, inv *user.Invitation) error
+	AcceptInvitation(ctx context.Context, tokenHash, userID string) (*user.Membership, error)
+
+	GroupStore
+
+	// ProcessOutbox hands the unpublished user events to fn, see outbox.Relay
+	ProcessOutbox(ctx context.Context, limit, maxAttempts int, fn func(*user.Event) error) (int, error)
+	ListEvents(ctx context.Context, f *user.EventFilter) ([]*user.Event, error)
+	EventsHead(ctx context.Context) (int64, int64, error)
+	GetEvent(ctx context.Context, id int64) (*user.Event, error)
+	ListAuditEvents(ctx context.Context, userID string) ([]*user.AuditEvent, error)
+
+	GetUserAsOf(ctx context.Context, id string, at time.Time) (*user.UserVersion, error)
+	ListUserVersions(ctx context.Context, id string) ([]*user.UserVersion, error)
+
+	WebhookStore
+
+	ClaimIdempotencyKey(ctx context.Context, k *user.IdempotencyKey) (*user.IdempotencyKey, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, k *user.IdempotencyKey) error
+	ReleaseIdempotencyKey(ctx context.Context, k *user.IdempotencyKey) error
+	PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int, error)
+}
+
+// WebhookStore keeps the webhooks of the organizations and their deliveries
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, w *user.Webhook) error
+	GetWebhook(ctx context.Context, id string) (*user.Webhook, error)
+	ListWebhooks(ctx context.Context, orgID string) ([]*user.Webhook, error)
+	UpdateWebhook(ctx context.Context, w *user.Webhook) error
+	DeleteWebhook(ctx context.Context, id string) error
+
+	EnqueueWebhookDeliveries(ctx context.Context, e *user.Event) (int, error)
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*user.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, d *user.WebhookDelivery, a *user.WebhookAttempt) error
+	ListWebhookDeliveries(ctx context.Context, webhookID, status string) ([]*user.WebhookDelivery, error)
+	ListWebhookAttempts(ctx context.Context, deliveryID string) ([]*user.WebhookAttempt, error)
+	ReplayWebhookDelivery(ctx context.Context, id string) (*user.WebhookDelivery, error)
+}
+
+// Notifications signals when new events are written to the outbox
+type Notifications interface {
+	Subscribe() (<-chan struct{}, func())
+}
+
+// GroupStore keeps the groups of the organizations and their members
+type GroupStore interface {
+	CreateGroup(ctx context.Context, g *user.Group) error
+	GetGroup(ctx context.Context, id string) (*user.Group, error)
+	UpdateGroup(ctx context.Context, g *user.Group) error
+	DeleteGroup(ctx context.Context, id string) error
+	ListGroups(ctx context.Context, orgID string) ([]*user.Group, error)
+
+	// AddGroupMember fails with user.ErrGroupCycle if the member group
+	// already contains the group, directly or through other groups
+	AddGroupMember(ctx context.Context, m *user.GroupMember) error
+	RemoveGroupMember(ctx context.Context, m *user.GroupMember) error
+	ListGroupMembers(ctx context.Context, groupID string) ([]*user.GroupMember, error)
+
+	// ListUserGroups returns the groups the user belongs to directly or
+	// through nested groups
+	ListUserGroups(ctx context.Context, userID string) ([]*user.Group, error)
+}
+
+// NewPostgresListener ...
+func NewPostgresListener(dsn string) (Notifications, error) {
+	return postgres.NewListener(dsn)
+}
+
+// Options of the connections to Postgres and MySQL, SQLite has none
+type Options struct {
+	Pool postgres.Pool
+
+	// ConnectTimeout is how long the first connection is retried
+	ConnectTimeout time.Duration
+
+	Retry   postgres.Retry
+	Breaker *postgres.Breaker
+
+	// Replicas serve the reads of users, they must be health checked
+	// with their Run method. Only Postgres has replicas.
+	Replicas *postgres.Replicas
+}
+
+// DefaultOptions ...
+func DefaultOptions() Options {
+	return Options{
+		Pool: postgres.Pool{
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		ConnectTimeout: time.Minute,
+		Retry:          postgres.DefaultRetry,
+		Breaker:        postgres.NewBreaker(5, 10*time.Second),
+	}
 }
 
 // NewPostgres ...
 func NewPostgres(dsn string) (Store, error) {
-	db, err := sqlx.Connect("postgres", dsn)
+	return NewPostgresWithOptions(dsn, DefaultOptions())
+}
+
+// NewPostgresWithOptions ...
+func NewPostgresWithOptions(dsn string, opts Options) (Store, error) {
+	db, err := postgres.Connect(context.Background(), dsn, opts.Pool, opts.ConnectTimeout)
 	if err != nil {
 		return nil, err
 	}
 
 	return &postgres.UserStore{
-		Store: db,
+		Store:    db,
+		Replicas: opts.Replicas,
+		Retry:    opts.Retry,
+		Breaker:  opts.Breaker,
 	}, nil
 }
+
+// NewPostgresReplicas ...
+func NewPostgresReplicas(dsns []string, pool postgres.Pool) (*postgres.Replicas, error) {
+	return postgres.NewReplicas(dsns, pool)
+}
+
+// NewSQLite opens the SQLite database file at path, creating it if it does
+// not exist. It is meant for a single instance, see sqlite.UserStore.
+func NewSQLite(path string) (Store, error) {
+	return sqlite.Open(path)
+}
+
+// NewMySQL connects to the MySQL database of the DSN, in the format of
+// github.com/go-sql-driver/mysql. The replicas of the options do not apply.
+func NewMySQL(dsn string, opts Options) (Store, error) {
+	us, err := mysql.Open(context.Background(), dsn, opts.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Pool.Apply(us.Store)
+	us.Retry = opts.Retry
+	us.Breaker = opts.Breaker
+
+	return us, nil
+}
+
+// Drivers of the DSNs
+const (
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite"
+)
+
+// Driver returns the driver of the DSN by its scheme, mysql:// and sqlite://,
+// any other DSN is of Postgres
+func Driver(dsn string) string {
+	switch {
+	case strings.HasPrefix(dsn, "mysql://"):
+		return DriverMySQL
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return DriverSQLite
+	}
+	return DriverPostgres
+}
+
+// Open connects to the database of the DSN with its driver, the scheme is
+// removed from MySQL and SQLite DSNs before they are opened
+func Open(dsn string, opts Options) (Store, error) {
+	switch Driver(dsn) {
+	case DriverMySQL:
+		return NewMySQL(strings.TrimPrefix(dsn, "mysql://"), opts)
+	case DriverSQLite:
+		return NewSQLite(strings.TrimPrefix(dsn, "sqlite://"))
+	}
+	return NewPostgresWithOptions(dsn, opts)
+}
@@ -0,0 +1,364 @@
+package memory
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+// GroupStore is a in memory database.GroupStore, meant for tests and local
+// runs without Postgres. It follows the same tenant rules as the postgres store.
+type GroupStore struct {
+	mu       sync.RWMutex
+	groups   map[string]*user.Group
+	users    map[string]map[string]time.Time
+	children map[string]map[string]time.Time
+}
+
+// NewGroupStore ...
+func NewGroupStore() *GroupStore {
+	return &GroupStore{
+		groups:   make(map[string]*user.Group),
+		users:    make(map[string]map[string]time.Time),
+		children: make(map[string]map[string]time.Time),
+	}
+}
+
+// CreateGroup ...
+func (gs *GroupStore) CreateGroup(ctx context.Context, g *user.Group) error {
+	if g.OrganizationID == "" || g.Name == "" {
+		return errors.New("must provide a organization id and name")
+	}
+
+	if err := checkScope(ctx, g.OrganizationID); err != nil {
+		return err
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if gs.nameTaken(g.OrganizationID, g.Name, "") {
+		return user.ErrGroupNameTaken
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	g.ID = id
+	g.CreatedAt = now
+	g.UpdatedAt = now
+
+	stored := *g
+	gs.groups[id] = &stored
+
+	return nil
+}
+
+// GetGroup ...
+func (gs *GroupStore) GetGroup(ctx context.Context, id string) (*user.Group, error) {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+
+	g, err := gs.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	found := *g
+	return &found, nil
+}
+
+// UpdateGroup ...
+func (gs *GroupStore) UpdateGroup(ctx context.Context, g *user.Group) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	stored, err := gs.get(ctx, g.ID)
+	if err != nil {
+		return err
+	}
+
+	if g.Name != "" {
+		if gs.nameTaken(stored.OrganizationID, g.Name, stored.ID) {
+			return user.ErrGroupNameTaken
+		}
+		stored.Name = g.Name
+	}
+
+	stored.Description = g.Description
+	stored.UpdatedAt = time.Now()
+
+	*g = *stored
+	return nil
+}
+
+// DeleteGroup ...
+func (gs *GroupStore) DeleteGroup(ctx context.Context, id string) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if _, err := gs.get(ctx, id); err != nil {
+		return err
+	}
+
+	delete(gs.groups, id)
+	delete(gs.users, id)
+	delete(gs.children, id)
+
+	for _, children := range gs.children {
+		delete(children, id)
+	}
+
+	return nil
+}
+
+// ListGroups ...
+func (gs *GroupStore) ListGroups(ctx context.Context, orgID string) ([]*user.Group, error) {
+	if err := checkScope(ctx, orgID); err != nil {
+		return nil, err
+	}
+
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+
+	gg := make([]*user.Group, 0)
+	for _, g := range gs.groups {
+		if g.OrganizationID == orgID {
+			found := *g
+			gg = append(gg, &found)
+		}
+	}
+
+	sortByName(gg)
+	return gg, nil
+}
+
+// AddGroupMember ...
+func (gs *GroupStore) AddGroupMember(ctx context.Context, m *user.GroupMember) error {
+	if (m.UserID == "") == (m.MemberGroupID == "") {
+		return user.ErrInvalidGroupMember
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	g, err := gs.get(ctx, m.GroupID)
+	if err != nil {
+		return err
+	}
+
+	members, id := gs.users, m.UserID
+
+	if m.MemberGroupID != "" {
+		child, err := gs.get(ctx, m.MemberGroupID)
+		if err != nil {
+			return err
+		}
+
+		if child.OrganizationID != g.OrganizationID {
+			return user.ErrGroupNotFound
+		}
+
+		if gs.reachable(child.ID, g.ID) {
+			return user.ErrGroupCycle
+		}
+
+		members, id = gs.children, m.MemberGroupID
+	}
+
+	if members[g.ID] == nil {
+		members[g.ID] = make(map[string]time.Time)
+	}
+
+	createdAt, ok := members[g.ID][id]
+	if !ok {
+		createdAt = time.Now()
+		members[g.ID][id] = createdAt
+	}
+
+	m.CreatedAt = createdAt
+	return nil
+}
+
+// RemoveGroupMember ...
+func (gs *GroupStore) RemoveGroupMember(ctx context.Context, m *user.GroupMember) error {
+	if (m.UserID == "") == (m.MemberGroupID == "") {
+		return user.ErrInvalidGroupMember
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if _, err := gs.get(ctx, m.GroupID); err != nil {
+		return err
+	}
+
+	members, id := gs.users, m.UserID
+	if m.MemberGroupID != "" {
+		members, id = gs.children, m.MemberGroupID
+	}
+
+	if _, ok := members[m.GroupID][id]; !ok {
+		return user.ErrNotMember
+	}
+
+	delete(members[m.GroupID], id)
+	return nil
+}
+
+// ListGroupMembers ...
+func (gs *GroupStore) ListGroupMembers(ctx context.Context, groupID string) ([]*user.GroupMember, error) {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+
+	if _, err := gs.get(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	mm := make([]*user.GroupMember, 0)
+	for id, createdAt := range gs.users[groupID] {
+		mm = append(mm, &user.GroupMember{GroupID: groupID, UserID: id, CreatedAt: createdAt})
+	}
+
+	for id, createdAt := range gs.children[groupID] {
+		mm = append(mm, &user.GroupMember{GroupID: groupID, MemberGroupID: id, CreatedAt: createdAt})
+	}
+
+	sort.Slice(mm, func(i, j int) bool { return mm[i].CreatedAt.Before(mm[j].CreatedAt) })
+	return mm, nil
+}
+
+// ListUserGroups walks up from the groups of the user, each group is
+// visited once so cycles can not make it loop.
+func (gs *GroupStore) ListUserGroups(ctx context.Context, userID string) ([]*user.Group, error) {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+
+	visited := make(map[string]bool)
+	queue := make([]string, 0)
+
+	for groupID, users := range gs.users {
+		if _, ok := users[userID]; ok {
+			visited[groupID] = true
+			queue = append(queue, groupID)
+		}
+	}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		for parentID, children := range gs.children {
+			if _, ok := children[id]; ok && !visited[parentID] {
+				visited[parentID] = true
+				queue = append(queue, parentID)
+			}
+		}
+	}
+
+	gg := make([]*user.Group, 0, len(visited))
+	for id := range visited {
+		g, err := gs.get(ctx, id)
+		if err != nil {
+			continue
+		}
+
+		found := *g
+		gg = append(gg, &found)
+	}
+
+	sortByName(gg)
+	return gg, nil
+}
+
+// get returns the stored group if it is visible to the tenant of the context
+func (gs *GroupStore) get(ctx context.Context, id string) (*user.Group, error) {
+	g, ok := gs.groups[id]
+	if !ok {
+		return nil, user.ErrGroupNotFound
+	}
+
+	if err := checkScope(ctx, g.OrganizationID); err != nil {
+		if err == tenant.ErrMismatch {
+			return nil, user.ErrGroupNotFound
+		}
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// reachable reports whether to is from or one of its nested groups
+func (gs *GroupStore) reachable(from, to string) bool {
+	visited := map[string]bool{from: true}
+	queue := []string{from}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		if id == to {
+			return true
+		}
+
+		for child := range gs.children[id] {
+			if !visited[child] {
+				visited[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	return false
+}
+
+func (gs *GroupStore) nameTaken(orgID, name, exceptID string) bool {
+	for _, g := range gs.groups {
+		if g.OrganizationID == orgID && g.Name == name && g.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// checkScope mirrors the row level security of the postgres store
+func checkScope(ctx context.Context, orgID string) error {
+	if id, ok := tenant.FromContext(ctx); ok {
+		if id != orgID {
+			return tenant.ErrMismatch
+		}
+		return nil
+	}
+
+	if !tenant.IsSystem(ctx) {
+		return tenant.ErrMissing
+	}
+
+	return nil
+}
+
+func sortByName(gg []*user.Group) {
+	sort.Slice(gg, func(i, j int) bool { return gg[i].Name < gg[j].Name })
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,68 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Rows are scoped by the app.tenant_id setting of the transaction, or visible
+-- to every tenant when app.bypass_tenant is on. Superusers and roles with
+-- BYPASSRLS skip these policies, the service must connect with a plain role.
+CREATE FUNCTION current_tenant_id() RETURNS uuid AS $$
+  SELECT nullif(current_setting('app.tenant_id', true), '')::uuid;
+$$ LANGUAGE sql STABLE;
+
+CREATE FUNCTION tenant_bypass() RETURNS boolean AS $$
+  SELECT coalesce(current_setting('app.bypass_tenant', true), '') = 'on';
+$$ LANGUAGE sql STABLE;
+
+ALTER TABLE memberships DROP CONSTRAINT memberships_user_id_fkey;
+ALTER TABLE memberships ADD CONSTRAINT memberships_user_id_fkey
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED;
+
+ALTER TABLE organizations ENABLE ROW LEVEL SECURITY;
+ALTER TABLE organizations FORCE ROW LEVEL SECURITY;
+CREATE POLICY organizations_tenant ON organizations
+  USING (tenant_bypass() OR id = current_tenant_id());
+
+ALTER TABLE memberships ENABLE ROW LEVEL SECURITY;
+ALTER TABLE memberships FORCE ROW LEVEL SECURITY;
+CREATE POLICY memberships_tenant ON memberships
+  USING (tenant_bypass() OR organization_id = current_tenant_id());
+
+ALTER TABLE invitations ENABLE ROW LEVEL SECURITY;
+ALTER TABLE invitations FORCE ROW LEVEL SECURITY;
+CREATE POLICY invitations_tenant ON invitations
+  USING (tenant_bypass() OR organization_id = current_tenant_id());
+
+ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE users FORCE ROW LEVEL SECURITY;
+CREATE POLICY users_tenant ON users
+  USING (tenant_bypass() OR EXISTS (
+    SELECT 1 FROM memberships m WHERE m.user_id = users.id AND m.organization_id = current_tenant_id()
+  ))
+  WITH CHECK (tenant_bypass() OR EXISTS (
+    SELECT 1 FROM memberships m WHERE m.user_id = users.id AND m.organization_id = current_tenant_id()
+  ));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP POLICY IF EXISTS users_tenant ON users;
+ALTER TABLE users NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE users DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS invitations_tenant ON invitations;
+ALTER TABLE invitations NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE invitations DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS memberships_tenant ON memberships;
+ALTER TABLE memberships NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE memberships DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS organizations_tenant ON organizations;
+ALTER TABLE organizations NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE organizations DISABLE ROW LEVEL SECURITY;
+
+ALTER TABLE memberships DROP CONSTRAINT memberships_user_id_fkey;
+ALTER TABLE memberships ADD CONSTRAINT memberships_user_id_fkey
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+DROP FUNCTION IF EXISTS tenant_bypass();
+DROP FUNCTION IF EXISTS current_tenant_id();
+-- +goose StatementEnd
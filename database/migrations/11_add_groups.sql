@@ -0,0 +1,60 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE groups (
+  id uuid PRIMARY KEY default gen_random_uuid(),
+  organization_id uuid NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  name varchar(255) NOT NULL,
+  description text NOT NULL DEFAULT '',
+  created_at timestamptz default now(),
+  updated_at timestamptz default now(),
+  UNIQUE (organization_id, name)
+);
+
+create trigger update_groups_update_at
+before update on groups for each row execute procedure update_updated_at_column();
+
+CREATE TABLE group_users (
+  group_id uuid NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+  user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at timestamptz default now(),
+  PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX group_users_user_id_idx ON group_users(user_id);
+
+CREATE TABLE group_groups (
+  group_id uuid NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+  member_group_id uuid NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+  created_at timestamptz default now(),
+  PRIMARY KEY (group_id, member_group_id),
+  CHECK (group_id <> member_group_id)
+);
+
+CREATE INDEX group_groups_member_group_id_idx ON group_groups(member_group_id);
+
+ALTER TABLE groups ENABLE ROW LEVEL SECURITY;
+ALTER TABLE groups FORCE ROW LEVEL SECURITY;
+CREATE POLICY groups_tenant ON groups
+  USING (tenant_bypass() OR organization_id = current_tenant_id());
+
+ALTER TABLE group_users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE group_users FORCE ROW LEVEL SECURITY;
+CREATE POLICY group_users_tenant ON group_users
+  USING (tenant_bypass() OR EXISTS (
+    SELECT 1 FROM groups g WHERE g.id = group_users.group_id AND g.organization_id = current_tenant_id()
+  ));
+
+ALTER TABLE group_groups ENABLE ROW LEVEL SECURITY;
+ALTER TABLE group_groups FORCE ROW LEVEL SECURITY;
+CREATE POLICY group_groups_tenant ON group_groups
+  USING (tenant_bypass() OR EXISTS (
+    SELECT 1 FROM groups g WHERE g.id = group_groups.group_id AND g.organization_id = current_tenant_id()
+  ));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS group_groups;
+DROP TABLE IF EXISTS group_users;
+DROP TABLE IF EXISTS groups;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE outbox (
+  id bigserial PRIMARY KEY,
+  type varchar(64) NOT NULL,
+  user_id uuid NOT NULL,
+  payload jsonb NOT NULL,
+  attempts integer NOT NULL DEFAULT 0,
+  last_error text,
+  created_at timestamptz default now(),
+  published_at timestamptz
+);
+
+CREATE INDEX outbox_unpublished_idx ON outbox(id) WHERE published_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS outbox;
+-- +goose StatementEnd
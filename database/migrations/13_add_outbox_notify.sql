@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE outbox ADD COLUMN before jsonb;
+
+CREATE INDEX outbox_user_id_idx ON outbox(user_id, id);
+
+create function notify_outbox_event()
+returns trigger as $$
+  begin
+      perform pg_notify('outbox_events', new.id::text);
+      return new;
+  end;
+$$ language plpgsql;
+
+create trigger outbox_event_notify
+after insert on outbox for each row execute procedure notify_outbox_event();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS outbox_event_notify ON outbox;
+DROP FUNCTION IF EXISTS notify_outbox_event();
+DROP INDEX IF EXISTS outbox_user_id_idx;
+ALTER TABLE outbox DROP COLUMN IF EXISTS before;
+-- +goose StatementEnd
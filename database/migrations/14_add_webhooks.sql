@@ -0,0 +1,76 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE webhooks (
+  id uuid PRIMARY KEY default gen_random_uuid(),
+  organization_id uuid NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  url text NOT NULL,
+  event_types text[] NOT NULL DEFAULT '{}',
+  active boolean NOT NULL DEFAULT true,
+  secret bytea NOT NULL,
+  created_at timestamptz default now(),
+  updated_at timestamptz default now()
+);
+
+CREATE INDEX webhooks_organization_id_idx ON webhooks(organization_id);
+
+create trigger update_webhooks_update_at
+before update on webhooks for each row execute procedure update_updated_at_column();
+
+CREATE TABLE webhook_deliveries (
+  id uuid PRIMARY KEY default gen_random_uuid(),
+  webhook_id uuid NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  event_id bigint NOT NULL REFERENCES outbox(id) ON DELETE CASCADE,
+  event_type varchar(64) NOT NULL,
+  status varchar(16) NOT NULL DEFAULT 'pending',
+  attempts integer NOT NULL DEFAULT 0,
+  next_attempt_at timestamptz NOT NULL DEFAULT now(),
+  last_status_code integer,
+  last_error text,
+  created_at timestamptz default now(),
+  updated_at timestamptz default now(),
+  UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+
+create trigger update_webhook_deliveries_update_at
+before update on webhook_deliveries for each row execute procedure update_updated_at_column();
+
+CREATE TABLE webhook_attempts (
+  id uuid PRIMARY KEY default gen_random_uuid(),
+  delivery_id uuid NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+  status_code integer,
+  error text,
+  duration_ms bigint NOT NULL DEFAULT 0,
+  created_at timestamptz default now()
+);
+
+CREATE INDEX webhook_attempts_delivery_id_idx ON webhook_attempts(delivery_id);
+
+ALTER TABLE webhooks ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhooks FORCE ROW LEVEL SECURITY;
+CREATE POLICY webhooks_tenant ON webhooks
+  USING (tenant_bypass() OR organization_id = current_tenant_id());
+
+ALTER TABLE webhook_deliveries ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_deliveries FORCE ROW LEVEL SECURITY;
+CREATE POLICY webhook_deliveries_tenant ON webhook_deliveries
+  USING (tenant_bypass() OR EXISTS (
+    SELECT 1 FROM webhooks w WHERE w.id = webhook_deliveries.webhook_id AND w.organization_id = current_tenant_id()
+  ));
+
+ALTER TABLE webhook_attempts ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_attempts FORCE ROW LEVEL SECURITY;
+CREATE POLICY webhook_attempts_tenant ON webhook_attempts
+  USING (tenant_bypass() OR EXISTS (
+    SELECT 1 FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+    WHERE d.id = webhook_attempts.delivery_id AND w.organization_id = current_tenant_id()
+  ));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS webhook_attempts;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+-- changes is json and not jsonb so it keeps the exact bytes covered by hash.
+-- There is no foreign key to users, the log outlives the rows it describes.
+CREATE TABLE audit_events (
+  id bigserial PRIMARY KEY,
+  user_id uuid NOT NULL,
+  action varchar(64) NOT NULL,
+  actor_id varchar(64) NOT NULL DEFAULT '',
+  request_id varchar(128) NOT NULL DEFAULT '',
+  changes json NOT NULL,
+  prev_hash varchar(64) NOT NULL DEFAULT '',
+  hash varchar(64) NOT NULL,
+  created_at timestamptz NOT NULL
+);
+
+CREATE INDEX audit_events_user_id_idx ON audit_events(user_id, id);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+  BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+  FOR EACH STATEMENT EXECUTE PROCEDURE audit_events_append_only();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS audit_events;
+DROP FUNCTION IF EXISTS audit_events_append_only();
+-- +goose StatementEnd
@@ -0,0 +1,79 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Every version of a user, valid from valid_from until valid_to, the current
+-- one has no valid_to. Passwords and the login throttling counters are not
+-- kept, a change of only those columns is not a new version.
+CREATE TABLE users_history (
+  version bigserial PRIMARY KEY,
+  id uuid NOT NULL,
+  email varchar(255) NOT NULL,
+  name varchar(255) NOT NULL,
+  last_name varchar(255) NOT NULL,
+  email_verified_at timestamptz,
+  mfa_enabled_at timestamptz,
+  created_at timestamptz,
+  updated_at timestamptz,
+  deleted_at timestamptz,
+  valid_from timestamptz NOT NULL,
+  valid_to timestamptz,
+  CHECK (valid_to IS NULL OR valid_to >= valid_from)
+);
+
+CREATE INDEX users_history_id_idx ON users_history(id, valid_from);
+CREATE UNIQUE INDEX users_history_current_idx ON users_history(id) WHERE valid_to IS NULL;
+
+-- clock_timestamp keeps the versions of a user apart when it changes several
+-- times in the same transaction
+CREATE FUNCTION record_user_version() RETURNS trigger AS $$
+DECLARE
+  at timestamptz := clock_timestamp();
+BEGIN
+  IF TG_OP <> 'INSERT' THEN
+    UPDATE users_history SET valid_to = at WHERE id = OLD.id AND valid_to IS NULL;
+  END IF;
+
+  IF TG_OP <> 'DELETE' THEN
+    INSERT INTO users_history (id, email, name, last_name, email_verified_at, mfa_enabled_at, created_at, updated_at, deleted_at, valid_from)
+    VALUES (NEW.id, NEW.email, NEW.name, NEW.last_name, NEW.email_verified_at, NEW.mfa_enabled_at, NEW.created_at, NEW.updated_at, NEW.deleted_at, at);
+  END IF;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_history_insert
+  AFTER INSERT ON users
+  FOR EACH ROW EXECUTE PROCEDURE record_user_version();
+
+CREATE TRIGGER users_history_update
+  AFTER UPDATE ON users
+  FOR EACH ROW
+  WHEN ((OLD.email, OLD.name, OLD.last_name, OLD.email_verified_at, OLD.mfa_enabled_at, OLD.deleted_at)
+    IS DISTINCT FROM (NEW.email, NEW.name, NEW.last_name, NEW.email_verified_at, NEW.mfa_enabled_at, NEW.deleted_at))
+  EXECUTE PROCEDURE record_user_version();
+
+CREATE TRIGGER users_history_delete
+  AFTER DELETE ON users
+  FOR EACH ROW EXECUTE PROCEDURE record_user_version();
+
+-- the existing users start their history at their creation
+INSERT INTO users_history (id, email, name, last_name, email_verified_at, mfa_enabled_at, created_at, updated_at, deleted_at, valid_from)
+SELECT id, email, name, last_name, email_verified_at, mfa_enabled_at, created_at, updated_at, deleted_at, coalesce(created_at, now())
+FROM users;
+
+ALTER TABLE users_history ENABLE ROW LEVEL SECURITY;
+ALTER TABLE users_history FORCE ROW LEVEL SECURITY;
+CREATE POLICY users_history_tenant ON users_history
+  USING (tenant_bypass() OR EXISTS (
+    SELECT 1 FROM memberships m WHERE m.user_id = users_history.id AND m.organization_id = current_tenant_id()
+  ));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS users_history_delete ON users;
+DROP TRIGGER IF EXISTS users_history_update ON users;
+DROP TRIGGER IF EXISTS users_history_insert ON users;
+DROP FUNCTION IF EXISTS record_user_version();
+DROP TABLE IF EXISTS users_history;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The scope is the tenant and user that sent the key, so clients can not see
+-- each other responses. Rows are only read by scope and key, without RLS.
+CREATE TABLE idempotency_keys (
+  scope varchar(255) NOT NULL,
+  key varchar(255) NOT NULL,
+  request_hash varchar(64) NOT NULL,
+  response bytea,
+  completed_at timestamptz,
+  created_at timestamptz NOT NULL default now(),
+  expires_at timestamptz NOT NULL,
+  PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys(expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS idempotency_keys;
+-- +goose StatementEnd
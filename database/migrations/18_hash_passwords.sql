@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Passwords are stored as the bcrypt of the base64 of their SHA-256, see
+-- password.Hash. The rows of every tenant are updated.
+SET LOCAL app.bypass_tenant = 'on';
+
+UPDATE users SET password = crypt(encode(digest(password, 'sha256'), 'base64'), gen_salt('bf', 10))
+WHERE password NOT LIKE '$2%';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- the passwords can not be recovered from their hashes
+SELECT 1;
+-- +goose StatementEnd
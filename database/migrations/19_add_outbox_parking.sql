@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE outbox ADD COLUMN parked_at timestamptz;
+
+CREATE INDEX outbox_parked_idx ON outbox(user_id) WHERE parked_at IS NOT NULL AND published_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS outbox_parked_idx;
+ALTER TABLE outbox DROP COLUMN IF EXISTS parked_at;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE outbox ADD COLUMN txid xid8 NOT NULL DEFAULT pg_current_xact_id();
+
+CREATE INDEX outbox_txid_idx ON outbox(txid, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS outbox_txid_idx;
+ALTER TABLE outbox DROP COLUMN IF EXISTS txid;
+-- +goose StatementEnd
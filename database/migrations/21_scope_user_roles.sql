@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A role granted in a organization only applies in it, the roles granted
+-- without a organization (the default role and the ones granted in the
+-- system scope) apply in every organization.
+ALTER TABLE user_roles ADD COLUMN organization_id uuid REFERENCES organizations(id) ON DELETE CASCADE;
+
+ALTER TABLE user_roles DROP CONSTRAINT user_roles_pkey;
+
+CREATE UNIQUE INDEX user_roles_user_role_organization_idx
+  ON user_roles(user_id, role_id, coalesce(organization_id, '00000000-0000-0000-0000-000000000000'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM user_roles WHERE organization_id IS NOT NULL;
+DROP INDEX IF EXISTS user_roles_user_role_organization_idx;
+ALTER TABLE user_roles DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE user_roles ADD PRIMARY KEY (user_id, role_id);
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE outbox ADD COLUMN claimed_until timestamptz;
+
+CREATE INDEX outbox_claimed_idx ON outbox(user_id) WHERE claimed_until IS NOT NULL AND published_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS outbox_claimed_idx;
+ALTER TABLE outbox DROP COLUMN IF EXISTS claimed_until;
+-- +goose StatementEnd
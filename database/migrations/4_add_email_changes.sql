@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE email_changes (
+  id uuid PRIMARY KEY default gen_random_uuid(),
+  user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  old_email varchar(255) NOT NULL,
+  new_email varchar(255) NOT NULL,
+  token_hash varchar(64) UNIQUE NOT NULL,
+  revert_token_hash varchar(64) UNIQUE NOT NULL,
+  expires_at timestamptz NOT NULL,
+  revert_expires_at timestamptz NOT NULL,
+  confirmed_at timestamptz,
+  reverted_at timestamptz,
+  created_at timestamptz default now()
+);
+
+CREATE INDEX email_changes_user_id_idx ON email_changes(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS email_changes;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN mfa_enabled_at timestamptz;
+
+CREATE TABLE user_mfa (
+  user_id uuid PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  secret bytea NOT NULL,
+  last_used_step bigint NOT NULL DEFAULT 0,
+  confirmed_at timestamptz,
+  created_at timestamptz default now()
+);
+
+CREATE TABLE mfa_recovery_codes (
+  id uuid PRIMARY KEY default gen_random_uuid(),
+  user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash varchar(64) NOT NULL,
+  used_at timestamptz,
+  created_at timestamptz default now(),
+  UNIQUE (user_id, code_hash)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS user_mfa;
+ALTER TABLE users DROP COLUMN IF EXISTS mfa_enabled_at;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN failed_login_attempts integer NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN last_failed_login_at timestamptz;
+ALTER TABLE users ADD COLUMN locked_until timestamptz;
+
+CREATE TABLE login_ip_throttles (
+  ip varchar(64) PRIMARY KEY,
+  failed_attempts integer NOT NULL DEFAULT 0,
+  last_failed_at timestamptz NOT NULL,
+  blocked_until timestamptz
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS login_ip_throttles;
+ALTER TABLE users DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE users DROP COLUMN IF EXISTS last_failed_login_at;
+ALTER TABLE users DROP COLUMN IF EXISTS failed_login_attempts;
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE roles (
+  id uuid PRIMARY KEY default gen_random_uuid(),
+  name varchar(64) UNIQUE NOT NULL,
+  description varchar(255) NOT NULL DEFAULT '',
+  built_in boolean NOT NULL DEFAULT false,
+  created_at timestamptz default now()
+);
+
+CREATE TABLE permissions (
+  id uuid PRIMARY KEY default gen_random_uuid(),
+  name varchar(128) UNIQUE NOT NULL,
+  description varchar(255) NOT NULL DEFAULT '',
+  created_at timestamptz default now()
+);
+
+CREATE TABLE role_permissions (
+  role_id uuid NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+  permission_id uuid NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+  PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE user_roles (
+  user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role_id uuid NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+  created_at timestamptz default now(),
+  PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX user_roles_role_id_idx ON user_roles(role_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO permissions (name, description) VALUES
+  ('users:read', 'Read any user'),
+  ('users:write', 'Create and update any user'),
+  ('users:delete', 'Delete any user'),
+  ('users:unlock', 'Unlock users locked after failed logins'),
+  ('mfa:reset', 'Reset the MFA of any user'),
+  ('roles:read', 'List roles and the roles of any user'),
+  ('roles:assign', 'Assign and revoke roles'),
+  ('profile:read', 'Read the own user'),
+  ('profile:write', 'Update the own user');
+
+INSERT INTO roles (name, description, built_in) VALUES
+  ('admin', 'Full access to every user', true),
+  ('support', 'Helps users recover their accounts', true),
+  ('user', 'Default role of every registered user', true);
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = 'admin';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'support' AND p.name IN ('users:read', 'users:unlock', 'mfa:reset', 'roles:read', 'profile:read', 'profile:write');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'user' AND p.name IN ('profile:read', 'profile:write');
+
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id FROM users u, roles r WHERE r.name = 'user';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM roles WHERE built_in;
+DELETE FROM permissions WHERE name IN ('users:read', 'users:write', 'users:delete', 'users:unlock', 'mfa:reset', 'roles:read', 'roles:assign', 'profile:read', 'profile:write');
+-- +goose StatementEnd
@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE organizations (
+  id uuid PRIMARY KEY default gen_random_uuid(),
+  name varchar(255) NOT NULL,
+  slug varchar(64) UNIQUE NOT NULL,
+  created_at timestamptz default now(),
+  updated_at timestamptz default now(),
+  deleted_at timestamptz
+);
+
+create trigger update_organizations_update_at
+before update on organizations for each row execute procedure update_updated_at_column();
+
+CREATE TABLE memberships (
+  organization_id uuid NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role varchar(32) NOT NULL DEFAULT 'member',
+  created_at timestamptz default now(),
+  PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX memberships_user_id_idx ON memberships(user_id);
+
+CREATE TABLE invitations (
+  id uuid PRIMARY KEY default gen_random_uuid(),
+  organization_id uuid NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  email varchar(255) NOT NULL,
+  role varchar(32) NOT NULL DEFAULT 'member',
+  token_hash varchar(64) UNIQUE NOT NULL,
+  invited_by uuid REFERENCES users(id) ON DELETE SET NULL,
+  expires_at timestamptz NOT NULL,
+  accepted_at timestamptz,
+  created_at timestamptz default now()
+);
+
+CREATE INDEX invitations_organization_id_idx ON invitations(organization_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS invitations;
+DROP TABLE IF EXISTS memberships;
+DROP TABLE IF EXISTS organizations;
+-- +goose StatementEnd
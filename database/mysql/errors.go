@@ -0,0 +1,13 @@
+package mysql
+
+import (
+	"errors"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+// isUniqueViolation reports whether err was caused by a unique constraint
+func isUniqueViolation(err error) bool {
+	var e *driver.MySQLError
+	return errors.As(err, &e) && e.Number == 1062
+}
@@ -0,0 +1,108 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// ClaimIdempotencyKey stores the key unless a unexpired one with the same
+// scope exists, a expired key is taken over. It returns the key stored and
+// whether it was claimed, when it was not the key is the existing one.
+func (us *UserStore) ClaimIdempotencyKey(ctx context.Context, k *user.IdempotencyKey) (*user.IdempotencyKey, bool, error) {
+	at := now()
+
+	// expires_at is set last, the assignments before it see the expiry of the existing key
+	query, args, err := squirrel.
+		Insert("idempotency_keys").
+		Columns("scope", "`key`", "request_hash", "created_at", "expires_at").
+		Values(k.Scope, k.Key, k.RequestHash, at, k.ExpiresAt).
+		Suffix(`on duplicate key update
+			request_hash = if(expires_at <= ?, ?, request_hash),
+			response = if(expires_at <= ?, null, response),
+			completed_at = if(expires_at <= ?, null, completed_at),
+			created_at = if(expires_at <= ?, ?, created_at),
+			expires_at = if(expires_at <= ?, ?, expires_at)`,
+			at, k.RequestHash, at, at, at, at, at, k.ExpiresAt).
+		ToSql()
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	var (
+		stored = &user.IdempotencyKey{}
+		n      int64
+	)
+
+	err = us.runKeys(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		// no rows are affected when the existing key is kept
+		if n, err = res.RowsAffected(); err != nil {
+			return err
+		}
+
+		err = tx.QueryRowxContext(ctx, "select * from idempotency_keys where scope = ? and `key` = ?", k.Scope, k.Key).StructScan(stored)
+		if err == sql.ErrNoRows {
+			// released by a failed request since the insert, the client can retry
+			return user.ErrIdempotencyKeyInProgress
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return stored, n > 0, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request of the key, kept
+// until k.ExpiresAt
+func (us *UserStore) CompleteIdempotencyKey(ctx context.Context, k *user.IdempotencyKey) error {
+	return us.runKeys(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "update idempotency_keys set response = ?, completed_at = ?, expires_at = ? where scope = ? and `key` = ?", k.Response, now(), k.ExpiresAt, k.Scope, k.Key)
+		return err
+	})
+}
+
+// ReleaseIdempotencyKey deletes a key whose request failed, so it can be retried
+func (us *UserStore) ReleaseIdempotencyKey(ctx context.Context, k *user.IdempotencyKey) error {
+	return us.runKeys(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "delete from idempotency_keys where scope = ? and `key` = ? and completed_at is null", k.Scope, k.Key)
+		return err
+	})
+}
+
+// PurgeIdempotencyKeys deletes the keys expired before the time
+func (us *UserStore) PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int, error) {
+	var n int64
+
+	err := us.runKeys(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "delete from idempotency_keys where expires_at < ?", before)
+		if err != nil {
+			return err
+		}
+
+		n, err = res.RowsAffected()
+		return err
+	})
+
+	return int(n), err
+}
+
+// runKeys executes fn like run in the system scope. The keys carry their own
+// scope and the requests without a access token have no tenant.
+func (us *UserStore) runKeys(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	return us.run(tenant.WithSystem(ctx), fn)
+}
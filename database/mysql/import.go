@@ -0,0 +1,77 @@
+package mysql
+
+import (
+	"context"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/jmoiron/sqlx"
+)
+
+// ImportUsers creates the users one by one in a single transaction, a
+// duplicate email only fails its own statement so the transaction goes on.
+// It returns the error of each user, nil for the imported ones and
+// user.ErrEmailTaken for the ones that already exist, so importing the same
+// users again is a no-op. With dryRun the transaction is rolled back.
+func (us *UserStore) ImportUsers(ctx context.Context, uu []*user.User, dryRun bool) ([]error, error) {
+	errs := make([]error, len(uu))
+
+	if len(uu) == 0 {
+		return errs, nil
+	}
+
+	tx, err := us.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for i, u := range uu {
+		if err := createUser(ctx, tx, u); err != nil {
+			if err == user.ErrEmailTaken {
+				errs[i] = err
+				continue
+			}
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		return errs, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+// ExportUsers returns up to limit users after the one with afterID, in order
+// of id, so a export reads every user once even while they change
+func (us *UserStore) ExportUsers(ctx context.Context, afterID string, limit uint64) ([]*user.User, error) {
+	query := squirrel.Select("*").From("users").Where("deleted_at is null").OrderBy("id").Limit(limit)
+
+	if afterID != "" {
+		query = query.Where("id > ?", afterID)
+	}
+
+	var uu []*user.User
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		uu = make([]*user.User, 0, limit)
+
+		sql, args, err := scopeSelect(ctx, query).ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.SelectContext(ctx, &uu, sql, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return uu, nil
+}
@@ -0,0 +1,118 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/jmoiron/sqlx"
+)
+
+// RecordLoginFailure increments the failed logins of the user and returns the
+// new count, failures older than windowStart are forgotten.
+func (us *UserStore) RecordLoginFailure(ctx context.Context, userID string, at, windowStart time.Time) (int, error) {
+	// the count is assigned first, it compares the time of the previous failure
+	query := squirrel.Update("users").
+		Set("failed_login_attempts", squirrel.Expr("case when last_failed_login_at is null or last_failed_login_at < ? then 1 else failed_login_attempts + 1 end", windowStart)).
+		Set("last_failed_login_at", at)
+
+	u := &user.User{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return updateUser(ctx, tx, query, squirrel.Expr("id = ? and deleted_at is null", userID), u)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return u.FailedLoginAttempts, nil
+}
+
+// LockUser ...
+func (us *UserStore) LockUser(ctx context.Context, userID string, until time.Time) error {
+	query := squirrel.Update("users").Set("locked_until", squirrel.Expr("greatest(coalesce(locked_until, ?), ?)", until, until))
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		err := updateUser(ctx, tx, query, squirrel.Expr("id = ?", userID), &user.User{})
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	})
+}
+
+// ResetLoginFailures clears the failed logins and the lock of the user
+func (us *UserStore) ResetLoginFailures(ctx context.Context, userID string) (*user.User, error) {
+	u := &user.User{}
+
+	query := squirrel.Update("users").
+		Set("failed_login_attempts", 0).
+		Set("last_failed_login_at", nil).
+		Set("locked_until", nil)
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return updateUser(ctx, tx, query, squirrel.Expr("id = ? and deleted_at is null", userID), u)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// GetIPBlockedUntil returns the time the address is blocked until, nil if it is not blocked
+func (us *UserStore) GetIPBlockedUntil(ctx context.Context, ip string) (*time.Time, error) {
+	var blockedUntil *time.Time
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		err := tx.QueryRowxContext(ctx, "select blocked_until from login_ip_throttles where ip = ?", ip).Scan(&blockedUntil)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return blockedUntil, nil
+}
+
+// RecordIPFailure increments the failed logins of the address and returns the
+// new count, failures older than windowStart are forgotten.
+func (us *UserStore) RecordIPFailure(ctx context.Context, ip string, at, windowStart time.Time) (int, error) {
+	var failures int
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		// the count is assigned first, it compares the time of the previous failure
+		_, err := tx.ExecContext(ctx, `insert into login_ip_throttles (ip, failed_attempts, last_failed_at) values (?, 1, ?)
+			on duplicate key update
+			failed_attempts = case when last_failed_at < ? then 1 else failed_attempts + 1 end,
+			last_failed_at = ?`, ip, at, windowStart, at)
+
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRowxContext(ctx, "select failed_attempts from login_ip_throttles where ip = ?", ip).Scan(&failures)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+// BlockIP ...
+func (us *UserStore) BlockIP(ctx context.Context, ip string, until time.Time) error {
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "update login_ip_throttles set blocked_until = greatest(coalesce(blocked_until, ?), ?) where ip = ?", until, until, ip)
+		return err
+	})
+}
@@ -0,0 +1,189 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/jmoiron/sqlx"
+)
+
+// SaveMFA stores a new unconfirmed enrollment, replacing a previous unconfirmed one
+func (us *UserStore) SaveMFA(ctx context.Context, m *user.MFA) error {
+	if m.UserID == "" {
+		return errors.New("must provide a user id")
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		var confirmed bool
+
+		err := tx.QueryRowxContext(ctx, "select confirmed_at is not null from user_mfa where user_id = ? for update", m.UserID).Scan(&confirmed)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		if confirmed {
+			return user.ErrMFAAlreadyEnabled
+		}
+
+		at := now()
+
+		query, args, err := squirrel.
+			Insert("user_mfa").
+			Columns("user_id", "secret", "created_at").
+			Values(m.UserID, m.Secret, at).
+			Suffix("on duplicate key update secret = ?, last_used_step = 0, created_at = ?", m.Secret, at).
+			ToSql()
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+
+		return tx.QueryRowxContext(ctx, "select * from user_mfa where user_id = ?", m.UserID).StructScan(m)
+	})
+}
+
+// GetMFA ...
+func (us *UserStore) GetMFA(ctx context.Context, userID string) (*user.MFA, error) {
+	if userID == "" {
+		return nil, errors.New("must provide a user id")
+	}
+
+	m := &user.MFA{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, "select * from user_mfa where user_id = ?", userID).StructScan(m)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrMFANotEnabled
+		}
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// ConfirmMFA enables the enrollment, replaces the recovery codes and flags the user in the same transaction
+func (us *UserStore) ConfirmMFA(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) (*user.User, error) {
+	u := &user.User{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		at := now()
+
+		res, err := tx.ExecContext(ctx, "update user_mfa set confirmed_at = ?, last_used_step = ? where user_id = ? and confirmed_at is null and last_used_step < ?", at, step, userID, step)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return user.ErrInvalidMFACode
+		}
+
+		if _, err := tx.ExecContext(ctx, "delete from mfa_recovery_codes where user_id = ?", userID); err != nil {
+			return err
+		}
+
+		if len(recoveryCodeHashes) > 0 {
+			insert := squirrel.Insert("mfa_recovery_codes").Columns("id", "user_id", "code_hash", "created_at")
+			for _, hash := range recoveryCodeHashes {
+				id, err := newID()
+				if err != nil {
+					return err
+				}
+				insert = insert.Values(id, userID, hash, at)
+			}
+
+			query, args, err := insert.ToSql()
+			if err != nil {
+				return err
+			}
+
+			if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+				return err
+			}
+		}
+
+		return updateUser(ctx, tx, squirrel.Update("users").Set("mfa_enabled_at", at), squirrel.Expr("id = ? and deleted_at is null", userID), u)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// UseMFAStep records the step of a accepted TOTP code, failing if the same or a later step was already used
+func (us *UserStore) UseMFAStep(ctx context.Context, userID string, step int64) error {
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "update user_mfa set last_used_step = ? where user_id = ? and confirmed_at is not null and last_used_step < ?", step, userID, step)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return user.ErrInvalidMFACode
+		}
+
+		return nil
+	})
+}
+
+// UseRecoveryCode marks a recovery code as used, failing if it does not exist or was already used
+func (us *UserStore) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "update mfa_recovery_codes set used_at = ? where user_id = ? and code_hash = ? and used_at is null", now(), userID, codeHash)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return user.ErrInvalidMFACode
+		}
+
+		return nil
+	})
+}
+
+// DeleteMFA removes the enrollment and recovery codes of the user
+func (us *UserStore) DeleteMFA(ctx context.Context, userID string) (*user.User, error) {
+	u := &user.User{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, "delete from mfa_recovery_codes where user_id = ?", userID); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "delete from user_mfa where user_id = ?", userID); err != nil {
+			return err
+		}
+
+		return updateUser(ctx, tx, squirrel.Update("users").Set("mfa_enabled_at", nil), squirrel.Expr("id = ? and deleted_at is null", userID), u)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
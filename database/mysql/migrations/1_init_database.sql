@@ -0,0 +1,324 @@
+-- The schema of the postgres migrations up to 17_add_idempotency_keys.sql.
+-- Ids, created_at and updated_at are set by the store, times are in UTC. The
+-- history of users and the tenant isolation are kept by the store too, there
+-- are no triggers for them nor row level security. Every statement ends with
+-- a semicolon at the end of a line, see migrate.
+CREATE TABLE users (
+  id varchar(36) PRIMARY KEY,
+  email varchar(255) UNIQUE NOT NULL,
+  name varchar(255) NOT NULL DEFAULT 'default_name',
+  last_name varchar(255) NOT NULL DEFAULT 'default_last_name',
+  password varchar(255) NOT NULL DEFAULT 'default_password',
+  created_at datetime(6) NOT NULL,
+  updated_at datetime(6) NOT NULL,
+  deleted_at datetime(6),
+  email_verified_at datetime(6),
+  mfa_enabled_at datetime(6),
+  failed_login_attempts integer NOT NULL DEFAULT 0,
+  last_failed_login_at datetime(6),
+  locked_until datetime(6)
+);
+
+CREATE TABLE email_verifications (
+  id varchar(36) PRIMARY KEY,
+  user_id varchar(36) NOT NULL,
+  email varchar(255) NOT NULL,
+  token_hash varchar(64) UNIQUE NOT NULL,
+  expires_at datetime(6) NOT NULL,
+  used_at datetime(6),
+  created_at datetime(6) NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX email_verifications_user_id_idx ON email_verifications(user_id);
+
+CREATE TABLE email_changes (
+  id varchar(36) PRIMARY KEY,
+  user_id varchar(36) NOT NULL,
+  old_email varchar(255) NOT NULL,
+  new_email varchar(255) NOT NULL,
+  token_hash varchar(64) UNIQUE NOT NULL,
+  revert_token_hash varchar(64) UNIQUE NOT NULL,
+  expires_at datetime(6) NOT NULL,
+  revert_expires_at datetime(6) NOT NULL,
+  confirmed_at datetime(6),
+  reverted_at datetime(6),
+  created_at datetime(6) NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX email_changes_user_id_idx ON email_changes(user_id);
+
+CREATE TABLE user_mfa (
+  user_id varchar(36) PRIMARY KEY,
+  secret blob NOT NULL,
+  last_used_step bigint NOT NULL DEFAULT 0,
+  confirmed_at datetime(6),
+  created_at datetime(6) NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE mfa_recovery_codes (
+  id varchar(36) PRIMARY KEY,
+  user_id varchar(36) NOT NULL,
+  code_hash varchar(64) NOT NULL,
+  used_at datetime(6),
+  created_at datetime(6) NOT NULL,
+  UNIQUE (user_id, code_hash),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE login_ip_throttles (
+  ip varchar(64) PRIMARY KEY,
+  failed_attempts integer NOT NULL DEFAULT 0,
+  last_failed_at datetime(6) NOT NULL,
+  blocked_until datetime(6)
+);
+
+CREATE TABLE roles (
+  id varchar(36) PRIMARY KEY,
+  name varchar(64) UNIQUE NOT NULL,
+  description varchar(255) NOT NULL DEFAULT '',
+  built_in tinyint(1) NOT NULL DEFAULT false,
+  created_at datetime(6) NOT NULL
+);
+
+CREATE TABLE permissions (
+  id varchar(36) PRIMARY KEY,
+  name varchar(128) UNIQUE NOT NULL,
+  description varchar(255) NOT NULL DEFAULT '',
+  created_at datetime(6) NOT NULL
+);
+
+CREATE TABLE role_permissions (
+  role_id varchar(36) NOT NULL,
+  permission_id varchar(36) NOT NULL,
+  PRIMARY KEY (role_id, permission_id),
+  FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+  FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_roles (
+  user_id varchar(36) NOT NULL,
+  role_id varchar(36) NOT NULL,
+  created_at datetime(6) NOT NULL,
+  PRIMARY KEY (user_id, role_id),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE
+);
+
+CREATE INDEX user_roles_role_id_idx ON user_roles(role_id);
+
+INSERT INTO permissions (id, name, description, created_at) VALUES
+  ('1338e098-b1e4-47ad-b5aa-d42ecedda5b3', 'users:read', 'Read any user', utc_timestamp(6)),
+  ('7bbd5427-0c28-4a08-9f5c-eb9a77f73d6c', 'users:write', 'Create and update any user', utc_timestamp(6)),
+  ('81734cd3-e46b-4476-8463-39e9440c0199', 'users:delete', 'Delete any user', utc_timestamp(6)),
+  ('4fb8af6d-d352-4acd-bb8f-85a86b45cdc7', 'users:unlock', 'Unlock users locked after failed logins', utc_timestamp(6)),
+  ('e3439fec-abc3-4d2c-bf69-4bdebb85dcbc', 'mfa:reset', 'Reset the MFA of any user', utc_timestamp(6)),
+  ('176a7f28-05c2-4b9e-8e60-c057c5ae4d0e', 'roles:read', 'List roles and the roles of any user', utc_timestamp(6)),
+  ('0675df9f-4b7b-490f-9dc6-30b16b080fb9', 'roles:assign', 'Assign and revoke roles', utc_timestamp(6)),
+  ('abcaa814-766b-4d72-a999-56c1339fc992', 'profile:read', 'Read the own user', utc_timestamp(6)),
+  ('d09ffa41-651c-45f3-bf44-1e10f7a647b5', 'profile:write', 'Update the own user', utc_timestamp(6));
+
+INSERT INTO roles (id, name, description, built_in, created_at) VALUES
+  ('4a76da5f-9a8c-406f-87ed-cffa2299b2e0', 'admin', 'Full access to every user', true, utc_timestamp(6)),
+  ('3f9c6979-ba9d-4184-ad0f-2f1686e52c05', 'support', 'Helps users recover their accounts', true, utc_timestamp(6)),
+  ('f43fa415-72e3-469a-b9d7-a9291376ee5d', 'user', 'Default role of every registered user', true, utc_timestamp(6));
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = 'admin';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'support' AND p.name IN ('users:read', 'users:unlock', 'mfa:reset', 'roles:read', 'profile:read', 'profile:write');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'user' AND p.name IN ('profile:read', 'profile:write');
+
+CREATE TABLE organizations (
+  id varchar(36) PRIMARY KEY,
+  name varchar(255) NOT NULL,
+  slug varchar(64) UNIQUE NOT NULL,
+  created_at datetime(6) NOT NULL,
+  updated_at datetime(6) NOT NULL,
+  deleted_at datetime(6)
+);
+
+CREATE TABLE memberships (
+  organization_id varchar(36) NOT NULL,
+  user_id varchar(36) NOT NULL,
+  role varchar(32) NOT NULL DEFAULT 'member',
+  created_at datetime(6) NOT NULL,
+  PRIMARY KEY (organization_id, user_id),
+  FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX memberships_user_id_idx ON memberships(user_id);
+
+CREATE TABLE invitations (
+  id varchar(36) PRIMARY KEY,
+  organization_id varchar(36) NOT NULL,
+  email varchar(255) NOT NULL,
+  role varchar(32) NOT NULL DEFAULT 'member',
+  token_hash varchar(64) UNIQUE NOT NULL,
+  invited_by varchar(36),
+  expires_at datetime(6) NOT NULL,
+  accepted_at datetime(6),
+  created_at datetime(6) NOT NULL,
+  FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+  FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX invitations_organization_id_idx ON invitations(organization_id);
+
+CREATE TABLE `groups` (
+  id varchar(36) PRIMARY KEY,
+  organization_id varchar(36) NOT NULL,
+  name varchar(255) NOT NULL,
+  description text NOT NULL,
+  created_at datetime(6) NOT NULL,
+  updated_at datetime(6) NOT NULL,
+  UNIQUE (organization_id, name),
+  FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+CREATE TABLE group_users (
+  group_id varchar(36) NOT NULL,
+  user_id varchar(36) NOT NULL,
+  created_at datetime(6) NOT NULL,
+  PRIMARY KEY (group_id, user_id),
+  FOREIGN KEY (group_id) REFERENCES `groups`(id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX group_users_user_id_idx ON group_users(user_id);
+
+CREATE TABLE group_groups (
+  group_id varchar(36) NOT NULL,
+  member_group_id varchar(36) NOT NULL,
+  created_at datetime(6) NOT NULL,
+  PRIMARY KEY (group_id, member_group_id),
+  FOREIGN KEY (group_id) REFERENCES `groups`(id) ON DELETE CASCADE,
+  FOREIGN KEY (member_group_id) REFERENCES `groups`(id) ON DELETE CASCADE
+);
+
+CREATE INDEX group_groups_member_group_id_idx ON group_groups(member_group_id);
+
+CREATE TABLE outbox (
+  id bigint PRIMARY KEY AUTO_INCREMENT,
+  type varchar(64) NOT NULL,
+  user_id varchar(36) NOT NULL,
+  payload mediumtext NOT NULL,
+  `before` mediumtext,
+  attempts integer NOT NULL DEFAULT 0,
+  last_error text,
+  created_at datetime(6) NOT NULL,
+  published_at datetime(6)
+);
+
+CREATE INDEX outbox_unpublished_idx ON outbox(published_at, id);
+CREATE INDEX outbox_user_id_idx ON outbox(user_id, id);
+
+-- event_types is a postgres array literal, read and written with pq.StringArray
+CREATE TABLE webhooks (
+  id varchar(36) PRIMARY KEY,
+  organization_id varchar(36) NOT NULL,
+  url text NOT NULL,
+  event_types text NOT NULL,
+  active tinyint(1) NOT NULL DEFAULT true,
+  secret blob NOT NULL,
+  created_at datetime(6) NOT NULL,
+  updated_at datetime(6) NOT NULL,
+  FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhooks_organization_id_idx ON webhooks(organization_id);
+
+CREATE TABLE webhook_deliveries (
+  id varchar(36) PRIMARY KEY,
+  webhook_id varchar(36) NOT NULL,
+  event_id bigint NOT NULL,
+  event_type varchar(64) NOT NULL,
+  status varchar(16) NOT NULL DEFAULT 'pending',
+  attempts integer NOT NULL DEFAULT 0,
+  next_attempt_at datetime(6) NOT NULL,
+  last_status_code integer,
+  last_error text,
+  created_at datetime(6) NOT NULL,
+  updated_at datetime(6) NOT NULL,
+  UNIQUE (webhook_id, event_id),
+  FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE,
+  FOREIGN KEY (event_id) REFERENCES outbox(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries(status, next_attempt_at);
+
+CREATE TABLE webhook_attempts (
+  id varchar(36) PRIMARY KEY,
+  delivery_id varchar(36) NOT NULL,
+  status_code integer,
+  error text,
+  duration_ms bigint NOT NULL DEFAULT 0,
+  created_at datetime(6) NOT NULL,
+  FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_attempts_delivery_id_idx ON webhook_attempts(delivery_id);
+
+-- There is no foreign key to users, the log outlives the rows it describes.
+CREATE TABLE audit_events (
+  id bigint PRIMARY KEY AUTO_INCREMENT,
+  user_id varchar(36) NOT NULL,
+  action varchar(64) NOT NULL,
+  actor_id varchar(64) NOT NULL DEFAULT '',
+  request_id varchar(128) NOT NULL DEFAULT '',
+  changes mediumtext NOT NULL,
+  prev_hash varchar(64) NOT NULL DEFAULT '',
+  hash varchar(64) NOT NULL,
+  created_at datetime(6) NOT NULL
+);
+
+CREATE INDEX audit_events_user_id_idx ON audit_events(user_id, id);
+
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_events is append-only';
+
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_events is append-only';
+
+CREATE TABLE users_history (
+  version bigint PRIMARY KEY AUTO_INCREMENT,
+  id varchar(36) NOT NULL,
+  email varchar(255) NOT NULL,
+  name varchar(255) NOT NULL,
+  last_name varchar(255) NOT NULL,
+  email_verified_at datetime(6),
+  mfa_enabled_at datetime(6),
+  created_at datetime(6),
+  updated_at datetime(6),
+  deleted_at datetime(6),
+  valid_from datetime(6) NOT NULL,
+  valid_to datetime(6),
+  -- the id of the current version only, so the unique index allows a
+  -- single current version per user like a partial index
+  current_id varchar(36) AS (CASE WHEN valid_to IS NULL THEN id END) STORED,
+  CHECK (valid_to IS NULL OR valid_to >= valid_from)
+);
+
+CREATE INDEX users_history_id_idx ON users_history(id, valid_from);
+CREATE UNIQUE INDEX users_history_current_idx ON users_history(current_id);
+
+CREATE TABLE idempotency_keys (
+  scope varchar(255) NOT NULL,
+  `key` varchar(255) NOT NULL,
+  request_hash varchar(64) NOT NULL,
+  response mediumblob,
+  completed_at datetime(6),
+  created_at datetime(6) NOT NULL,
+  expires_at datetime(6) NOT NULL,
+  PRIMARY KEY (scope, `key`)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys(expires_at);
@@ -0,0 +1,5 @@
+-- 19_add_outbox_parking.sql of the postgres migrations.
+
+ALTER TABLE outbox ADD COLUMN parked_at datetime(6);
+
+CREATE INDEX outbox_parked_idx ON outbox(user_id, parked_at);
@@ -0,0 +1,8 @@
+-- The postgres migrations read the outbox in order of transaction instead,
+-- see 20_add_outbox_txid.sql of them.
+
+CREATE TABLE outbox_lock (
+  id int PRIMARY KEY
+);
+
+INSERT INTO outbox_lock (id) VALUES (1);
@@ -0,0 +1,10 @@
+-- 21_scope_user_roles.sql of the postgres migrations. A unique key allows
+-- many nulls in mysql so the grants without a organization are keyed by a
+-- generated column.
+
+ALTER TABLE user_roles
+  ADD COLUMN organization_id varchar(36),
+  ADD COLUMN organization_key varchar(36) AS (coalesce(organization_id, '')) STORED,
+  ADD FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+  DROP PRIMARY KEY,
+  ADD PRIMARY KEY (user_id, role_id, organization_key);
@@ -0,0 +1,7 @@
+-- 22_add_webhooks_permission.sql of the postgres migrations.
+
+INSERT INTO permissions (id, name, description, created_at) VALUES
+  ('ef18e768-4824-4ef8-970c-2d0a3f1dca0c', 'webhooks:write', 'Create, change, delete and replay the webhooks of the organization', utc_timestamp(6));
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = 'admin' AND p.name = 'webhooks:write';
@@ -0,0 +1,5 @@
+-- 23_add_outbox_lease.sql of the postgres migrations.
+
+ALTER TABLE outbox ADD COLUMN claimed_until datetime(6);
+
+CREATE INDEX outbox_claimed_idx ON outbox(user_id, claimed_until);
@@ -0,0 +1,207 @@
+package mysql
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frperezr/microservices-demo/src/users-api/database/postgres"
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// UserStore is a database.Store on MySQL 8.
+//
+// MySQL has no RETURNING, every write reads the rows it changed again in its
+// transaction, and no row level security, so the queries of the store limit
+// the rows to the tenant of the context themselves.
+type UserStore struct {
+	Store *sqlx.DB
+
+	// Retry runs the transactions that fail with a transient error again,
+	// Breaker fails them fast while the database is down
+	Retry   postgres.Retry
+	Breaker *postgres.Breaker
+}
+
+// Open connects to the database of the DSN, in the format of
+// github.com/go-sql-driver/mysql, waiting up to timeout for it to answer,
+// and applies the migrations it is missing. Times are read and written in UTC.
+func Open(ctx context.Context, dsn string, timeout time.Duration) (*UserStore, error) {
+	cfg, err := driver.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+
+	connector, err := driver.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db := sqlx.NewDb(sql.OpenDB(connector), "mysql")
+
+	if err := ping(ctx, db, timeout); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &UserStore{Store: db}, nil
+}
+
+// ping waits for the database to answer, retrying every second
+func ping(ctx context.Context, db *sqlx.DB, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		log.Println(fmt.Sprintf("[User Service][MySQL][Error] connecting, attempt %v: %v", attempt, err))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// migrate applies the migrations with a version higher than the last one
+// recorded in schema_migrations. Statements that change the schema commit on
+// their own in MySQL, so a migration that fails halfway must be fixed by
+// hand. A named lock keeps instances starting together from migrating twice.
+func migrate(ctx context.Context, db *sqlx.DB) error {
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+
+	versions := make(map[int]string, len(entries))
+	for _, e := range entries {
+		v, err := strconv.Atoi(strings.SplitN(e.Name(), "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("migration %v: %w", e.Name(), err)
+		}
+		versions[v] = e.Name()
+	}
+
+	order := make([]int, 0, len(versions))
+	for v := range versions {
+		order = append(order, v)
+	}
+	sort.Ints(order)
+
+	// the lock belongs to the session, so every statement runs on the same connection
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked int
+	if err := conn.QueryRowxContext(ctx, "select get_lock('users_api_migrations', 60)").Scan(&locked); err != nil {
+		return err
+	}
+
+	if locked != 1 {
+		return fmt.Errorf("timeout waiting for the migrations lock")
+	}
+	defer conn.ExecContext(context.Background(), "select release_lock('users_api_migrations')")
+
+	_, err = conn.ExecContext(ctx, "create table if not exists schema_migrations (version bigint primary key, applied_at datetime(6) not null)")
+	if err != nil {
+		return err
+	}
+
+	var current int
+	if err := conn.QueryRowxContext(ctx, "select coalesce(max(version), 0) from schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+
+	for _, v := range order {
+		if v <= current {
+			continue
+		}
+
+		file, err := migrations.ReadFile("migrations/" + versions[v])
+		if err != nil {
+			return err
+		}
+
+		for _, stmt := range statements(string(file)) {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("migration %v: %w", versions[v], err)
+			}
+		}
+
+		if _, err := conn.ExecContext(ctx, "insert into schema_migrations (version, applied_at) values (?, ?)", v, now()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// statements splits a migration into its statements, each one ends with a
+// semicolon at the end of a line
+func statements(file string) []string {
+	stmts := make([]string, 0)
+
+	for _, s := range strings.Split(file, ";\n") {
+		s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), ";"))
+
+		empty := true
+		for _, line := range strings.Split(s, "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+				empty = false
+				break
+			}
+		}
+
+		if !empty {
+			stmts = append(stmts, s)
+		}
+	}
+
+	return stmts
+}
+
+// now returns the current time with the precision of the datetime(6) columns,
+// so the time written is the time read back
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// newID returns a random UUID, the ids postgres makes with gen_random_uuid
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
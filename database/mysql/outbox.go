@@ -0,0 +1,246 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// eventColumns reads a missing before as a empty document instead of null
+const eventColumns = "id, type, user_id, payload, coalesce(`before`, '') as `before`, attempts, last_error, created_at, published_at, parked_at, 0 as txid"
+
+// insertEvent writes a event of the user into the outbox and its audit log, it must
+// run in the transaction of the change so the event exists if and only if the change does.
+//
+// The transactions that write events take turns on the row of outbox_lock
+// until they commit, so the ids of the events are taken in the order they
+// commit and ListEvents never reads a id before a lower one.
+func insertEvent(ctx context.Context, tx *sqlx.Tx, eventType string, before, after *user.User) error {
+	if err := insertAudit(ctx, tx, eventType, before, after); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "select id from outbox_lock where id = 1 for update"); err != nil {
+		return err
+	}
+
+	e, err := user.NewEvent(eventType, before, after)
+	if err != nil {
+		return err
+	}
+
+	query, args, err := squirrel.
+		Insert("outbox").
+		Columns("type", "user_id", "payload", "`before`", "created_at").
+		Values(e.Type, e.UserID, string(e.Payload), nullJSON(e.Before), now()).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// outboxLease is the time the events claimed by a relay are hidden from the
+// other relays, a relay that dies releases them when it runs out
+const outboxLease = 5 * time.Minute
+
+// ProcessOutbox hands the oldest unpublished events to fn, in order, and marks
+// the ones it accepted as published. Like in the postgres store the batch is
+// claimed for outboxLease in a short transaction and fn runs outside of it,
+// so several relays can run at once. A event is published again if the
+// process dies before it is marked, or fn outlasts the lease, consumers must
+// deduplicate by id. Failures are handled like in the postgres store: the
+// user of the event waits, and after maxAttempts the event is parked.
+func (us *UserStore) ProcessOutbox(ctx context.Context, limit, maxAttempts int, fn func(*user.Event) error) (int, error) {
+	ee, err := us.claimOutbox(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		published int
+		failed    error
+		waiting   []int64
+	)
+
+	blocked := make(map[string]bool)
+
+	for _, e := range ee {
+		if blocked[e.UserID] {
+			waiting = append(waiting, e.ID)
+			continue
+		}
+
+		if err := fn(e); err != nil {
+			// later events of the user wait so it keeps the order of its events
+			blocked[e.UserID] = true
+			if failed == nil {
+				failed = fmt.Errorf("event %v: %w", e.ID, err)
+			}
+
+			msg := err.Error()
+			err := us.run(ctx, func(tx *sqlx.Tx) error {
+				// mysql assigns in order, parked_at sees the new attempts
+				_, err := tx.ExecContext(ctx, `update outbox set attempts = attempts + 1, last_error = ?, claimed_until = null,
+					parked_at = case when attempts >= ? then ? end where id = ?`, msg, maxAttempts, now(), e.ID)
+				return err
+			})
+
+			if err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		err := us.run(ctx, func(tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, "update outbox set published_at = ?, attempts = attempts + 1, last_error = null, claimed_until = null where id = ?", now(), e.ID)
+			return err
+		})
+
+		if err != nil {
+			return published, err
+		}
+
+		published++
+	}
+
+	if len(waiting) > 0 {
+		query, args, err := squirrel.Update("outbox").Set("claimed_until", nil).Where(squirrel.Eq{"id": waiting}).ToSql()
+		if err != nil {
+			return published, err
+		}
+
+		err = us.run(ctx, func(tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, query, args...)
+			return err
+		})
+
+		if err != nil {
+			return published, err
+		}
+	}
+
+	return published, failed
+}
+
+// claimOutbox claims the oldest unpublished events of the users without
+// parked or claimed events, in order of id
+func (us *UserStore) claimOutbox(ctx context.Context, limit int) ([]*user.Event, error) {
+	var ee []*user.Event
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		ee = make([]*user.Event, 0)
+
+		// a claim running at the same time could not see the events of this
+		// one until it commits, so they take turns on the row of outbox_lock
+		if _, err := tx.ExecContext(ctx, "select id from outbox_lock where id = 1 for update"); err != nil {
+			return err
+		}
+
+		at := now()
+
+		var ids []int64
+		err := tx.SelectContext(ctx, &ids, `select o.id from outbox o where o.published_at is null and o.parked_at is null
+			and not exists (select 1 from outbox p where p.user_id = o.user_id and p.published_at is null
+				and (p.parked_at is not null or p.claimed_until > ?))
+			order by o.id limit ?`, at, limit)
+
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		query, args, err := squirrel.Update("outbox").Set("claimed_until", at.Add(outboxLease)).Where(squirrel.Eq{"id": ids}).ToSql()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+
+		query, args, err = squirrel.Select(eventColumns).From("outbox").Where(squirrel.Eq{"id": ids}).OrderBy("id").ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.SelectContext(ctx, &ee, query, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ee, nil
+}
+
+// ListEvents returns the events of the outbox in order, in a tenant scope
+// only the events of its members are returned. The events commit in order of
+// id, see insertEvent.
+func (us *UserStore) ListEvents(ctx context.Context, f *user.EventFilter) ([]*user.Event, error) {
+	query := squirrel.Select(eventColumns).From("outbox").Where("id > ?", f.AfterID).OrderBy("id")
+
+	if len(f.UserIDs) > 0 {
+		query = query.Where(squirrel.Eq{"user_id": f.UserIDs})
+	}
+
+	if len(f.Types) > 0 {
+		query = query.Where(squirrel.Eq{"type": f.Types})
+	}
+
+	if f.Limit > 0 {
+		query = query.Limit(f.Limit)
+	}
+
+	if orgID, ok := tenant.FromContext(ctx); ok {
+		query = query.Where("exists (select 1 from memberships m where m.user_id = outbox.user_id and m.organization_id = ?)", orgID)
+	}
+
+	ee := make([]*user.Event, 0)
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		sql, args, err := query.ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.SelectContext(ctx, &ee, sql, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ee, nil
+}
+
+// EventsHead returns the position of the last event, the events after it are
+// read with it as EventFilter.AfterID
+func (us *UserStore) EventsHead(ctx context.Context) (int64, int64, error) {
+	var id int64
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, "select coalesce(max(id), 0) from outbox").Scan(&id)
+	})
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return 0, id, nil
+}
+
+// nullJSON stores a empty document as null
+func nullJSON(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
@@ -0,0 +1,105 @@
+package mysql
+
+import (
+	"context"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+// commitError is a error of a commit, where a lost connection leaves the
+// transaction committed or not
+type commitError struct {
+	err error
+}
+
+func (e *commitError) Error() string {
+	return e.err.Error()
+}
+
+// retry calls fn until it succeeds, fails with a error that is not
+// transient or runs out of attempts. A connection lost on commit is not
+// retried, the transaction may have been applied.
+func (us *UserStore) retry(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+
+		var cerr *commitError
+		if errors.As(err, &cerr) {
+			err = cerr.err
+			if isConnError(err) {
+				return err
+			}
+		}
+
+		if err == nil || !IsTransient(err) || attempt >= us.Retry.Attempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(us.Retry.Delay(attempt)):
+		}
+	}
+}
+
+// IsTransient reports whether a query that failed with err can succeed if
+// run again: deadlocks, lock wait timeouts and lost connections
+func IsTransient(err error) bool {
+	var e *driver.MySQLError
+	if errors.As(err, &e) {
+		switch e.Number {
+		case 1205, 1213:
+			return true
+		}
+	}
+
+	return isConnError(err)
+}
+
+// isConnError reports whether err is a failure of the connection or the
+// server rather than of the query
+func isConnError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, sqldriver.ErrBadConn) || errors.Is(err, driver.ErrInvalidConn) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// too many connections and the server shutting down
+	var e *driver.MySQLError
+	if errors.As(err, &e) {
+		return e.Number == 1040 || e.Number == 1053
+	}
+
+	return false
+}
+
+// breakerError returns err as the breaker must see it, the breaker only
+// knows the connection errors of database/sql and the network
+func breakerError(err error) error {
+	if err == nil || !isConnError(err) || errors.Is(err, sqldriver.ErrBadConn) {
+		return err
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %v", sqldriver.ErrBadConn, err)
+}
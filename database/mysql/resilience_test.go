@@ -0,0 +1,64 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/database/postgres"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestRunOpensTheBreakerWhileTheDatabaseIsDown(t *testing.T) {
+	cfg := driver.NewConfig()
+	cfg.Net = "tcp"
+	cfg.Addr = "127.0.0.1:1"
+
+	connector, err := driver.NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := sqlx.NewDb(sql.OpenDB(connector), "mysql")
+	defer db.Close()
+
+	us := &UserStore{
+		Store:   db,
+		Retry:   postgres.Retry{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		Breaker: postgres.NewBreaker(2, time.Hour),
+	}
+
+	calls := 0
+	err = us.run(tenant.WithSystem(context.Background()), func(tx *sqlx.Tx) error {
+		calls++
+		return nil
+	})
+
+	// the first two attempts fail to connect and open the breaker, the last
+	// one fails fast
+	if err != user.ErrUnavailable || calls != 0 {
+		t.Fatalf("run = %v after %v calls, want %v", err, calls, user.ErrUnavailable)
+	}
+}
+
+func TestTransientErrors(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{&driver.MySQLError{Number: 1213}, true},
+		{&driver.MySQLError{Number: 1205}, true},
+		{&driver.MySQLError{Number: 1040}, true},
+		{driver.ErrInvalidConn, true},
+		{&driver.MySQLError{Number: 1062}, false},
+		{context.Canceled, false},
+	} {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
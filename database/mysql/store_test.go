@@ -0,0 +1,25 @@
+package mysql_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/frperezr/microservices-demo/src/users-api/database"
+	"github.com/frperezr/microservices-demo/src/users-api/database/storetest"
+)
+
+// TestStore runs against the database of TEST_MYSQL_DSN, in the format of
+// github.com/go-sql-driver/mysql, the migrations are applied on open
+func TestStore(t *testing.T) {
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+
+	store, err := database.NewMySQL(dsn, database.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storetest.Run(t, store)
+}
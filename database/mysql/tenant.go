@@ -0,0 +1,129 @@
+package mysql
+
+import (
+	"context"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// memberOfTenant restricts a query over users to the members of the tenant
+const memberOfTenant = "exists (select 1 from memberships m where m.user_id = users.id and m.organization_id = ?)"
+
+// run executes fn in a transaction, again when it fails with a transient
+// error. MySQL has no row level security, so every query of the store limits
+// the rows to the tenant of the context itself, with scopeSelect and inTenant.
+func (us *UserStore) run(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	return us.retry(ctx, func() error {
+		tx, err := us.begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return &commitError{err}
+		}
+
+		return nil
+	})
+}
+
+// begin starts a transaction unless the breaker is open, the context must
+// have a tenant or the system scope
+func (us *UserStore) begin(ctx context.Context) (*sqlx.Tx, error) {
+	if _, ok := tenant.FromContext(ctx); !ok && !tenant.IsSystem(ctx) {
+		return nil, tenant.ErrMissing
+	}
+
+	if err := us.Breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	// a transaction that starts proves the database is reachable
+	tx, err := us.Store.BeginTxx(ctx, nil)
+	us.Breaker.Record(breakerError(err))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// inTenant limits the rows to the ones of the tenant of the context, column
+// is the organization of the row. It matches every row in the system scope.
+func inTenant(ctx context.Context, column string) squirrel.Sqlizer {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return squirrel.Eq{column: id}
+	}
+	return squirrel.Expr("1 = 1")
+}
+
+// scopeSelect adds the tenant of the context to a query over users
+func scopeSelect(ctx context.Context, q squirrel.SelectBuilder) squirrel.SelectBuilder {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return q.Where(memberOfTenant, id)
+	}
+	return q
+}
+
+// getUser runs a scoped select over users returning a single row
+func getUser(ctx context.Context, tx *sqlx.Tx, q squirrel.SelectBuilder) (*user.User, error) {
+	sql, args, err := scopeSelect(ctx, q).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	u := &user.User{}
+
+	if err := tx.QueryRowxContext(ctx, sql, args...).StructScan(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// lockUser returns the current row of the user, locking it until the end of
+// the transaction so concurrent changes are applied one after the other
+func lockUser(ctx context.Context, tx *sqlx.Tx, id string) (*user.User, error) {
+	return getUser(ctx, tx, squirrel.Select("*").From("users").Where("id = ?", id).Suffix("for update"))
+}
+
+// updateUser applies the columns of set to the user matching where in the
+// tenant, reading the updated row into u, and records the new version of the
+// user. It sets updated_at. MySQL assigns the columns in order and the later
+// ones see the new values of the earlier ones.
+func updateUser(ctx context.Context, tx *sqlx.Tx, set squirrel.UpdateBuilder, where squirrel.Sqlizer, u *user.User) error {
+	sql, args, err := scopeSelect(ctx, squirrel.Select("id").From("users").Where(where)).Suffix("for update").ToSql()
+	if err != nil {
+		return err
+	}
+
+	var id string
+
+	if err := tx.QueryRowxContext(ctx, sql, args...).Scan(&id); err != nil {
+		return err
+	}
+
+	sql, args, err = set.Set("updated_at", now()).Where("id = ?", id).ToSql()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return err
+	}
+
+	if err := tx.QueryRowxContext(ctx, "select * from users where id = ?", id).StructScan(u); err != nil {
+		return err
+	}
+
+	return recordVersion(ctx, tx, u)
+}
@@ -0,0 +1,504 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// CreateWebhook ...
+func (us *UserStore) CreateWebhook(ctx context.Context, w *user.Webhook) error {
+	if w.OrganizationID == "" || w.URL == "" {
+		return errors.New("must provide a organization id and url")
+	}
+
+	if id, ok := tenant.FromContext(ctx); ok && id != w.OrganizationID {
+		return tenant.ErrMismatch
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	at := now()
+
+	query, args, err := squirrel.
+		Insert("webhooks").
+		Columns("id", "organization_id", "url", "event_types", "active", "secret", "created_at", "updated_at").
+		Values(id, w.OrganizationID, w.URL, eventTypes(w.EventTypes), w.Active, w.Secret, at, at).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+
+		return scanWebhook(tx.QueryRowxContext(ctx, "select * from webhooks where id = ?", id), w)
+	})
+}
+
+// GetWebhook ...
+func (us *UserStore) GetWebhook(ctx context.Context, id string) (*user.Webhook, error) {
+	w := &user.Webhook{}
+
+	query, args, err := squirrel.Select("*").From("webhooks").Where("id = ?", id).Where(inTenant(ctx, "organization_id")).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.run(ctx, func(tx *sqlx.Tx) error {
+		return scanWebhook(tx.QueryRowxContext(ctx, query, args...), w)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrWebhookNotFound
+		}
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// ListWebhooks ...
+func (us *UserStore) ListWebhooks(ctx context.Context, orgID string) ([]*user.Webhook, error) {
+	var ww []*user.Webhook
+
+	query, args, err := squirrel.
+		Select("*").
+		From("webhooks").
+		Where("organization_id = ?", orgID).
+		Where(inTenant(ctx, "organization_id")).
+		OrderBy("created_at").
+		ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.run(ctx, func(tx *sqlx.Tx) error {
+		rows := make([]*webhookRow, 0)
+		if err := tx.SelectContext(ctx, &rows, query, args...); err != nil {
+			return err
+		}
+
+		ww = toWebhooks(rows)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ww, nil
+}
+
+// UpdateWebhook replaces the url, event types and active flag of the webhook
+func (us *UserStore) UpdateWebhook(ctx context.Context, w *user.Webhook) error {
+	update := squirrel.Update("webhooks").
+		Set("event_types", eventTypes(w.EventTypes)).
+		Set("active", w.Active).
+		Set("updated_at", now()).
+		Where("id = ?", w.ID).
+		Where(inTenant(ctx, "organization_id"))
+
+	if w.URL != "" {
+		update = update.Set("url", w.URL)
+	}
+
+	query, args, err := update.ToSql()
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+
+		query, args, err := squirrel.Select("*").From("webhooks").Where("id = ?", w.ID).Where(inTenant(ctx, "organization_id")).ToSql()
+		if err != nil {
+			return err
+		}
+
+		if err := scanWebhook(tx.QueryRowxContext(ctx, query, args...), w); err != nil {
+			if err == sql.ErrNoRows {
+				return user.ErrWebhookNotFound
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// DeleteWebhook removes the webhook with its deliveries
+func (us *UserStore) DeleteWebhook(ctx context.Context, id string) error {
+	query, args, err := squirrel.Delete("webhooks").Where("id = ?", id).Where(inTenant(ctx, "organization_id")).ToSql()
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return user.ErrWebhookNotFound
+		}
+
+		return nil
+	})
+}
+
+// EnqueueWebhookDeliveries creates a delivery of the event for every active
+// webhook subscribed to its type in the organizations of the user. Enqueuing
+// the same event twice is a no-op.
+func (us *UserStore) EnqueueWebhookDeliveries(ctx context.Context, e *user.Event) (int, error) {
+	var n int64
+
+	query, args, err := squirrel.
+		Select("w.*").
+		From("webhooks w").
+		Where("w.active").
+		Where("exists (select 1 from memberships m where m.user_id = ? and m.organization_id = w.organization_id)", e.UserID).
+		Where(inTenant(ctx, "w.organization_id")).
+		ToSql()
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = us.run(ctx, func(tx *sqlx.Tx) error {
+		n = 0
+
+		rows := make([]*webhookRow, 0)
+		if err := tx.SelectContext(ctx, &rows, query, args...); err != nil {
+			return err
+		}
+		ww := toWebhooks(rows)
+
+		at := now()
+
+		for _, w := range ww {
+			// the event types are a array literal, so they are matched here rather than in the query
+			if !subscribed(w, e.Type) {
+				continue
+			}
+
+			id, err := newID()
+			if err != nil {
+				return err
+			}
+
+			res, err := tx.ExecContext(ctx, `insert into webhook_deliveries (id, webhook_id, event_id, event_type, next_attempt_at, created_at, updated_at)
+				values (?, ?, ?, ?, ?, ?, ?)
+				on duplicate key update id = id`, id, w.ID, e.ID, e.Type, at, at, at)
+
+			if err != nil {
+				return err
+			}
+
+			inserted, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+
+			n += inserted
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// ClaimWebhookDeliveries returns the pending deliveries that are due, pushing
+// their next attempt by lease so other workers skip them meanwhile. If the
+// worker dies the deliveries are attempted again once the lease expires.
+func (us *UserStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*user.WebhookDelivery, error) {
+	var dd []*user.WebhookDelivery
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		dd = make([]*user.WebhookDelivery, 0)
+
+		at := now()
+
+		var ids []string
+
+		// deliveries claimed by a concurrent worker are skipped rather than waited for
+		err := tx.SelectContext(ctx, &ids, `select id from webhook_deliveries
+			where status = 'pending' and next_attempt_at <= ?
+			order by next_attempt_at limit ?
+			for update skip locked`, at, limit)
+
+		if err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		query, args, err := squirrel.
+			Update("webhook_deliveries").
+			Set("next_attempt_at", at.Add(lease)).
+			Set("updated_at", at).
+			Where(squirrel.Eq{"id": ids}).
+			ToSql()
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+
+		query, args, err = squirrel.Select("*").From("webhook_deliveries").Where(squirrel.Eq{"id": ids}).OrderBy("next_attempt_at").ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.SelectContext(ctx, &dd, query, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dd, nil
+}
+
+// GetEvent ...
+func (us *UserStore) GetEvent(ctx context.Context, id int64) (*user.Event, error) {
+	e := &user.Event{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, "select "+eventColumns+" from outbox where id = ?", id).StructScan(e)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// RecordWebhookAttempt stores the attempt and the new state of its delivery
+func (us *UserStore) RecordWebhookAttempt(ctx context.Context, d *user.WebhookDelivery, a *user.WebhookAttempt) error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		at := now()
+
+		_, err := tx.ExecContext(ctx, `insert into webhook_attempts (id, delivery_id, status_code, error, duration_ms, created_at)
+			values (?, ?, ?, ?, ?, ?)`, id, d.ID, a.StatusCode, a.Error, a.DurationMS, at)
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.QueryRowxContext(ctx, "select * from webhook_attempts where id = ?", id).StructScan(a); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `update webhook_deliveries set
+			status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?, last_error = ?, updated_at = ?
+			where id = ?`, d.Status, d.Attempts, d.NextAttemptAt, d.LastStatusCode, d.LastError, at, d.ID)
+
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRowxContext(ctx, "select * from webhook_deliveries where id = ?", d.ID).StructScan(d)
+	})
+}
+
+// ListWebhookDeliveries returns the deliveries of the webhook, newest first, optionally by status
+func (us *UserStore) ListWebhookDeliveries(ctx context.Context, webhookID, status string) ([]*user.WebhookDelivery, error) {
+	query := squirrel.
+		Select("*").
+		From("webhook_deliveries").
+		Where("webhook_id = ?", webhookID).
+		Where(ofWebhookInTenant(ctx)).
+		OrderBy("created_at desc")
+
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var dd []*user.WebhookDelivery
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		dd = make([]*user.WebhookDelivery, 0)
+
+		sql, args, err := query.ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.SelectContext(ctx, &dd, sql, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dd, nil
+}
+
+// ListWebhookAttempts ...
+func (us *UserStore) ListWebhookAttempts(ctx context.Context, deliveryID string) ([]*user.WebhookAttempt, error) {
+	var aa []*user.WebhookAttempt
+
+	query := squirrel.Select("*").From("webhook_attempts").Where("delivery_id = ?", deliveryID).OrderBy("created_at")
+
+	if orgID, ok := tenant.FromContext(ctx); ok {
+		query = query.Where(`exists (select 1 from webhook_deliveries d join webhooks w on w.id = d.webhook_id
+			where d.id = webhook_attempts.delivery_id and w.organization_id = ?)`, orgID)
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.run(ctx, func(tx *sqlx.Tx) error {
+		aa = make([]*user.WebhookAttempt, 0)
+
+		return tx.SelectContext(ctx, &aa, sql, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return aa, nil
+}
+
+// ReplayWebhookDelivery schedules the delivery again right away, whatever its
+// status, with a fresh count of attempts
+func (us *UserStore) ReplayWebhookDelivery(ctx context.Context, id string) (*user.WebhookDelivery, error) {
+	d := &user.WebhookDelivery{}
+
+	at := now()
+
+	query, args, err := squirrel.
+		Update("webhook_deliveries").
+		Set("status", user.DeliveryPending).
+		Set("attempts", 0).
+		Set("next_attempt_at", at).
+		Set("updated_at", at).
+		Where("id = ?", id).
+		Where(ofWebhookInTenant(ctx)).
+		ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.run(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+
+		query, args, err := squirrel.Select("*").From("webhook_deliveries").Where("id = ?", id).Where(ofWebhookInTenant(ctx)).ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRowxContext(ctx, query, args...).StructScan(d)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrDeliveryNotFound
+		}
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// webhookRow is a row of webhooks, whose event types are stored as a array literal of postgres
+type webhookRow struct {
+	user.Webhook
+	EventTypes pq.StringArray `db:"event_types"`
+}
+
+// scanWebhook scans the webhook of the row into w
+func scanWebhook(row *sqlx.Row, w *user.Webhook) error {
+	r := &webhookRow{}
+	if err := row.StructScan(r); err != nil {
+		return err
+	}
+
+	*w = r.Webhook
+	w.EventTypes = r.EventTypes
+	return nil
+}
+
+// toWebhooks returns the webhooks of the rows
+func toWebhooks(rows []*webhookRow) []*user.Webhook {
+	ww := make([]*user.Webhook, 0, len(rows))
+	for _, r := range rows {
+		w := r.Webhook
+		w.EventTypes = r.EventTypes
+		ww = append(ww, &w)
+	}
+	return ww
+}
+
+// eventTypes stores a nil list as a empty array
+func eventTypes(types []string) interface{} {
+	if types == nil {
+		types = []string{}
+	}
+	return pq.Array(types)
+}
+
+// ofWebhookInTenant limits a query over webhook_deliveries to the webhooks of the tenant of the context
+func ofWebhookInTenant(ctx context.Context) squirrel.Sqlizer {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return squirrel.Expr("exists (select 1 from webhooks w where w.id = webhook_deliveries.webhook_id and w.organization_id = ?)", id)
+	}
+	return squirrel.Expr("1 = 1")
+}
+
+// subscribed reports whether the webhook receives events of the type
+func subscribed(w *user.Webhook, eventType string) bool {
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+
+	for _, t := range w.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
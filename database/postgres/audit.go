@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/actor"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// insertAudit appends the change of the user to its audit chain. The callers
+// hold the lock of the user row, the last entry is locked too so entries of
+// a user are never chained to the same predecessor.
+func insertAudit(ctx context.Context, tx *sqlx.Tx, action string, before, after *user.User) error {
+	a, err := user.NewAuditEvent(action, before, after)
+	if err != nil {
+		return err
+	}
+
+	who := actor.FromContext(ctx)
+	a.ActorID = who.UserID
+	a.RequestID = who.RequestID
+
+	var prev string
+
+	err = tx.QueryRowxContext(ctx, "select hash from audit_events where user_id = $1 order by id desc limit 1 for update", a.UserID).Scan(&prev)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	a.Seal(prev)
+
+	query, args, err := squirrel.
+		Insert("audit_events").
+		Columns("user_id", "action", "actor_id", "request_id", "changes", "prev_hash", "hash", "created_at").
+		Values(a.UserID, a.Action, a.ActorID, a.RequestID, string(a.Changes), a.PrevHash, a.Hash, a.CreatedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// ListAuditEvents returns the audit chain of the user, oldest first
+func (us *UserStore) ListAuditEvents(ctx context.Context, userID string) ([]*user.AuditEvent, error) {
+	if userID == "" {
+		return nil, errors.New("must provide a user id")
+	}
+
+	query := squirrel.
+		Select("id", "user_id", "action", "actor_id", "request_id", "changes", "prev_hash", "hash", "created_at").
+		From("audit_events").
+		Where("user_id = ?", userID).
+		OrderBy("id")
+
+	if orgID, ok := tenant.FromContext(ctx); ok {
+		query = query.Where("exists (select 1 from memberships m where m.user_id = audit_events.user_id and m.organization_id = ?)", orgID)
+	}
+
+	var aa []*user.AuditEvent
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		aa = make([]*user.AuditEvent, 0)
+
+		sql, args, err := query.PlaceholderFormat(squirrel.Dollar).ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.SelectContext(ctx, &aa, sql, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return aa, nil
+}
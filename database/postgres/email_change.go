@@ -0,0 +1,147 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateEmailChange stages a new email change for the user, replacing any
+// change still waiting for confirmation.
+func (us *UserStore) CreateEmailChange(ctx context.Context, c *user.EmailChange) error {
+	if c.UserID == "" {
+		return errors.New("must provide a user id")
+	}
+
+	if c.NewEmail == "" {
+		return errors.New("must provide a email")
+	}
+
+	query, args, err := squirrel.
+		Insert("email_changes").
+		Columns("user_id", "old_email", "new_email", "token_hash", "revert_token_hash", "expires_at", "revert_expires_at").
+		Values(c.UserID, strings.ToLower(c.OldEmail), strings.ToLower(c.NewEmail), c.TokenHash, c.RevertTokenHash, c.ExpiresAt, c.RevertExpiresAt).
+		Suffix("returning *").
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, "delete from email_changes where user_id = $1 and confirmed_at is null and reverted_at is null", c.UserID); err != nil {
+			return err
+		}
+
+		return tx.QueryRowxContext(ctx, query, args...).StructScan(c)
+	})
+}
+
+// ConfirmEmailChange consumes the token and swaps the email of the user in the
+// same transaction, failing with user.ErrEmailTaken if the new email was
+// registered in the meantime.
+func (us *UserStore) ConfirmEmailChange(ctx context.Context, tokenHash string) (*user.User, error) {
+	if tokenHash == "" {
+		return nil, user.ErrInvalidToken
+	}
+
+	var u *user.User
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		c := &user.EmailChange{}
+
+		row := tx.QueryRowxContext(ctx, "update email_changes set confirmed_at = now() where token_hash = $1 and confirmed_at is null and reverted_at is null and expires_at > now() returning *", tokenHash)
+		if err := row.StructScan(c); err != nil {
+			return err
+		}
+
+		before, err := lockUser(ctx, tx, c.UserID)
+		if err != nil {
+			return err
+		}
+
+		u = &user.User{}
+
+		row = tx.QueryRowxContext(ctx, "update users set email = $1, email_verified_at = now() where id = $2 and email = $3 and deleted_at is null returning *", c.NewEmail, c.UserID, c.OldEmail)
+		if err := row.StructScan(u); err != nil {
+			return err
+		}
+
+		return insertEvent(ctx, tx, user.EventUserUpdated, before, u)
+	})
+
+	if err != nil {
+		return nil, emailChangeError(err)
+	}
+
+	return u, nil
+}
+
+// RevertEmailChange cancels a pending change, or restores the old email of the
+// user if the change was already confirmed.
+func (us *UserStore) RevertEmailChange(ctx context.Context, revertTokenHash string) (*user.User, error) {
+	if revertTokenHash == "" {
+		return nil, user.ErrInvalidToken
+	}
+
+	var u *user.User
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		c := &user.EmailChange{}
+
+		row := tx.QueryRowxContext(ctx, "update email_changes set reverted_at = now() where revert_token_hash = $1 and reverted_at is null and revert_expires_at > now() returning *", revertTokenHash)
+		if err := row.StructScan(c); err != nil {
+			return err
+		}
+
+		before, err := lockUser(ctx, tx, c.UserID)
+		if err != nil {
+			return err
+		}
+
+		u = &user.User{}
+
+		if c.ConfirmedAt == nil {
+			row = tx.QueryRowxContext(ctx, "select * from users where id = $1 and deleted_at is null", c.UserID)
+		} else {
+			// the revert link was received on the old address, so it is verified again
+			row = tx.QueryRowxContext(ctx, "update users set email = $1, email_verified_at = now() where id = $2 and email = $3 and deleted_at is null returning *", c.OldEmail, c.UserID, c.NewEmail)
+		}
+
+		if err := row.StructScan(u); err != nil {
+			return err
+		}
+
+		if c.ConfirmedAt == nil {
+			return nil
+		}
+
+		return insertEvent(ctx, tx, user.EventUserUpdated, before, u)
+	})
+
+	if err != nil {
+		return nil, emailChangeError(err)
+	}
+
+	return u, nil
+}
+
+// emailChangeError converts the errors of a email change, a token or user
+// that is not found makes the token invalid
+func emailChangeError(err error) error {
+	if err == sql.ErrNoRows {
+		return user.ErrInvalidToken
+	}
+
+	if isUniqueViolation(err) {
+		return user.ErrEmailTaken
+	}
+
+	return err
+}
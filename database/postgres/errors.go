@@ -0,0 +1,13 @@
+package postgres
+
+import (
+	"github.com/lib/pq"
+)
+
+// isUniqueViolation reports whether err was caused by a unique constraint
+func isUniqueViolation(err error) bool {
+	if pqErr, ok := err.(*pq.Error); ok {
+		return pqErr.Code == "23505"
+	}
+	return false
+}
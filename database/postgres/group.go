@@ -0,0 +1,272 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateGroup ...
+func (us *UserStore) CreateGroup(ctx context.Context, g *user.Group) error {
+	if g.OrganizationID == "" || g.Name == "" {
+		return errors.New("must provide a organization id and name")
+	}
+
+	query, args, err := squirrel.
+		Insert("groups").
+		Columns("organization_id", "name", "description").
+		Values(g.OrganizationID, g.Name, g.Description).
+		Suffix("returning *").
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.QueryRowxContext(ctx, query, args...).StructScan(g); err != nil {
+			if isUniqueViolation(err) {
+				return user.ErrGroupNameTaken
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// GetGroup ...
+func (us *UserStore) GetGroup(ctx context.Context, id string) (*user.Group, error) {
+	if id == "" {
+		return nil, errors.New("must provide a id")
+	}
+
+	g := &user.Group{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, "select * from groups where id = $1", id).StructScan(g)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrGroupNotFound
+		}
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// UpdateGroup ...
+func (us *UserStore) UpdateGroup(ctx context.Context, g *user.Group) error {
+	if g.ID == "" {
+		return errors.New("must provide a id")
+	}
+
+	update := squirrel.Update("groups").Set("description", g.Description).Where("id = ?", g.ID)
+
+	if g.Name != "" {
+		update = update.Set("name", g.Name)
+	}
+
+	query, args, err := update.Suffix("returning *").PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.QueryRowxContext(ctx, query, args...).StructScan(g); err != nil {
+			if isUniqueViolation(err) {
+				return user.ErrGroupNameTaken
+			}
+			if err == sql.ErrNoRows {
+				return user.ErrGroupNotFound
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// DeleteGroup removes the group, its members and its membership in other groups
+func (us *UserStore) DeleteGroup(ctx context.Context, id string) error {
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "delete from groups where id = $1", id)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return user.ErrGroupNotFound
+		}
+
+		return nil
+	})
+}
+
+// ListGroups ...
+func (us *UserStore) ListGroups(ctx context.Context, orgID string) ([]*user.Group, error) {
+	var gg []*user.Group
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		gg = make([]*user.Group, 0)
+
+		return tx.SelectContext(ctx, &gg, "select * from groups where organization_id = $1 order by name", orgID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return gg, nil
+}
+
+// AddGroupMember adds a user or a group to the group. Nested groups are
+// checked for cycles while holding a lock on the groups of the organization,
+// so two concurrent additions can not close a cycle between them.
+func (us *UserStore) AddGroupMember(ctx context.Context, m *user.GroupMember) error {
+	if (m.UserID == "") == (m.MemberGroupID == "") {
+		return user.ErrInvalidGroupMember
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		var orgID string
+		if err := tx.QueryRowxContext(ctx, "select organization_id from groups where id = $1", m.GroupID).Scan(&orgID); err != nil {
+			if err == sql.ErrNoRows {
+				return user.ErrGroupNotFound
+			}
+			return err
+		}
+
+		if m.UserID != "" {
+			row := tx.QueryRowxContext(ctx, `insert into group_users (group_id, user_id) values ($1, $2)
+				on conflict (group_id, user_id) do update set user_id = excluded.user_id
+				returning created_at`, m.GroupID, m.UserID)
+
+			return row.Scan(&m.CreatedAt)
+		}
+
+		if _, err := tx.ExecContext(ctx, "select pg_advisory_xact_lock(hashtext($1))", "groups:"+orgID); err != nil {
+			return err
+		}
+
+		var memberOrgID string
+		if err := tx.QueryRowxContext(ctx, "select organization_id from groups where id = $1", m.MemberGroupID).Scan(&memberOrgID); err != nil {
+			if err == sql.ErrNoRows {
+				return user.ErrGroupNotFound
+			}
+			return err
+		}
+
+		if memberOrgID != orgID {
+			return user.ErrGroupNotFound
+		}
+
+		var cycle bool
+
+		// the group can not be added if it is already reachable from the new member
+		row := tx.QueryRowxContext(ctx, `with recursive descendants (id) as (
+				select $1::uuid
+				union
+				select gg.member_group_id from group_groups gg join descendants d on gg.group_id = d.id
+			)
+			select exists (select 1 from descendants where id = $2)`, m.MemberGroupID, m.GroupID)
+
+		if err := row.Scan(&cycle); err != nil {
+			return err
+		}
+
+		if cycle {
+			return user.ErrGroupCycle
+		}
+
+		row = tx.QueryRowxContext(ctx, `insert into group_groups (group_id, member_group_id) values ($1, $2)
+			on conflict (group_id, member_group_id) do update set member_group_id = excluded.member_group_id
+			returning created_at`, m.GroupID, m.MemberGroupID)
+
+		return row.Scan(&m.CreatedAt)
+	})
+}
+
+// RemoveGroupMember ...
+func (us *UserStore) RemoveGroupMember(ctx context.Context, m *user.GroupMember) error {
+	if (m.UserID == "") == (m.MemberGroupID == "") {
+		return user.ErrInvalidGroupMember
+	}
+
+	query := "delete from group_users where group_id = $1 and user_id = $2"
+	member := m.UserID
+
+	if m.MemberGroupID != "" {
+		query = "delete from group_groups where group_id = $1 and member_group_id = $2"
+		member = m.MemberGroupID
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, query, m.GroupID, member)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return user.ErrNotMember
+		}
+
+		return nil
+	})
+}
+
+// ListGroupMembers returns the direct members of the group
+func (us *UserStore) ListGroupMembers(ctx context.Context, groupID string) ([]*user.GroupMember, error) {
+	var mm []*user.GroupMember
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		mm = make([]*user.GroupMember, 0)
+
+		return tx.SelectContext(ctx, &mm, `select group_id, user_id::text as user_id, '' as member_group_id, created_at
+			from group_users where group_id = $1
+			union all
+			select group_id, '' as user_id, member_group_id::text as member_group_id, created_at
+			from group_groups where group_id = $1
+			order by created_at`, groupID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return mm, nil
+}
+
+// ListUserGroups expands the groups of the user walking up the nested groups,
+// the union of the recursive query ignores groups already visited so cycles
+// can not make it loop.
+func (us *UserStore) ListUserGroups(ctx context.Context, userID string) ([]*user.Group, error) {
+	var gg []*user.Group
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		gg = make([]*user.Group, 0)
+
+		return tx.SelectContext(ctx, &gg, `with recursive effective (id) as (
+				select group_id from group_users where user_id = $1
+				union
+				select gg.group_id from group_groups gg join effective e on gg.member_group_id = e.id
+			)
+			select g.* from groups g join effective e on e.id = g.id
+			order by g.name`, userID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return gg, nil
+}
@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/jmoiron/sqlx"
+)
+
+// versionColumns are the columns of users_history, filled by a trigger on users
+const versionColumns = "version, id, email, name, last_name, email_verified_at, mfa_enabled_at, created_at, updated_at, deleted_at, valid_from, valid_to"
+
+// GetUserAsOf returns the version of the user that was current at the given time
+func (us *UserStore) GetUserAsOf(ctx context.Context, id string, at time.Time) (*user.UserVersion, error) {
+	if id == "" {
+		return nil, errors.New("must provide a id")
+	}
+
+	v := &user.UserVersion{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, `select `+versionColumns+` from users_history
+			where id = $1 and valid_from <= $2 and (valid_to is null or valid_to > $2)`, id, at).StructScan(v)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// ListUserVersions returns every version of the user, oldest first
+func (us *UserStore) ListUserVersions(ctx context.Context, id string) ([]*user.UserVersion, error) {
+	if id == "" {
+		return nil, errors.New("must provide a id")
+	}
+
+	query, args, err := squirrel.
+		Select(versionColumns).
+		From("users_history").
+		Where("id = ?", id).
+		OrderBy("valid_from", "version").
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var vv []*user.UserVersion
+
+	err = us.run(ctx, func(tx *sqlx.Tx) error {
+		vv = make([]*user.UserVersion, 0)
+
+		return tx.SelectContext(ctx, &vv, query, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return vv, nil
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// ClaimIdempotencyKey stores the key unless a unexpired one with the same
+// scope exists, a expired key is taken over. It returns the key stored and
+// whether it was claimed, when it was not the key is the existing one.
+func (us *UserStore) ClaimIdempotencyKey(ctx context.Context, k *user.IdempotencyKey) (*user.IdempotencyKey, bool, error) {
+	var (
+		stored  *user.IdempotencyKey
+		claimed bool
+	)
+
+	err := us.runKeys(ctx, func(tx *sqlx.Tx) error {
+		stored, claimed = &user.IdempotencyKey{}, true
+
+		err := tx.QueryRowxContext(ctx, `insert into idempotency_keys (scope, key, request_hash, expires_at)
+			values ($1, $2, $3, $4)
+			on conflict (scope, key) do update set
+				request_hash = excluded.request_hash, response = null, completed_at = null,
+				created_at = now(), expires_at = excluded.expires_at
+			where idempotency_keys.expires_at <= now()
+			returning *`, k.Scope, k.Key, k.RequestHash, k.ExpiresAt).StructScan(stored)
+
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		claimed = false
+
+		err = tx.QueryRowxContext(ctx, "select * from idempotency_keys where scope = $1 and key = $2", k.Scope, k.Key).StructScan(stored)
+		if err == sql.ErrNoRows {
+			// released by a failed request since the insert, the client can retry
+			return user.ErrIdempotencyKeyInProgress
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return stored, claimed, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request of the key, kept
+// until k.ExpiresAt
+func (us *UserStore) CompleteIdempotencyKey(ctx context.Context, k *user.IdempotencyKey) error {
+	return us.runKeys(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "update idempotency_keys set response = $3, completed_at = now(), expires_at = $4 where scope = $1 and key = $2", k.Scope, k.Key, k.Response, k.ExpiresAt)
+		return err
+	})
+}
+
+// ReleaseIdempotencyKey deletes a key whose request failed, so it can be retried
+func (us *UserStore) ReleaseIdempotencyKey(ctx context.Context, k *user.IdempotencyKey) error {
+	return us.runKeys(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "delete from idempotency_keys where scope = $1 and key = $2 and completed_at is null", k.Scope, k.Key)
+		return err
+	})
+}
+
+// PurgeIdempotencyKeys deletes the keys expired before the time
+func (us *UserStore) PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int, error) {
+	var n int64
+
+	err := us.runKeys(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "delete from idempotency_keys where expires_at < $1", before)
+		if err != nil {
+			return err
+		}
+
+		n, err = res.RowsAffected()
+		return err
+	})
+
+	return int(n), err
+}
+
+// runKeys executes fn like run in the system scope. The keys carry their own
+// scope and the requests without a access token have no tenant.
+func (us *UserStore) runKeys(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	return us.run(tenant.WithSystem(ctx), fn)
+}
@@ -0,0 +1,173 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ImportUsers copies the users into a temporary table and inserts them from
+// it with a single statement, which is much faster than a insert per user. It
+// returns the error of each user, nil for the imported ones and
+// user.ErrEmailTaken for the ones that already exist, so importing the same
+// users again is a no-op. With dryRun the transaction is rolled back.
+func (us *UserStore) ImportUsers(ctx context.Context, uu []*user.User, dryRun bool) ([]error, error) {
+	errs := make([]error, len(uu))
+
+	if len(uu) == 0 {
+		return errs, nil
+	}
+
+	tx, err := us.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `create temporary table import_users (
+		pos int not null,
+		id uuid not null default gen_random_uuid(),
+		email varchar(255) not null,
+		name varchar(255) not null,
+		last_name varchar(255) not null,
+		password varchar(255) not null
+	) on commit drop`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := copyImportUsers(ctx, tx, uu); err != nil {
+		return nil, err
+	}
+
+	orgID, scoped := tenant.FromContext(ctx)
+	if scoped {
+		// as in Create the memberships go first so the users are visible
+		// to the tenant, the ones of skipped users are removed below
+		_, err := tx.ExecContext(ctx, `insert into memberships (organization_id, user_id, role)
+			select $1, id, $2 from import_users`, orgID, user.OrgRoleMember)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	imported := make([]*user.User, 0, len(uu))
+
+	err = tx.SelectContext(ctx, &imported, `insert into users (id, email, name, last_name, password)
+		select id, email, name, last_name, password from import_users order by pos
+		on conflict (email) do nothing
+		returning *`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	byEmail := make(map[string]*user.User, len(imported))
+	for _, u := range imported {
+		byEmail[u.Email] = u
+	}
+
+	skipped := make([]string, 0)
+
+	for i, u := range uu {
+		created, ok := byEmail[strings.ToLower(u.Email)]
+		if !ok {
+			errs[i] = user.ErrEmailTaken
+			skipped = append(skipped, strings.ToLower(u.Email))
+			continue
+		}
+
+		*u = *created
+
+		if err := insertEvent(ctx, tx, user.EventUserCreated, nil, u); err != nil {
+			return nil, err
+		}
+		u.Roles = []string{user.DefaultRole}
+	}
+
+	if scoped && len(skipped) > 0 {
+		_, err := tx.ExecContext(ctx, `delete from memberships where organization_id = $1
+			and user_id in (select id from import_users where email = any($2))`, orgID, pq.Array(skipped))
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `insert into user_roles (user_id, role_id)
+		select u.id, r.id from import_users i
+		join users u on u.id = i.id
+		join roles r on r.name = $1
+		on conflict do nothing`, user.DefaultRole)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return errs, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+// copyImportUsers loads the users into import_users with COPY
+func copyImportUsers(ctx context.Context, tx *sqlx.Tx, uu []*user.User) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("import_users", "pos", "email", "name", "last_name", "password"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, u := range uu {
+		if _, err := stmt.ExecContext(ctx, i, strings.ToLower(u.Email), u.Name, u.LastName, u.Password); err != nil {
+			return err
+		}
+	}
+
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return err
+	}
+
+	return stmt.Close()
+}
+
+// ExportUsers returns up to limit users after the one with afterID, in order
+// of id, so a export reads every user once even while they change
+func (us *UserStore) ExportUsers(ctx context.Context, afterID string, limit uint64) ([]*user.User, error) {
+	query := squirrel.Select("*").From("users").Where("deleted_at is null").OrderBy("id").Limit(limit)
+
+	if afterID != "" {
+		query = query.Where("id > ?", afterID)
+	}
+
+	var uu []*user.User
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		uu = make([]*user.User, 0, limit)
+
+		sql, args, err := scopeSelect(ctx, query).PlaceholderFormat(squirrel.Dollar).ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.SelectContext(ctx, &uu, sql, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return uu, nil
+}
@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// OutboxChannel is notified with the id of every event written to the outbox
+const OutboxChannel = "outbox_events"
+
+// Listener wakes up the watchers of the outbox when Postgres notifies a new
+// event. Notifications are only a hint, watchers still read the outbox, so a
+// lost notification only delays a event until the next poll.
+type Listener struct {
+	listener *pq.Listener
+
+	mu   sync.Mutex
+	subs map[chan struct{}]struct{}
+}
+
+// NewListener ...
+func NewListener(dsn string) (*Listener, error) {
+	l := &Listener{
+		subs: make(map[chan struct{}]struct{}),
+	}
+
+	l.listener = pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println(fmt.Sprintf("[User Service][Listener][Error] %v", err.Error()))
+		}
+	})
+
+	if err := l.listener.Listen(OutboxChannel); err != nil {
+		l.listener.Close()
+		return nil, err
+	}
+
+	go l.run()
+
+	return l, nil
+}
+
+// Subscribe returns a channel signaled after new events, cancel must be called when done
+func (l *Listener) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	l.mu.Lock()
+	l.subs[ch] = struct{}{}
+	l.mu.Unlock()
+
+	return ch, func() {
+		l.mu.Lock()
+		delete(l.subs, ch)
+		l.mu.Unlock()
+	}
+}
+
+// Close ...
+func (l *Listener) Close() error {
+	return l.listener.Close()
+}
+
+func (l *Listener) run() {
+	// a nil notification is sent after reconnecting, waking everyone up is
+	// the right thing to do then too
+	for range l.listener.Notify {
+		l.mu.Lock()
+		for ch := range l.subs {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+		l.mu.Unlock()
+	}
+}
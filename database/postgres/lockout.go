@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/jmoiron/sqlx"
+)
+
+// RecordLoginFailure increments the failed logins of the user and returns the
+// new count, failures older than windowStart are forgotten.
+func (us *UserStore) RecordLoginFailure(ctx context.Context, userID string, at, windowStart time.Time) (int, error) {
+	var failures int
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowxContext(ctx, `update users set
+			failed_login_attempts = case when last_failed_login_at is null or last_failed_login_at < $3 then 1 else failed_login_attempts + 1 end,
+			last_failed_login_at = $2
+			where id = $1 and deleted_at is null returning failed_login_attempts`, userID, at, windowStart)
+
+		return row.Scan(&failures)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+// LockUser ...
+func (us *UserStore) LockUser(ctx context.Context, userID string, until time.Time) error {
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "update users set locked_until = greatest(locked_until, $2) where id = $1", userID, until)
+		return err
+	})
+}
+
+// ResetLoginFailures clears the failed logins and the lock of the user
+func (us *UserStore) ResetLoginFailures(ctx context.Context, userID string) (*user.User, error) {
+	u := &user.User{}
+
+	query := squirrel.Update("users").
+		Set("failed_login_attempts", 0).
+		Set("last_failed_login_at", nil).
+		Set("locked_until", nil).
+		Where("id = ? and deleted_at is null", userID)
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return updateUser(ctx, tx, query, u)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// GetIPBlockedUntil returns the time the address is blocked until, nil if it is not blocked
+func (us *UserStore) GetIPBlockedUntil(ctx context.Context, ip string) (*time.Time, error) {
+	var blockedUntil *time.Time
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, "select blocked_until from login_ip_throttles where ip = $1", ip).Scan(&blockedUntil)
+	})
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return blockedUntil, nil
+}
+
+// RecordIPFailure increments the failed logins of the address and returns the
+// new count, failures older than windowStart are forgotten.
+func (us *UserStore) RecordIPFailure(ctx context.Context, ip string, at, windowStart time.Time) (int, error) {
+	var failures int
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowxContext(ctx, `insert into login_ip_throttles (ip, failed_attempts, last_failed_at) values ($1, 1, $2)
+			on conflict (ip) do update set
+			failed_attempts = case when login_ip_throttles.last_failed_at < $3 then 1 else login_ip_throttles.failed_attempts + 1 end,
+			last_failed_at = $2
+			returning failed_attempts`, ip, at, windowStart)
+
+		return row.Scan(&failures)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+// BlockIP ...
+func (us *UserStore) BlockIP(ctx context.Context, ip string, until time.Time) error {
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "update login_ip_throttles set blocked_until = greatest(blocked_until, $2) where ip = $1", ip, until)
+		return err
+	})
+}
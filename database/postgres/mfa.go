@@ -0,0 +1,173 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/jmoiron/sqlx"
+)
+
+// SaveMFA stores a new unconfirmed enrollment, replacing a previous unconfirmed one
+func (us *UserStore) SaveMFA(ctx context.Context, m *user.MFA) error {
+	if m.UserID == "" {
+		return errors.New("must provide a user id")
+	}
+
+	query, args, err := squirrel.
+		Insert("user_mfa").
+		Columns("user_id", "secret").
+		Values(m.UserID, m.Secret).
+		Suffix("on conflict (user_id) do update set secret = excluded.secret, last_used_step = 0, created_at = now() where user_mfa.confirmed_at is null returning *").
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	err = us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, query, args...).StructScan(m)
+	})
+
+	if err == sql.ErrNoRows {
+		return user.ErrMFAAlreadyEnabled
+	}
+
+	return err
+}
+
+// GetMFA ...
+func (us *UserStore) GetMFA(ctx context.Context, userID string) (*user.MFA, error) {
+	if userID == "" {
+		return nil, errors.New("must provide a user id")
+	}
+
+	m := &user.MFA{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, "select * from user_mfa where user_id = $1", userID).StructScan(m)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrMFANotEnabled
+		}
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// ConfirmMFA enables the enrollment, replaces the recovery codes and flags the user in the same transaction
+func (us *UserStore) ConfirmMFA(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) (*user.User, error) {
+	u := &user.User{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "update user_mfa set confirmed_at = now(), last_used_step = $2 where user_id = $1 and confirmed_at is null and last_used_step < $2", userID, step)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return user.ErrInvalidMFACode
+		}
+
+		if _, err := tx.ExecContext(ctx, "delete from mfa_recovery_codes where user_id = $1", userID); err != nil {
+			return err
+		}
+
+		if len(recoveryCodeHashes) > 0 {
+			insert := squirrel.Insert("mfa_recovery_codes").Columns("user_id", "code_hash")
+			for _, hash := range recoveryCodeHashes {
+				insert = insert.Values(userID, hash)
+			}
+
+			query, args, err := insert.PlaceholderFormat(squirrel.Dollar).ToSql()
+			if err != nil {
+				return err
+			}
+
+			if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+				return err
+			}
+		}
+
+		return tx.QueryRowxContext(ctx, "update users set mfa_enabled_at = now() where id = $1 and deleted_at is null returning *", userID).StructScan(u)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// UseMFAStep records the step of a accepted TOTP code, failing if the same or a later step was already used
+func (us *UserStore) UseMFAStep(ctx context.Context, userID string, step int64) error {
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "update user_mfa set last_used_step = $2 where user_id = $1 and confirmed_at is not null and last_used_step < $2", userID, step)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return user.ErrInvalidMFACode
+		}
+
+		return nil
+	})
+}
+
+// UseRecoveryCode marks a recovery code as used, failing if it does not exist or was already used
+func (us *UserStore) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "update mfa_recovery_codes set used_at = now() where user_id = $1 and code_hash = $2 and used_at is null", userID, codeHash)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return user.ErrInvalidMFACode
+		}
+
+		return nil
+	})
+}
+
+// DeleteMFA removes the enrollment and recovery codes of the user
+func (us *UserStore) DeleteMFA(ctx context.Context, userID string) (*user.User, error) {
+	u := &user.User{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, "delete from mfa_recovery_codes where user_id = $1", userID); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "delete from user_mfa where user_id = $1", userID); err != nil {
+			return err
+		}
+
+		return tx.QueryRowxContext(ctx, "update users set mfa_enabled_at = null where id = $1 and deleted_at is null returning *", userID).StructScan(u)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
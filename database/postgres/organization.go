@@ -0,0 +1,239 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateOrganization creates the organization with the given user as its owner
+func (us *UserStore) CreateOrganization(ctx context.Context, o *user.Organization, ownerID string) error {
+	if o.Name == "" || o.Slug == "" {
+		return errors.New("must provide a name and slug")
+	}
+
+	if ownerID == "" {
+		return errors.New("must provide a owner id")
+	}
+
+	query, args, err := squirrel.
+		Insert("organizations").
+		Columns("name", "slug").
+		Values(o.Name, strings.ToLower(o.Slug)).
+		Suffix("returning *").
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.QueryRowxContext(ctx, query, args...).StructScan(o); err != nil {
+			if isUniqueViolation(err) {
+				return user.ErrSlugTaken
+			}
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, "insert into memberships (organization_id, user_id, role) values ($1, $2, $3)", o.ID, ownerID, user.OrgRoleOwner)
+		return err
+	})
+}
+
+// GetOrganization ...
+func (us *UserStore) GetOrganization(ctx context.Context, id string) (*user.Organization, error) {
+	if id == "" {
+		return nil, errors.New("must provide a id")
+	}
+
+	o := &user.Organization{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, "select * from organizations where id = $1 and deleted_at is null", id).StructScan(o)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// ListOrganizations returns the organizations the user is member of
+func (us *UserStore) ListOrganizations(ctx context.Context, userID string) ([]*user.Organization, error) {
+	var oo []*user.Organization
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		oo = make([]*user.Organization, 0)
+
+		return tx.SelectContext(ctx, &oo, `select o.* from organizations o
+			join memberships m on m.organization_id = o.id
+			where m.user_id = $1 and o.deleted_at is null
+			order by o.name`, userID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return oo, nil
+}
+
+// GetMembership ...
+func (us *UserStore) GetMembership(ctx context.Context, orgID, userID string) (*user.Membership, error) {
+	m := &user.Membership{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, "select * from memberships where organization_id = $1 and user_id = $2", orgID, userID).StructScan(m)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrNotMember
+		}
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// SetMemberRole changes the role of a existing member
+func (us *UserStore) SetMemberRole(ctx context.Context, orgID, userID, role string) (*user.Membership, error) {
+	m := &user.Membership{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		if role != user.OrgRoleOwner {
+			if err := checkNotLastOwner(ctx, tx, orgID, userID); err != nil {
+				return err
+			}
+		}
+
+		return tx.QueryRowxContext(ctx, "update memberships set role = $3 where organization_id = $1 and user_id = $2 returning *", orgID, userID, role).StructScan(m)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrNotMember
+		}
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// RemoveMember ...
+func (us *UserStore) RemoveMember(ctx context.Context, orgID, userID string) error {
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		if err := checkNotLastOwner(ctx, tx, orgID, userID); err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, "delete from memberships where organization_id = $1 and user_id = $2", orgID, userID)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return user.ErrNotMember
+		}
+
+		// the roles granted in the organization go with the membership
+		_, err = tx.ExecContext(ctx, "delete from user_roles where organization_id = $1 and user_id = $2", orgID, userID)
+		return err
+	})
+}
+
+// CreateInvitation ...
+func (us *UserStore) CreateInvitation(ctx context.Context, inv *user.Invitation) error {
+	if inv.OrganizationID == "" || inv.Email == "" {
+		return errors.New("must provide a organization id and email")
+	}
+
+	query, args, err := squirrel.
+		Insert("invitations").
+		Columns("organization_id", "email", "role", "token_hash", "invited_by", "expires_at").
+		Values(inv.OrganizationID, strings.ToLower(inv.Email), inv.Role, inv.TokenHash, inv.InvitedBy, inv.ExpiresAt).
+		Suffix("returning *").
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, query, args...).StructScan(inv)
+	})
+}
+
+// AcceptInvitation consumes the invitation and adds the user to the organization.
+// The invitation is only valid for the user registered with the invited email.
+func (us *UserStore) AcceptInvitation(ctx context.Context, tokenHash, userID string) (*user.Membership, error) {
+	m := &user.Membership{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		inv := &user.Invitation{}
+
+		row := tx.QueryRowxContext(ctx, `update invitations i set accepted_at = now()
+			from users u
+			where i.token_hash = $1 and i.accepted_at is null and i.expires_at > now()
+			and u.id = $2 and u.email = i.email and u.deleted_at is null
+			returning i.*`, tokenHash, userID)
+
+		if err := row.StructScan(inv); err != nil {
+			if err == sql.ErrNoRows {
+				return user.ErrInvalidToken
+			}
+			return err
+		}
+
+		row = tx.QueryRowxContext(ctx, `insert into memberships (organization_id, user_id, role) values ($1, $2, $3)
+			on conflict (organization_id, user_id) do update set role = memberships.role
+			returning *`, inv.OrganizationID, userID, inv.Role)
+
+		return row.StructScan(m)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// checkNotLastOwner fails if the user is the only owner of the organization,
+// the organization row is locked so concurrent changes can not remove both owners.
+func checkNotLastOwner(ctx context.Context, tx *sqlx.Tx, orgID, userID string) error {
+	if _, err := tx.ExecContext(ctx, "select id from organizations where id = $1 for update", orgID); err != nil {
+		return err
+	}
+
+	var isOwner bool
+	var owners int
+
+	row := tx.QueryRowxContext(ctx, `select
+		coalesce(bool_or(user_id = $2), false),
+		count(*)
+		from memberships where organization_id = $1 and role = $3`, orgID, userID, user.OrgRoleOwner)
+
+	if err := row.Scan(&isOwner, &owners); err != nil {
+		return err
+	}
+
+	if isOwner && owners <= 1 {
+		return user.ErrLastOwner
+	}
+
+	return nil
+}
@@ -0,0 +1,242 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// eventColumns reads a missing before as a empty document instead of null
+const eventColumns = "id, type, user_id, payload, coalesce(before::text, '') as before, attempts, last_error, created_at, published_at, parked_at, txid::text::bigint as txid"
+
+// insertEvent writes a event of the user into the outbox and its audit log, it must
+// run in the transaction of the change so the event exists if and only if the change does
+func insertEvent(ctx context.Context, tx *sqlx.Tx, eventType string, before, after *user.User) error {
+	if err := insertAudit(ctx, tx, eventType, before, after); err != nil {
+		return err
+	}
+
+	e, err := user.NewEvent(eventType, before, after)
+	if err != nil {
+		return err
+	}
+
+	query, args, err := squirrel.
+		Insert("outbox").
+		Columns("type", "user_id", "payload", "before").
+		Values(e.Type, e.UserID, []byte(e.Payload), nullJSON(e.Before)).
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// outboxLease is the time the events claimed by a relay are hidden from the
+// other relays, a relay that dies releases them when it runs out
+const outboxLease = 5 * time.Minute
+
+// ProcessOutbox hands the oldest unpublished events to fn, in order, and marks
+// the ones it accepted as published. The batch is claimed for outboxLease in a
+// short transaction and fn runs outside of it, so several relays can run at
+// once without holding locks during the I/O of the sink. The claims are taken
+// one relay at a time and skip the users with claimed events, so the events
+// of a user are published by a single relay in order. A event is published
+// again if the process dies before it is marked, or fn outlasts the lease,
+// consumers must deduplicate by id.
+//
+// When fn fails the later events of the same user wait, the events of other
+// users go on. A event that failed maxAttempts times is parked with the
+// events of its user until its parked_at is cleared. The first error of fn
+// is returned along with the count of published events.
+func (us *UserStore) ProcessOutbox(ctx context.Context, limit, maxAttempts int, fn func(*user.Event) error) (int, error) {
+	ee, err := us.claimOutbox(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		published int
+		failed    error
+		waiting   []int64
+	)
+
+	blocked := make(map[string]bool)
+
+	for _, e := range ee {
+		if blocked[e.UserID] {
+			waiting = append(waiting, e.ID)
+			continue
+		}
+
+		if err := fn(e); err != nil {
+			// later events of the user wait so it keeps the order of its events
+			blocked[e.UserID] = true
+			if failed == nil {
+				failed = fmt.Errorf("event %v: %w", e.ID, err)
+			}
+
+			msg := err.Error()
+			err := us.run(ctx, func(tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx, `update outbox set attempts = attempts + 1, last_error = $2, claimed_until = null,
+					parked_at = case when attempts + 1 >= $3 then now() end where id = $1`, e.ID, msg, maxAttempts)
+				return err
+			})
+
+			if err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		err := us.run(ctx, func(tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, "update outbox set published_at = now(), attempts = attempts + 1, last_error = null, claimed_until = null where id = $1", e.ID)
+			return err
+		})
+
+		if err != nil {
+			return published, err
+		}
+
+		published++
+	}
+
+	if len(waiting) > 0 {
+		err := us.run(ctx, func(tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, "update outbox set claimed_until = null where id = any($1)", pq.Array(waiting))
+			return err
+		})
+
+		if err != nil {
+			return published, err
+		}
+	}
+
+	return published, failed
+}
+
+// claimOutbox claims the oldest unpublished events of the users without
+// parked or claimed events, in order of id
+func (us *UserStore) claimOutbox(ctx context.Context, limit int) ([]*user.Event, error) {
+	var ee []*user.Event
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		ee = make([]*user.Event, 0)
+
+		// a claim running at the same time could not see the events of this
+		// one until it commits, so they take turns
+		if _, err := tx.ExecContext(ctx, "select pg_advisory_xact_lock(hashtext('users-api.outbox'))"); err != nil {
+			return err
+		}
+
+		return tx.SelectContext(ctx, &ee, `with claimed as (
+			update outbox set claimed_until = now() + $2 * interval '1 millisecond'
+			where id in (
+				select o.id from outbox o where o.published_at is null and o.parked_at is null
+				and not exists (select 1 from outbox p where p.user_id = o.user_id and p.published_at is null
+					and (p.parked_at is not null or p.claimed_until > now()))
+				order by o.id limit $1
+			)
+			returning `+eventColumns+`
+		)
+		select * from claimed order by id`, limit, outboxLease.Milliseconds())
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ee, nil
+}
+
+// ListEvents returns the events of the outbox in order, in a tenant scope
+// only the events of its members are returned.
+//
+// Ids are taken before the transactions commit, so a event can commit after
+// events with a higher id were read. Events are read instead in order of the
+// transaction that wrote them, and only once every transaction before it
+// ended, so a later event always comes after the ones already read. A long
+// transaction holds back the events written after it started.
+func (us *UserStore) ListEvents(ctx context.Context, f *user.EventFilter) ([]*user.Event, error) {
+	query := squirrel.Select(eventColumns).From("outbox").
+		Where("(txid, id) > (?::text::xid8, ?)", f.AfterTxID, f.AfterID).
+		Where("txid < pg_snapshot_xmin(pg_current_snapshot())").
+		OrderBy("txid", "id")
+
+	if len(f.UserIDs) > 0 {
+		query = query.Where("user_id = any(?)", pq.Array(f.UserIDs))
+	}
+
+	if len(f.Types) > 0 {
+		query = query.Where("type = any(?)", pq.Array(f.Types))
+	}
+
+	if f.Limit > 0 {
+		query = query.Limit(f.Limit)
+	}
+
+	if orgID, ok := tenant.FromContext(ctx); ok {
+		query = query.Where("exists (select 1 from memberships m where m.user_id = outbox.user_id and m.organization_id = ?)", orgID)
+	}
+
+	var ee []*user.Event
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		ee = make([]*user.Event, 0)
+
+		sql, args, err := query.PlaceholderFormat(squirrel.Dollar).ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.SelectContext(ctx, &ee, sql, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ee, nil
+}
+
+// EventsHead returns the position of the last event ListEvents can read, the
+// events after it are read with it as EventFilter.AfterTxID and AfterID
+func (us *UserStore) EventsHead(ctx context.Context) (int64, int64, error) {
+	var txID, id int64
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowxContext(ctx, `select txid::text::bigint, id from outbox
+			where txid < pg_snapshot_xmin(pg_current_snapshot())
+			order by txid desc, id desc limit 1`)
+
+		if err := row.Scan(&txID, &id); err != sql.ErrNoRows {
+			return err
+		}
+		return nil
+	})
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return txID, id, nil
+}
+
+// nullJSON stores a empty document as null
+func nullJSON(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ListRoles returns every role with its permissions
+func (us *UserStore) ListRoles(ctx context.Context) ([]*user.Role, error) {
+	var roles []*user.Role
+
+	err := us.runRead(ctx, func(tx *sqlx.Tx) error {
+		roles = make([]*user.Role, 0)
+		if err := tx.SelectContext(ctx, &roles, "select * from roles order by name"); err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryxContext(ctx, "select rp.role_id, p.name from role_permissions rp join permissions p on p.id = rp.permission_id order by p.name")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		byID := make(map[string]*user.Role, len(roles))
+		for _, r := range roles {
+			r.Permissions = make([]string, 0)
+			byID[r.ID] = r
+		}
+
+		for rows.Next() {
+			var roleID, permission string
+			if err := rows.Scan(&roleID, &permission); err != nil {
+				return err
+			}
+
+			if r, ok := byID[roleID]; ok {
+				r.Permissions = append(r.Permissions, permission)
+			}
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// GetUserRoles returns the role names of each of the given users, the roles
+// granted in the tenant of the context and the ones granted outside of any
+// tenant
+func (us *UserStore) GetUserRoles(ctx context.Context, userIDs ...string) (map[string][]string, error) {
+	roles := make(map[string][]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return roles, nil
+	}
+
+	err := us.runRead(ctx, func(tx *sqlx.Tx) error {
+		roles = make(map[string][]string, len(userIDs))
+
+		rows, err := tx.QueryxContext(ctx, `select ur.user_id, r.name from user_roles ur join roles r on r.id = ur.role_id
+			where ur.user_id = any($1) and (ur.organization_id is null or ur.organization_id = $2)
+			order by r.name`, pq.Array(userIDs), roleOrganization(ctx))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var userID, role string
+			if err := rows.Scan(&userID, &role); err != nil {
+				return err
+			}
+
+			roles[userID] = append(roles[userID], role)
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// AssignRole ...
+func (us *UserStore) AssignRole(ctx context.Context, userID, role string) error {
+	if userID == "" {
+		return errors.New("must provide a user id")
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		id, err := roleID(ctx, tx, role)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "insert into user_roles (user_id, role_id, organization_id) values ($1, $2, $3) on conflict do nothing", userID, id, roleOrganization(ctx))
+		return err
+	})
+}
+
+// RevokeRole ...
+func (us *UserStore) RevokeRole(ctx context.Context, userID, role string) error {
+	if userID == "" {
+		return errors.New("must provide a user id")
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		id, err := roleID(ctx, tx, role)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "delete from user_roles where user_id = $1 and role_id = $2 and organization_id is not distinct from $3", userID, id, roleOrganization(ctx))
+		return err
+	})
+}
+
+// HasPermission reports whether any role of the user grants the permission
+func (us *UserStore) HasPermission(ctx context.Context, userID, permission string) (bool, error) {
+	var allowed bool
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowxContext(ctx, `select exists (
+			select 1 from user_roles ur
+			join role_permissions rp on rp.role_id = ur.role_id
+			join permissions p on p.id = rp.permission_id
+			join users u on u.id = ur.user_id
+			where ur.user_id = $1 and p.name = $2 and u.deleted_at is null
+			and (ur.organization_id is null or ur.organization_id = $3)
+		)`, userID, permission, roleOrganization(ctx))
+
+		return row.Scan(&allowed)
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return allowed, nil
+}
+
+// roleOrganization returns the organization the roles are granted and
+// checked in, the tenant of the context. Outside of a tenant it is nil, the
+// roles granted there apply in every organization.
+func roleOrganization(ctx context.Context) interface{} {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return id
+	}
+	return nil
+}
+
+func roleID(ctx context.Context, tx *sqlx.Tx, role string) (string, error) {
+	var id string
+
+	if err := tx.QueryRowxContext(ctx, "select id from roles where name = $1", role).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return "", user.ErrRoleNotFound
+		}
+		return "", err
+	}
+
+	return id, nil
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultHealthInterval is the time between health checks of the replicas
+const DefaultHealthInterval = 5 * time.Second
+
+// Replicas are read only copies of the primary database. Reads are spread
+// between the healthy ones in turns, a replica that fails a health check
+// or a query is skipped until it passes a check again.
+type Replicas struct {
+	Interval time.Duration
+
+	dbs  []*replica
+	next atomic.Uint64
+}
+
+type replica struct {
+	db      *sqlx.DB
+	name    string
+	healthy atomic.Bool
+}
+
+// NewReplicas connects lazily to the replicas, they are unhealthy until the
+// first check of Run
+func NewReplicas(dsns []string, pool Pool) (*Replicas, error) {
+	r := &Replicas{Interval: DefaultHealthInterval}
+
+	for i, dsn := range dsns {
+		db, err := sqlx.Open("postgres", dsn)
+		if err != nil {
+			return nil, err
+		}
+		pool.Apply(db)
+
+		r.dbs = append(r.dbs, &replica{db: db, name: fmt.Sprintf("replica %v", i)})
+	}
+
+	return r, nil
+}
+
+// Run checks the health of the replicas every Interval until the context is canceled
+func (r *Replicas) Run(ctx context.Context) error {
+	for {
+		for _, rep := range r.dbs {
+			r.check(ctx, rep)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.Interval):
+		}
+	}
+}
+
+func (r *Replicas) check(ctx context.Context, rep *replica) {
+	ctx, cancel := context.WithTimeout(ctx, r.Interval)
+	defer cancel()
+
+	// a replica that was promoted is no longer read only
+	var recovering bool
+	err := rep.db.QueryRowContext(ctx, "select pg_is_in_recovery()").Scan(&recovering)
+	if err == nil && !recovering {
+		err = fmt.Errorf("not in recovery")
+	}
+
+	healthy := err == nil
+	if rep.healthy.Swap(healthy) != healthy {
+		if healthy {
+			log.Println(fmt.Sprintf("[User Service][Replicas] %v is healthy", rep.name))
+		} else {
+			log.Println(fmt.Sprintf("[User Service][Replicas][Error] %v is unhealthy: %v", rep.name, err))
+		}
+	}
+}
+
+// pick returns the next healthy replica, nil if there is none
+func (r *Replicas) pick() *replica {
+	if r == nil {
+		return nil
+	}
+
+	n := uint64(len(r.dbs))
+	for i := uint64(0); i < n; i++ {
+		rep := r.dbs[r.next.Add(1)%n]
+		if rep.healthy.Load() {
+			return rep
+		}
+	}
+
+	return nil
+}
+
+// fail marks a replica unhealthy after a failed query, until the next check
+func (r *Replicas) fail(rep *replica, err error) {
+	if rep.healthy.Swap(false) {
+		log.Println(fmt.Sprintf("[User Service][Replicas][Error] %v is unhealthy: %v", rep.name, err))
+	}
+}
@@ -0,0 +1,266 @@
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Pool configures the connections kept to a database, zero values keep the
+// defaults of database/sql
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Apply ...
+func (p Pool) Apply(db *sqlx.DB) {
+	if p.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(p.MaxOpenConns)
+	}
+
+	if p.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+
+	if p.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+
+	if p.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+	}
+}
+
+// Connect opens the database and waits until it answers, retrying with
+// exponential backoff for up to timeout, so the service can start before
+// the database does
+func Connect(ctx context.Context, dsn string, pool Pool, timeout time.Duration) (*sqlx.DB, error) {
+	db, err := sqlx.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	pool.Apply(db)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	retry := Retry{BaseDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second}
+
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return db, nil
+		}
+
+		delay := retry.Delay(attempt)
+		log.Println(fmt.Sprintf("[User Service][Postgres][Error] connecting, attempt %v, retrying in %v: %v", attempt, delay, err))
+
+		select {
+		case <-ctx.Done():
+			db.Close()
+			return nil, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Retry runs the transactions that fail with a transient error again, up to
+// Attempts times in total, waiting BaseDelay doubled on each attempt up to
+// MaxDelay. A zero Retry runs them once.
+type Retry struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetry ...
+var DefaultRetry = Retry{Attempts: 3, BaseDelay: 50 * time.Millisecond, MaxDelay: time.Second}
+
+// Delay returns how long to wait after the given attempt
+func (r Retry) Delay(attempt int) time.Duration {
+	d := r.BaseDelay << uint(attempt-1)
+	if d <= 0 || d > r.MaxDelay {
+		return r.MaxDelay
+	}
+	return d
+}
+
+// commitError is a error of a commit, where a lost connection leaves the
+// transaction committed or not
+type commitError struct {
+	err error
+}
+
+func (e *commitError) Error() string {
+	return e.err.Error()
+}
+
+// retry calls fn until it succeeds, fails with a error that is not
+// transient or runs out of attempts. A connection lost on commit is only
+// retried for reads, a write may have been applied.
+func (us *UserStore) retry(ctx context.Context, read bool, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+
+		var cerr *commitError
+		if errors.As(err, &cerr) {
+			err = cerr.err
+			if !read && isConnError(err) {
+				return err
+			}
+		}
+
+		if err == nil || !IsTransient(err) || attempt >= us.Retry.Attempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(us.Retry.Delay(attempt)):
+		}
+	}
+}
+
+// IsTransient reports whether a query that failed with err can succeed if
+// run again: serialization failures, deadlocks and lost connections
+func IsTransient(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "40001", "40P01":
+			return true
+		}
+	}
+
+	return isConnError(err)
+}
+
+// isCanceled reports whether err comes from the context of the request or
+// its statement being canceled
+func isCanceled(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014"
+}
+
+// isConnError reports whether err is a failure of the connection or the
+// server rather than of the query
+func isConnError(err error) bool {
+	if isCanceled(err) {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// connection exceptions, operator interventions like a shutdown, and
+	// too many connections
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		class := pqErr.Code.Class()
+		return class == "08" || class == "57" || pqErr.Code == "53300"
+	}
+
+	return false
+}
+
+// Breaker stops sending queries to a database that is down. After
+// Threshold transactions in a row fail to start it opens and fails every
+// transaction with user.ErrUnavailable for Cooldown, then lets a single one
+// through to check if the database is back. A Threshold of 0 disables it.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker ...
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+	}
+}
+
+// Allow returns user.ErrUnavailable while the breaker is open
+func (b *Breaker) Allow() error {
+	if b == nil || b.Threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.Threshold {
+		return nil
+	}
+
+	if b.probing || time.Now().Sub(b.openedAt) < b.Cooldown {
+		return user.ErrUnavailable
+	}
+
+	b.probing = true
+	return nil
+}
+
+// Record counts the connection failures in a row, any other outcome closes
+// the breaker. A canceled request says nothing of the database, it is not
+// counted and a probe that was canceled lets the next request probe.
+func (b *Breaker) Record(err error) {
+	if b == nil || b.Threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	if isCanceled(err) {
+		return
+	}
+
+	if err == nil || !isConnError(err) {
+		if b.failures >= b.Threshold {
+			log.Println("[User Service][Database] circuit breaker closed")
+		}
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.Threshold {
+		if b.failures == b.Threshold {
+			log.Println(fmt.Sprintf("[User Service][Database][Error] circuit breaker open: %v", err))
+		}
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/lib/pq"
+)
+
+func TestBreakerIgnoresCanceledRequests(t *testing.T) {
+	b := NewBreaker(2, time.Hour)
+
+	b.Record(driver.ErrBadConn)
+	b.Record(context.Canceled)
+	b.Record(fmt.Errorf("begin: %w", context.DeadlineExceeded))
+	b.Record(&pq.Error{Code: "57014"})
+
+	// the failure before the cancellations is still counted
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow after a failure = %v, want nil", err)
+	}
+
+	b.Record(driver.ErrBadConn)
+	if err := b.Allow(); err != user.ErrUnavailable {
+		t.Fatalf("Allow after %v failures = %v, want %v", b.Threshold, err, user.ErrUnavailable)
+	}
+}
+
+func TestBreakerProbesAgainAfterACanceledProbe(t *testing.T) {
+	b := NewBreaker(1, time.Millisecond)
+
+	b.Record(driver.ErrBadConn)
+	time.Sleep(2 * time.Millisecond)
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow after the cooldown = %v, want the probe through", err)
+	}
+
+	b.Record(context.Canceled)
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow after a canceled probe = %v, want another probe through", err)
+	}
+
+	b.Record(nil)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow after a successful probe = %v, want the breaker closed", err)
+	}
+}
+
+func TestCanceledQueriesAreNotTransient(t *testing.T) {
+	if IsTransient(&pq.Error{Code: "57014"}) {
+		t.Fatal("a canceled statement is retried")
+	}
+
+	if !IsTransient(&pq.Error{Code: "57P01"}) {
+		t.Fatal("a terminated connection is not retried")
+	}
+}
@@ -0,0 +1,25 @@
+package postgres_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/frperezr/microservices-demo/src/users-api/database"
+	"github.com/frperezr/microservices-demo/src/users-api/database/storetest"
+)
+
+// TestStore runs against the database of TEST_POSTGRES_DSN, it must have the
+// migrations applied and the role must not bypass row level security
+func TestStore(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	store, err := database.NewPostgres(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storetest.Run(t, store)
+}
@@ -0,0 +1,185 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/consistency"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// memberOfTenant restricts a query over users to the members of the tenant
+const memberOfTenant = "exists (select 1 from memberships m where m.user_id = users.id and m.organization_id = ?)"
+
+// run executes fn in a transaction scoped to the tenant of the context. The
+// scope is set with set_config(..., true), the parameterized form of SET LOCAL,
+// so the row level security policies of the tables apply to every statement.
+//
+// A transaction that fails with a transient error is run again, see Retry,
+// so fn must only change the database through tx.
+func (us *UserStore) run(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	return us.retry(ctx, false, func() error {
+		tx, err := us.begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return &commitError{err}
+		}
+
+		return nil
+	})
+}
+
+// runRead executes fn like run on a replica, or on the primary when there is
+// no healthy replica or the context must read the primary. A replica that
+// fails is retried on the primary.
+func (us *UserStore) runRead(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	rep := us.Replicas.pick()
+
+	if rep != nil && !consistency.ReadPrimary(ctx) {
+		tx, err := rep.db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err == nil {
+			err = readOnly(ctx, tx, fn)
+		}
+
+		if err == nil || err == sql.ErrNoRows || ctx.Err() != nil {
+			return err
+		}
+
+		if isConnError(err) {
+			us.Replicas.fail(rep, err)
+		}
+	}
+
+	// a read can always run again, even if the connection is lost on commit
+	return us.retry(ctx, true, func() error {
+		tx, err := us.beginPrimary(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+
+		return readOnly(ctx, tx, fn)
+	})
+}
+
+// readOnly executes fn in the read only transaction scoped like run
+func readOnly(ctx context.Context, tx *sqlx.Tx, fn func(tx *sqlx.Tx) error) error {
+	defer tx.Rollback()
+
+	if err := setScope(ctx, tx); err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// begin starts a transaction scoped to the tenant of the context
+func (us *UserStore) begin(ctx context.Context) (*sqlx.Tx, error) {
+	tx, err := us.beginPrimary(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the reads of runRead can go to a replica, every other
+	// transaction counts as a write for the reads that follow it
+	consistency.MarkWrite(ctx)
+
+	if err := setScope(ctx, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// beginPrimary starts a transaction on the primary unless the breaker is open
+func (us *UserStore) beginPrimary(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	if err := us.Breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	// a transaction that starts proves the database is reachable
+	tx, err := us.Store.BeginTxx(ctx, opts)
+	us.Breaker.Record(err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+func setScope(ctx context.Context, tx *sqlx.Tx) error {
+	if id, ok := tenant.FromContext(ctx); ok {
+		_, err := tx.ExecContext(ctx, "select set_config('app.tenant_id', $1, true)", id)
+		return err
+	}
+
+	if tenant.IsSystem(ctx) {
+		_, err := tx.ExecContext(ctx, "select set_config('app.bypass_tenant', 'on', true)")
+		return err
+	}
+
+	return tenant.ErrMissing
+}
+
+// scopeSelect adds the tenant of the context to a query over users
+func scopeSelect(ctx context.Context, q squirrel.SelectBuilder) squirrel.SelectBuilder {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return q.Where(memberOfTenant, id)
+	}
+	return q
+}
+
+// scopeUpdate adds the tenant of the context to a update of users
+func scopeUpdate(ctx context.Context, q squirrel.UpdateBuilder) squirrel.UpdateBuilder {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return q.Where(memberOfTenant, id)
+	}
+	return q
+}
+
+// getUser runs a scoped select over users returning a single row
+func getUser(ctx context.Context, tx *sqlx.Tx, q squirrel.SelectBuilder) (*user.User, error) {
+	sql, args, err := scopeSelect(ctx, q).PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	u := &user.User{}
+
+	if err := tx.QueryRowxContext(ctx, sql, args...).StructScan(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// lockUser returns the current row of the user locking it until the end of the transaction
+func lockUser(ctx context.Context, tx *sqlx.Tx, id string) (*user.User, error) {
+	return getUser(ctx, tx, squirrel.Select("*").From("users").Where("id = ?", id).Suffix("for update"))
+}
+
+// updateUser runs a scoped update over users returning the updated row into u
+func updateUser(ctx context.Context, tx *sqlx.Tx, q squirrel.UpdateBuilder, u *user.User) error {
+	sql, args, err := scopeUpdate(ctx, q).Suffix("returning *").PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return err
+	}
+
+	return tx.QueryRowxContext(ctx, sql, args...).StructScan(u)
+}
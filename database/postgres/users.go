@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"strings"
@@ -8,90 +9,238 @@ import (
 
 	"github.com/Masterminds/squirrel"
 	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // UserStore ...
 type UserStore struct {
 	Store *sqlx.DB
+
+	// Replicas serve GetByID, GetByEmail and List when set
+	Replicas *Replicas
+
+	// Retry runs again the transactions that fail with a transient error,
+	// Breaker fails them fast while the database is down
+	Retry   Retry
+	Breaker *Breaker
 }
 
 // GetByID ...
-func (us *UserStore) GetByID(id string) (*user.User, error) {
+func (us *UserStore) GetByID(ctx context.Context, id string) (*user.User, error) {
 	if id == "" {
 		return nil, errors.New("must provide a id")
 	}
 
-	query := squirrel.Select("*").From("users").Where("id = ? and deleted_at is null", id)
+	var c *user.User
+
+	err := us.runRead(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		c, err = getUser(ctx, tx, squirrel.Select("*").From("users").Where("id = ? and deleted_at is null", id))
+		return err
+	})
 
-	sql, args, err := query.PlaceholderFormat(squirrel.Dollar).ToSql()
 	if err != nil {
 		return nil, err
 	}
 
-	row := us.Store.QueryRowx(sql, args...)
+	return c, nil
+}
+
+// GetByIDs returns the users with the given ids, in any order. Missing and
+// deleted users are left out.
+func (us *UserStore) GetByIDs(ctx context.Context, ids []string) ([]*user.User, error) {
+	uu := make([]*user.User, 0, len(ids))
+
+	if len(ids) == 0 {
+		return uu, nil
+	}
+
+	query := squirrel.Select("*").From("users").Where("id = any(?) and deleted_at is null", pq.Array(ids))
 
-	c := &user.User{}
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		uu = uu[:0]
 
-	if err := row.StructScan(c); err != nil {
+		sql, args, err := scopeSelect(ctx, query).PlaceholderFormat(squirrel.Dollar).ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.SelectContext(ctx, &uu, sql, args...)
+	})
+
+	if err != nil {
 		return nil, err
 	}
 
-	return c, nil
+	return uu, nil
 }
 
 // GetByEmail ...
-func (us *UserStore) GetByEmail(email string) (*user.User, error) {
+func (us *UserStore) GetByEmail(ctx context.Context, email string) (*user.User, error) {
 	if email == "" {
 		return nil, errors.New("must provide a email")
 	}
 
-	query := squirrel.Select("*").From("users").Where("email = ? and deleted_at is null", email)
+	var c *user.User
+
+	err := us.runRead(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		c, err = getUser(ctx, tx, squirrel.Select("*").From("users").Where("email = ? and deleted_at is null", email))
+		return err
+	})
 
-	sql, args, err := query.PlaceholderFormat(squirrel.Dollar).ToSql()
 	if err != nil {
 		return nil, err
 	}
 
-	row := us.Store.QueryRowx(sql, args...)
+	return c, nil
+}
 
-	c := &user.User{}
+// Create inserts the user with the default role, when the context has a
+// tenant the user is added as a member of it in the same transaction.
+func (us *UserStore) Create(ctx context.Context, u *user.User) error {
+	if u.Email == "" {
+		return errors.New("must provide a email")
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		return createUser(ctx, tx, u)
+	})
+}
 
-	if err := row.StructScan(c); err != nil {
+// errBatchRollback discards the transaction of a all-or-nothing batch
+var errBatchRollback = errors.New("batch rolled back")
+
+// BatchCreate inserts the users in a single transaction, returning the error
+// of each one, nil for the created users. A failed user is skipped unless
+// atomic is set, then nothing is created and the other users fail with
+// user.ErrBatchAborted.
+func (us *UserStore) BatchCreate(ctx context.Context, uu []*user.User, atomic bool) ([]error, error) {
+	var errs []error
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		// the transaction runs again when it fails with a transient error
+		errs = make([]error, len(uu))
+
+		for i, u := range uu {
+			if u.Email == "" {
+				errs[i] = errors.New("must provide a email")
+			} else if err := createSavepoint(ctx, tx, u); err != nil {
+				if _, ok := err.(*batchError); !ok {
+					return err
+				}
+				errs[i] = err.(*batchError).err
+			}
+
+			if errs[i] != nil && atomic {
+				for j := range errs {
+					if j != i {
+						errs[j] = user.ErrBatchAborted
+					}
+				}
+				return errBatchRollback
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil && err != errBatchRollback {
 		return nil, err
 	}
 
-	return c, nil
+	return errs, nil
 }
 
-// Create ...
-func (us *UserStore) Create(u *user.User) error {
-	if u.Email == "" {
-		return errors.New("must provide a email")
+// batchError is the failure of a single user of a batch
+type batchError struct {
+	err error
+}
+
+func (e *batchError) Error() string {
+	return e.err.Error()
+}
+
+// createSavepoint creates the user inside a savepoint, so its failure leaves
+// the transaction usable for the rest of the batch
+func createSavepoint(ctx context.Context, tx *sqlx.Tx, u *user.User) error {
+	if _, err := tx.ExecContext(ctx, "savepoint batch_create"); err != nil {
+		return err
+	}
+
+	if err := createUser(ctx, tx, u); err != nil {
+		if _, err := tx.ExecContext(ctx, "rollback to savepoint batch_create"); err != nil {
+			return err
+		}
+		return &batchError{err}
 	}
 
-	sql, args, err := squirrel.
-		Insert("users").
-		Columns("email", "name", "last_name", "password").
-		Values(strings.ToLower(u.Email), u.Name, u.LastName, u.Password).
-		Suffix("returning *").
-		PlaceholderFormat(squirrel.Dollar).
-		ToSql()
+	_, err := tx.ExecContext(ctx, "release savepoint batch_create")
+	return err
+}
+
+func createUser(ctx context.Context, tx *sqlx.Tx, u *user.User) error {
+	query := squirrel.Insert("users")
+
+	if orgID, ok := tenant.FromContext(ctx); ok {
+		// the membership goes first so the new row is visible to the
+		// tenant, its foreign key to users is checked at commit
+		var id string
+		if err := tx.QueryRowxContext(ctx, "select gen_random_uuid()").Scan(&id); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "insert into memberships (organization_id, user_id, role) values ($1, $2, $3)", orgID, id, user.OrgRoleMember); err != nil {
+			return err
+		}
+
+		query = query.
+			Columns("id", "email", "name", "last_name", "password").
+			Values(id, strings.ToLower(u.Email), u.Name, u.LastName, u.Password)
+	} else {
+		query = query.
+			Columns("email", "name", "last_name", "password").
+			Values(strings.ToLower(u.Email), u.Name, u.LastName, u.Password)
+	}
 
+	sql, args, err := query.Suffix("returning *").PlaceholderFormat(squirrel.Dollar).ToSql()
 	if err != nil {
 		return err
 	}
 
-	row := us.Store.QueryRowx(sql, args...)
+	row := tx.QueryRowxContext(ctx, sql, args...)
 	if err := row.StructScan(u); err != nil {
+		if isUniqueViolation(err) {
+			return user.ErrEmailTaken
+		}
+		return err
+	}
+
+	if err := assignDefaultRole(ctx, tx, u.ID); err != nil {
+		return err
+	}
+
+	if err := insertEvent(ctx, tx, user.EventUserCreated, nil, u); err != nil {
 		return err
 	}
 
+	u.Roles = []string{user.DefaultRole}
 	return nil
 }
 
+// assignDefaultRole grants user.DefaultRole to a user created in the transaction
+func assignDefaultRole(ctx context.Context, tx *sqlx.Tx, userID string) error {
+	_, err := tx.ExecContext(ctx, `insert into user_roles (user_id, role_id)
+		select $1, id from roles where name = $2
+		on conflict do nothing`, userID, user.DefaultRole)
+
+	return err
+}
+
 // Update ...
-func (us *UserStore) Update(u *user.User) error {
+func (us *UserStore) Update(ctx context.Context, u *user.User) error {
 	if u.ID == "" {
 		return errors.New("must provide a id")
 	}
@@ -99,7 +248,10 @@ func (us *UserStore) Update(u *user.User) error {
 	query := squirrel.Update("users")
 
 	if u.Email != "" {
-		query = query.Set("email", strings.ToLower(u.Email))
+		email := strings.ToLower(u.Email)
+		query = query.
+			Set("email", email).
+			Set("email_verified_at", squirrel.Expr("case when email = ? then email_verified_at end", email))
 	}
 
 	if u.Name != "" {
@@ -114,33 +266,121 @@ func (us *UserStore) Update(u *user.User) error {
 		query = query.Set("password", u.Password)
 	}
 
-	sql, args, err := query.Where("id = ? and deleted_at is null", u.ID).Suffix("returning *").PlaceholderFormat(squirrel.Dollar).ToSql()
-	if err != nil {
-		return nil
-	}
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		before, err := lockUser(ctx, tx, u.ID)
+		if err != nil {
+			return err
+		}
 
-	row := us.Store.QueryRowx(sql, args...)
-	if err := row.StructScan(u); err != nil {
-		return err
-	}
+		if err := updateUser(ctx, tx, query.Where("id = ? and deleted_at is null", u.ID), u); err != nil {
+			if isUniqueViolation(err) {
+				return user.ErrEmailTaken
+			}
+			return err
+		}
 
-	return nil
+		return insertEvent(ctx, tx, user.EventUserUpdated, before, u)
+	})
 }
 
 // Delete ...
-func (us *UserStore) Delete(id string) error {
+func (us *UserStore) Delete(ctx context.Context, id string) error {
 	if id == "" {
 		return errors.New("must provide a id")
 	}
 
-	c := &user.User{}
+	query := squirrel.Update("users").Set("deleted_at", time.Now()).Where("id = ? and deleted_at is null", id)
 
-	row := us.Store.QueryRowx("update users set deleted_at = $1 where id = $2", time.Now(), id)
-	if err := row.StructScan(c); err != nil {
-		if err == sql.ErrNoRows {
-			return nil
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		before, err := lockUser(ctx, tx, id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
 		}
-		return err
+
+		u := &user.User{}
+
+		if err := updateUser(ctx, tx, query, u); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+
+		return insertEvent(ctx, tx, user.EventUserDeleted, before, u)
+	})
+}
+
+// Restore undoes the deletion of a user
+func (us *UserStore) Restore(ctx context.Context, id string) (*user.User, error) {
+	if id == "" {
+		return nil, errors.New("must provide a id")
 	}
-	return nil
+
+	query := squirrel.Update("users").Set("deleted_at", nil).Where("id = ? and deleted_at is not null", id)
+
+	u := &user.User{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		before, err := lockUser(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := updateUser(ctx, tx, query, u); err != nil {
+			return err
+		}
+
+		return insertEvent(ctx, tx, user.EventUserRestored, before, u)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// List ...
+func (us *UserStore) List(ctx context.Context, opts *user.ListOptions) ([]*user.User, error) {
+	query := squirrel.Select("*").From("users").Where("deleted_at is null").OrderBy("created_at desc")
+
+	if opts != nil {
+		if opts.Verified != nil {
+			if *opts.Verified {
+				query = query.Where("email_verified_at is not null")
+			} else {
+				query = query.Where("email_verified_at is null")
+			}
+		}
+
+		if opts.Limit > 0 {
+			query = query.Limit(opts.Limit)
+		}
+
+		if opts.Offset > 0 {
+			query = query.Offset(opts.Offset)
+		}
+	}
+
+	var uu []*user.User
+
+	err := us.runRead(ctx, func(tx *sqlx.Tx) error {
+		uu = make([]*user.User, 0)
+
+		sql, args, err := scopeSelect(ctx, query).PlaceholderFormat(squirrel.Dollar).ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.SelectContext(ctx, &uu, sql, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return uu, nil
 }
@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateEmailVerification stores a new verification token for the user,
+// any previous pending token of the same user stops being valid.
+func (us *UserStore) CreateEmailVerification(ctx context.Context, v *user.EmailVerification) error {
+	if v.UserID == "" {
+		return errors.New("must provide a user id")
+	}
+
+	if v.TokenHash == "" {
+		return errors.New("must provide a token hash")
+	}
+
+	query, args, err := squirrel.
+		Insert("email_verifications").
+		Columns("user_id", "email", "token_hash", "expires_at").
+		Values(v.UserID, v.Email, v.TokenHash, v.ExpiresAt).
+		Suffix("returning *").
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, "delete from email_verifications where user_id = $1 and used_at is null", v.UserID); err != nil {
+			return err
+		}
+
+		return tx.QueryRowxContext(ctx, query, args...).StructScan(v)
+	})
+}
+
+// VerifyEmail consumes the token and marks the email it was issued for as verified.
+// The token is rejected if the user changed the email after it was issued.
+func (us *UserStore) VerifyEmail(ctx context.Context, tokenHash string) (*user.User, error) {
+	if tokenHash == "" {
+		return nil, user.ErrInvalidToken
+	}
+
+	var u *user.User
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		v := &user.EmailVerification{}
+
+		row := tx.QueryRowxContext(ctx, "update email_verifications set used_at = now() where token_hash = $1 and used_at is null and expires_at > now() returning *", tokenHash)
+		if err := row.StructScan(v); err != nil {
+			return err
+		}
+
+		before, err := lockUser(ctx, tx, v.UserID)
+		if err != nil {
+			return err
+		}
+
+		u = &user.User{}
+
+		row = tx.QueryRowxContext(ctx, "update users set email_verified_at = now() where id = $1 and email = $2 and deleted_at is null returning *", v.UserID, v.Email)
+		if err := row.StructScan(u); err != nil {
+			return err
+		}
+
+		return insertEvent(ctx, tx, user.EventUserUpdated, before, u)
+	})
+
+	if err == sql.ErrNoRows {
+		return nil, user.ErrInvalidToken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
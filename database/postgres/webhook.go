@@ -0,0 +1,309 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// CreateWebhook ...
+func (us *UserStore) CreateWebhook(ctx context.Context, w *user.Webhook) error {
+	if w.OrganizationID == "" || w.URL == "" {
+		return errors.New("must provide a organization id and url")
+	}
+
+	query, args, err := squirrel.
+		Insert("webhooks").
+		Columns("organization_id", "url", "event_types", "active", "secret").
+		Values(w.OrganizationID, w.URL, eventTypes(w.EventTypes), w.Active, w.Secret).
+		Suffix("returning *").
+		PlaceholderFormat(squirrel.Dollar).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		return scanWebhook(tx.QueryRowxContext(ctx, query, args...), w)
+	})
+}
+
+// GetWebhook ...
+func (us *UserStore) GetWebhook(ctx context.Context, id string) (*user.Webhook, error) {
+	w := &user.Webhook{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return scanWebhook(tx.QueryRowxContext(ctx, "select * from webhooks where id = $1", id), w)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrWebhookNotFound
+		}
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// ListWebhooks ...
+func (us *UserStore) ListWebhooks(ctx context.Context, orgID string) ([]*user.Webhook, error) {
+	var ww []*user.Webhook
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		rows := make([]*webhookRow, 0)
+		if err := tx.SelectContext(ctx, &rows, "select * from webhooks where organization_id = $1 order by created_at", orgID); err != nil {
+			return err
+		}
+
+		ww = toWebhooks(rows)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ww, nil
+}
+
+// UpdateWebhook replaces the url, event types and active flag of the webhook
+func (us *UserStore) UpdateWebhook(ctx context.Context, w *user.Webhook) error {
+	update := squirrel.Update("webhooks").
+		Set("event_types", eventTypes(w.EventTypes)).
+		Set("active", w.Active).
+		Where("id = ?", w.ID)
+
+	if w.URL != "" {
+		update = update.Set("url", w.URL)
+	}
+
+	query, args, err := update.Suffix("returning *").PlaceholderFormat(squirrel.Dollar).ToSql()
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		if err := scanWebhook(tx.QueryRowxContext(ctx, query, args...), w); err != nil {
+			if err == sql.ErrNoRows {
+				return user.ErrWebhookNotFound
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// DeleteWebhook removes the webhook with its deliveries
+func (us *UserStore) DeleteWebhook(ctx context.Context, id string) error {
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "delete from webhooks where id = $1", id)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return user.ErrWebhookNotFound
+		}
+
+		return nil
+	})
+}
+
+// EnqueueWebhookDeliveries creates a delivery of the event for every active
+// webhook subscribed to its type in the organizations of the user. Enqueuing
+// the same event twice is a no-op.
+func (us *UserStore) EnqueueWebhookDeliveries(ctx context.Context, e *user.Event) (int, error) {
+	var n int64
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, `insert into webhook_deliveries (webhook_id, event_id, event_type)
+			select w.id, $1, $2 from webhooks w
+			where w.active and (cardinality(w.event_types) = 0 or $2 = any(w.event_types))
+			and exists (select 1 from memberships m where m.user_id = $3 and m.organization_id = w.organization_id)
+			on conflict (webhook_id, event_id) do nothing`, e.ID, e.Type, e.UserID)
+
+		if err != nil {
+			return err
+		}
+
+		n, err = res.RowsAffected()
+		return err
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// ClaimWebhookDeliveries returns the pending deliveries that are due, pushing
+// their next attempt by lease so other workers skip them meanwhile. If the
+// worker dies the deliveries are attempted again once the lease expires.
+func (us *UserStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*user.WebhookDelivery, error) {
+	var dd []*user.WebhookDelivery
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		dd = make([]*user.WebhookDelivery, 0)
+
+		return tx.SelectContext(ctx, &dd, `update webhook_deliveries set next_attempt_at = now() + $2 * interval '1 millisecond'
+			where id in (
+				select id from webhook_deliveries
+				where status = 'pending' and next_attempt_at <= now()
+				order by next_attempt_at limit $1
+				for update skip locked
+			)
+			returning *`, limit, lease.Milliseconds())
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dd, nil
+}
+
+// GetEvent ...
+func (us *UserStore) GetEvent(ctx context.Context, id int64) (*user.Event, error) {
+	e := &user.Event{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, "select "+eventColumns+" from outbox where id = $1", id).StructScan(e)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// RecordWebhookAttempt stores the attempt and the new state of its delivery
+func (us *UserStore) RecordWebhookAttempt(ctx context.Context, d *user.WebhookDelivery, a *user.WebhookAttempt) error {
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowxContext(ctx, `insert into webhook_attempts (delivery_id, status_code, error, duration_ms)
+			values ($1, $2, $3, $4) returning *`, d.ID, a.StatusCode, a.Error, a.DurationMS)
+
+		if err := row.StructScan(a); err != nil {
+			return err
+		}
+
+		row = tx.QueryRowxContext(ctx, `update webhook_deliveries set
+			status = $2, attempts = $3, next_attempt_at = $4, last_status_code = $5, last_error = $6
+			where id = $1 returning *`, d.ID, d.Status, d.Attempts, d.NextAttemptAt, d.LastStatusCode, d.LastError)
+
+		return row.StructScan(d)
+	})
+}
+
+// ListWebhookDeliveries returns the deliveries of the webhook, newest first, optionally by status
+func (us *UserStore) ListWebhookDeliveries(ctx context.Context, webhookID, status string) ([]*user.WebhookDelivery, error) {
+	query := squirrel.Select("*").From("webhook_deliveries").Where("webhook_id = ?", webhookID).OrderBy("created_at desc")
+
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var dd []*user.WebhookDelivery
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		dd = make([]*user.WebhookDelivery, 0)
+
+		sql, args, err := query.PlaceholderFormat(squirrel.Dollar).ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.SelectContext(ctx, &dd, sql, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dd, nil
+}
+
+// ListWebhookAttempts ...
+func (us *UserStore) ListWebhookAttempts(ctx context.Context, deliveryID string) ([]*user.WebhookAttempt, error) {
+	var aa []*user.WebhookAttempt
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		aa = make([]*user.WebhookAttempt, 0)
+
+		return tx.SelectContext(ctx, &aa, "select * from webhook_attempts where delivery_id = $1 order by created_at", deliveryID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return aa, nil
+}
+
+// ReplayWebhookDelivery schedules the delivery again right away, whatever its
+// status, with a fresh count of attempts
+func (us *UserStore) ReplayWebhookDelivery(ctx context.Context, id string) (*user.WebhookDelivery, error) {
+	d := &user.WebhookDelivery{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, `update webhook_deliveries set status = 'pending', attempts = 0, next_attempt_at = now()
+			where id = $1 returning *`, id).StructScan(d)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrDeliveryNotFound
+		}
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// webhookRow is a row of webhooks, whose event types are stored as a text array
+type webhookRow struct {
+	user.Webhook
+	EventTypes pq.StringArray `db:"event_types"`
+}
+
+// scanWebhook scans the webhook of the row into w
+func scanWebhook(row *sqlx.Row, w *user.Webhook) error {
+	r := &webhookRow{}
+	if err := row.StructScan(r); err != nil {
+		return err
+	}
+
+	*w = r.Webhook
+	w.EventTypes = r.EventTypes
+	return nil
+}
+
+// toWebhooks returns the webhooks of the rows
+func toWebhooks(rows []*webhookRow) []*user.Webhook {
+	ww := make([]*user.Webhook, 0, len(rows))
+	for _, r := range rows {
+		w := r.Webhook
+		w.EventTypes = r.EventTypes
+		ww = append(ww, &w)
+	}
+	return ww
+}
+
+// eventTypes stores a nil list as a empty array
+func eventTypes(types []string) interface{} {
+	if types == nil {
+		types = []string{}
+	}
+	return pq.Array(types)
+}
@@ -0,0 +1,183 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// CreateEmailChange stages a new email change for the user, replacing any
+// change still waiting for confirmation.
+func (us *UserStore) CreateEmailChange(ctx context.Context, c *user.EmailChange) error {
+	if c.UserID == "" {
+		return errors.New("must provide a user id")
+	}
+
+	if c.NewEmail == "" {
+		return errors.New("must provide a email")
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	tx, err := us.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "delete from email_changes where user_id = ? and confirmed_at is null and reverted_at is null", c.UserID); err != nil {
+		return err
+	}
+
+	query, args, err := squirrel.
+		Insert("email_changes").
+		Columns("id", "user_id", "old_email", "new_email", "token_hash", "revert_token_hash", "expires_at", "revert_expires_at", "created_at").
+		Values(id, c.UserID, strings.ToLower(c.OldEmail), strings.ToLower(c.NewEmail), c.TokenHash, c.RevertTokenHash, timestamp(c.ExpiresAt), timestamp(c.RevertExpiresAt), now()).
+		Suffix("returning *").
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	if err := tx.QueryRowxContext(ctx, query, args...).StructScan(c); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConfirmEmailChange consumes the token and swaps the email of the user in the
+// same transaction, failing with user.ErrEmailTaken if the new email was
+// registered in the meantime.
+func (us *UserStore) ConfirmEmailChange(ctx context.Context, tokenHash string) (*user.User, error) {
+	if tokenHash == "" {
+		return nil, user.ErrInvalidToken
+	}
+
+	tx, err := us.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	at := now()
+	c := &user.EmailChange{}
+
+	row := tx.QueryRowxContext(ctx, "update email_changes set confirmed_at = ? where token_hash = ? and confirmed_at is null and reverted_at is null and expires_at > ? returning *", at, tokenHash, at)
+	if err := row.StructScan(c); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	before, err := lockUser(ctx, tx, c.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	u := &user.User{}
+
+	query := squirrel.Update("users").
+		Set("email", c.NewEmail).
+		Set("email_verified_at", at).
+		Where("id = ? and email = ? and deleted_at is null", c.UserID, c.OldEmail)
+
+	if err := updateUser(ctx, tx, query, u); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrInvalidToken
+		}
+		if isUniqueViolation(err) {
+			return nil, user.ErrEmailTaken
+		}
+		return nil, err
+	}
+
+	if err := insertEvent(ctx, tx, user.EventUserUpdated, before, u); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// RevertEmailChange cancels a pending change, or restores the old email of the
+// user if the change was already confirmed.
+func (us *UserStore) RevertEmailChange(ctx context.Context, revertTokenHash string) (*user.User, error) {
+	if revertTokenHash == "" {
+		return nil, user.ErrInvalidToken
+	}
+
+	tx, err := us.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	at := now()
+	c := &user.EmailChange{}
+
+	row := tx.QueryRowxContext(ctx, "update email_changes set reverted_at = ? where revert_token_hash = ? and reverted_at is null and revert_expires_at > ? returning *", at, revertTokenHash, at)
+	if err := row.StructScan(c); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	before, err := lockUser(ctx, tx, c.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	u := &user.User{}
+
+	if c.ConfirmedAt == nil {
+		u, err = getUser(ctx, tx, squirrel.Select("*").From("users").Where("id = ? and deleted_at is null", c.UserID))
+	} else {
+		// the revert link was received on the old address, so it is verified again
+		err = updateUser(ctx, tx, squirrel.Update("users").
+			Set("email", c.OldEmail).
+			Set("email_verified_at", at).
+			Where("id = ? and email = ? and deleted_at is null", c.UserID, c.NewEmail), u)
+	}
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrInvalidToken
+		}
+		if isUniqueViolation(err) {
+			return nil, user.ErrEmailTaken
+		}
+		return nil, err
+	}
+
+	if c.ConfirmedAt != nil {
+		if err := insertEvent(ctx, tx, user.EventUserUpdated, before, u); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
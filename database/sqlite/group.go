@@ -0,0 +1,347 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateGroup ...
+func (us *UserStore) CreateGroup(ctx context.Context, g *user.Group) error {
+	if g.OrganizationID == "" || g.Name == "" {
+		return errors.New("must provide a organization id and name")
+	}
+
+	if id, ok := tenant.FromContext(ctx); ok && id != g.OrganizationID {
+		return tenant.ErrMismatch
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	at := now()
+
+	query, args, err := squirrel.
+		Insert("groups").
+		Columns("id", "organization_id", "name", "description", "created_at", "updated_at").
+		Values(id, g.OrganizationID, g.Name, g.Description, at, at).
+		Suffix("returning *").
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.QueryRowxContext(ctx, query, args...).StructScan(g); err != nil {
+			if isUniqueViolation(err) {
+				return user.ErrGroupNameTaken
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// GetGroup ...
+func (us *UserStore) GetGroup(ctx context.Context, id string) (*user.Group, error) {
+	if id == "" {
+		return nil, errors.New("must provide a id")
+	}
+
+	g := &user.Group{}
+
+	query, args, err := squirrel.Select("*").From("groups").Where("id = ?", id).Where(inTenant(ctx, "organization_id")).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, query, args...).StructScan(g)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrGroupNotFound
+		}
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// UpdateGroup ...
+func (us *UserStore) UpdateGroup(ctx context.Context, g *user.Group) error {
+	if g.ID == "" {
+		return errors.New("must provide a id")
+	}
+
+	update := squirrel.Update("groups").
+		Set("description", g.Description).
+		Set("updated_at", now()).
+		Where("id = ?", g.ID).
+		Where(inTenant(ctx, "organization_id"))
+
+	if g.Name != "" {
+		update = update.Set("name", g.Name)
+	}
+
+	query, args, err := update.Suffix("returning *").ToSql()
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.QueryRowxContext(ctx, query, args...).StructScan(g); err != nil {
+			if isUniqueViolation(err) {
+				return user.ErrGroupNameTaken
+			}
+			if err == sql.ErrNoRows {
+				return user.ErrGroupNotFound
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// DeleteGroup removes the group, its members and its membership in other groups
+func (us *UserStore) DeleteGroup(ctx context.Context, id string) error {
+	query, args, err := squirrel.Delete("groups").Where("id = ?", id).Where(inTenant(ctx, "organization_id")).ToSql()
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return user.ErrGroupNotFound
+		}
+
+		return nil
+	})
+}
+
+// ListGroups ...
+func (us *UserStore) ListGroups(ctx context.Context, orgID string) ([]*user.Group, error) {
+	var gg []*user.Group
+
+	query, args, err := squirrel.
+		Select("*").
+		From("groups").
+		Where("organization_id = ?", orgID).
+		Where(inTenant(ctx, "organization_id")).
+		OrderBy("name").
+		ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.run(ctx, func(tx *sqlx.Tx) error {
+		gg = make([]*user.Group, 0)
+
+		return tx.SelectContext(ctx, &gg, query, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return gg, nil
+}
+
+// AddGroupMember adds a user or a group to the group. Nested groups are
+// checked for cycles, transactions do not overlap so two concurrent
+// additions can not close a cycle between them.
+func (us *UserStore) AddGroupMember(ctx context.Context, m *user.GroupMember) error {
+	if (m.UserID == "") == (m.MemberGroupID == "") {
+		return user.ErrInvalidGroupMember
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		orgID, err := groupOrganization(ctx, tx, m.GroupID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return user.ErrGroupNotFound
+			}
+			return err
+		}
+
+		if m.UserID != "" {
+			row := tx.QueryRowxContext(ctx, `insert into group_users (group_id, user_id, created_at) values (?, ?, ?)
+				on conflict (group_id, user_id) do update set user_id = excluded.user_id
+				returning created_at`, m.GroupID, m.UserID, now())
+
+			return row.Scan(&m.CreatedAt)
+		}
+
+		memberOrgID, err := groupOrganization(ctx, tx, m.MemberGroupID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return user.ErrGroupNotFound
+			}
+			return err
+		}
+
+		if memberOrgID != orgID {
+			return user.ErrGroupNotFound
+		}
+
+		var cycle bool
+
+		// the group can not be added if it is already reachable from the new member
+		row := tx.QueryRowxContext(ctx, `with recursive descendants (id) as (
+				select ?
+				union
+				select gg.member_group_id from group_groups gg join descendants d on gg.group_id = d.id
+			)
+			select exists (select 1 from descendants where id = ?)`, m.MemberGroupID, m.GroupID)
+
+		if err := row.Scan(&cycle); err != nil {
+			return err
+		}
+
+		if cycle {
+			return user.ErrGroupCycle
+		}
+
+		row = tx.QueryRowxContext(ctx, `insert into group_groups (group_id, member_group_id, created_at) values (?, ?, ?)
+			on conflict (group_id, member_group_id) do update set member_group_id = excluded.member_group_id
+			returning created_at`, m.GroupID, m.MemberGroupID, now())
+
+		return row.Scan(&m.CreatedAt)
+	})
+}
+
+// RemoveGroupMember ...
+func (us *UserStore) RemoveGroupMember(ctx context.Context, m *user.GroupMember) error {
+	if (m.UserID == "") == (m.MemberGroupID == "") {
+		return user.ErrInvalidGroupMember
+	}
+
+	query := "delete from group_users where group_id = ? and user_id = ?"
+	member := m.UserID
+
+	if m.MemberGroupID != "" {
+		query = "delete from group_groups where group_id = ? and member_group_id = ?"
+		member = m.MemberGroupID
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		if _, err := groupOrganization(ctx, tx, m.GroupID); err != nil {
+			if err == sql.ErrNoRows {
+				return user.ErrNotMember
+			}
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, query, m.GroupID, member)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return user.ErrNotMember
+		}
+
+		return nil
+	})
+}
+
+// ListGroupMembers returns the direct members of the group
+func (us *UserStore) ListGroupMembers(ctx context.Context, groupID string) ([]*user.GroupMember, error) {
+	var mm []*user.GroupMember
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		mm = make([]*user.GroupMember, 0)
+
+		if _, err := groupOrganization(ctx, tx, groupID); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+
+		return tx.SelectContext(ctx, &mm, `select group_id, user_id, '' as member_group_id, created_at
+			from group_users where group_id = ?
+			union all
+			select group_id, '' as user_id, member_group_id, created_at
+			from group_groups where group_id = ?
+			order by created_at`, groupID, groupID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return mm, nil
+}
+
+// ListUserGroups expands the groups of the user walking up the nested groups,
+// the union of the recursive query ignores groups already visited so cycles
+// can not make it loop.
+func (us *UserStore) ListUserGroups(ctx context.Context, userID string) ([]*user.Group, error) {
+	var gg []*user.Group
+
+	query, args, err := squirrel.
+		Select("g.*").
+		Prefix(`with recursive effective (id) as (
+				select group_id from group_users where user_id = ?
+				union
+				select gg.group_id from group_groups gg join effective e on gg.member_group_id = e.id
+			)`, userID).
+		From("groups g").
+		Join("effective e on e.id = g.id").
+		Where(inTenant(ctx, "g.organization_id")).
+		OrderBy("g.name").
+		ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.run(ctx, func(tx *sqlx.Tx) error {
+		gg = make([]*user.Group, 0)
+
+		return tx.SelectContext(ctx, &gg, query, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return gg, nil
+}
+
+// groupOrganization returns the organization of the group, sql.ErrNoRows if
+// the group does not exist in the tenant of the context
+func groupOrganization(ctx context.Context, tx *sqlx.Tx, id string) (string, error) {
+	query, args, err := squirrel.Select("organization_id").From("groups").Where("id = ?", id).Where(inTenant(ctx, "organization_id")).ToSql()
+	if err != nil {
+		return "", err
+	}
+
+	var orgID string
+
+	if err := tx.QueryRowxContext(ctx, query, args...).Scan(&orgID); err != nil {
+		return "", err
+	}
+
+	return orgID, nil
+}
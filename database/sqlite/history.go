@@ -0,0 +1,140 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// versionColumns are the columns of users_history, filled by recordVersion
+const versionColumns = "version, id, email, name, last_name, email_verified_at, mfa_enabled_at, created_at, updated_at, deleted_at, valid_from, valid_to"
+
+// recordVersion closes the current version of the user and adds u as the new
+// one, what the triggers of users_history do in postgres. A change of only
+// the password or the login throttling columns is not a new version.
+func recordVersion(ctx context.Context, tx *sqlx.Tx, u *user.User) error {
+	at := time.Now()
+
+	current := &user.UserVersion{}
+
+	err := tx.QueryRowxContext(ctx, "select "+versionColumns+" from users_history where id = ? and valid_to is null", u.ID).StructScan(current)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return err
+	case sameVersion(&current.User, u):
+		return nil
+	default:
+		// keeps the versions of a user apart when it changes twice in a row
+		if !at.After(current.ValidFrom) {
+			at = current.ValidFrom.Add(time.Nanosecond)
+		}
+
+		if _, err := tx.ExecContext(ctx, "update users_history set valid_to = ? where version = ?", timestamp(at), current.Version); err != nil {
+			return err
+		}
+	}
+
+	query, args, err := squirrel.
+		Insert("users_history").
+		Columns("id", "email", "name", "last_name", "email_verified_at", "mfa_enabled_at", "created_at", "updated_at", "deleted_at", "valid_from").
+		Values(u.ID, u.Email, u.Name, u.LastName, nullTimestamp(u.EmailVerifiedAt), nullTimestamp(u.MFAEnabledAt), timestamp(u.CreatedAt), timestamp(u.UpdatedAt), nullTimestamp(u.DeletedAt), timestamp(at)).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// sameVersion reports whether the columns kept in the history are equal
+func sameVersion(a, b *user.User) bool {
+	return a.Email == b.Email && a.Name == b.Name && a.LastName == b.LastName &&
+		sameTime(a.EmailVerifiedAt, b.EmailVerifiedAt) &&
+		sameTime(a.MFAEnabledAt, b.MFAEnabledAt) &&
+		sameTime(a.DeletedAt, b.DeletedAt)
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// GetUserAsOf returns the version of the user that was current at the given time
+func (us *UserStore) GetUserAsOf(ctx context.Context, id string, at time.Time) (*user.UserVersion, error) {
+	if id == "" {
+		return nil, errors.New("must provide a id")
+	}
+
+	query := squirrel.
+		Select(versionColumns).
+		From("users_history").
+		Where("id = ? and valid_from <= ? and (valid_to is null or valid_to > ?)", id, timestamp(at), timestamp(at))
+
+	v := &user.UserVersion{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		sql, args, err := scopeHistory(ctx, query).ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRowxContext(ctx, sql, args...).StructScan(v)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// ListUserVersions returns every version of the user, oldest first
+func (us *UserStore) ListUserVersions(ctx context.Context, id string) ([]*user.UserVersion, error) {
+	if id == "" {
+		return nil, errors.New("must provide a id")
+	}
+
+	query, args, err := scopeHistory(ctx, squirrel.
+		Select(versionColumns).
+		From("users_history").
+		Where("id = ?", id).
+		OrderBy("valid_from", "version")).
+		ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var vv []*user.UserVersion
+
+	err = us.run(ctx, func(tx *sqlx.Tx) error {
+		vv = make([]*user.UserVersion, 0)
+
+		return tx.SelectContext(ctx, &vv, query, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return vv, nil
+}
+
+// scopeHistory limits the history to the members of the tenant of the context
+func scopeHistory(ctx context.Context, q squirrel.SelectBuilder) squirrel.SelectBuilder {
+	if orgID, ok := tenant.FromContext(ctx); ok {
+		return q.Where("exists (select 1 from memberships m where m.user_id = users_history.id and m.organization_id = ?)", orgID)
+	}
+	return q
+}
@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// ClaimIdempotencyKey stores the key unless a unexpired one with the same
+// scope exists, a expired key is taken over. It returns the key stored and
+// whether it was claimed, when it was not the key is the existing one.
+func (us *UserStore) ClaimIdempotencyKey(ctx context.Context, k *user.IdempotencyKey) (*user.IdempotencyKey, bool, error) {
+	claimed := &user.IdempotencyKey{}
+	at := now()
+
+	err := us.Store.QueryRowxContext(ctx, `insert into idempotency_keys (scope, key, request_hash, created_at, expires_at)
+		values (?, ?, ?, ?, ?)
+		on conflict (scope, key) do update set
+			request_hash = excluded.request_hash, response = null, completed_at = null,
+			created_at = excluded.created_at, expires_at = excluded.expires_at
+		where idempotency_keys.expires_at <= ?
+		returning *`, k.Scope, k.Key, k.RequestHash, at, timestamp(k.ExpiresAt), at).StructScan(claimed)
+
+	if err == nil {
+		return claimed, true, nil
+	}
+
+	if err != sql.ErrNoRows {
+		return nil, false, err
+	}
+
+	existing := &user.IdempotencyKey{}
+
+	err = us.Store.QueryRowxContext(ctx, "select * from idempotency_keys where scope = ? and key = ?", k.Scope, k.Key).StructScan(existing)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// released by a failed request since the insert, the client can retry
+			return nil, false, user.ErrIdempotencyKeyInProgress
+		}
+		return nil, false, err
+	}
+
+	return existing, false, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request of the key, kept
+// until k.ExpiresAt
+func (us *UserStore) CompleteIdempotencyKey(ctx context.Context, k *user.IdempotencyKey) error {
+	_, err := us.Store.ExecContext(ctx, "update idempotency_keys set response = ?, completed_at = ?, expires_at = ? where scope = ? and key = ?", k.Response, now(), timestamp(k.ExpiresAt), k.Scope, k.Key)
+	return err
+}
+
+// ReleaseIdempotencyKey deletes a key whose request failed, so it can be retried
+func (us *UserStore) ReleaseIdempotencyKey(ctx context.Context, k *user.IdempotencyKey) error {
+	_, err := us.Store.ExecContext(ctx, "delete from idempotency_keys where scope = ? and key = ? and completed_at is null", k.Scope, k.Key)
+	return err
+}
+
+// PurgeIdempotencyKeys deletes the keys expired before the time
+func (us *UserStore) PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int, error) {
+	res, err := us.Store.ExecContext(ctx, "delete from idempotency_keys where expires_at < ?", timestamp(before))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
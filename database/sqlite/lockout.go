@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/jmoiron/sqlx"
+)
+
+// RecordLoginFailure increments the failed logins of the user and returns the
+// new count, failures older than windowStart are forgotten.
+func (us *UserStore) RecordLoginFailure(ctx context.Context, userID string, at, windowStart time.Time) (int, error) {
+	query := squirrel.Update("users").
+		Set("failed_login_attempts", squirrel.Expr("case when last_failed_login_at is null or last_failed_login_at < ? then 1 else failed_login_attempts + 1 end", timestamp(windowStart))).
+		Set("last_failed_login_at", timestamp(at)).
+		Where("id = ? and deleted_at is null", userID)
+
+	u := &user.User{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return updateUser(ctx, tx, query, u)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return u.FailedLoginAttempts, nil
+}
+
+// LockUser ...
+func (us *UserStore) LockUser(ctx context.Context, userID string, until time.Time) error {
+	query := squirrel.Update("users").
+		Set("locked_until", squirrel.Expr("max(coalesce(locked_until, ?), ?)", timestamp(until), timestamp(until))).
+		Where("id = ?", userID)
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		err := updateUser(ctx, tx, query, &user.User{})
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	})
+}
+
+// ResetLoginFailures clears the failed logins and the lock of the user
+func (us *UserStore) ResetLoginFailures(ctx context.Context, userID string) (*user.User, error) {
+	u := &user.User{}
+
+	query := squirrel.Update("users").
+		Set("failed_login_attempts", 0).
+		Set("last_failed_login_at", nil).
+		Set("locked_until", nil).
+		Where("id = ? and deleted_at is null", userID)
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		return updateUser(ctx, tx, query, u)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// GetIPBlockedUntil returns the time the address is blocked until, nil if it is not blocked
+func (us *UserStore) GetIPBlockedUntil(ctx context.Context, ip string) (*time.Time, error) {
+	var blockedUntil *time.Time
+
+	row := us.Store.QueryRowxContext(ctx, "select blocked_until from login_ip_throttles where ip = ?", ip)
+	if err := row.Scan(&blockedUntil); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return blockedUntil, nil
+}
+
+// RecordIPFailure increments the failed logins of the address and returns the
+// new count, failures older than windowStart are forgotten.
+func (us *UserStore) RecordIPFailure(ctx context.Context, ip string, at, windowStart time.Time) (int, error) {
+	var failures int
+
+	row := us.Store.QueryRowxContext(ctx, `insert into login_ip_throttles (ip, failed_attempts, last_failed_at) values (?, 1, ?)
+		on conflict (ip) do update set
+		failed_attempts = case when login_ip_throttles.last_failed_at < ? then 1 else login_ip_throttles.failed_attempts + 1 end,
+		last_failed_at = excluded.last_failed_at
+		returning failed_attempts`, ip, timestamp(at), timestamp(windowStart))
+
+	if err := row.Scan(&failures); err != nil {
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+// BlockIP ...
+func (us *UserStore) BlockIP(ctx context.Context, ip string, until time.Time) error {
+	_, err := us.Store.ExecContext(ctx, "update login_ip_throttles set blocked_until = max(coalesce(blocked_until, ?), ?) where ip = ?", timestamp(until), timestamp(until), ip)
+	return err
+}
@@ -0,0 +1,180 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// SaveMFA stores a new unconfirmed enrollment, replacing a previous unconfirmed one
+func (us *UserStore) SaveMFA(ctx context.Context, m *user.MFA) error {
+	if m.UserID == "" {
+		return errors.New("must provide a user id")
+	}
+
+	query, args, err := squirrel.
+		Insert("user_mfa").
+		Columns("user_id", "secret", "created_at").
+		Values(m.UserID, m.Secret, now()).
+		Suffix("on conflict (user_id) do update set secret = excluded.secret, last_used_step = 0, created_at = excluded.created_at where user_mfa.confirmed_at is null returning *").
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	if err := us.Store.QueryRowxContext(ctx, query, args...).StructScan(m); err != nil {
+		if err == sql.ErrNoRows {
+			return user.ErrMFAAlreadyEnabled
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetMFA ...
+func (us *UserStore) GetMFA(ctx context.Context, userID string) (*user.MFA, error) {
+	if userID == "" {
+		return nil, errors.New("must provide a user id")
+	}
+
+	m := &user.MFA{}
+
+	if err := us.Store.QueryRowxContext(ctx, "select * from user_mfa where user_id = ?", userID).StructScan(m); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrMFANotEnabled
+		}
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// ConfirmMFA enables the enrollment, replaces the recovery codes and flags the user in the same transaction
+func (us *UserStore) ConfirmMFA(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) (*user.User, error) {
+	tx, err := us.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	at := now()
+
+	res, err := tx.ExecContext(ctx, "update user_mfa set confirmed_at = ?, last_used_step = ? where user_id = ? and confirmed_at is null and last_used_step < ?", at, step, userID, step)
+	if err != nil {
+		return nil, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, user.ErrInvalidMFACode
+	}
+
+	if _, err := tx.ExecContext(ctx, "delete from mfa_recovery_codes where user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	if len(recoveryCodeHashes) > 0 {
+		insert := squirrel.Insert("mfa_recovery_codes").Columns("id", "user_id", "code_hash", "created_at")
+		for _, hash := range recoveryCodeHashes {
+			id, err := newID()
+			if err != nil {
+				return nil, err
+			}
+			insert = insert.Values(id, userID, hash, at)
+		}
+
+		query, args, err := insert.ToSql()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	u := &user.User{}
+
+	if err := updateUser(ctx, tx, squirrel.Update("users").Set("mfa_enabled_at", at).Where("id = ? and deleted_at is null", userID), u); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// UseMFAStep records the step of a accepted TOTP code, failing if the same or a later step was already used
+func (us *UserStore) UseMFAStep(ctx context.Context, userID string, step int64) error {
+	res, err := us.Store.ExecContext(ctx, "update user_mfa set last_used_step = ? where user_id = ? and confirmed_at is not null and last_used_step < ?", step, userID, step)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return user.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks a recovery code as used, failing if it does not exist or was already used
+func (us *UserStore) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	res, err := us.Store.ExecContext(ctx, "update mfa_recovery_codes set used_at = ? where user_id = ? and code_hash = ? and used_at is null", now(), userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return user.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// DeleteMFA removes the enrollment and recovery codes of the user
+func (us *UserStore) DeleteMFA(ctx context.Context, userID string) (*user.User, error) {
+	tx, err := us.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "delete from mfa_recovery_codes where user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "delete from user_mfa where user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	u := &user.User{}
+
+	if err := updateUser(ctx, tx, squirrel.Update("users").Set("mfa_enabled_at", nil).Where("id = ? and deleted_at is null", userID), u); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
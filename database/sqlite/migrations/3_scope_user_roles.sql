@@ -0,0 +1,20 @@
+-- 21_scope_user_roles.sql of the postgres migrations. The primary key of
+-- user_roles can't be dropped in sqlite so the table is rebuilt.
+
+CREATE TABLE user_roles_scoped (
+  user_id varchar(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role_id varchar(36) NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+  organization_id varchar(36) REFERENCES organizations(id) ON DELETE CASCADE,
+  created_at datetime NOT NULL
+);
+
+INSERT INTO user_roles_scoped (user_id, role_id, created_at)
+  SELECT user_id, role_id, created_at FROM user_roles;
+
+DROP TABLE user_roles;
+
+ALTER TABLE user_roles_scoped RENAME TO user_roles;
+
+CREATE UNIQUE INDEX user_roles_user_role_organization_idx ON user_roles(user_id, role_id, coalesce(organization_id, ''));
+
+CREATE INDEX user_roles_role_id_idx ON user_roles(role_id);
@@ -0,0 +1,341 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateOrganization creates the organization with the given user as its owner
+func (us *UserStore) CreateOrganization(ctx context.Context, o *user.Organization, ownerID string) error {
+	if o.Name == "" || o.Slug == "" {
+		return errors.New("must provide a name and slug")
+	}
+
+	if ownerID == "" {
+		return errors.New("must provide a owner id")
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	tx, err := us.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	at := now()
+
+	query, args, err := squirrel.
+		Insert("organizations").
+		Columns("id", "name", "slug", "created_at", "updated_at").
+		Values(id, o.Name, strings.ToLower(o.Slug), at, at).
+		Suffix("returning *").
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	if err := tx.QueryRowxContext(ctx, query, args...).StructScan(o); err != nil {
+		if isUniqueViolation(err) {
+			return user.ErrSlugTaken
+		}
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "insert into memberships (organization_id, user_id, role, created_at) values (?, ?, ?, ?)", o.ID, ownerID, user.OrgRoleOwner, at); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetOrganization ...
+func (us *UserStore) GetOrganization(ctx context.Context, id string) (*user.Organization, error) {
+	if id == "" {
+		return nil, errors.New("must provide a id")
+	}
+
+	o := &user.Organization{}
+
+	query, args, err := squirrel.
+		Select("*").
+		From("organizations").
+		Where("id = ? and deleted_at is null", id).
+		Where(inTenant(ctx, "id")).
+		ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, query, args...).StructScan(o)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// ListOrganizations returns the organizations the user is member of
+func (us *UserStore) ListOrganizations(ctx context.Context, userID string) ([]*user.Organization, error) {
+	var oo []*user.Organization
+
+	query, args, err := squirrel.
+		Select("o.*").
+		From("organizations o").
+		Join("memberships m on m.organization_id = o.id").
+		Where("m.user_id = ? and o.deleted_at is null", userID).
+		Where(inTenant(ctx, "o.id")).
+		OrderBy("o.name").
+		ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.run(ctx, func(tx *sqlx.Tx) error {
+		oo = make([]*user.Organization, 0)
+
+		return tx.SelectContext(ctx, &oo, query, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return oo, nil
+}
+
+// GetMembership ...
+func (us *UserStore) GetMembership(ctx context.Context, orgID, userID string) (*user.Membership, error) {
+	m := &user.Membership{}
+
+	query, args, err := squirrel.
+		Select("*").
+		From("memberships").
+		Where("organization_id = ? and user_id = ?", orgID, userID).
+		Where(inTenant(ctx, "organization_id")).
+		ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, query, args...).StructScan(m)
+	})
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrNotMember
+		}
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// SetMemberRole changes the role of a existing member
+func (us *UserStore) SetMemberRole(ctx context.Context, orgID, userID, role string) (*user.Membership, error) {
+	tx, err := us.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if role != user.OrgRoleOwner {
+		if err := checkNotLastOwner(ctx, tx, orgID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	query, args, err := squirrel.
+		Update("memberships").
+		Set("role", role).
+		Where("organization_id = ? and user_id = ?", orgID, userID).
+		Where(inTenant(ctx, "organization_id")).
+		Suffix("returning *").
+		ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	m := &user.Membership{}
+
+	if err := tx.QueryRowxContext(ctx, query, args...).StructScan(m); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrNotMember
+		}
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// RemoveMember ...
+func (us *UserStore) RemoveMember(ctx context.Context, orgID, userID string) error {
+	tx, err := us.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotLastOwner(ctx, tx, orgID, userID); err != nil {
+		return err
+	}
+
+	query, args, err := squirrel.
+		Delete("memberships").
+		Where("organization_id = ? and user_id = ?", orgID, userID).
+		Where(inTenant(ctx, "organization_id")).
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return user.ErrNotMember
+	}
+
+	// the roles granted in the organization go with the membership
+	if _, err := tx.ExecContext(ctx, "delete from user_roles where organization_id = ? and user_id = ?", orgID, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateInvitation ...
+func (us *UserStore) CreateInvitation(ctx context.Context, inv *user.Invitation) error {
+	if inv.OrganizationID == "" || inv.Email == "" {
+		return errors.New("must provide a organization id and email")
+	}
+
+	// the row must belong to the tenant of the context like any row it can read
+	if id, ok := tenant.FromContext(ctx); ok && id != inv.OrganizationID {
+		return tenant.ErrMismatch
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	query, args, err := squirrel.
+		Insert("invitations").
+		Columns("id", "organization_id", "email", "role", "token_hash", "invited_by", "expires_at", "created_at").
+		Values(id, inv.OrganizationID, strings.ToLower(inv.Email), inv.Role, inv.TokenHash, inv.InvitedBy, timestamp(inv.ExpiresAt), now()).
+		Suffix("returning *").
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, query, args...).StructScan(inv)
+	})
+}
+
+// AcceptInvitation consumes the invitation and adds the user to the organization.
+// The invitation is only valid for the user registered with the invited email.
+func (us *UserStore) AcceptInvitation(ctx context.Context, tokenHash, userID string) (*user.Membership, error) {
+	tx, err := us.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	at := now()
+	inv := &user.Invitation{}
+
+	query, args, err := squirrel.
+		Update("invitations").
+		Set("accepted_at", at).
+		Where("token_hash = ? and accepted_at is null and expires_at > ?", tokenHash, at).
+		Where("exists (select 1 from users u where u.id = ? and u.email = invitations.email and u.deleted_at is null)", userID).
+		Where(inTenant(ctx, "organization_id")).
+		Suffix("returning *").
+		ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRowxContext(ctx, query, args...)
+
+	if err := row.StructScan(inv); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	m := &user.Membership{}
+
+	row = tx.QueryRowxContext(ctx, `insert into memberships (organization_id, user_id, role, created_at) values (?, ?, ?, ?)
+		on conflict (organization_id, user_id) do update set role = memberships.role
+		returning *`, inv.OrganizationID, userID, inv.Role, at)
+
+	if err := row.StructScan(m); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// checkNotLastOwner fails if the user is the only owner of the organization,
+// transactions do not overlap so concurrent changes can not remove both owners.
+func checkNotLastOwner(ctx context.Context, tx *sqlx.Tx, orgID, userID string) error {
+	var isOwner bool
+	var owners int
+
+	row := tx.QueryRowxContext(ctx, `select
+		coalesce(max(user_id = ?), 0),
+		count(*)
+		from memberships where organization_id = ? and role = ?`, userID, orgID, user.OrgRoleOwner)
+
+	if err := row.Scan(&isOwner, &owners); err != nil {
+		return err
+	}
+
+	if isOwner && owners <= 1 {
+		return user.ErrLastOwner
+	}
+
+	return nil
+}
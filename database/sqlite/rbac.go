@@ -0,0 +1,167 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// ListRoles returns every role with its permissions
+func (us *UserStore) ListRoles(ctx context.Context) ([]*user.Role, error) {
+	roles := make([]*user.Role, 0)
+	if err := us.Store.SelectContext(ctx, &roles, "select * from roles order by name"); err != nil {
+		return nil, err
+	}
+
+	rows, err := us.Store.QueryxContext(ctx, "select rp.role_id, p.name from role_permissions rp join permissions p on p.id = rp.permission_id order by p.name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[string]*user.Role, len(roles))
+	for _, r := range roles {
+		r.Permissions = make([]string, 0)
+		byID[r.ID] = r
+	}
+
+	for rows.Next() {
+		var roleID, permission string
+		if err := rows.Scan(&roleID, &permission); err != nil {
+			return nil, err
+		}
+
+		if r, ok := byID[roleID]; ok {
+			r.Permissions = append(r.Permissions, permission)
+		}
+	}
+
+	return roles, rows.Err()
+}
+
+// GetUserRoles returns the role names of each of the given users, the roles
+// granted in the tenant of the context and the ones granted outside of any
+// tenant
+func (us *UserStore) GetUserRoles(ctx context.Context, userIDs ...string) (map[string][]string, error) {
+	roles := make(map[string][]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return roles, nil
+	}
+
+	query, args, err := squirrel.
+		Select("ur.user_id", "r.name").
+		From("user_roles ur").
+		Join("roles r on r.id = ur.role_id").
+		Where(squirrel.Eq{"ur.user_id": userIDs}).
+		Where("(ur.organization_id is null or ur.organization_id = ?)", roleOrganization(ctx)).
+		OrderBy("r.name").
+		ToSql()
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := us.Store.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, role string
+		if err := rows.Scan(&userID, &role); err != nil {
+			return nil, err
+		}
+
+		roles[userID] = append(roles[userID], role)
+	}
+
+	return roles, rows.Err()
+}
+
+// AssignRole ...
+func (us *UserStore) AssignRole(ctx context.Context, userID, role string) error {
+	if userID == "" {
+		return errors.New("must provide a user id")
+	}
+
+	roleID, err := us.roleID(ctx, role)
+	if err != nil {
+		return err
+	}
+
+	_, err = us.Store.ExecContext(ctx, "insert into user_roles (user_id, role_id, organization_id, created_at) values (?, ?, ?, ?) on conflict do nothing", userID, roleID, roleOrganization(ctx), now())
+	return err
+}
+
+// RevokeRole ...
+func (us *UserStore) RevokeRole(ctx context.Context, userID, role string) error {
+	if userID == "" {
+		return errors.New("must provide a user id")
+	}
+
+	roleID, err := us.roleID(ctx, role)
+	if err != nil {
+		return err
+	}
+
+	_, err = us.Store.ExecContext(ctx, "delete from user_roles where user_id = ? and role_id = ? and organization_id is ?", userID, roleID, roleOrganization(ctx))
+	return err
+}
+
+// HasPermission reports whether any role of the user grants the permission
+func (us *UserStore) HasPermission(ctx context.Context, userID, permission string) (bool, error) {
+	var allowed bool
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		q := scopeSelect(ctx, squirrel.
+			Select("1").
+			From("user_roles ur").
+			Join("role_permissions rp on rp.role_id = ur.role_id").
+			Join("permissions p on p.id = rp.permission_id").
+			Join("users on users.id = ur.user_id").
+			Where("ur.user_id = ? and p.name = ? and users.deleted_at is null", userID, permission).
+			Where("(ur.organization_id is null or ur.organization_id = ?)", roleOrganization(ctx)))
+
+		sql, args, err := q.Prefix("select exists (").Suffix(")").ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRowxContext(ctx, sql, args...).Scan(&allowed)
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return allowed, nil
+}
+
+func (us *UserStore) roleID(ctx context.Context, role string) (string, error) {
+	var id string
+
+	if err := us.Store.QueryRowxContext(ctx, "select id from roles where name = ?", role).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return "", user.ErrRoleNotFound
+		}
+		return "", err
+	}
+
+	return id, nil
+}
+
+// roleOrganization returns the organization the roles are granted and
+// checked in, the tenant of the context. Outside of a tenant it is nil, the
+// roles granted there apply in every organization.
+func roleOrganization(ctx context.Context) interface{} {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return id
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/rand"
+	"embed"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	// pure Go driver, the service builds without cgo
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// UserStore is a database.Store on a SQLite file, for deployments of a
+// single instance that run without Postgres.
+//
+// It keeps a single connection, so transactions run one at a time and there
+// is nothing to lock. Unlike the postgres store no query holds a transaction
+// open while the callers code runs.
+type UserStore struct {
+	Store *sqlx.DB
+}
+
+// Open opens the database file at path, creating it if it does not exist,
+// and applies the migrations it is missing. ":memory:" keeps the database in
+// memory until the store is closed.
+func Open(path string) (*UserStore, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+	db, err := sqlx.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// a database in memory exists only in the connection that created it
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+
+	if err := migrate(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &UserStore{Store: db}, nil
+}
+
+// migrate applies the migrations with a version higher than the user_version
+// of the database, each one in its own transaction
+func migrate(ctx context.Context, db *sqlx.DB) error {
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+
+	versions := make(map[int]string, len(entries))
+	for _, e := range entries {
+		v, err := strconv.Atoi(strings.SplitN(e.Name(), "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("migration %v: %w", e.Name(), err)
+		}
+		versions[v] = e.Name()
+	}
+
+	order := make([]int, 0, len(versions))
+	for v := range versions {
+		order = append(order, v)
+	}
+	sort.Ints(order)
+
+	var current int
+	if err := db.QueryRowxContext(ctx, "pragma user_version").Scan(&current); err != nil {
+		return err
+	}
+
+	for _, v := range order {
+		if v <= current {
+			continue
+		}
+
+		stmts, err := migrations.ReadFile("migrations/" + versions[v])
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, string(stmts)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %v: %w", versions[v], err)
+		}
+
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("pragma user_version = %d", v)); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// timeFormat has a fixed width, so times stored as text sort and compare in
+// the order of the times
+const timeFormat = "2006-01-02 15:04:05.000000000-07:00"
+
+// timestamp formats t to be stored or compared with a stored time
+func timestamp(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// nullTimestamp formats t like timestamp, a nil time is stored as null
+func nullTimestamp(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return timestamp(*t)
+}
+
+// now returns the current time formatted to be stored
+func now() string {
+	return timestamp(time.Now())
+}
+
+// newID returns a random UUID, the ids postgres makes with gen_random_uuid
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
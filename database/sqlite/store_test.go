@@ -0,0 +1,19 @@
+package sqlite_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/frperezr/microservices-demo/src/users-api/database/sqlite"
+	"github.com/frperezr/microservices-demo/src/users-api/database/storetest"
+)
+
+func TestStore(t *testing.T) {
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Store.Close()
+
+	storetest.Run(t, store)
+}
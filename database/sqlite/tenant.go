@@ -0,0 +1,101 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// memberOfTenant restricts a query over users to the members of the tenant
+const memberOfTenant = "exists (select 1 from memberships m where m.user_id = users.id and m.organization_id = ?)"
+
+// run executes fn in a transaction. SQLite has no row level security, so
+// every query of the store limits the rows to the tenant of the context
+// itself, with scopeSelect, scopeUpdate and inTenant.
+func (us *UserStore) run(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := us.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// begin starts a transaction, the context must have a tenant or the system scope
+func (us *UserStore) begin(ctx context.Context) (*sqlx.Tx, error) {
+	if _, ok := tenant.FromContext(ctx); !ok && !tenant.IsSystem(ctx) {
+		return nil, tenant.ErrMissing
+	}
+
+	return us.Store.BeginTxx(ctx, nil)
+}
+
+// inTenant limits the rows to the ones of the tenant of the context, column
+// is the organization of the row. It matches every row in the system scope.
+func inTenant(ctx context.Context, column string) squirrel.Sqlizer {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return squirrel.Eq{column: id}
+	}
+	return squirrel.Expr("1 = 1")
+}
+
+// scopeSelect adds the tenant of the context to a query over users
+func scopeSelect(ctx context.Context, q squirrel.SelectBuilder) squirrel.SelectBuilder {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return q.Where(memberOfTenant, id)
+	}
+	return q
+}
+
+// scopeUpdate adds the tenant of the context to a update of users
+func scopeUpdate(ctx context.Context, q squirrel.UpdateBuilder) squirrel.UpdateBuilder {
+	if id, ok := tenant.FromContext(ctx); ok {
+		return q.Where(memberOfTenant, id)
+	}
+	return q
+}
+
+// getUser runs a scoped select over users returning a single row
+func getUser(ctx context.Context, tx *sqlx.Tx, q squirrel.SelectBuilder) (*user.User, error) {
+	sql, args, err := scopeSelect(ctx, q).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	u := &user.User{}
+
+	if err := tx.QueryRowxContext(ctx, sql, args...).StructScan(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// lockUser returns the current row of the user, there is no lock to take as
+// transactions do not overlap
+func lockUser(ctx context.Context, tx *sqlx.Tx, id string) (*user.User, error) {
+	return getUser(ctx, tx, squirrel.Select("*").From("users").Where("id = ?", id))
+}
+
+// updateUser runs a scoped update over users returning the updated row into
+// u, it sets updated_at and records the new version of the user
+func updateUser(ctx context.Context, tx *sqlx.Tx, q squirrel.UpdateBuilder, u *user.User) error {
+	sql, args, err := scopeUpdate(ctx, q.Set("updated_at", now())).Suffix("returning *").ToSql()
+	if err != nil {
+		return err
+	}
+
+	if err := tx.QueryRowxContext(ctx, sql, args...).StructScan(u); err != nil {
+		return err
+	}
+
+	return recordVersion(ctx, tx, u)
+}
@@ -0,0 +1,367 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// GetByID ...
+func (us *UserStore) GetByID(ctx context.Context, id string) (*user.User, error) {
+	if id == "" {
+		return nil, errors.New("must provide a id")
+	}
+
+	var c *user.User
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		c, err = getUser(ctx, tx, squirrel.Select("*").From("users").Where("id = ? and deleted_at is null", id))
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetByIDs returns the users with the given ids, in any order. Missing and
+// deleted users are left out.
+func (us *UserStore) GetByIDs(ctx context.Context, ids []string) ([]*user.User, error) {
+	uu := make([]*user.User, 0, len(ids))
+
+	if len(ids) == 0 {
+		return uu, nil
+	}
+
+	query := squirrel.Select("*").From("users").Where(squirrel.Eq{"id": ids}).Where("deleted_at is null")
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		sql, args, err := scopeSelect(ctx, query).ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.SelectContext(ctx, &uu, sql, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return uu, nil
+}
+
+// GetByEmail ...
+func (us *UserStore) GetByEmail(ctx context.Context, email string) (*user.User, error) {
+	if email == "" {
+		return nil, errors.New("must provide a email")
+	}
+
+	var c *user.User
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		c, err = getUser(ctx, tx, squirrel.Select("*").From("users").Where("email = ? and deleted_at is null", email))
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Create inserts the user with the default role, when the context has a
+// tenant the user is added as a member of it in the same transaction.
+func (us *UserStore) Create(ctx context.Context, u *user.User) error {
+	if u.Email == "" {
+		return errors.New("must provide a email")
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		return createUser(ctx, tx, u)
+	})
+}
+
+// errBatchRollback discards the transaction of a all-or-nothing batch
+var errBatchRollback = errors.New("batch rolled back")
+
+// BatchCreate inserts the users in a single transaction, returning the error
+// of each one, nil for the created users. A failed user is skipped unless
+// atomic is set, then nothing is created and the other users fail with
+// user.ErrBatchAborted.
+func (us *UserStore) BatchCreate(ctx context.Context, uu []*user.User, atomic bool) ([]error, error) {
+	errs := make([]error, len(uu))
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		for i, u := range uu {
+			if u.Email == "" {
+				errs[i] = errors.New("must provide a email")
+			} else if err := createSavepoint(ctx, tx, u); err != nil {
+				if _, ok := err.(*batchError); !ok {
+					return err
+				}
+				errs[i] = err.(*batchError).err
+			}
+
+			if errs[i] != nil && atomic {
+				for j := range errs {
+					if j != i {
+						errs[j] = user.ErrBatchAborted
+					}
+				}
+				return errBatchRollback
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil && err != errBatchRollback {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+// batchError is the failure of a single user of a batch
+type batchError struct {
+	err error
+}
+
+func (e *batchError) Error() string {
+	return e.err.Error()
+}
+
+// createSavepoint creates the user inside a savepoint, so its failure leaves
+// the transaction usable for the rest of the batch
+func createSavepoint(ctx context.Context, tx *sqlx.Tx, u *user.User) error {
+	if _, err := tx.ExecContext(ctx, "savepoint batch_create"); err != nil {
+		return err
+	}
+
+	if err := createUser(ctx, tx, u); err != nil {
+		if _, err := tx.ExecContext(ctx, "rollback to savepoint batch_create"); err != nil {
+			return err
+		}
+		return &batchError{err}
+	}
+
+	_, err := tx.ExecContext(ctx, "release savepoint batch_create")
+	return err
+}
+
+func createUser(ctx context.Context, tx *sqlx.Tx, u *user.User) error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	at := now()
+
+	query, args, err := squirrel.
+		Insert("users").
+		Columns("id", "email", "name", "last_name", "password", "created_at", "updated_at").
+		Values(id, strings.ToLower(u.Email), u.Name, u.LastName, u.Password, at, at).
+		Suffix("returning *").
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	if err := tx.QueryRowxContext(ctx, query, args...).StructScan(u); err != nil {
+		if isUniqueViolation(err) {
+			return user.ErrEmailTaken
+		}
+		return err
+	}
+
+	if orgID, ok := tenant.FromContext(ctx); ok {
+		if _, err := tx.ExecContext(ctx, "insert into memberships (organization_id, user_id, role, created_at) values (?, ?, ?, ?)", orgID, u.ID, user.OrgRoleMember, at); err != nil {
+			return err
+		}
+	}
+
+	if err := assignDefaultRole(ctx, tx, u.ID); err != nil {
+		return err
+	}
+
+	if err := recordVersion(ctx, tx, u); err != nil {
+		return err
+	}
+
+	if err := insertEvent(ctx, tx, user.EventUserCreated, nil, u); err != nil {
+		return err
+	}
+
+	u.Roles = []string{user.DefaultRole}
+	return nil
+}
+
+// assignDefaultRole grants user.DefaultRole to a user created in the transaction
+func assignDefaultRole(ctx context.Context, tx *sqlx.Tx, userID string) error {
+	_, err := tx.ExecContext(ctx, `insert into user_roles (user_id, role_id, created_at)
+		select ?, id, ? from roles where name = ?
+		on conflict do nothing`, userID, now(), user.DefaultRole)
+
+	return err
+}
+
+// Update ...
+func (us *UserStore) Update(ctx context.Context, u *user.User) error {
+	if u.ID == "" {
+		return errors.New("must provide a id")
+	}
+
+	query := squirrel.Update("users")
+
+	if u.Email != "" {
+		email := strings.ToLower(u.Email)
+		query = query.
+			Set("email", email).
+			Set("email_verified_at", squirrel.Expr("case when email = ? then email_verified_at end", email))
+	}
+
+	if u.Name != "" {
+		query = query.Set("name", u.Name)
+	}
+
+	if u.LastName != "" {
+		query = query.Set("last_name", u.LastName)
+	}
+
+	if u.Password != "" {
+		query = query.Set("password", u.Password)
+	}
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		before, err := lockUser(ctx, tx, u.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := updateUser(ctx, tx, query.Where("id = ? and deleted_at is null", u.ID), u); err != nil {
+			if isUniqueViolation(err) {
+				return user.ErrEmailTaken
+			}
+			return err
+		}
+
+		return insertEvent(ctx, tx, user.EventUserUpdated, before, u)
+	})
+}
+
+// Delete ...
+func (us *UserStore) Delete(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("must provide a id")
+	}
+
+	query := squirrel.Update("users").Set("deleted_at", now()).Where("id = ? and deleted_at is null", id)
+
+	return us.run(ctx, func(tx *sqlx.Tx) error {
+		before, err := lockUser(ctx, tx, id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+
+		u := &user.User{}
+
+		if err := updateUser(ctx, tx, query, u); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+
+		return insertEvent(ctx, tx, user.EventUserDeleted, before, u)
+	})
+}
+
+// Restore undoes the deletion of a user
+func (us *UserStore) Restore(ctx context.Context, id string) (*user.User, error) {
+	if id == "" {
+		return nil, errors.New("must provide a id")
+	}
+
+	query := squirrel.Update("users").Set("deleted_at", nil).Where("id = ? and deleted_at is not null", id)
+
+	u := &user.User{}
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		before, err := lockUser(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := updateUser(ctx, tx, query, u); err != nil {
+			return err
+		}
+
+		return insertEvent(ctx, tx, user.EventUserRestored, before, u)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// List ...
+func (us *UserStore) List(ctx context.Context, opts *user.ListOptions) ([]*user.User, error) {
+	query := squirrel.Select("*").From("users").Where("deleted_at is null").OrderBy("created_at desc")
+
+	if opts != nil {
+		if opts.Verified != nil {
+			if *opts.Verified {
+				query = query.Where("email_verified_at is not null")
+			} else {
+				query = query.Where("email_verified_at is null")
+			}
+		}
+
+		if opts.Limit > 0 {
+			query = query.Limit(opts.Limit)
+		} else if opts.Offset > 0 {
+			// SQLite only takes a offset after a limit
+			query = query.Limit(math.MaxInt64)
+		}
+
+		if opts.Offset > 0 {
+			query = query.Offset(opts.Offset)
+		}
+	}
+
+	uu := make([]*user.User, 0)
+
+	err := us.run(ctx, func(tx *sqlx.Tx) error {
+		sql, args, err := scopeSelect(ctx, query).ToSql()
+		if err != nil {
+			return err
+		}
+
+		return tx.SelectContext(ctx, &uu, sql, args...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return uu, nil
+}
@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Masterminds/squirrel"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// CreateEmailVerification stores a new verification token for the user,
+// any previous pending token of the same user stops being valid.
+func (us *UserStore) CreateEmailVerification(ctx context.Context, v *user.EmailVerification) error {
+	if v.UserID == "" {
+		return errors.New("must provide a user id")
+	}
+
+	if v.TokenHash == "" {
+		return errors.New("must provide a token hash")
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	tx, err := us.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "delete from email_verifications where user_id = ? and used_at is null", v.UserID); err != nil {
+		return err
+	}
+
+	query, args, err := squirrel.
+		Insert("email_verifications").
+		Columns("id", "user_id", "email", "token_hash", "expires_at", "created_at").
+		Values(id, v.UserID, v.Email, v.TokenHash, timestamp(v.ExpiresAt), now()).
+		Suffix("returning *").
+		ToSql()
+
+	if err != nil {
+		return err
+	}
+
+	if err := tx.QueryRowxContext(ctx, query, args...).StructScan(v); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// VerifyEmail consumes the token and marks the email it was issued for as verified.
+// The token is rejected if the user changed the email after it was issued.
+func (us *UserStore) VerifyEmail(ctx context.Context, tokenHash string) (*user.User, error) {
+	if tokenHash == "" {
+		return nil, user.ErrInvalidToken
+	}
+
+	tx, err := us.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	at := now()
+	v := &user.EmailVerification{}
+
+	row := tx.QueryRowxContext(ctx, "update email_verifications set used_at = ? where token_hash = ? and used_at is null and expires_at > ? returning *", at, tokenHash, at)
+	if err := row.StructScan(v); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	before, err := lockUser(ctx, tx, v.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	u := &user.User{}
+
+	query := squirrel.Update("users").Set("email_verified_at", at).Where("id = ? and email = ? and deleted_at is null", v.UserID, v.Email)
+	if err := updateUser(ctx, tx, query, u); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, user.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if err := insertEvent(ctx, tx, user.EventUserUpdated, before, u); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
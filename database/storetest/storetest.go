@@ -0,0 +1,1145 @@
+// Package storetest checks that a database.Store behaves like the others, each
+// driver runs it from its tests against a real database.
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/actor"
+	"github.com/frperezr/microservices-demo/src/users-api/database"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+// Run runs the suite against the store. The database may be shared with other
+// runs, every test creates its own users and organizations.
+func Run(t *testing.T, store database.Store) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, database.Store)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"EmailTaken", testEmailTaken},
+		{"Update", testUpdate},
+		{"DeleteAndRestore", testDeleteAndRestore},
+		{"DefaultRole", testDefaultRole},
+		{"OrganizationRoles", testOrganizationRoles},
+		{"Events", testEvents},
+		{"Outbox", testOutbox},
+		{"TenantIsolation", testTenantIsolation},
+		{"Memberships", testMemberships},
+		{"EmailVerification", testEmailVerification},
+		{"LoginFailures", testLoginFailures},
+		{"IPThrottling", testIPThrottling},
+		{"IdempotencyKeys", testIdempotencyKeys},
+		{"Groups", testGroups},
+		{"Webhooks", testWebhooks},
+		{"History", testHistory},
+		{"AuditChain", testAuditChain},
+		{"EmailChange", testEmailChange},
+		{"MFA", testMFA},
+		{"BatchCreate", testBatchCreate},
+		{"Import", testImport},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, store)
+		})
+	}
+}
+
+var seq int64
+
+// unique returns the name with a suffix no other run uses
+func unique(name string) string {
+	return fmt.Sprintf("%v-%v-%v", name, time.Now().UnixNano(), atomic.AddInt64(&seq, 1))
+}
+
+// system returns a context in the system scope
+func system() context.Context {
+	return tenant.WithSystem(context.Background())
+}
+
+// createUser creates a user with a unique email in the scope of ctx
+func createUser(t *testing.T, ctx context.Context, store database.Store) *user.User {
+	t.Helper()
+
+	u := &user.User{Email: unique("ada") + "@acme.test", Name: "Ada", LastName: "Lovelace", Password: "hash of the password"}
+	if err := store.Create(ctx, u); err != nil {
+		t.Fatalf("Create = %v", err)
+	}
+
+	return u
+}
+
+// createOrganization creates a organization owned by a new user
+func createOrganization(t *testing.T, store database.Store) (*user.Organization, *user.User) {
+	t.Helper()
+
+	owner := createUser(t, system(), store)
+
+	slug := unique("acme")
+	org := &user.Organization{Name: slug, Slug: slug}
+	if err := store.CreateOrganization(system(), org, owner.ID); err != nil {
+		t.Fatalf("CreateOrganization = %v", err)
+	}
+
+	return org, owner
+}
+
+func testCreateAndGet(t *testing.T, store database.Store) {
+	ctx := system()
+
+	u := &user.User{Email: strings.ToUpper(unique("ada")) + "@ACME.TEST", Name: "Ada", LastName: "Lovelace", Password: "hash of the password"}
+	if err := store.Create(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+
+	if u.ID == "" || u.CreatedAt.IsZero() || u.UpdatedAt.IsZero() {
+		t.Fatalf("Create = %+v, want the id and timestamps", u)
+	}
+
+	if u.Email != strings.ToLower(u.Email) {
+		t.Fatalf("email = %v, want it lowercased", u.Email)
+	}
+
+	got, err := store.GetByID(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Email != u.Email || got.Name != u.Name || got.LastName != u.LastName || got.Password != u.Password {
+		t.Fatalf("GetByID = %+v, want %+v", got, u)
+	}
+
+	if got.EmailVerifiedAt != nil || got.DeletedAt != nil || got.FailedLoginAttempts != 0 {
+		t.Fatalf("GetByID = %+v, want a unverified active user", got)
+	}
+
+	if got, err := store.GetByEmail(ctx, u.Email); err != nil || got.ID != u.ID {
+		t.Fatalf("GetByEmail = %v, %v, want %v", got, err, u.ID)
+	}
+
+	uu, err := store.GetByIDs(ctx, []string{u.ID, "00000000-0000-0000-0000-000000000000"})
+	if err != nil || len(uu) != 1 || uu[0].ID != u.ID {
+		t.Fatalf("GetByIDs = %v, %v, want only %v", uu, err, u.ID)
+	}
+
+	if _, err := store.GetByID(ctx, "00000000-0000-0000-0000-000000000000"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetByID of a missing user = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func testEmailTaken(t *testing.T, store database.Store) {
+	ctx := system()
+	u := createUser(t, ctx, store)
+
+	err := store.Create(ctx, &user.User{Email: strings.ToUpper(u.Email), Name: "Ada", LastName: "Lovelace", Password: "hash of the password"})
+	if err != user.ErrEmailTaken {
+		t.Fatalf("Create with a taken email = %v, want %v", err, user.ErrEmailTaken)
+	}
+
+	other := createUser(t, ctx, store)
+
+	if err := store.Update(ctx, &user.User{ID: other.ID, Email: u.Email}); err != user.ErrEmailTaken {
+		t.Fatalf("Update to a taken email = %v, want %v", err, user.ErrEmailTaken)
+	}
+}
+
+func testUpdate(t *testing.T, store database.Store) {
+	ctx := system()
+	u := createUser(t, ctx, store)
+
+	changed := &user.User{ID: u.ID, Name: "Augusta"}
+	if err := store.Update(ctx, changed); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.GetByID(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Name != "Augusta" || got.LastName != u.LastName || got.Email != u.Email {
+		t.Fatalf("GetByID = %+v, want only the name changed", got)
+	}
+
+	if got.UpdatedAt.Before(u.UpdatedAt) {
+		t.Fatalf("updated at = %v, want it after %v", got.UpdatedAt, u.UpdatedAt)
+	}
+
+	if err := store.Update(ctx, &user.User{ID: "00000000-0000-0000-0000-000000000000", Name: "Nobody"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("Update of a missing user = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func testDeleteAndRestore(t *testing.T, store database.Store) {
+	ctx := system()
+	u := createUser(t, ctx, store)
+
+	if err := store.Delete(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.GetByID(ctx, u.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetByID of a deleted user = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	// deleting twice is not a error
+	if err := store.Delete(ctx, u.ID); err != nil {
+		t.Fatalf("Delete of a deleted user = %v", err)
+	}
+
+	restored, err := store.Restore(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.ID != u.ID || restored.DeletedAt != nil {
+		t.Fatalf("Restore = %+v, want the active user", restored)
+	}
+
+	if _, err := store.Restore(ctx, u.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("Restore of a active user = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func testDefaultRole(t *testing.T, store database.Store) {
+	ctx := system()
+	u := createUser(t, ctx, store)
+
+	roles, err := store.GetUserRoles(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(roles[u.ID]) != 1 || roles[u.ID][0] != user.DefaultRole {
+		t.Fatalf("roles = %v, want [%v]", roles[u.ID], user.DefaultRole)
+	}
+}
+
+func testOrganizationRoles(t *testing.T, store database.Store) {
+	acme, owner := createOrganization(t, store)
+
+	globex := &user.Organization{Name: unique("globex"), Slug: unique("globex")}
+	if err := store.CreateOrganization(system(), globex, owner.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	inAcme := tenant.WithID(context.Background(), acme.ID)
+	inGlobex := tenant.WithID(context.Background(), globex.ID)
+
+	if err := store.AssignRole(inAcme, owner.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		ctx  context.Context
+		want bool
+	}{
+		{"in the organization", inAcme, true},
+		{"in another organization", inGlobex, false},
+		{"outside of any organization", system(), false},
+	} {
+		allowed, err := store.HasPermission(tt.ctx, owner.ID, user.PermissionDeleteUsers)
+		if err != nil || allowed != tt.want {
+			t.Fatalf("HasPermission %v = %v, %v, want %v", tt.name, allowed, err, tt.want)
+		}
+	}
+
+	roles, err := store.GetUserRoles(inGlobex, owner.ID)
+	if err != nil || len(roles[owner.ID]) != 1 || roles[owner.ID][0] != user.DefaultRole {
+		t.Fatalf("GetUserRoles in another organization = %v, %v, want [%v]", roles[owner.ID], err, user.DefaultRole)
+	}
+
+	// revoking in another organization leaves the grant
+	if err := store.RevokeRole(inGlobex, owner.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if allowed, err := store.HasPermission(inAcme, owner.ID, user.PermissionDeleteUsers); err != nil || !allowed {
+		t.Fatalf("HasPermission after a revoke in another organization = %v, %v, want true", allowed, err)
+	}
+
+	// the grants go with the membership
+	member := createUser(t, inAcme, store)
+	if err := store.AssignRole(inAcme, member.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.RemoveMember(system(), acme.ID, member.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	roles, err = store.GetUserRoles(inAcme, member.ID)
+	if err != nil || len(roles[member.ID]) != 1 {
+		t.Fatalf("GetUserRoles after RemoveMember = %v, %v, want [%v]", roles[member.ID], err, user.DefaultRole)
+	}
+}
+
+func testEvents(t *testing.T, store database.Store) {
+	ctx := system()
+	u := createUser(t, ctx, store)
+
+	if err := store.Update(ctx, &user.User{ID: u.ID, Name: "Augusta"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Delete(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	ee, err := store.ListEvents(ctx, &user.EventFilter{UserIDs: []string{u.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{user.EventUserCreated, user.EventUserUpdated, user.EventUserDeleted}
+	if len(ee) != len(want) {
+		t.Fatalf("got %v events, want %v", len(ee), len(want))
+	}
+
+	for i, e := range ee {
+		if e.Type != want[i] || e.UserID != u.ID {
+			t.Fatalf("event #%v = %v of %v, want %v", i+1, e.Type, e.UserID, want[i])
+		}
+	}
+
+	if len(ee[0].Before) != 0 || len(ee[1].Before) == 0 {
+		t.Fatal("want the previous user only on the changes")
+	}
+
+	if strings.Contains(string(ee[0].Payload), u.Password) {
+		t.Fatal("the event has the password")
+	}
+
+	// resuming after the first event skips it
+	rest, err := store.ListEvents(ctx, &user.EventFilter{AfterTxID: ee[0].TxID, AfterID: ee[0].ID, UserIDs: []string{u.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rest) != 2 || rest[0].ID != ee[1].ID {
+		t.Fatalf("ListEvents after the first event = %v events, want the other 2", len(rest))
+	}
+
+	e, err := store.GetEvent(ctx, ee[1].ID)
+	if err != nil || e.Type != user.EventUserUpdated {
+		t.Fatalf("GetEvent = %v, %v, want the %v event", e, err, user.EventUserUpdated)
+	}
+
+	txID, id, err := store.EventsHead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := store.ListEvents(ctx, &user.EventFilter{AfterTxID: txID, AfterID: id, UserIDs: []string{u.ID}})
+	if err != nil || len(after) != 0 {
+		t.Fatalf("ListEvents after the head = %v events, %v, want none", len(after), err)
+	}
+
+	if _, err := store.Restore(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err = store.ListEvents(ctx, &user.EventFilter{AfterTxID: txID, AfterID: id, UserIDs: []string{u.ID}})
+	if err != nil || len(after) != 1 || after[0].Type != user.EventUserRestored {
+		t.Fatalf("ListEvents after the head = %v events, %v, want the %v event", len(after), err, user.EventUserRestored)
+	}
+}
+
+func testOutbox(t *testing.T, store database.Store) {
+	ctx := system()
+	u := createUser(t, ctx, store)
+
+	if err := store.Update(ctx, &user.User{ID: u.ID, Name: "Augusta"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the outbox is shared with the other tests, their events are accepted
+	var (
+		seen  []int64
+		other []int64
+	)
+
+	_, err := store.ProcessOutbox(ctx, 1000, 10, func(e *user.Event) error {
+		if e.UserID != u.ID {
+			return nil
+		}
+
+		seen = append(seen, e.ID)
+		if len(seen) > 1 {
+			return nil
+		}
+
+		// a relay running meanwhile leaves the claimed events of the user
+		if _, err := store.ProcessOutbox(ctx, 1000, 10, func(e *user.Event) error {
+			if e.UserID == u.ID {
+				other = append(other, e.ID)
+			}
+			return nil
+		}); err != nil {
+			t.Errorf("ProcessOutbox of another relay = %v", err)
+		}
+
+		return errors.New("sink is down")
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "sink is down") {
+		t.Fatalf("ProcessOutbox = %v, want the error of the sink", err)
+	}
+
+	if len(seen) != 1 || len(other) != 0 {
+		t.Fatalf("got events %v and %v of another relay, want only the first one", seen, other)
+	}
+
+	// the failed event and the ones after it are handed again, in order
+	var again []int64
+
+	if _, err := store.ProcessOutbox(ctx, 1000, 10, func(e *user.Event) error {
+		if e.UserID == u.ID {
+			again = append(again, e.ID)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(again) != 2 || again[0] != seen[0] || again[1] <= again[0] {
+		t.Fatalf("got events %v after the failure, want %v and the next one", again, seen[0])
+	}
+
+	ee, err := store.ListEvents(ctx, &user.EventFilter{UserIDs: []string{u.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range ee {
+		if e.PublishedAt == nil {
+			t.Fatalf("event %v is not published", e.ID)
+		}
+	}
+}
+
+func testTenantIsolation(t *testing.T, store database.Store) {
+	acme, _ := createOrganization(t, store)
+	globex, _ := createOrganization(t, store)
+
+	member := createUser(t, tenant.WithID(context.Background(), acme.ID), store)
+
+	if _, err := store.GetMembership(system(), acme.ID, member.ID); err != nil {
+		t.Fatalf("GetMembership = %v, want the user created in the tenant to be a member", err)
+	}
+
+	if _, err := store.GetByID(tenant.WithID(context.Background(), acme.ID), member.ID); err != nil {
+		t.Fatalf("GetByID in the tenant = %v", err)
+	}
+
+	other := tenant.WithID(context.Background(), globex.ID)
+
+	if _, err := store.GetByID(other, member.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetByID in another tenant = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	if err := store.Update(other, &user.User{ID: member.ID, Name: "Mallory"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("Update in another tenant = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	ee, err := store.ListEvents(other, &user.EventFilter{UserIDs: []string{member.ID}})
+	if err != nil || len(ee) != 0 {
+		t.Fatalf("ListEvents in another tenant = %v events, %v, want none", len(ee), err)
+	}
+}
+
+func testMemberships(t *testing.T, store database.Store) {
+	ctx := system()
+	org, owner := createOrganization(t, store)
+
+	m, err := store.GetMembership(ctx, org.ID, owner.ID)
+	if err != nil || m.Role != user.OrgRoleOwner {
+		t.Fatalf("GetMembership of the owner = %v, %v, want %v", m, err, user.OrgRoleOwner)
+	}
+
+	if _, err := store.SetMemberRole(ctx, org.ID, owner.ID, user.OrgRoleAdmin); err != user.ErrLastOwner {
+		t.Fatalf("SetMemberRole of the last owner = %v, want %v", err, user.ErrLastOwner)
+	}
+
+	if err := store.RemoveMember(ctx, org.ID, owner.ID); err != user.ErrLastOwner {
+		t.Fatalf("RemoveMember of the last owner = %v, want %v", err, user.ErrLastOwner)
+	}
+
+	stranger := createUser(t, ctx, store)
+
+	if _, err := store.GetMembership(ctx, org.ID, stranger.ID); err != user.ErrNotMember {
+		t.Fatalf("GetMembership of a stranger = %v, want %v", err, user.ErrNotMember)
+	}
+
+	oo, err := store.ListOrganizations(ctx, owner.ID)
+	if err != nil || len(oo) != 1 || oo[0].ID != org.ID {
+		t.Fatalf("ListOrganizations = %v, %v, want %v", oo, err, org.ID)
+	}
+
+	slug := &user.Organization{Name: "Acme", Slug: strings.ToUpper(org.Slug)}
+	if err := store.CreateOrganization(ctx, slug, owner.ID); err != user.ErrSlugTaken {
+		t.Fatalf("CreateOrganization with a taken slug = %v, want %v", err, user.ErrSlugTaken)
+	}
+}
+
+func testEmailVerification(t *testing.T, store database.Store) {
+	ctx := system()
+	u := createUser(t, ctx, store)
+
+	first := &user.EmailVerification{UserID: u.ID, Email: u.Email, TokenHash: unique("first"), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := store.CreateEmailVerification(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+
+	second := &user.EmailVerification{UserID: u.ID, Email: u.Email, TokenHash: unique("second"), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := store.CreateEmailVerification(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.VerifyEmail(ctx, first.TokenHash); err != user.ErrInvalidToken {
+		t.Fatalf("VerifyEmail with a replaced token = %v, want %v", err, user.ErrInvalidToken)
+	}
+
+	verified, err := store.VerifyEmail(ctx, second.TokenHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if verified.ID != u.ID || !verified.IsEmailVerified() {
+		t.Fatalf("VerifyEmail = %+v, want the user verified", verified)
+	}
+
+	if _, err := store.VerifyEmail(ctx, second.TokenHash); err != user.ErrInvalidToken {
+		t.Fatalf("VerifyEmail with a used token = %v, want %v", err, user.ErrInvalidToken)
+	}
+
+	expired := &user.EmailVerification{UserID: u.ID, Email: u.Email, TokenHash: unique("expired"), ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := store.CreateEmailVerification(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.VerifyEmail(ctx, expired.TokenHash); err != user.ErrInvalidToken {
+		t.Fatalf("VerifyEmail with a expired token = %v, want %v", err, user.ErrInvalidToken)
+	}
+}
+
+func testLoginFailures(t *testing.T, store database.Store) {
+	ctx := system()
+	u := createUser(t, ctx, store)
+
+	now := time.Now()
+
+	for i := 1; i <= 3; i++ {
+		n, err := store.RecordLoginFailure(ctx, u.ID, now, now.Add(-time.Hour))
+		if err != nil || n != i {
+			t.Fatalf("RecordLoginFailure #%v = %v, %v, want %v", i, n, err, i)
+		}
+	}
+
+	// the failures before the window are forgotten
+	if n, err := store.RecordLoginFailure(ctx, u.ID, now.Add(2*time.Hour), now.Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("RecordLoginFailure after the window = %v, %v, want 1", n, err)
+	}
+
+	until := now.Add(time.Hour).Truncate(time.Second)
+	if err := store.LockUser(ctx, u.ID, until); err != nil {
+		t.Fatal(err)
+	}
+
+	locked, err := store.GetByID(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if locked.LockedUntil == nil || !locked.LockedUntil.Equal(until) {
+		t.Fatalf("locked until = %v, want %v", locked.LockedUntil, until)
+	}
+
+	reset, err := store.ResetLoginFailures(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reset.FailedLoginAttempts != 0 || reset.LockedUntil != nil || reset.LastFailedLoginAt != nil {
+		t.Fatalf("ResetLoginFailures = %+v, want no failures or lock", reset)
+	}
+}
+
+func testIPThrottling(t *testing.T, store database.Store) {
+	ctx := system()
+	ip := unique("ip")
+
+	if until, err := store.GetIPBlockedUntil(ctx, ip); err != nil || until != nil {
+		t.Fatalf("GetIPBlockedUntil of a new address = %v, %v, want nil", until, err)
+	}
+
+	now := time.Now()
+
+	for i := 1; i <= 2; i++ {
+		n, err := store.RecordIPFailure(ctx, ip, now, now.Add(-time.Hour))
+		if err != nil || n != i {
+			t.Fatalf("RecordIPFailure #%v = %v, %v, want %v", i, n, err, i)
+		}
+	}
+
+	until := now.Add(time.Hour).Truncate(time.Second)
+	if err := store.BlockIP(ctx, ip, until); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.GetIPBlockedUntil(ctx, ip)
+	if err != nil || got == nil || !got.Equal(until) {
+		t.Fatalf("GetIPBlockedUntil = %v, %v, want %v", got, err, until)
+	}
+}
+
+func testIdempotencyKeys(t *testing.T, store database.Store) {
+	ctx := system()
+	scope := unique("acme/ada")
+
+	claim := &user.IdempotencyKey{Scope: scope, Key: "key", RequestHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+
+	if _, claimed, err := store.ClaimIdempotencyKey(ctx, claim); err != nil || !claimed {
+		t.Fatalf("ClaimIdempotencyKey = %v, %v, want it claimed", claimed, err)
+	}
+
+	existing, claimed, err := store.ClaimIdempotencyKey(ctx, claim)
+	if err != nil || claimed || existing.CompletedAt != nil {
+		t.Fatalf("ClaimIdempotencyKey while in progress = %v, %v, want the pending key", claimed, err)
+	}
+
+	claim.Response = []byte("response")
+	if err := store.CompleteIdempotencyKey(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+
+	existing, claimed, err = store.ClaimIdempotencyKey(ctx, claim)
+	if err != nil || claimed || string(existing.Response) != "response" || existing.CompletedAt == nil {
+		t.Fatalf("ClaimIdempotencyKey after the response = %v, %v, want the stored response", claimed, err)
+	}
+
+	// a released key can be claimed again, a completed one is kept
+	if err := store.ReleaseIdempotencyKey(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, claimed, err := store.ClaimIdempotencyKey(ctx, claim); err != nil || claimed {
+		t.Fatalf("ClaimIdempotencyKey after releasing a completed key = %v, %v, want the stored response", claimed, err)
+	}
+
+	expired := &user.IdempotencyKey{Scope: scope, Key: "expired", RequestHash: "hash", ExpiresAt: time.Now().Add(-time.Minute)}
+	if _, claimed, err := store.ClaimIdempotencyKey(ctx, expired); err != nil || !claimed {
+		t.Fatalf("ClaimIdempotencyKey = %v, %v, want it claimed", claimed, err)
+	}
+
+	expired.ExpiresAt = time.Now().Add(time.Hour)
+	if _, claimed, err := store.ClaimIdempotencyKey(ctx, expired); err != nil || !claimed {
+		t.Fatalf("ClaimIdempotencyKey of a expired key = %v, %v, want it taken over", claimed, err)
+	}
+}
+
+func testGroups(t *testing.T, store database.Store) {
+	org, owner := createOrganization(t, store)
+	other, _ := createOrganization(t, store)
+
+	ctx := tenant.WithID(context.Background(), org.ID)
+
+	admins := &user.Group{OrganizationID: org.ID, Name: "admins"}
+	if err := store.CreateGroup(ctx, admins); err != nil {
+		t.Fatal(err)
+	}
+
+	staff := &user.Group{OrganizationID: org.ID, Name: "staff"}
+	if err := store.CreateGroup(ctx, staff); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.CreateGroup(ctx, &user.Group{OrganizationID: org.ID, Name: "admins"}); err != user.ErrGroupNameTaken {
+		t.Fatalf("CreateGroup with a taken name = %v, want %v", err, user.ErrGroupNameTaken)
+	}
+
+	if err := store.UpdateGroup(ctx, &user.Group{ID: admins.ID, Description: "Can do anything"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.GetGroup(ctx, admins.ID)
+	if err != nil || got.Name != "admins" || got.Description != "Can do anything" {
+		t.Fatalf("GetGroup = %+v, %v, want the description changed", got, err)
+	}
+
+	if _, err := store.GetGroup(tenant.WithID(context.Background(), other.ID), admins.ID); err != user.ErrGroupNotFound {
+		t.Fatalf("GetGroup in another tenant = %v, want %v", err, user.ErrGroupNotFound)
+	}
+
+	// staff contains admins, so the owner in admins is in both
+	if err := store.AddGroupMember(ctx, &user.GroupMember{GroupID: admins.ID, UserID: owner.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.AddGroupMember(ctx, &user.GroupMember{GroupID: staff.ID, MemberGroupID: admins.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.AddGroupMember(ctx, &user.GroupMember{GroupID: admins.ID, MemberGroupID: staff.ID}); err != user.ErrGroupCycle {
+		t.Fatalf("AddGroupMember closing a cycle = %v, want %v", err, user.ErrGroupCycle)
+	}
+
+	mm, err := store.ListGroupMembers(ctx, staff.ID)
+	if err != nil || len(mm) != 1 || mm[0].MemberGroupID != admins.ID {
+		t.Fatalf("ListGroupMembers = %v, %v, want the admins group", mm, err)
+	}
+
+	gg, err := store.ListUserGroups(ctx, owner.ID)
+	if err != nil || len(gg) != 2 || gg[0].ID != admins.ID || gg[1].ID != staff.ID {
+		t.Fatalf("ListUserGroups = %v, %v, want admins and staff", gg, err)
+	}
+
+	if err := store.RemoveGroupMember(ctx, &user.GroupMember{GroupID: admins.ID, UserID: owner.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.RemoveGroupMember(ctx, &user.GroupMember{GroupID: admins.ID, UserID: owner.ID}); err != user.ErrNotMember {
+		t.Fatalf("RemoveGroupMember of a removed user = %v, want %v", err, user.ErrNotMember)
+	}
+
+	if err := store.DeleteGroup(ctx, admins.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.GetGroup(ctx, admins.ID); err != user.ErrGroupNotFound {
+		t.Fatalf("GetGroup of a deleted group = %v, want %v", err, user.ErrGroupNotFound)
+	}
+
+	gg, err = store.ListGroups(ctx, org.ID)
+	if err != nil || len(gg) != 1 || gg[0].ID != staff.ID {
+		t.Fatalf("ListGroups = %v, %v, want only staff", gg, err)
+	}
+}
+
+func testWebhooks(t *testing.T, store database.Store) {
+	org, _ := createOrganization(t, store)
+	other, _ := createOrganization(t, store)
+
+	ctx := tenant.WithID(context.Background(), org.ID)
+
+	w := &user.Webhook{OrganizationID: org.ID, URL: "https://acme.test/hooks", EventTypes: []string{user.EventUserUpdated}, Active: true, Secret: []byte("secret")}
+	if err := store.CreateWebhook(ctx, w); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.GetWebhook(ctx, w.ID)
+	if err != nil || len(got.EventTypes) != 1 || got.EventTypes[0] != user.EventUserUpdated || string(got.Secret) != "secret" {
+		t.Fatalf("GetWebhook = %+v, %v, want %+v", got, err, w)
+	}
+
+	if _, err := store.GetWebhook(tenant.WithID(context.Background(), other.ID), w.ID); err != user.ErrWebhookNotFound {
+		t.Fatalf("GetWebhook in another tenant = %v, want %v", err, user.ErrWebhookNotFound)
+	}
+
+	ww, err := store.ListWebhooks(ctx, org.ID)
+	if err != nil || len(ww) != 1 || ww[0].ID != w.ID {
+		t.Fatalf("ListWebhooks = %v, %v, want %v", ww, err, w.ID)
+	}
+
+	member := createUser(t, ctx, store)
+	if err := store.Update(ctx, &user.User{ID: member.ID, Name: "Augusta"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ee, err := store.ListEvents(system(), &user.EventFilter{UserIDs: []string{member.ID}})
+	if err != nil || len(ee) != 2 {
+		t.Fatalf("ListEvents = %v events, %v, want 2", len(ee), err)
+	}
+
+	// only the types the webhook is subscribed to are delivered, once
+	for _, tt := range []struct {
+		e    *user.Event
+		want int
+	}{
+		{ee[0], 0},
+		{ee[1], 1},
+		{ee[1], 0},
+	} {
+		if n, err := store.EnqueueWebhookDeliveries(system(), tt.e); err != nil || n != tt.want {
+			t.Fatalf("EnqueueWebhookDeliveries of %v = %v, %v, want %v", tt.e.Type, n, err, tt.want)
+		}
+	}
+
+	// other runs may share the queue, only the delivery of the webhook counts
+	claim := func() *user.WebhookDelivery {
+		dd, err := store.ClaimWebhookDeliveries(system(), 1000, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, d := range dd {
+			if d.WebhookID == w.ID {
+				return d
+			}
+		}
+
+		return nil
+	}
+
+	d := claim()
+	if d == nil || d.EventID != ee[1].ID || d.Status != user.DeliveryPending {
+		t.Fatalf("ClaimWebhookDeliveries = %+v, want the pending delivery of event %v", d, ee[1].ID)
+	}
+
+	if claimed := claim(); claimed != nil {
+		t.Fatalf("ClaimWebhookDeliveries of a claimed delivery = %+v, want it skipped", claimed)
+	}
+
+	code := 200
+	d.Status, d.Attempts, d.LastStatusCode = user.DeliverySucceeded, 1, &code
+
+	if err := store.RecordWebhookAttempt(system(), d, &user.WebhookAttempt{DeliveryID: d.ID, StatusCode: &code, DurationMS: 12}); err != nil {
+		t.Fatal(err)
+	}
+
+	dd, err := store.ListWebhookDeliveries(ctx, w.ID, user.DeliverySucceeded)
+	if err != nil || len(dd) != 1 || dd[0].Attempts != 1 {
+		t.Fatalf("ListWebhookDeliveries = %v, %v, want the succeeded delivery", dd, err)
+	}
+
+	aa, err := store.ListWebhookAttempts(ctx, d.ID)
+	if err != nil || len(aa) != 1 || aa[0].StatusCode == nil || *aa[0].StatusCode != code {
+		t.Fatalf("ListWebhookAttempts = %v, %v, want the attempt", aa, err)
+	}
+
+	replayed, err := store.ReplayWebhookDelivery(ctx, d.ID)
+	if err != nil || replayed.Status != user.DeliveryPending || replayed.Attempts != 0 {
+		t.Fatalf("ReplayWebhookDelivery = %+v, %v, want it pending again", replayed, err)
+	}
+
+	if _, err := store.ReplayWebhookDelivery(tenant.WithID(context.Background(), other.ID), d.ID); err != user.ErrDeliveryNotFound {
+		t.Fatalf("ReplayWebhookDelivery in another tenant = %v, want %v", err, user.ErrDeliveryNotFound)
+	}
+
+	if err := store.DeleteWebhook(ctx, w.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.GetWebhook(ctx, w.ID); err != user.ErrWebhookNotFound {
+		t.Fatalf("GetWebhook of a deleted webhook = %v, want %v", err, user.ErrWebhookNotFound)
+	}
+}
+
+func testHistory(t *testing.T, store database.Store) {
+	ctx := system()
+	u := createUser(t, ctx, store)
+
+	if err := store.Update(ctx, &user.User{ID: u.ID, Name: "Augusta"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a change of the password alone is not a new version
+	if err := store.Update(ctx, &user.User{ID: u.ID, Password: "another hash"}); err != nil {
+		t.Fatal(err)
+	}
+
+	vv, err := store.ListUserVersions(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vv) != 2 || vv[0].Name != "Ada" || vv[1].Name != "Augusta" {
+		t.Fatalf("ListUserVersions = %v versions, want Ada and Augusta", len(vv))
+	}
+
+	if vv[0].ValidTo == nil || !vv[0].ValidTo.Equal(vv[1].ValidFrom) || vv[1].ValidTo != nil {
+		t.Fatalf("versions valid until %v and %v, want the first one closed by the second", vv[0].ValidTo, vv[1].ValidTo)
+	}
+
+	first, err := store.GetUserAsOf(ctx, u.ID, vv[0].ValidFrom)
+	if err != nil || first.Version != vv[0].Version || first.Name != "Ada" {
+		t.Fatalf("GetUserAsOf the creation = %+v, %v, want Ada", first, err)
+	}
+
+	current, err := store.GetUserAsOf(ctx, u.ID, time.Now().Add(time.Minute))
+	if err != nil || current.Name != "Augusta" {
+		t.Fatalf("GetUserAsOf now = %+v, %v, want Augusta", current, err)
+	}
+
+	if _, err := store.GetUserAsOf(ctx, u.ID, vv[0].ValidFrom.Add(-time.Second)); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetUserAsOf before the creation = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	org, _ := createOrganization(t, store)
+
+	vv, err = store.ListUserVersions(tenant.WithID(context.Background(), org.ID), u.ID)
+	if err != nil || len(vv) != 0 {
+		t.Fatalf("ListUserVersions in another tenant = %v versions, %v, want none", len(vv), err)
+	}
+}
+
+func testAuditChain(t *testing.T, store database.Store) {
+	ctx := actor.With(system(), actor.Actor{UserID: "admin", RequestID: unique("request")})
+	u := createUser(t, ctx, store)
+
+	if err := store.Update(ctx, &user.User{ID: u.ID, Name: "Augusta", Password: "another hash"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Delete(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	aa, err := store.ListAuditEvents(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{user.EventUserCreated, user.EventUserUpdated, user.EventUserDeleted}
+	if len(aa) != len(want) {
+		t.Fatalf("got %v audit events, want %v", len(aa), len(want))
+	}
+
+	for i, a := range aa {
+		if a.Action != want[i] || a.ActorID != "admin" || a.RequestID != actor.FromContext(ctx).RequestID {
+			t.Fatalf("audit event #%v = %v by %v, want %v by admin", i+1, a.Action, a.ActorID, want[i])
+		}
+	}
+
+	// the hashes must survive the round trip through the database
+	if err := user.VerifyAuditChain(aa); err != nil {
+		t.Fatalf("VerifyAuditChain = %v", err)
+	}
+
+	if strings.Contains(string(aa[1].Changes), "another hash") || !strings.Contains(string(aa[1].Changes), user.AuditRedacted) {
+		t.Fatalf("changes = %s, want the password redacted", aa[1].Changes)
+	}
+}
+
+func testEmailChange(t *testing.T, store database.Store) {
+	ctx := system()
+	u := createUser(t, ctx, store)
+
+	change := func(email string) *user.EmailChange {
+		t.Helper()
+
+		c := &user.EmailChange{
+			UserID:          u.ID,
+			OldEmail:        u.Email,
+			NewEmail:        email,
+			TokenHash:       unique("confirm"),
+			RevertTokenHash: unique("revert"),
+			ExpiresAt:       time.Now().Add(time.Hour),
+			RevertExpiresAt: time.Now().Add(24 * time.Hour),
+		}
+
+		if err := store.CreateEmailChange(ctx, c); err != nil {
+			t.Fatalf("CreateEmailChange = %v", err)
+		}
+
+		return c
+	}
+
+	replaced := change(unique("grace") + "@acme.test")
+	c := change(unique("grace") + "@acme.test")
+
+	if _, err := store.ConfirmEmailChange(ctx, replaced.TokenHash); err != user.ErrInvalidToken {
+		t.Fatalf("ConfirmEmailChange with a replaced token = %v, want %v", err, user.ErrInvalidToken)
+	}
+
+	changed, err := store.ConfirmEmailChange(ctx, c.TokenHash)
+	if err != nil || changed.Email != c.NewEmail || !changed.IsEmailVerified() {
+		t.Fatalf("ConfirmEmailChange = %+v, %v, want the verified new email", changed, err)
+	}
+
+	if _, err := store.ConfirmEmailChange(ctx, c.TokenHash); err != user.ErrInvalidToken {
+		t.Fatalf("ConfirmEmailChange with a used token = %v, want %v", err, user.ErrInvalidToken)
+	}
+
+	reverted, err := store.RevertEmailChange(ctx, c.RevertTokenHash)
+	if err != nil || reverted.Email != u.Email {
+		t.Fatalf("RevertEmailChange = %+v, %v, want the old email back", reverted, err)
+	}
+
+	if _, err := store.RevertEmailChange(ctx, c.RevertTokenHash); err != user.ErrInvalidToken {
+		t.Fatalf("RevertEmailChange with a used token = %v, want %v", err, user.ErrInvalidToken)
+	}
+
+	// the new email was registered while the change waited
+	other := createUser(t, ctx, store)
+	taken := change(other.Email)
+
+	if _, err := store.ConfirmEmailChange(ctx, taken.TokenHash); err != user.ErrEmailTaken {
+		t.Fatalf("ConfirmEmailChange to a taken email = %v, want %v", err, user.ErrEmailTaken)
+	}
+}
+
+func testMFA(t *testing.T, store database.Store) {
+	ctx := system()
+	u := createUser(t, ctx, store)
+
+	if _, err := store.GetMFA(ctx, u.ID); err != user.ErrMFANotEnabled {
+		t.Fatalf("GetMFA before enrolling = %v, want %v", err, user.ErrMFANotEnabled)
+	}
+
+	// a unconfirmed enrollment is replaced by the next one
+	for _, secret := range []string{"first secret", "second secret"} {
+		if err := store.SaveMFA(ctx, &user.MFA{UserID: u.ID, Secret: []byte(secret)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := store.GetMFA(ctx, u.ID)
+	if err != nil || string(m.Secret) != "second secret" || m.ConfirmedAt != nil {
+		t.Fatalf("GetMFA = %+v, %v, want the second unconfirmed enrollment", m, err)
+	}
+
+	enabled, err := store.ConfirmMFA(ctx, u.ID, 10, []string{"code a", "code b"})
+	if err != nil || !enabled.IsMFAEnabled() {
+		t.Fatalf("ConfirmMFA = %+v, %v, want mfa enabled", enabled, err)
+	}
+
+	if _, err := store.ConfirmMFA(ctx, u.ID, 11, nil); err != user.ErrInvalidMFACode {
+		t.Fatalf("ConfirmMFA twice = %v, want %v", err, user.ErrInvalidMFACode)
+	}
+
+	if err := store.SaveMFA(ctx, &user.MFA{UserID: u.ID, Secret: []byte("third secret")}); err != user.ErrMFAAlreadyEnabled {
+		t.Fatalf("SaveMFA once enabled = %v, want %v", err, user.ErrMFAAlreadyEnabled)
+	}
+
+	// a step is only accepted after the last one used
+	if err := store.UseMFAStep(ctx, u.ID, 10); err != user.ErrInvalidMFACode {
+		t.Fatalf("UseMFAStep of the used step = %v, want %v", err, user.ErrInvalidMFACode)
+	}
+
+	if err := store.UseMFAStep(ctx, u.ID, 11); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.UseRecoveryCode(ctx, u.ID, "code a"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, code := range []string{"code a", "code c"} {
+		if err := store.UseRecoveryCode(ctx, u.ID, code); err != user.ErrInvalidMFACode {
+			t.Fatalf("UseRecoveryCode of %q = %v, want %v", code, err, user.ErrInvalidMFACode)
+		}
+	}
+
+	disabled, err := store.DeleteMFA(ctx, u.ID)
+	if err != nil || disabled.IsMFAEnabled() {
+		t.Fatalf("DeleteMFA = %+v, %v, want mfa disabled", disabled, err)
+	}
+
+	if _, err := store.GetMFA(ctx, u.ID); err != user.ErrMFANotEnabled {
+		t.Fatalf("GetMFA after DeleteMFA = %v, want %v", err, user.ErrMFANotEnabled)
+	}
+}
+
+func testBatchCreate(t *testing.T, store database.Store) {
+	ctx := system()
+	existing := createUser(t, ctx, store)
+
+	batch := func() []*user.User {
+		return []*user.User{
+			{Email: unique("ada") + "@acme.test", Name: "Ada", LastName: "Lovelace", Password: "hash of the password"},
+			{Email: existing.Email, Name: "Ada", LastName: "Lovelace", Password: "hash of the password"},
+			{Email: unique("grace") + "@acme.test", Name: "Grace", LastName: "Hopper", Password: "hash of the password"},
+		}
+	}
+
+	uu := batch()
+
+	errs, err := store.BatchCreate(ctx, uu, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errs[0] != nil || errs[1] != user.ErrEmailTaken || errs[2] != nil {
+		t.Fatalf("BatchCreate = %v, want only the taken email to fail", errs)
+	}
+
+	for _, i := range []int{0, 2} {
+		if _, err := store.GetByID(ctx, uu[i].ID); err != nil {
+			t.Fatalf("GetByID of user #%v = %v", i, err)
+		}
+	}
+
+	uu = batch()
+
+	errs, err = store.BatchCreate(ctx, uu, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errs[0] != user.ErrBatchAborted || errs[1] != user.ErrEmailTaken || errs[2] != user.ErrBatchAborted {
+		t.Fatalf("atomic BatchCreate = %v, want the others aborted", errs)
+	}
+
+	if _, err := store.GetByEmail(ctx, uu[0].Email); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetByEmail of a aborted user = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func testImport(t *testing.T, store database.Store) {
+	org, owner := createOrganization(t, store)
+	ctx := tenant.WithID(context.Background(), org.ID)
+
+	emails := []string{unique("ada") + "@acme.test", owner.Email, unique("grace") + "@acme.test"}
+
+	users := func() []*user.User {
+		uu := make([]*user.User, 0, len(emails))
+		for _, email := range emails {
+			uu = append(uu, &user.User{Email: email, Name: "Ada", LastName: "Lovelace", Password: "hash of the password"})
+		}
+		return uu
+	}
+
+	errs, err := store.ImportUsers(ctx, users(), true)
+	if err != nil || errs[0] != nil || errs[1] != user.ErrEmailTaken || errs[2] != nil {
+		t.Fatalf("ImportUsers dry run = %v, %v, want only the taken email to fail", errs, err)
+	}
+
+	if _, err := store.GetByEmail(system(), emails[0]); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetByEmail after a dry run = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	errs, err = store.ImportUsers(ctx, users(), false)
+	if err != nil || errs[0] != nil || errs[1] != user.ErrEmailTaken || errs[2] != nil {
+		t.Fatalf("ImportUsers = %v, %v, want only the taken email to fail", errs, err)
+	}
+
+	// importing the same users again is a no-op
+	errs, err = store.ImportUsers(ctx, users(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, err := range errs {
+		if err != user.ErrEmailTaken {
+			t.Fatalf("ImportUsers again, user #%v = %v, want %v", i, err, user.ErrEmailTaken)
+		}
+	}
+
+	// the imported users are members of the tenant
+	uu, err := store.ExportUsers(ctx, "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported := make(map[string]bool)
+	for _, u := range uu {
+		exported[u.Email] = true
+	}
+
+	if len(uu) != 3 || !exported[emails[0]] || !exported[emails[1]] || !exported[emails[2]] {
+		t.Fatalf("ExportUsers = %v users, want the owner and the 2 imported", len(uu))
+	}
+}
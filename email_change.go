@@ -0,0 +1,26 @@
+package users
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrEmailTaken is returned when the email is already used by another user
+var ErrEmailTaken = errors.New("user already registered")
+
+// EmailChange is a staged change of the email of a user. The change is only
+// applied once confirmed with the token sent to the new address, and can be
+// reverted with the token sent to the old one.
+type EmailChange struct {
+	ID              string     `json:"id" db:"id"`
+	UserID          string     `json:"user_id" db:"user_id"`
+	OldEmail        string     `json:"old_email" db:"old_email"`
+	NewEmail        string     `json:"new_email" db:"new_email"`
+	TokenHash       string     `json:"-" db:"token_hash"`
+	RevertTokenHash string     `json:"-" db:"revert_token_hash"`
+	ExpiresAt       time.Time  `json:"expires_at" db:"expires_at"`
+	RevertExpiresAt time.Time  `json:"revert_expires_at" db:"revert_expires_at"`
+	ConfirmedAt     *time.Time `json:"confirmed_at" db:"confirmed_at"`
+	RevertedAt      *time.Time `json:"reverted_at" db:"reverted_at"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,54 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+// AESGCM encrypts small secrets before storing them, the nonce is prepended to the ciphertext
+type AESGCM struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCM returns a cipher for the given 32 bytes key
+func NewAESGCM(key []byte) (*AESGCM, error) {
+	if len(key) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AESGCM{
+		aead: aead,
+	}, nil
+}
+
+// Encrypt ...
+func (c *AESGCM) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt ...
+func (c *AESGCM) Decrypt(ciphertext []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(ciphertext) < size {
+		return nil, errors.New("invalid ciphertext")
+	}
+
+	return c.aead.Open(nil, ciphertext[:size], ciphertext[size:], nil)
+}
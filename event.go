@@ -0,0 +1,131 @@
+package users
+
+import (
+	"encoding/json"
+	"time"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+)
+
+// Types of the user lifecycle events
+const (
+	EventUserCreated  = "user.created"
+	EventUserUpdated  = "user.updated"
+	EventUserDeleted  = "user.deleted"
+	EventUserRestored = "user.restored"
+)
+
+// Event is a change of a user recorded in the outbox, the payload is the
+// state of the user after the change and before the state previous to it,
+// empty for created users.
+type Event struct {
+	ID          int64           `json:"id" db:"id"`
+	Type        string          `json:"type" db:"type"`
+	UserID      string          `json:"user_id" db:"user_id"`
+	Payload     json.RawMessage `json:"payload" db:"payload"`
+	Before      json.RawMessage `json:"before,omitempty" db:"before"`
+	Attempts    int             `json:"-" db:"attempts"`
+	LastError   *string         `json:"-" db:"last_error"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+	PublishedAt *time.Time      `json:"-" db:"published_at"`
+	ParkedAt    *time.Time      `json:"-" db:"parked_at"`
+
+	// TxID is the transaction that wrote the event in the postgres store,
+	// the events are read in order of TxID and ID, 0 for the other stores
+	TxID int64 `json:"-" db:"txid"`
+}
+
+// EventPayload is the public view of a user sent to other services
+type EventPayload struct {
+	ID              string     `json:"id"`
+	Email           string     `json:"email"`
+	Name            string     `json:"name"`
+	LastName        string     `json:"last_name"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at"`
+}
+
+// EventFilter selects the events of the outbox
+type EventFilter struct {
+	// AfterTxID and AfterID skip the events up to a previous event, see Event.TxID
+	AfterTxID int64
+	AfterID   int64
+	UserIDs   []string
+	Types     []string
+	Limit     uint64
+}
+
+// NewEvent builds a event of the given type for the user, the password is never included.
+// before is the user previous to the change, nil for created users.
+func NewEvent(eventType string, before, after *User) (*Event, error) {
+	payload, err := json.Marshal(newEventPayload(after))
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Event{
+		Type:    eventType,
+		UserID:  after.ID,
+		Payload: payload,
+	}
+
+	if before != nil {
+		if e.Before, err = json.Marshal(newEventPayload(before)); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// Snapshots decodes the state of the user before and after the change, before is nil for created users
+func (e *Event) Snapshots() (*EventPayload, *EventPayload, error) {
+	var before *EventPayload
+
+	if len(e.Before) > 0 {
+		before = &EventPayload{}
+		if err := json.Unmarshal(e.Before, before); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	after := &EventPayload{}
+	if err := json.Unmarshal(e.Payload, after); err != nil {
+		return nil, nil, err
+	}
+
+	return before, after, nil
+}
+
+// ToProto ...
+func (p *EventPayload) ToProto() *pb.User {
+	u := &pb.User{
+		Id:        p.ID,
+		Email:     p.Email,
+		Name:      p.Name,
+		LastName:  p.LastName,
+		CreatedAt: p.CreatedAt.Unix(),
+		UpdatedAt: p.UpdatedAt.Unix(),
+	}
+
+	if p.EmailVerifiedAt != nil {
+		u.EmailVerifiedAt = p.EmailVerifiedAt.Unix()
+	}
+
+	return u
+}
+
+func newEventPayload(u *User) *EventPayload {
+	return &EventPayload{
+		ID:              u.ID,
+		Email:           u.Email,
+		Name:            u.Name,
+		LastName:        u.LastName,
+		EmailVerifiedAt: u.EmailVerifiedAt,
+		CreatedAt:       u.CreatedAt,
+		UpdatedAt:       u.UpdatedAt,
+		DeletedAt:       u.DeletedAt,
+	}
+}
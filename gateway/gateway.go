@@ -0,0 +1,282 @@
+package gateway
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// OpenAPI is the OpenAPI 3 document of the REST API, served at /v1/openapi.json
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// forwardedHeaders are the HTTP headers sent to the gRPC service as metadata
+var forwardedHeaders = []string{"x-request-id", "authorization", "idempotency-key", "x-read-primary"}
+
+// Gateway serves a REST/JSON API translated to calls of the gRPC service, so
+// REST requests go through the same validation, interceptors and logging
+type Gateway struct {
+	client pb.UserServiceClient
+	mux    *http.ServeMux
+}
+
+// response is implemented by every response of the gRPC service
+type response interface {
+	GetError() *pb.Error
+}
+
+// New ...
+func New(client pb.UserServiceClient) *Gateway {
+	g := &Gateway{
+		client: client,
+		mux:    http.NewServeMux(),
+	}
+
+	g.mux.HandleFunc("GET /v1/users/{id}", g.getByID)
+	g.mux.HandleFunc("GET /v1/users", g.list)
+	g.mux.HandleFunc("POST /v1/users", g.create)
+	g.mux.HandleFunc("PATCH /v1/users/{id}", g.update)
+	g.mux.HandleFunc("DELETE /v1/users/{id}", g.delete)
+	g.mux.HandleFunc("GET /v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(OpenAPI)
+	})
+
+	return g
+}
+
+// ServeHTTP ...
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+// userBody is the JSON body of POST and PATCH /v1/users
+type userBody struct {
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	LastName string `json:"last_name"`
+	Password string `json:"password"`
+}
+
+func (b *userBody) toProto() *pb.User {
+	return &pb.User{
+		Email:    b.Email,
+		Name:     b.Name,
+		LastName: b.LastName,
+		Password: b.Password,
+	}
+}
+
+func (g *Gateway) getByID(w http.ResponseWriter, r *http.Request) {
+	ctx := outgoingContext(r)
+	var header metadata.MD
+
+	res, err := g.client.GetByID(ctx, &pb.GetUserByIDRequest{Id: r.PathValue("id")}, grpc.Header(&header))
+	writeResponse(w, header, http.StatusOK, res, err)
+}
+
+// list returns the user with the email query param, or the page of users
+// selected by limit, offset, verified and organization_id
+func (g *Gateway) list(w http.ResponseWriter, r *http.Request) {
+	ctx := outgoingContext(r)
+	var header metadata.MD
+	q := r.URL.Query()
+
+	if email := q.Get("email"); email != "" {
+		res, err := g.client.GetByEmail(ctx, &pb.GetUserByEmailRequest{Email: email}, grpc.Header(&header))
+		writeResponse(w, header, http.StatusOK, res, err)
+		return
+	}
+
+	req := &pb.ListUsersRequest{
+		OrganizationId: q.Get("organization_id"),
+		Verified:       pb.VerifiedFilter_ANY,
+	}
+
+	for name, field := range map[string]*int32{"limit": &req.Limit, "offset": &req.Offset} {
+		if v := q.Get(name); v != "" {
+			i, err := strconv.ParseInt(v, 10, 32)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid %v", name))
+				return
+			}
+			*field = int32(i)
+		}
+	}
+
+	if v := q.Get("verified"); v != "" {
+		verified, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid verified")
+			return
+		}
+
+		req.Verified = pb.VerifiedFilter_UNVERIFIED
+		if verified {
+			req.Verified = pb.VerifiedFilter_VERIFIED
+		}
+	}
+
+	res, err := g.client.List(ctx, req, grpc.Header(&header))
+	writeResponse(w, header, http.StatusOK, res, err)
+}
+
+func (g *Gateway) create(w http.ResponseWriter, r *http.Request) {
+	body := &userBody{}
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	ctx := outgoingContext(r)
+	var header metadata.MD
+
+	res, err := g.client.Create(ctx, &pb.CreateUserRequest{Data: body.toProto()}, grpc.Header(&header))
+	writeResponse(w, header, http.StatusCreated, res, err)
+}
+
+func (g *Gateway) update(w http.ResponseWriter, r *http.Request) {
+	body := &userBody{}
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	data := body.toProto()
+	data.Id = r.PathValue("id")
+
+	ctx := outgoingContext(r)
+	var header metadata.MD
+
+	res, err := g.client.Update(ctx, &pb.UpdateUserRequest{Data: data}, grpc.Header(&header))
+	writeResponse(w, header, http.StatusOK, res, err)
+}
+
+func (g *Gateway) delete(w http.ResponseWriter, r *http.Request) {
+	ctx := outgoingContext(r)
+	var header metadata.MD
+
+	res, err := g.client.Delete(ctx, &pb.DeleteUserRequest{UserId: r.PathValue("id")}, grpc.Header(&header))
+	writeResponse(w, header, http.StatusNoContent, res, err)
+}
+
+// outgoingContext forwards the headers of the request as gRPC metadata
+func outgoingContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	for _, name := range forwardedHeaders {
+		if v := r.Header.Get(name); v != "" {
+			md.Set(name, v)
+		}
+	}
+
+	return metadata.NewOutgoingContext(r.Context(), md)
+}
+
+// writeResponse writes the response of a call, the code of its pb.Error is
+// used as the status of failed calls
+func writeResponse(w http.ResponseWriter, header metadata.MD, code int, res response, err error) {
+	if ids := header.Get("x-request-id"); len(ids) > 0 {
+		w.Header().Set("X-Request-Id", ids[0])
+	}
+
+	if err != nil {
+		st := status.Convert(err)
+		writeError(w, httpStatus(st.Code()), st.Message())
+		return
+	}
+
+	if e := res.GetError(); e != nil {
+		writeError(w, int(e.GetCode()), e.GetMessage())
+		return
+	}
+
+	if code == http.StatusNoContent {
+		w.WriteHeader(code)
+		return
+	}
+
+	writeJSON(w, code, res)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	if code < 400 || code > 599 {
+		code = http.StatusInternalServerError
+	}
+
+	writeJSON(w, code, map[string]*pb.Error{
+		"error": {
+			Code:    int32(code),
+			Message: message,
+		},
+	})
+}
+
+// writeJSON writes v as JSON, messages of the service in the JSON mapping of
+// protobuf with the field names of the proto, as in openapi.json
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	var (
+		b   []byte
+		err error
+	)
+
+	if m, ok := v.(proto.Message); ok {
+		b, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	} else {
+		b, err = json.Marshal(v)
+	}
+
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][Gateway][Error] %v", err.Error()))
+		writeError(w, http.StatusInternalServerError, "could not encode the response")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if _, err := w.Write(append(b, '\n')); err != nil {
+		log.Println(fmt.Sprintf("[User Service][Gateway][Error] %v", err.Error()))
+	}
+}
+
+// httpStatus maps the codes of failed gRPC calls, the service itself reports
+// errors in pb.Error
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument, codes.OutOfRange, codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Canceled:
+		return 499
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+
+	return http.StatusInternalServerError
+}
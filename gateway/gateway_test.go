@@ -0,0 +1,27 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+)
+
+func TestWriteJSONUsesTheProtobufMapping(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	writeJSON(w, http.StatusOK, &pb.GetUserByIDResponse{Data: &pb.User{Id: "1", LastName: "Lovelace", CreatedAt: 1700000000}})
+
+	body := w.Body.String()
+	for _, want := range []string{`"last_name":"Lovelace"`, `"created_at":"1700000000"`} {
+		if !strings.Contains(strings.ReplaceAll(body, " ", ""), want) {
+			t.Errorf("body = %v, want %v", body, want)
+		}
+	}
+
+	if strings.Contains(body, "email_verified_at") {
+		t.Errorf("body = %v, want the unset fields left out", body)
+	}
+}
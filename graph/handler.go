@@ -0,0 +1,49 @@
+package graph
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/idempotency"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+)
+
+// Schema is the GraphQL schema of the users domain
+//
+//go:embed schema.graphql
+var Schema string
+
+// Handler serves GraphQL queries over HTTP, each request gets its own Loader
+type Handler struct {
+	userSvc users.Service
+	relay   *relay.Handler
+
+	// Idempotency makes the retries of mutations with the same
+	// Idempotency-Key header return the first response, see idempotent
+	Idempotency *idempotency.Keys
+}
+
+// NewHandler ...
+func NewHandler(userSvc users.Service) *Handler {
+	schema := graphql.MustParseSchema(Schema, &Resolver{userSvc: userSvc})
+
+	return &Handler{
+		userSvc: userSvc,
+		relay:   &relay.Handler{Schema: schema},
+	}
+}
+
+// ServeHTTP serves the queries sent with POST, the only method the relay
+// handler reads
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := WithLoader(r.Context(), NewLoader(h.userSvc.GetByIDs))
+	h.idempotent(w, r.WithContext(ctx), h.relay.ServeHTTP)
+}
@@ -0,0 +1,107 @@
+package graph
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/idempotency"
+)
+
+// IdempotencyKeyHeader is the header with the idempotency key of a mutation
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxBodySize is the largest request read to hash it for its idempotency key
+const maxBodySize = 1 << 20
+
+// idempotent serves the request once per idempotency key, with the keys of
+// the gRPC service. Retries with the same key and body get the first
+// response back, responses with errors are not kept so the request can be
+// retried. Without a key, or when Idempotency is not set, serve is always
+// called.
+func (h *Handler) idempotent(w http.ResponseWriter, r *http.Request, serve http.HandlerFunc) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" || h.Idempotency == nil {
+		serve(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.Sum256(append([]byte("graphql\x00"), body...))
+	requestHash := hex.EncodeToString(hash[:])
+
+	code := http.StatusOK
+
+	res, replayed, err := h.Idempotency.Do(r.Context(), idempotency.Scope(r.Context(), requestHash), key, requestHash, func() ([]byte, bool, error) {
+		rec := &recorder{header: http.Header{}, code: http.StatusOK}
+		serve(rec, r)
+
+		code = rec.code
+
+		var gr struct {
+			Errors []json.RawMessage `json:"errors"`
+		}
+
+		keep := code == http.StatusOK && json.Unmarshal(rec.body.Bytes(), &gr) == nil && len(gr.Errors) == 0
+		return rec.body.Bytes(), keep, nil
+	})
+
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][GraphQL][Error] idempotency_key = %v %v", key, err.Error()))
+		http.Error(w, err.Error(), idempotencyStatus(err))
+		return
+	}
+
+	if replayed {
+		log.Println(fmt.Sprintf("[User Service][GraphQL][Replay] idempotency_key = %v", key))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(res)
+}
+
+// idempotencyStatus is the HTTP status of the errors of the keys
+func idempotencyStatus(err error) int {
+	switch err {
+	case users.ErrInvalidIdempotencyKey:
+		return http.StatusBadRequest
+	case users.ErrIdempotencyKeyInProgress:
+		return http.StatusConflict
+	case users.ErrIdempotencyKeyReused:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// recorder keeps the response of the relay handler so it can be stored
+type recorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *recorder) WriteHeader(code int) {
+	r.code = code
+}
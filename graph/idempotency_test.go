@@ -0,0 +1,66 @@
+package graph
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frperezr/microservices-demo/src/users-api/actor"
+	"github.com/frperezr/microservices-demo/src/users-api/database/sqlite"
+	"github.com/frperezr/microservices-demo/src/users-api/idempotency"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+func TestMutationsAreReplayedByIdempotencyKey(t *testing.T) {
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Store.Close()
+
+	h := &Handler{Idempotency: idempotency.New(store)}
+	ctx := actor.With(tenant.WithID(context.Background(), "org"), actor.Actor{UserID: "ada"})
+
+	calls := 0
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Query().Get("fail") != "" {
+			w.Write([]byte(`{"errors":[{"message":"email already taken"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"createUser":{"id":"1"}}}`))
+	}
+
+	send := func(key, query, url string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, url, strings.NewReader(query)).WithContext(ctx)
+		r.Header.Set(IdempotencyKeyHeader, key)
+
+		w := httptest.NewRecorder()
+		h.idempotent(w, r, serve)
+
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		w := send("key-1", `{"query":"mutation { createUser }"}`, "/graphql")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"id":"1"`) || calls != 1 {
+			t.Fatalf("request #%v = %v %v after %v calls, want the first response", i+1, w.Code, w.Body, calls)
+		}
+	}
+
+	if w := send("key-1", `{"query":"mutation { deleteUser }"}`, "/graphql"); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("key reused with another request = %v, want %v", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	// responses with errors are not kept
+	for i := 0; i < 2; i++ {
+		send("key-2", `{"query":"mutation { createUser }"}`, "/graphql?fail=1")
+	}
+
+	if calls != 3 {
+		t.Fatalf("got %v calls, want the failed request to run again", calls)
+	}
+}
@@ -0,0 +1,164 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+)
+
+const (
+	// DefaultLoaderWait is the time the loader collects ids before fetching them
+	DefaultLoaderWait = 2 * time.Millisecond
+
+	// DefaultLoaderBatchSize is the most ids fetched at once
+	DefaultLoaderBatchSize = 100
+)
+
+type loaderKey struct{}
+
+// Loader batches and caches the users loaded by id while resolving a query,
+// so a list of groups with their members makes a single GetByIDs call instead
+// of one GetByID per member. A loader lives for a single request.
+type Loader struct {
+	fetch     func(ctx context.Context, ids []string) ([]*users.User, error)
+	wait      time.Duration
+	batchSize int
+
+	mu    sync.Mutex
+	cache map[string]*loaderResult
+	batch []string
+	timer *time.Timer
+}
+
+type loaderResult struct {
+	done chan struct{}
+	user *users.User
+	err  error
+}
+
+// NewLoader ...
+func NewLoader(fetch func(ctx context.Context, ids []string) ([]*users.User, error)) *Loader {
+	return &Loader{
+		fetch:     fetch,
+		wait:      DefaultLoaderWait,
+		batchSize: DefaultLoaderBatchSize,
+		cache:     make(map[string]*loaderResult),
+	}
+}
+
+// WithLoader returns a context carrying the loader
+func WithLoader(ctx context.Context, l *Loader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, l)
+}
+
+// LoaderFromContext ...
+func LoaderFromContext(ctx context.Context) *Loader {
+	l, _ := ctx.Value(loaderKey{}).(*Loader)
+	return l
+}
+
+// Load returns the user with the id, sql.ErrNoRows if it does not exist
+func (l *Loader) Load(ctx context.Context, id string) (*users.User, error) {
+	l.mu.Lock()
+
+	r, ok := l.cache[id]
+	if !ok {
+		r = &loaderResult{done: make(chan struct{})}
+		l.cache[id] = r
+		l.batch = append(l.batch, id)
+
+		if len(l.batch) >= l.batchSize {
+			l.timer.Stop()
+			go l.dispatch(ctx)
+		} else if len(l.batch) == 1 {
+			l.timer = time.AfterFunc(l.wait, func() { l.dispatch(ctx) })
+		}
+	}
+
+	l.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return r.user, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// LoadMany returns the users with the ids in the same order, the missing ones are left out
+func (l *Loader) LoadMany(ctx context.Context, ids []string) ([]*users.User, error) {
+	results := make([]*users.User, len(ids))
+	errs := make([]error, len(ids))
+
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			results[i], errs[i] = l.Load(ctx, id)
+		}(i, id)
+	}
+	wg.Wait()
+
+	uu := make([]*users.User, 0, len(ids))
+	for i, u := range results {
+		if errs[i] == sql.ErrNoRows {
+			continue
+		}
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		uu = append(uu, u)
+	}
+
+	return uu, nil
+}
+
+// Prime stores a user already loaded by other means
+func (l *Loader) Prime(u *users.User) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.cache[u.ID]; ok {
+		return
+	}
+
+	r := &loaderResult{done: make(chan struct{}), user: u}
+	close(r.done)
+	l.cache[u.ID] = r
+}
+
+func (l *Loader) dispatch(ctx context.Context) {
+	l.mu.Lock()
+	ids := l.batch
+	l.batch = nil
+	results := make(map[string]*loaderResult, len(ids))
+	for _, id := range ids {
+		results[id] = l.cache[id]
+	}
+	l.mu.Unlock()
+
+	if len(ids) == 0 {
+		return
+	}
+
+	uu, err := l.fetch(ctx, ids)
+
+	for _, u := range uu {
+		if r, ok := results[u.ID]; ok {
+			r.user = u
+		}
+	}
+
+	for _, r := range results {
+		if err != nil {
+			r.err = err
+		} else if r.user == nil {
+			r.err = sql.ErrNoRows
+		}
+		close(r.done)
+	}
+}
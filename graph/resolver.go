@@ -0,0 +1,345 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// MaxPageSize is the largest page of the users query
+const MaxPageSize = 100
+
+// errInvalidCursor ...
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Resolver is the root resolver of the schema
+type Resolver struct {
+	userSvc users.Service
+}
+
+// User ...
+func (r *Resolver) User(ctx context.Context, args struct{ ID graphql.ID }) (*userResolver, error) {
+	u, err := r.load(ctx, string(args.ID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &userResolver{r, u}, nil
+}
+
+// UserByEmail ...
+func (r *Resolver) UserByEmail(ctx context.Context, args struct{ Email string }) (*userResolver, error) {
+	u, err := r.userSvc.GetByEmail(ctx, strings.ToLower(args.Email))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.user(ctx, u), nil
+}
+
+// Users returns a page of users after the cursor, the cursors are offsets of the list
+func (r *Resolver) Users(ctx context.Context, args struct {
+	First          int32
+	After          *string
+	Verified       *bool
+	OrganizationID *graphql.ID
+}) (*userConnectionResolver, error) {
+	first := uint64(args.First)
+	if first == 0 || first > MaxPageSize {
+		first = MaxPageSize
+	}
+
+	var offset uint64
+	if args.After != nil {
+		var err error
+		if offset, err = decodeCursor(*args.After); err != nil {
+			return nil, err
+		}
+		offset++
+	}
+
+	opts := &users.ListOptions{
+		Verified: args.Verified,
+		// one more than asked tells if there is a next page
+		Limit:  first + 1,
+		Offset: offset,
+	}
+
+	if args.OrganizationID != nil {
+		opts.OrganizationID = string(*args.OrganizationID)
+	}
+
+	uu, err := r.userSvc.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &userConnectionResolver{}
+	if uint64(len(uu)) > first {
+		conn.hasNextPage = true
+		uu = uu[:first]
+	}
+
+	for i, u := range uu {
+		conn.edges = append(conn.edges, &userEdgeResolver{
+			cursor: encodeCursor(offset + uint64(i)),
+			node:   r.user(ctx, u),
+		})
+	}
+
+	return conn, nil
+}
+
+// CreateUser ...
+func (r *Resolver) CreateUser(ctx context.Context, args struct {
+	Input struct {
+		Email    string
+		Name     string
+		LastName string
+		Password string
+	}
+}) (*userResolver, error) {
+	u := &users.User{
+		Email:    args.Input.Email,
+		Name:     args.Input.Name,
+		LastName: args.Input.LastName,
+		Password: args.Input.Password,
+	}
+
+	if err := r.userSvc.Create(ctx, u); err != nil {
+		return nil, err
+	}
+
+	return r.user(ctx, u), nil
+}
+
+// UpdateUser ...
+func (r *Resolver) UpdateUser(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input struct {
+		Name     *string
+		LastName *string
+		Password *string
+	}
+}) (*userResolver, error) {
+	u := &users.User{ID: string(args.ID)}
+
+	if args.Input.Name != nil {
+		u.Name = *args.Input.Name
+	}
+
+	if args.Input.LastName != nil {
+		u.LastName = *args.Input.LastName
+	}
+
+	if args.Input.Password != nil {
+		u.Password = *args.Input.Password
+	}
+
+	if err := r.userSvc.Update(ctx, u); err != nil {
+		return nil, err
+	}
+
+	// the roles are not returned by Update
+	updated, err := r.userSvc.GetByID(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &userResolver{r, updated}, nil
+}
+
+// DeleteUser ...
+func (r *Resolver) DeleteUser(ctx context.Context, args struct{ ID graphql.ID }) (bool, error) {
+	if err := r.userSvc.Delete(ctx, string(args.ID)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// load reads the user through the loader of the request, if there is one
+func (r *Resolver) load(ctx context.Context, id string) (*users.User, error) {
+	if l := LoaderFromContext(ctx); l != nil {
+		return l.Load(ctx, id)
+	}
+
+	return r.userSvc.GetByID(ctx, id)
+}
+
+// user wraps a user loaded by other means, keeping it for later loads by id
+func (r *Resolver) user(ctx context.Context, u *users.User) *userResolver {
+	if l := LoaderFromContext(ctx); l != nil {
+		l.Prime(u)
+	}
+
+	return &userResolver{r, u}
+}
+
+type userResolver struct {
+	root *Resolver
+	u    *users.User
+}
+
+func (ur *userResolver) ID() graphql.ID          { return graphql.ID(ur.u.ID) }
+func (ur *userResolver) Email() string           { return ur.u.Email }
+func (ur *userResolver) Name() string            { return ur.u.Name }
+func (ur *userResolver) LastName() string        { return ur.u.LastName }
+func (ur *userResolver) EmailVerified() bool     { return ur.u.IsEmailVerified() }
+func (ur *userResolver) MfaEnabled() bool        { return ur.u.IsMFAEnabled() }
+func (ur *userResolver) CreatedAt() graphql.Time { return graphql.Time{Time: ur.u.CreatedAt} }
+func (ur *userResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: ur.u.UpdatedAt} }
+
+func (ur *userResolver) Roles() []string {
+	if ur.u.Roles == nil {
+		return []string{}
+	}
+	return ur.u.Roles
+}
+
+func (ur *userResolver) Organizations(ctx context.Context) ([]*organizationResolver, error) {
+	orgs, err := ur.root.userSvc.ListOrganizations(ctx, ur.u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*organizationResolver, 0, len(orgs))
+	for _, o := range orgs {
+		res = append(res, &organizationResolver{o})
+	}
+
+	return res, nil
+}
+
+func (ur *userResolver) Groups(ctx context.Context) ([]*groupResolver, error) {
+	groups, err := ur.root.userSvc.ListUserGroups(ctx, ur.u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*groupResolver, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, &groupResolver{ur.root, g})
+	}
+
+	return res, nil
+}
+
+type organizationResolver struct {
+	o *users.Organization
+}
+
+func (or *organizationResolver) ID() graphql.ID          { return graphql.ID(or.o.ID) }
+func (or *organizationResolver) Name() string            { return or.o.Name }
+func (or *organizationResolver) Slug() string            { return or.o.Slug }
+func (or *organizationResolver) CreatedAt() graphql.Time { return graphql.Time{Time: or.o.CreatedAt} }
+
+type groupResolver struct {
+	root *Resolver
+	g    *users.Group
+}
+
+func (gr *groupResolver) ID() graphql.ID             { return graphql.ID(gr.g.ID) }
+func (gr *groupResolver) OrganizationID() graphql.ID { return graphql.ID(gr.g.OrganizationID) }
+func (gr *groupResolver) Name() string               { return gr.g.Name }
+func (gr *groupResolver) Description() string        { return gr.g.Description }
+
+// Members loads the users of the group in a single batch with the members of
+// the other groups of the query
+func (gr *groupResolver) Members(ctx context.Context) ([]*userResolver, error) {
+	members, err := gr.root.userSvc.ListGroupMembers(ctx, gr.g.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(members))
+	for _, m := range members {
+		if m.UserID != "" {
+			ids = append(ids, m.UserID)
+		}
+	}
+
+	var uu []*users.User
+	if l := LoaderFromContext(ctx); l != nil {
+		uu, err = l.LoadMany(ctx, ids)
+	} else {
+		uu, err = gr.root.userSvc.GetByIDs(ctx, ids)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*userResolver, 0, len(uu))
+	for _, u := range uu {
+		res = append(res, &userResolver{gr.root, u})
+	}
+
+	return res, nil
+}
+
+type userConnectionResolver struct {
+	edges       []*userEdgeResolver
+	hasNextPage bool
+}
+
+func (cr *userConnectionResolver) Edges() []*userEdgeResolver {
+	if cr.edges == nil {
+		return []*userEdgeResolver{}
+	}
+	return cr.edges
+}
+
+func (cr *userConnectionResolver) PageInfo() *pageInfoResolver {
+	p := &pageInfoResolver{hasNextPage: cr.hasNextPage}
+	if len(cr.edges) > 0 {
+		p.endCursor = &cr.edges[len(cr.edges)-1].cursor
+	}
+	return p
+}
+
+type userEdgeResolver struct {
+	cursor string
+	node   *userResolver
+}
+
+func (er *userEdgeResolver) Cursor() string      { return er.cursor }
+func (er *userEdgeResolver) Node() *userResolver { return er.node }
+
+type pageInfoResolver struct {
+	hasNextPage bool
+	endCursor   *string
+}
+
+func (pr *pageInfoResolver) HasNextPage() bool  { return pr.hasNextPage }
+func (pr *pageInfoResolver) EndCursor() *string { return pr.endCursor }
+
+func encodeCursor(offset uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.FormatUint(offset, 10)))
+}
+
+func decodeCursor(cursor string) (uint64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(b), "offset:") {
+		return 0, errInvalidCursor
+	}
+
+	offset, err := strconv.ParseUint(strings.TrimPrefix(string(b), "offset:"), 10, 64)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+
+	return offset, nil
+}
@@ -0,0 +1,81 @@
+package users
+
+import (
+	"errors"
+	"time"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+)
+
+var (
+	// ErrGroupNotFound ...
+	ErrGroupNotFound = errors.New("group not found")
+
+	// ErrGroupNameTaken ...
+	ErrGroupNameTaken = errors.New("group name already taken in the organization")
+
+	// ErrGroupCycle is returned when adding a group would make it a member of itself
+	ErrGroupCycle = errors.New("group membership would create a cycle")
+
+	// ErrInvalidGroupMember is returned when a member is not exactly one of a user or a group
+	ErrInvalidGroupMember = errors.New("group member must be a user or a group")
+)
+
+// Group is a set of users and other groups inside a organization
+type Group struct {
+	ID             string    `json:"id" db:"id"`
+	OrganizationID string    `json:"organization_id" db:"organization_id"`
+	Name           string    `json:"name" db:"name"`
+	Description    string    `json:"description" db:"description"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// GroupMember is a direct member of a group, either UserID or MemberGroupID is set
+type GroupMember struct {
+	GroupID       string    `json:"group_id" db:"group_id"`
+	UserID        string    `json:"user_id" db:"user_id"`
+	MemberGroupID string    `json:"member_group_id" db:"member_group_id"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// ToProto ...
+func (g *Group) ToProto() *pb.Group {
+	return &pb.Group{
+		Id:             g.ID,
+		OrganizationId: g.OrganizationID,
+		Name:           g.Name,
+		Description:    g.Description,
+		CreatedAt:      g.CreatedAt.Unix(),
+		UpdatedAt:      g.UpdatedAt.Unix(),
+	}
+}
+
+// ToProto ...
+func (m *GroupMember) ToProto() *pb.GroupMember {
+	return &pb.GroupMember{
+		GroupId:       m.GroupID,
+		UserId:        m.UserID,
+		MemberGroupId: m.MemberGroupID,
+		CreatedAt:     m.CreatedAt.Unix(),
+	}
+}
+
+// FromProto ...
+func (g *Group) FromProto(pg *pb.Group) *Group {
+	return &Group{
+		ID:             pg.Id,
+		OrganizationID: pg.OrganizationId,
+		Name:           pg.Name,
+		Description:    pg.Description,
+	}
+}
+
+// FromProto ...
+func (m *GroupMember) FromProto(pm *pb.GroupMember) *GroupMember {
+	return &GroupMember{
+		GroupID:       pm.GroupId,
+		UserID:        pm.UserId,
+		MemberGroupID: pm.MemberGroupId,
+	}
+}
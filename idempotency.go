@@ -0,0 +1,33 @@
+package users
+
+import (
+	"errors"
+	"time"
+)
+
+// MaxIdempotencyKeyLength ...
+const MaxIdempotencyKeyLength = 255
+
+var (
+	// ErrIdempotencyKeyReused is returned when a key is sent again with a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+
+	// ErrIdempotencyKeyInProgress is returned when a key is sent again before its first request finished
+	ErrIdempotencyKeyInProgress = errors.New("a request with the idempotency key is in progress")
+
+	// ErrInvalidIdempotencyKey ...
+	ErrInvalidIdempotencyKey = errors.New("idempotency key must have at most 255 characters")
+)
+
+// IdempotencyKey is a key sent by a client to make the retries of a request
+// safe. The response of the first request is kept until ExpiresAt and
+// returned to the retries, Response is nil while that request runs.
+type IdempotencyKey struct {
+	Scope       string     `db:"scope"`
+	Key         string     `db:"key"`
+	RequestHash string     `db:"request_hash"`
+	Response    []byte     `db:"response"`
+	CompletedAt *time.Time `db:"completed_at"`
+	CreatedAt   time.Time  `db:"created_at"`
+	ExpiresAt   time.Time  `db:"expires_at"`
+}
@@ -0,0 +1,136 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/actor"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+const (
+	// DefaultTTL is how long the response of a key is kept
+	DefaultTTL = 24 * time.Hour
+
+	// DefaultLease is how long a key is held by a request that did not finish,
+	// after it the key can be claimed again
+	DefaultLease = time.Minute
+
+	// DefaultInterval is the time between purges of expired keys
+	DefaultInterval = time.Hour
+)
+
+// Store keeps the idempotency keys and the responses of their requests
+type Store interface {
+	ClaimIdempotencyKey(ctx context.Context, k *users.IdempotencyKey) (*users.IdempotencyKey, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, k *users.IdempotencyKey) error
+	ReleaseIdempotencyKey(ctx context.Context, k *users.IdempotencyKey) error
+	PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int, error)
+}
+
+// Keys runs each request once per idempotency key
+type Keys struct {
+	Store    Store
+	TTL      time.Duration
+	Lease    time.Duration
+	Interval time.Duration
+	Now      func() time.Time
+}
+
+// New ...
+func New(store Store) *Keys {
+	return &Keys{
+		Store:    store,
+		TTL:      DefaultTTL,
+		Lease:    DefaultLease,
+		Interval: DefaultInterval,
+		Now:      time.Now,
+	}
+}
+
+// Do calls fn the first time the key is seen in the scope and returns the
+// response it stores, retries with the same request hash get that response
+// back without calling fn. fn returns the encoded response and whether it
+// is kept, a request that fails or is not kept releases the key so it can
+// run again.
+//
+// The key is claimed for Lease and only kept for TTL once the response is
+// stored, so the key of a request whose server died is claimed again after
+// Lease. A request running longer than Lease may then run twice.
+func (k *Keys) Do(ctx context.Context, scope, key, requestHash string, fn func() ([]byte, bool, error)) ([]byte, bool, error) {
+	if len(key) > users.MaxIdempotencyKeyLength {
+		return nil, false, users.ErrInvalidIdempotencyKey
+	}
+
+	ik := &users.IdempotencyKey{
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   k.Now().Add(k.Lease),
+	}
+
+	stored, claimed, err := k.Store.ClaimIdempotencyKey(ctx, ik)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !claimed {
+		switch {
+		case stored.RequestHash != requestHash:
+			return nil, false, users.ErrIdempotencyKeyReused
+		case stored.CompletedAt == nil:
+			return nil, false, users.ErrIdempotencyKeyInProgress
+		}
+		return stored.Response, true, nil
+	}
+
+	res, keep, err := fn()
+	if err != nil || !keep {
+		if err := k.Store.ReleaseIdempotencyKey(ctx, ik); err != nil {
+			log.Println(fmt.Sprintf("[User Service][Idempotency][Error] releasing key: %v", err.Error()))
+		}
+		return res, false, err
+	}
+
+	ik.Response = res
+	ik.ExpiresAt = k.Now().Add(k.TTL)
+	if err := k.Store.CompleteIdempotencyKey(ctx, ik); err != nil {
+		// the request did run, a retry will get ErrIdempotencyKeyInProgress
+		// until the lease expires
+		log.Println(fmt.Sprintf("[User Service][Idempotency][Error] storing response: %v", err.Error()))
+	}
+
+	return res, false, nil
+}
+
+// Scope keeps the keys of each tenant and user apart. Calls without a access
+// token share no tenant nor user, so their keys are scoped to the request
+// hash, and only replay the request they came with.
+func Scope(ctx context.Context, requestHash string) string {
+	id, _ := tenant.FromContext(ctx)
+	userID := actor.FromContext(ctx).UserID
+
+	if id == "" && userID == "" {
+		return "anonymous/" + requestHash
+	}
+
+	return id + "/" + userID
+}
+
+// Run deletes the expired keys every Interval until the context is canceled
+func (k *Keys) Run(ctx context.Context) error {
+	for {
+		if _, err := k.Store.PurgeIdempotencyKeys(ctx, k.Now()); err != nil {
+			log.Println(fmt.Sprintf("[User Service][Idempotency][Error] %v", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(k.Interval):
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package idempotency
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/actor"
+	"github.com/frperezr/microservices-demo/src/users-api/database/sqlite"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+// newTestKeys returns the keys on a new SQLite database
+func newTestKeys(t *testing.T) *Keys {
+	t.Helper()
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Store.Close() })
+
+	return New(store)
+}
+
+func TestDoReplaysTheStoredResponse(t *testing.T) {
+	k := newTestKeys(t)
+	ctx := context.Background()
+
+	calls := 0
+	fn := func() ([]byte, bool, error) {
+		calls++
+		return []byte("created"), true, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		res, replayed, err := k.Do(ctx, "acme/ada", "key-1", "hash", fn)
+		if err != nil || string(res) != "created" || replayed != (i == 1) {
+			t.Fatalf("Do #%v = %q, %v, %v", i+1, res, replayed, err)
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("fn was called %v times, want 1", calls)
+	}
+
+	if _, _, err := k.Do(ctx, "acme/ada", "key-1", "other hash", fn); err != users.ErrIdempotencyKeyReused {
+		t.Fatalf("Do with another request = %v, want %v", err, users.ErrIdempotencyKeyReused)
+	}
+}
+
+func TestDoTakesOverTheKeyAfterTheLease(t *testing.T) {
+	k := newTestKeys(t)
+	ctx := context.Background()
+
+	fn := func() ([]byte, bool, error) {
+		return []byte("created"), true, nil
+	}
+
+	// requests that claimed their key and never finished, the lease of the
+	// second one is over
+	running := &users.IdempotencyKey{Scope: "acme/ada", Key: "key-1", RequestHash: "hash", ExpiresAt: time.Now().Add(k.Lease)}
+	crashed := &users.IdempotencyKey{Scope: "acme/ada", Key: "key-2", RequestHash: "hash", ExpiresAt: time.Now().Add(-time.Second)}
+
+	for _, claim := range []*users.IdempotencyKey{running, crashed} {
+		if _, claimed, err := k.Store.ClaimIdempotencyKey(ctx, claim); err != nil || !claimed {
+			t.Fatalf("ClaimIdempotencyKey = %v, %v", claimed, err)
+		}
+	}
+
+	if _, _, err := k.Do(ctx, "acme/ada", "key-1", "hash", fn); err != users.ErrIdempotencyKeyInProgress {
+		t.Fatalf("Do within the lease = %v, want %v", err, users.ErrIdempotencyKeyInProgress)
+	}
+
+	res, replayed, err := k.Do(ctx, "acme/ada", "key-2", "hash", fn)
+	if err != nil || replayed || string(res) != "created" {
+		t.Fatalf("Do after the lease = %q, %v, %v, want the request to run", res, replayed, err)
+	}
+
+	// the response is kept for TTL, not for the lease
+	stored, claimed, err := k.Store.ClaimIdempotencyKey(ctx, &users.IdempotencyKey{Scope: "acme/ada", Key: "key-2", RequestHash: "hash", ExpiresAt: time.Now()})
+	if err != nil || claimed || stored.CompletedAt == nil {
+		t.Fatalf("ClaimIdempotencyKey after the response = %v, %v, want the stored response", claimed, err)
+	}
+
+	if !stored.ExpiresAt.After(time.Now().Add(k.TTL - time.Hour)) {
+		t.Fatalf("response expires at %v, want after the TTL", stored.ExpiresAt)
+	}
+}
+
+func TestScope(t *testing.T) {
+	anonymous := context.Background()
+	if a, b := Scope(anonymous, "a"), Scope(anonymous, "b"); a == b {
+		t.Fatalf("anonymous requests share the scope %q", a)
+	}
+
+	inTenant := actor.With(tenant.WithID(context.Background(), "org"), actor.Actor{UserID: "ada"})
+	if a, b := Scope(inTenant, "a"), Scope(inTenant, "b"); a != b || a != "org/ada" {
+		t.Fatalf("scopes = %q, %q, want org/ada", a, b)
+	}
+}
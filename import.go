@@ -0,0 +1,43 @@
+package users
+
+import "errors"
+
+// ImportBatchSize is the most rows of a import written in one transaction,
+// a failed import keeps the batches committed before it
+const ImportBatchSize = 500
+
+// ExportBatchSize is the number of users read at once by a export
+const ExportBatchSize = 1000
+
+// ErrDuplicateImportEmail is the error of a row whose email is in a previous row of the same import
+var ErrDuplicateImportEmail = errors.New("email is repeated in the import")
+
+// ImportResult is the outcome of a import
+type ImportResult struct {
+	Imported int
+	Skipped  int
+	Failed   int
+
+	// LastRow is the last row of the last batch committed, a interrupted
+	// import can be resumed from the row after it
+	LastRow int64
+
+	Errors []*ImportError
+}
+
+// ImportError is the failure of a single row of a import
+type ImportError struct {
+	Row   int64
+	Email string
+	Err   error
+}
+
+// ExportOptions ...
+type ExportOptions struct {
+	// AfterID resumes a export after the user with the id, users are
+	// exported in order of id
+	AfterID string
+
+	// OrganizationID scopes the export to the members of the organization
+	OrganizationID string
+}
@@ -0,0 +1,46 @@
+package users
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrAccountLocked is returned when the account is temporarily locked after too many failed logins
+	ErrAccountLocked = errors.New("account temporarily locked")
+
+	// ErrTooManyAttempts is returned when the client address is temporarily blocked after too many failed logins
+	ErrTooManyAttempts = errors.New("too many failed attempts, try again later")
+)
+
+// LockoutPolicy configures the throttling of failed logins. Once Threshold
+// failures happen within Window the account or address is locked for
+// BaseDuration, doubling on every further failure up to MaxDuration.
+type LockoutPolicy struct {
+	Threshold    int
+	Window       time.Duration
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+}
+
+// LockDuration returns the time to lock after the given number of failures, zero means no lock
+func (p LockoutPolicy) LockDuration(failures int) time.Duration {
+	if p.Threshold <= 0 || failures < p.Threshold {
+		return 0
+	}
+
+	d := p.BaseDuration
+	for i := p.Threshold; i < failures; i++ {
+		d *= 2
+		if d >= p.MaxDuration {
+			return p.MaxDuration
+		}
+	}
+
+	return d
+}
+
+// IsLocked reports whether the user can not authenticate at the given time
+func (u *User) IsLocked(at time.Time) bool {
+	return u.LockedUntil != nil && u.LockedUntil.After(at)
+}
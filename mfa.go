@@ -0,0 +1,32 @@
+package users
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInvalidMFACode is returned when a TOTP or recovery code is wrong or already used
+	ErrInvalidMFACode = errors.New("invalid mfa code")
+
+	// ErrMFANotEnabled ...
+	ErrMFANotEnabled = errors.New("mfa not enabled")
+
+	// ErrMFAAlreadyEnabled ...
+	ErrMFAAlreadyEnabled = errors.New("mfa already enabled")
+)
+
+// MFA is the TOTP enrollment of a user, Secret is stored encrypted
+type MFA struct {
+	UserID       string     `json:"user_id" db:"user_id"`
+	Secret       []byte     `json:"-" db:"secret"`
+	LastUsedStep int64      `json:"-" db:"last_used_step"`
+	ConfirmedAt  *time.Time `json:"confirmed_at" db:"confirmed_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// MFAEnrollment is returned when starting the enrollment, it must be shown only once
+type MFAEnrollment struct {
+	Secret     string
+	OtpauthURI string
+}
@@ -0,0 +1,48 @@
+package notifier
+
+import (
+	"fmt"
+	"log"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+)
+
+var _ user.Notifier = (*Log)(nil)
+
+// Log is a notifier that writes the messages to the service log instead of
+// delivering them, it is meant for local development only.
+type Log struct {
+	// BaseURL is used to build the links included in the messages
+	BaseURL string
+}
+
+// NewLog ...
+func NewLog(baseURL string) *Log {
+	return &Log{
+		BaseURL: baseURL,
+	}
+}
+
+// SendEmailVerification ...
+func (l *Log) SendEmailVerification(u *user.User, token string) error {
+	log.Println(fmt.Sprintf("[Notifier][SendEmailVerification] to = %v link = %v/verify-email?token=%v", u.Email, l.BaseURL, token))
+	return nil
+}
+
+// SendEmailChangeConfirmation ...
+func (l *Log) SendEmailChangeConfirmation(u *user.User, newEmail, token string) error {
+	log.Println(fmt.Sprintf("[Notifier][SendEmailChangeConfirmation] to = %v link = %v/confirm-email-change?token=%v", newEmail, l.BaseURL, token))
+	return nil
+}
+
+// SendEmailChangeNotice ...
+func (l *Log) SendEmailChangeNotice(u *user.User, newEmail, revertToken string) error {
+	log.Println(fmt.Sprintf("[Notifier][SendEmailChangeNotice] to = %v new_email = %v link = %v/revert-email-change?token=%v", u.Email, newEmail, l.BaseURL, revertToken))
+	return nil
+}
+
+// SendInvitation ...
+func (l *Log) SendInvitation(inv *user.Invitation, org *user.Organization, token string) error {
+	log.Println(fmt.Sprintf("[Notifier][SendInvitation] to = %v organization = %v link = %v/accept-invitation?token=%v", inv.Email, org.Name, l.BaseURL, token))
+	return nil
+}
@@ -0,0 +1,111 @@
+package users
+
+import (
+	"errors"
+	"time"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+)
+
+// Roles of a member inside a organization
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+var (
+	// ErrOrganizationNotFound ...
+	ErrOrganizationNotFound = errors.New("organization not found")
+
+	// ErrSlugTaken ...
+	ErrSlugTaken = errors.New("organization slug already taken")
+
+	// ErrNotMember is returned when the user does not belong to the organization
+	ErrNotMember = errors.New("user is not a member of the organization")
+
+	// ErrInvalidOrgRole ...
+	ErrInvalidOrgRole = errors.New("invalid organization role")
+
+	// ErrLastOwner is returned when removing or demoting the only owner of a organization
+	ErrLastOwner = errors.New("organization must have at least one owner")
+)
+
+// IsValidOrgRole ...
+func IsValidOrgRole(role string) bool {
+	switch role {
+	case OrgRoleOwner, OrgRoleAdmin, OrgRoleMember:
+		return true
+	}
+	return false
+}
+
+// Organization is a tenant, users belong to it through memberships
+type Organization struct {
+	ID        string     `json:"id" db:"id"`
+	Name      string     `json:"name" db:"name"`
+	Slug      string     `json:"slug" db:"slug"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at" db:"deleted_at"`
+}
+
+// Membership is the role of a user inside a organization
+type Membership struct {
+	OrganizationID string    `json:"organization_id" db:"organization_id"`
+	UserID         string    `json:"user_id" db:"user_id"`
+	Role           string    `json:"role" db:"role"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// Invitation lets the owner of the email join a organization with the given role
+type Invitation struct {
+	ID             string     `json:"id" db:"id"`
+	OrganizationID string     `json:"organization_id" db:"organization_id"`
+	Email          string     `json:"email" db:"email"`
+	Role           string     `json:"role" db:"role"`
+	TokenHash      string     `json:"-" db:"token_hash"`
+	InvitedBy      *string    `json:"invited_by" db:"invited_by"`
+	ExpiresAt      time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at" db:"accepted_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ToProto ...
+func (o *Organization) ToProto() *pb.Organization {
+	return &pb.Organization{
+		Id:        o.ID,
+		Name:      o.Name,
+		Slug:      o.Slug,
+		CreatedAt: o.CreatedAt.Unix(),
+		UpdatedAt: o.UpdatedAt.Unix(),
+	}
+}
+
+// ToProto ...
+func (m *Membership) ToProto() *pb.Membership {
+	return &pb.Membership{
+		OrganizationId: m.OrganizationID,
+		UserId:         m.UserID,
+		Role:           m.Role,
+		CreatedAt:      m.CreatedAt.Unix(),
+	}
+}
+
+// ToProto ...
+func (i *Invitation) ToProto() *pb.Invitation {
+	var invitedBy string
+	if i.InvitedBy != nil {
+		invitedBy = *i.InvitedBy
+	}
+
+	return &pb.Invitation{
+		Id:             i.ID,
+		OrganizationId: i.OrganizationID,
+		Email:          i.Email,
+		Role:           i.Role,
+		InvitedBy:      invitedBy,
+		ExpiresAt:      i.ExpiresAt.Unix(),
+		CreatedAt:      i.CreatedAt.Unix(),
+	}
+}
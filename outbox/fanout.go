@@ -0,0 +1,22 @@
+package outbox
+
+import (
+	"context"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// Fanout publishes each event to every sink in order. A failure stops the
+// event from being marked as published, so the sinks before the failing one
+// get it again on the next attempt.
+type Fanout []Sink
+
+// Publish ...
+func (f Fanout) Publish(ctx context.Context, e *users.Event) error {
+	for _, sink := range f {
+		if err := sink.Publish(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
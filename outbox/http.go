@@ -0,0 +1,56 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// HTTPSink posts each event as JSON to a URL, any status other than 2xx is a failure
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPSink ...
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{
+		URL:    url,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Publish ...
+func (hs *HTTPSink) Publish(ctx context.Context, e *users.Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hs.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Id", strconv.FormatInt(e.ID, 10))
+	req.Header.Set("X-Event-Type", e.Type)
+
+	res, err := hs.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("outbox: %v responded %v", hs.URL, res.Status)
+	}
+
+	return nil
+}
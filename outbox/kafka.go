@@ -0,0 +1,50 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaSink writes each event to a topic keyed by user id, so the events of
+// a user land in the same partition and keep their order
+type KafkaSink struct {
+	Writer *kafka.Writer
+}
+
+// NewKafkaSink ...
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+	return &KafkaSink{
+		Writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+}
+
+// Publish ...
+func (ks *KafkaSink) Publish(ctx context.Context, e *users.Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return ks.Writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(e.UserID),
+		Value: b,
+		Headers: []kafka.Header{
+			{Key: "event-id", Value: []byte(strconv.FormatInt(e.ID, 10))},
+			{Key: "event-type", Value: []byte(e.Type)},
+		},
+	})
+}
+
+// Close ...
+func (ks *KafkaSink) Close() error {
+	return ks.Writer.Close()
+}
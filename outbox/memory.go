@@ -0,0 +1,47 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// MemorySink keeps the published events, meant for tests
+type MemorySink struct {
+	mu     sync.Mutex
+	events []*users.Event
+
+	// Err is returned by Publish when set, to simulate a unavailable sink
+	Err error
+
+	// Reject, when set, fails the events it returns a error for
+	Reject func(e *users.Event) error
+}
+
+// Publish ...
+func (ms *MemorySink) Publish(ctx context.Context, e *users.Event) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.Err != nil {
+		return ms.Err
+	}
+
+	if ms.Reject != nil {
+		if err := ms.Reject(e); err != nil {
+			return err
+		}
+	}
+
+	ms.events = append(ms.events, e)
+	return nil
+}
+
+// Events returns the events published so far
+func (ms *MemorySink) Events() []*users.Event {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return append([]*users.Event(nil), ms.events...)
+}
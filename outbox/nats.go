@@ -0,0 +1,44 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/nats-io/nats.go"
+)
+
+// NATSSink publishes each event to the subject <Prefix>.<type>, e.g. users.user.created.
+// The event id goes in the Nats-Msg-Id header so JetStream streams drop redeliveries.
+type NATSSink struct {
+	Conn   *nats.Conn
+	Prefix string
+}
+
+// NewNATSSink ...
+func NewNATSSink(conn *nats.Conn) *NATSSink {
+	return &NATSSink{
+		Conn:   conn,
+		Prefix: "users",
+	}
+}
+
+// Publish ...
+func (ns *NATSSink) Publish(ctx context.Context, e *users.Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(ns.Prefix + "." + e.Type)
+	msg.Header.Set(nats.MsgIdHdr, strconv.FormatInt(e.ID, 10))
+	msg.Data = b
+
+	if err := ns.Conn.PublishMsg(msg); err != nil {
+		return err
+	}
+
+	// the flush round trip confirms the server received the message
+	return ns.Conn.FlushWithContext(ctx)
+}
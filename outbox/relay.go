@@ -0,0 +1,86 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+const (
+	// DefaultInterval is the time the relay waits when the outbox is empty
+	DefaultInterval = time.Second
+
+	// DefaultBatchSize is the number of events published per transaction
+	DefaultBatchSize = 100
+
+	// DefaultMaxAttempts is the number of times a event is published before it is parked
+	DefaultMaxAttempts = 10
+)
+
+// Store is the outbox written by the users store
+type Store interface {
+	ProcessOutbox(ctx context.Context, limit, maxAttempts int, fn func(*users.Event) error) (int, error)
+}
+
+// Sink delivers events to other services, a event is only marked as
+// published once Publish returns nil
+type Sink interface {
+	Publish(ctx context.Context, e *users.Event) error
+}
+
+// Relay moves the events of the outbox to a sink with at least once delivery.
+// Each user gets its events in order: when one can not be published the later
+// ones of the same user wait, and after MaxAttempts it is parked with them
+// while the events of other users go on.
+type Relay struct {
+	Store       Store
+	Sink        Sink
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+}
+
+// NewRelay ...
+func NewRelay(store Store, sink Sink) *Relay {
+	return &Relay{
+		Store:       store,
+		Sink:        sink,
+		Interval:    DefaultInterval,
+		BatchSize:   DefaultBatchSize,
+		MaxAttempts: DefaultMaxAttempts,
+	}
+}
+
+// Run publishes events until the context is canceled
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		n, err := r.Flush(ctx)
+		if err != nil {
+			log.Println(fmt.Sprintf("[User Service][Outbox][Error] %v", err.Error()))
+		}
+
+		// a full batch means there may be more events waiting
+		if err == nil && n == r.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.Interval):
+		}
+	}
+}
+
+// Flush publishes a single batch of events and returns how many were
+// published, with the first error of the sink if any failed
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	// the outbox holds the events of every tenant
+	return r.Store.ProcessOutbox(tenant.WithSystem(ctx), r.BatchSize, r.MaxAttempts, func(e *users.Event) error {
+		return r.Sink.Publish(ctx, e)
+	})
+}
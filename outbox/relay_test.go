@@ -0,0 +1,155 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/database/sqlite"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+// newTestStore returns a SQLite store with a user per email, each with a
+// user.created and a user.updated event in the outbox
+func newTestStore(t *testing.T, emails ...string) (*sqlite.UserStore, map[string]*users.User) {
+	t.Helper()
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Store.Close() })
+
+	ctx := tenant.WithSystem(context.Background())
+	byEmail := make(map[string]*users.User)
+
+	for _, email := range emails {
+		u := &users.User{Email: email, Name: "Ada", LastName: "Lovelace", Password: "hash"}
+		if err := store.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.Update(ctx, &users.User{ID: u.ID, Name: "Augusta"}); err != nil {
+			t.Fatal(err)
+		}
+
+		byEmail[email] = u
+	}
+
+	return store, byEmail
+}
+
+func TestRelayPublishesInOrder(t *testing.T) {
+	store, _ := newTestStore(t, "ada@example.com", "grace@example.com")
+
+	sink := &MemorySink{}
+	relay := NewRelay(store, sink)
+	relay.BatchSize = 3
+
+	n, err := relay.Flush(context.Background())
+	if err != nil || n != 3 {
+		t.Fatalf("first flush = %v, %v, want 3", n, err)
+	}
+
+	n, err = relay.Flush(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("second flush = %v, %v, want 1", n, err)
+	}
+
+	events := sink.Events()
+	for i := 1; i < len(events); i++ {
+		if events[i].ID <= events[i-1].ID {
+			t.Errorf("event %v published after %v", events[i].ID, events[i-1].ID)
+		}
+	}
+
+	if n, err := relay.Flush(context.Background()); err != nil || n != 0 {
+		t.Errorf("flush of a empty outbox = %v, %v", n, err)
+	}
+}
+
+func TestRelayFailuresOnlyHoldTheirUser(t *testing.T) {
+	store, byEmail := newTestStore(t, "ada@example.com", "grace@example.com")
+	poisoned := byEmail["ada@example.com"]
+
+	errRejected := errors.New("rejected")
+
+	sink := &MemorySink{Reject: func(e *users.Event) error {
+		if e.UserID == poisoned.ID {
+			return errRejected
+		}
+		return nil
+	}}
+
+	relay := NewRelay(store, sink)
+	relay.MaxAttempts = 2
+
+	n, err := relay.Flush(context.Background())
+	if !errors.Is(err, errRejected) {
+		t.Fatalf("flush error = %v, want %v", err, errRejected)
+	}
+
+	// the events of the other user are published
+	if n != 2 {
+		t.Fatalf("published = %v, want 2", n)
+	}
+
+	for _, e := range sink.Events() {
+		if e.UserID == poisoned.ID {
+			t.Fatalf("event %v of the failing user was published", e.ID)
+		}
+	}
+
+	ctx := tenant.WithSystem(context.Background())
+
+	ee, err := store.ListEvents(ctx, &users.EventFilter{UserIDs: []string{poisoned.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the first event of the user was tried, the later one waits for it
+	if ee[0].Attempts != 1 || ee[0].LastError == nil || *ee[0].LastError != errRejected.Error() || ee[1].Attempts != 0 {
+		t.Fatalf("attempts = %v and %v, want 1 and 0", ee[0].Attempts, ee[1].Attempts)
+	}
+
+	if _, err := relay.Flush(context.Background()); !errors.Is(err, errRejected) {
+		t.Fatalf("second flush error = %v, want %v", err, errRejected)
+	}
+
+	ee, err = store.ListEvents(ctx, &users.EventFilter{UserIDs: []string{poisoned.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ee[0].ParkedAt == nil {
+		t.Fatalf("event was not parked after %v attempts", ee[0].Attempts)
+	}
+
+	// parked events are not tried again
+	sink.Reject = nil
+
+	if n, err := relay.Flush(context.Background()); err != nil || n != 0 {
+		t.Fatalf("flush with the user parked = %v, %v, want 0", n, err)
+	}
+}
+
+func TestRelayReportsAUnavailableSink(t *testing.T) {
+	store, _ := newTestStore(t, "ada@example.com")
+
+	errDown := errors.New("sink down")
+	sink := &MemorySink{Err: errDown}
+
+	n, err := NewRelay(store, sink).Flush(context.Background())
+	if !errors.Is(err, errDown) || n != 0 {
+		t.Fatalf("flush = %v, %v, want %v", n, err, errDown)
+	}
+
+	sink.Err = nil
+
+	n, err = NewRelay(store, sink).Flush(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("flush after the sink is back = %v, %v, want 2", n, err)
+	}
+}
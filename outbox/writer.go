@@ -0,0 +1,36 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// WriterSink writes each event as a JSON line
+type WriterSink struct {
+	mu sync.Mutex
+	W  io.Writer
+}
+
+// NewStdoutSink ...
+func NewStdoutSink() *WriterSink {
+	return &WriterSink{W: os.Stdout}
+}
+
+// Publish ...
+func (ws *WriterSink) Publish(ctx context.Context, e *users.Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	_, err = ws.W.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,177 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	prefixLength = 5
+	hashLength   = 40
+)
+
+// Blocklist is a offline set of breached password SHA-1 hashes indexed by the
+// 5 characters prefix used by the k-anonymity range API of Have I Been Pwned,
+// so the files downloaded from it can be loaded as they are.
+type Blocklist struct {
+	mu       sync.RWMutex
+	prefixes map[string]map[string]struct{}
+}
+
+// NewBlocklist ...
+func NewBlocklist() *Blocklist {
+	return &Blocklist{
+		prefixes: make(map[string]map[string]struct{}),
+	}
+}
+
+// Contains reports whether the password is in the blocklist
+func (b *Blocklist) Contains(password string) bool {
+	hash := hashPassword(password)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	_, ok := b.prefixes[hash[:prefixLength]][hash[prefixLength:]]
+	return ok
+}
+
+// Len returns the number of hashes in the blocklist
+func (b *Blocklist) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	n := 0
+	for _, suffixes := range b.prefixes {
+		n += len(suffixes)
+	}
+	return n
+}
+
+// AddPassword ...
+func (b *Blocklist) AddPassword(password string) {
+	hash := hashPassword(password)
+	b.add(hash[:prefixLength], hash[prefixLength:])
+}
+
+// AddHash adds a hex encoded SHA-1 hash
+func (b *Blocklist) AddHash(hash string) error {
+	hash = strings.ToUpper(strings.TrimSpace(hash))
+	if len(hash) != hashLength {
+		return fmt.Errorf("invalid sha1 hash %q", hash)
+	}
+
+	b.add(hash[:prefixLength], hash[prefixLength:])
+	return nil
+}
+
+// Load reads full hashes, one per line with an optional ":count" suffix
+func (b *Blocklist) Load(r io.Reader) error {
+	return scanLines(r, func(line string) error {
+		return b.AddHash(stripCount(line))
+	})
+}
+
+// LoadFile ...
+func (b *Blocklist) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return b.Load(f)
+}
+
+// LoadRange reads a range response of the given prefix, one "SUFFIX:count" per line
+func (b *Blocklist) LoadRange(prefix string, r io.Reader) error {
+	prefix = strings.ToUpper(prefix)
+	if len(prefix) != prefixLength {
+		return fmt.Errorf("invalid hash prefix %q", prefix)
+	}
+
+	return scanLines(r, func(line string) error {
+		return b.AddHash(prefix + stripCount(line))
+	})
+}
+
+// LoadRangeDir loads every range file of the directory, named by their prefix
+// with an optional extension (e.g. 21BD1.txt).
+func (b *Blocklist) LoadRangeDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		prefix := strings.TrimSuffix(name, filepath.Ext(name))
+		if len(prefix) != prefixLength {
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+
+		err = b.LoadRange(prefix, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (b *Blocklist) add(prefix, suffix string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	suffixes, ok := b.prefixes[prefix]
+	if !ok {
+		suffixes = make(map[string]struct{})
+		b.prefixes[prefix] = suffixes
+	}
+	suffixes[suffix] = struct{}{}
+}
+
+func hashPassword(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func stripCount(line string) string {
+	if i := strings.Index(line, ":"); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+func scanLines(r io.Reader, fn func(line string) error) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,43 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadRangeDir(t *testing.T) {
+	dir := t.TempDir()
+
+	// the SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	files := map[string]string{
+		"5BAA6.txt":  "1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\n",
+		"README.txt": "not a range\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "ABCDE"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBlocklist()
+	if err := b.LoadRangeDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Len() != 1 {
+		t.Errorf("len = %v, want 1", b.Len())
+	}
+
+	if !b.Contains("password") {
+		t.Error("password is not blocked")
+	}
+
+	if b.Contains("correct horse battery staple") {
+		t.Error("correct horse battery staple is blocked")
+	}
+}
@@ -0,0 +1,26 @@
+package password
+
+// CommonBlocklist returns a new blocklist with the most common passwords found in breaches
+func CommonBlocklist() *Blocklist {
+	b := NewBlocklist()
+	for _, p := range commonPasswords {
+		b.AddPassword(p)
+	}
+	return b
+}
+
+var commonPasswords = []string{
+	"123456", "123456789", "12345678", "12345", "1234567", "1234567890", "123123", "111111",
+	"000000", "654321", "666666", "121212", "112233", "987654321", "123321", "1q2w3e4r",
+	"1q2w3e4r5t", "1qaz2wsx", "qwerty", "qwerty123", "qwertyuiop", "asdfghjkl", "zxcvbnm",
+	"password", "password1", "password123", "Password", "Password1", "Password123", "passw0rd",
+	"p@ssw0rd", "P@ssw0rd", "iloveyou", "princess", "sunshine", "football", "baseball",
+	"welcome", "welcome1", "welcome123", "admin", "admin123", "administrator", "letmein",
+	"monkey", "dragon", "master", "shadow", "superman", "batman", "trustno1", "starwars",
+	"michael", "jessica", "charlie", "whatever", "freedom", "computer", "internet", "secret",
+	"abc123", "abcd1234", "abcdef", "aa123456", "a123456", "changeme", "default", "guest",
+	"login", "hello123", "hunter2", "killer", "pokemon", "soccer", "hockey", "jordan23",
+	"mustang", "access", "flower", "lovely", "loveme", "samsung", "google", "zaq12wsx",
+	"qazwsx", "Qwerty123", "Qwerty123!", "Aa123456", "Aa123456!", "Welcome1!", "Summer2023",
+	"Winter2023", "Spring2024", "Autumn2024", "12qwaszx", "987654", "7777777", "88888888",
+}
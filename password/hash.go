@@ -0,0 +1,34 @@
+package password
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashCost is the bcrypt cost of new hashes, it can be lowered in tests
+var HashCost = bcrypt.DefaultCost
+
+// Hash returns the bcrypt hash stored instead of the password. The password
+// is reduced with SHA-256 first since bcrypt only reads 72 bytes.
+func Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword(prehash(password), HashCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// Matches reports whether the password is the one of the hash
+func Matches(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), prehash(password)) == nil
+}
+
+// prehash returns the base64 of the SHA-256 of the password, the migration
+// that hashed the existing passwords computes the same with pgcrypto
+func prehash(password string) []byte {
+	sum := sha256.Sum256([]byte(password))
+	return []byte(base64.StdEncoding.EncodeToString(sum[:]))
+}
@@ -0,0 +1,49 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHash(t *testing.T) {
+	HashCost = bcrypt.MinCost
+
+	hash, err := Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "$2") {
+		t.Fatalf("hash = %v, want a bcrypt hash", hash)
+	}
+
+	if !Matches(hash, "correct horse battery staple") {
+		t.Error("the password does not match its hash")
+	}
+
+	if Matches(hash, "correct horse battery stapler") {
+		t.Error("a different password matches the hash")
+	}
+
+	if Matches("correct horse battery staple", "correct horse battery staple") {
+		t.Error("a password stored in plain text matches")
+	}
+}
+
+func TestHashLongPasswords(t *testing.T) {
+	HashCost = bcrypt.MinCost
+
+	long := strings.Repeat("a", 100)
+
+	hash, err := Hash(long + "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bcrypt alone would ignore everything after the 72nd byte
+	if Matches(hash, long+"2") {
+		t.Error("passwords that differ after 72 bytes match")
+	}
+}
@@ -0,0 +1,136 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// Rules reported in the violations
+const (
+	RuleMinLength    = "min_length"
+	RuleMaxLength    = "max_length"
+	RuleUppercase    = "uppercase"
+	RuleLowercase    = "lowercase"
+	RuleDigit        = "digit"
+	RuleSymbol       = "symbol"
+	RulePersonalInfo = "personal_info"
+	RuleBreached     = "breached"
+)
+
+// minPersonalInfoLength avoids rejecting passwords for containing very short names
+const minPersonalInfoLength = 3
+
+// Policy are the rules a password must follow
+type Policy struct {
+	MinLength int
+	MaxLength int
+
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+
+	// DisallowPersonalInfo rejects passwords containing the email or names of the user
+	DisallowPersonalInfo bool
+
+	// Blocklist rejects known common or breached passwords, nil disables the check
+	Blocklist *Blocklist
+}
+
+// DefaultPolicy follows NIST SP 800-63B: length and blocklist over composition rules
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MinLength:            8,
+		MaxLength:            128,
+		DisallowPersonalInfo: true,
+		Blocklist:            CommonBlocklist(),
+	}
+}
+
+// Validate returns every rule the password of the user breaks, nil if it is valid
+func (p *Policy) Validate(password string, u *user.User) []user.FieldViolation {
+	var violations []user.FieldViolation
+
+	add := func(rule, description string) {
+		violations = append(violations, user.FieldViolation{
+			Field:       "password",
+			Rule:        rule,
+			Description: description,
+		})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		add(RuleMinLength, fmt.Sprintf("must have at least %v characters", p.MinLength))
+	}
+
+	if p.MaxLength > 0 && length > p.MaxLength {
+		add(RuleMaxLength, fmt.Sprintf("must have at most %v characters", p.MaxLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	if p.RequireUppercase && !upper {
+		add(RuleUppercase, "must contain a uppercase letter")
+	}
+
+	if p.RequireLowercase && !lower {
+		add(RuleLowercase, "must contain a lowercase letter")
+	}
+
+	if p.RequireDigit && !digit {
+		add(RuleDigit, "must contain a digit")
+	}
+
+	if p.RequireSymbol && !symbol {
+		add(RuleSymbol, "must contain a symbol")
+	}
+
+	if p.DisallowPersonalInfo && u != nil && containsPersonalInfo(password, u) {
+		add(RulePersonalInfo, "must not contain the email or name")
+	}
+
+	if p.Blocklist != nil && p.Blocklist.Contains(password) {
+		add(RuleBreached, "is too common or appeared in a data breach")
+	}
+
+	return violations
+}
+
+func containsPersonalInfo(password string, u *user.User) bool {
+	password = strings.ToLower(password)
+
+	parts := []string{u.Name, u.LastName, u.Email}
+	if i := strings.Index(u.Email, "@"); i > 0 {
+		parts = append(parts, u.Email[:i])
+	}
+
+	for _, part := range parts {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if utf8.RuneCountInString(part) < minPersonalInfoLength {
+			continue
+		}
+
+		if strings.Contains(password, part) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,52 @@
+package users
+
+import (
+	"errors"
+	"time"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+)
+
+// DefaultRole is assigned to every new user
+const DefaultRole = "user"
+
+// Permissions the service checks before acting on other users
+const (
+	PermissionAssignRoles   = "roles:assign"
+	PermissionUnlockUsers   = "users:unlock"
+	PermissionResetMFA      = "mfa:reset"
+	PermissionWriteUsers    = "users:write"
+	PermissionDeleteUsers   = "users:delete"
+	PermissionWriteProfile  = "profile:write"
+	PermissionWriteWebhooks = "webhooks:write"
+)
+
+var (
+	// ErrRoleNotFound ...
+	ErrRoleNotFound = errors.New("role not found")
+
+	// ErrPermissionDenied is returned when no role of the acting user grants the permission
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// Role groups the permissions granted to the users it is assigned to
+type Role struct {
+	ID          string    `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	BuiltIn     bool      `json:"built_in" db:"built_in"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+
+	Permissions []string `json:"permissions" db:"-"`
+}
+
+// ToProto ...
+func (r *Role) ToProto() *pb.Role {
+	return &pb.Role{
+		Id:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		BuiltIn:     r.BuiltIn,
+		Permissions: r.Permissions,
+	}
+}
@@ -0,0 +1,86 @@
+package users
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/frperezr/microservices-demo/src/users-api/actor"
+	"github.com/frperezr/microservices-demo/src/users-api/token"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader is the metadata key of the id of a request, one is generated
+// when the caller does not send it and it is returned in the response headers
+const RequestIDHeader = "x-request-id"
+
+// ActorInterceptor records who made each request for the audit log, the user
+// of the access token sent as "authorization: Bearer <token>" and the request
+// id. It does not reject requests, a missing or invalid token leaves the
+// actor empty.
+func ActorInterceptor(tokens *token.Issuer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = actorContext(ctx, tokens)
+		grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, actor.FromContext(ctx).RequestID))
+
+		return handler(ctx, req)
+	}
+}
+
+// ActorStreamInterceptor is the ActorInterceptor of the streaming RPCs
+func ActorStreamInterceptor(tokens *token.Issuer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := actorContext(ss.Context(), tokens)
+		ss.SetHeader(metadata.Pairs(RequestIDHeader, actor.FromContext(ctx).RequestID))
+
+		return handler(srv, &contextStream{
+			ServerStream: ss,
+			ctx:          ctx,
+		})
+	}
+}
+
+func actorContext(ctx context.Context, tokens *token.Issuer) context.Context {
+	a := actor.Actor{}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(RequestIDHeader); len(ids) > 0 {
+			a.RequestID = ids[0]
+		}
+	}
+
+	if claims, ok := accessClaims(ctx, tokens); ok {
+		a.UserID = claims.Subject
+	}
+
+	if a.RequestID == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		a.RequestID = hex.EncodeToString(b)
+	}
+
+	return actor.With(ctx, a)
+}
+
+// accessClaims returns the claims of the access token sent as
+// "authorization: Bearer <token>", false when there is none or it is invalid
+func accessClaims(ctx context.Context, tokens *token.Issuer) (*token.Claims, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || tokens == nil {
+		return nil, false
+	}
+
+	auth := md.Get("authorization")
+	if len(auth) == 0 || !strings.HasPrefix(auth[0], "Bearer ") {
+		return nil, false
+	}
+
+	claims, err := tokens.ParseAccess(strings.TrimPrefix(auth[0], "Bearer "))
+	if err != nil {
+		return nil, false
+	}
+
+	return claims, true
+}
@@ -0,0 +1,54 @@
+package users
+
+import (
+	"fmt"
+	"log"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"golang.org/x/net/context"
+)
+
+// ListAuditEvents returns the audit log of a user, verified tells if its hash chain is intact
+func (us *Service) ListAuditEvents(ctx context.Context, gr *pb.ListAuditEventsRequest) (*pb.ListAuditEventsResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][ListAuditEvents][Request] user_id = %v", gr.GetUserId()))
+
+	if gr.GetUserId() == "" {
+		log.Println("[User Service][ListAuditEvents][Error] must provide a user_id")
+		return &pb.ListAuditEventsResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a user_id",
+			},
+		}, nil
+	}
+
+	events, err := us.userSvc.ListAuditEvents(ctx, gr.GetUserId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ListAuditEvents][Error] %v", err.Error()))
+		return &pb.ListAuditEventsResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	data := make([]*pb.AuditEvent, 0, len(events))
+	for _, e := range events {
+		data = append(data, e.ToProto())
+	}
+
+	verified := true
+	if err := users.VerifyAuditChain(events); err != nil {
+		log.Println(fmt.Sprintf("[User Service][ListAuditEvents][Error] %v", err.Error()))
+		verified = false
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ListAuditEvents][Response] count = %v", len(data)))
+	return &pb.ListAuditEventsResponse{
+		Data:     data,
+		Verified: verified,
+		Error:    nil,
+	}, nil
+}
@@ -0,0 +1,143 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"golang.org/x/net/context"
+)
+
+// BatchGetUsers returns the users found with the ids and the ids that were not found
+func (us *Service) BatchGetUsers(ctx context.Context, gr *pb.BatchGetUsersRequest) (*pb.BatchGetUsersResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][BatchGetUsers][Request] ids = %v", gr.GetIds()))
+
+	found, missing, err := us.userSvc.BatchGetUsers(ctx, gr.GetIds())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][BatchGetUsers][Error] %v", err.Error()))
+		return &pb.BatchGetUsersResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	data := make([]*pb.User, 0, len(found))
+	for _, u := range found {
+		data = append(data, u.ToProto())
+	}
+
+	log.Println(fmt.Sprintf("[User Service][BatchGetUsers][Response] found = %v missing = %v", len(data), len(missing)))
+	return &pb.BatchGetUsersResponse{
+		Data:       data,
+		MissingIds: missing,
+		Error:      nil,
+	}, nil
+}
+
+// BatchCreateUsers creates the users, with the result of each one in the
+// order of the request. With all_or_nothing no user is created if any fails.
+func (us *Service) BatchCreateUsers(ctx context.Context, gr *pb.BatchCreateUsersRequest) (*pb.BatchCreateUsersResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][BatchCreateUsers][Request] count = %v all_or_nothing = %v", len(gr.GetData()), gr.GetAllOrNothing()))
+
+	if len(gr.GetData()) > users.MaxBatchSize {
+		log.Println(fmt.Sprintf("[User Service][BatchCreateUsers][Error] %v", users.ErrBatchTooLarge))
+		return &pb.BatchCreateUsersResponse{
+			Error: &pb.Error{
+				Code:    errorCode(users.ErrBatchTooLarge),
+				Message: users.ErrBatchTooLarge.Error(),
+			},
+		}, nil
+	}
+
+	errs := make([]error, len(gr.GetData()))
+	uu := make([]*users.User, 0, len(gr.GetData()))
+	index := make([]int, 0, len(gr.GetData()))
+
+	for i, data := range gr.GetData() {
+		if err := requiredUserFields(data); err != nil {
+			errs[i] = err
+			continue
+		}
+
+		uu = append(uu, &users.User{
+			Email:    data.GetEmail(),
+			Name:     data.GetName(),
+			LastName: data.GetLastName(),
+			Password: data.GetPassword(),
+		})
+		index = append(index, i)
+	}
+
+	if len(uu) < len(errs) && gr.GetAllOrNothing() {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = users.ErrBatchAborted
+			}
+		}
+	} else {
+		created, err := us.userSvc.BatchCreateUsers(ctx, uu, gr.GetAllOrNothing())
+		if err != nil {
+			log.Println(fmt.Sprintf("[User Service][BatchCreateUsers][Error] %v", err.Error()))
+			return &pb.BatchCreateUsersResponse{
+				Error: &pb.Error{
+					Code:    errorCode(err),
+					Message: err.Error(),
+				},
+			}, nil
+		}
+
+		for j, i := range index {
+			errs[i] = created[j]
+		}
+	}
+
+	results := make([]*pb.BatchCreateUserResult, 0, len(errs))
+	failed := 0
+
+	for i, err := range errs {
+		result := &pb.BatchCreateUserResult{Index: int32(i)}
+
+		if err != nil {
+			failed++
+			result.Error = &pb.Error{
+				Code:       errorCode(err),
+				Message:    err.Error(),
+				Violations: fieldViolations(err),
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	for j, i := range index {
+		if errs[i] == nil {
+			results[i].Data = uu[j].ToProto()
+		}
+	}
+
+	log.Println(fmt.Sprintf("[User Service][BatchCreateUsers][Response] created = %v failed = %v", len(results)-failed, failed))
+	return &pb.BatchCreateUsersResponse{
+		Data:  results,
+		Error: nil,
+	}, nil
+}
+
+// requiredUserFields checks the fields a new user must have
+func requiredUserFields(u *pb.User) error {
+	switch {
+	case u.GetEmail() == "":
+		return errors.New("email param is empty")
+	case u.GetName() == "":
+		return errors.New("name param is empty")
+	case u.GetLastName() == "":
+		return errors.New("last_name param is empty")
+	case u.GetPassword() == "":
+		return errors.New("password param is empty")
+	}
+
+	return nil
+}
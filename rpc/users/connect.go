@@ -0,0 +1,151 @@
+package users
+
+import (
+	"net/http"
+	"strings"
+
+	"connectrpc.com/connect"
+	"github.com/frperezr/microservices-demo/src/users-api/actor"
+	"github.com/frperezr/microservices-demo/src/users-api/token"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// ConnectServiceName is the name of the service in the procedures of the Connect handler
+const ConnectServiceName = "pb.UserService"
+
+// ConnectHandler serves the browserMethods over the Connect, gRPC-Web and
+// gRPC protocols on plain HTTP, for browser clients that can not speak gRPC.
+// It returns the path to mount the handler on, like the handlers generated by
+// protoc-gen-connect-go. The other methods are only served over gRPC.
+func (us *Service) ConnectHandler(tokens *token.Issuer) (string, http.Handler) {
+	opts := []connect.HandlerOption{
+		connect.WithInterceptors(&connectInterceptor{tokens: tokens}),
+	}
+
+	mux := http.NewServeMux()
+
+	// the publicMethods, to sign up and sign in
+	connectUnary(mux, "Create", us.Create, opts...)
+	connectUnary(mux, "Authenticate", us.Authenticate, opts...)
+	connectUnary(mux, "VerifyEmail", us.VerifyEmail, opts...)
+	connectUnary(mux, "ResendVerification", us.ResendVerification, opts...)
+	connectUnary(mux, "ConfirmEmailChange", us.ConfirmEmailChange, opts...)
+	connectUnary(mux, "RevertEmailChange", us.RevertEmailChange, opts...)
+
+	// the selfMethods
+	connectUnary(mux, "EnrollMFA", us.EnrollMFA, opts...)
+	connectUnary(mux, "ConfirmMFA", us.ConfirmMFA, opts...)
+	connectUnary(mux, "DisableMFA", us.DisableMFA, opts...)
+	connectUnary(mux, "ListOrganizations", us.ListOrganizations, opts...)
+	connectUnary(mux, "CreateOrganization", us.CreateOrganization, opts...)
+	connectUnary(mux, "AcceptInvitation", us.AcceptInvitation, opts...)
+
+	// reads within the organization of the token
+	connectUnary(mux, "GetByID", us.GetByID, opts...)
+	connectUnary(mux, "GetOrganization", us.GetOrganization, opts...)
+	connectUnary(mux, "ListUserRoles", us.ListUserRoles, opts...)
+	connectUnary(mux, "CheckPermission", us.CheckPermission, opts...)
+	connectUnary(mux, "ListUserGroups", us.ListUserGroups, opts...)
+
+	return "/" + ConnectServiceName + "/", connectAuth(tokens, mux)
+}
+
+// connectAuth rejects the requests without a valid access token before they
+// are read, but for the publicMethods. Procedures that are not mounted are not
+// found.
+func connectAuth(tokens *token.Issuer, h http.Handler) http.Handler {
+	errWriter := connect.NewErrorWriter()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !publicMethods[methodName(r.URL.Path)] {
+			md := metadata.Pairs("authorization", r.Header.Get("Authorization"))
+			if _, ok := accessClaims(metadata.NewIncomingContext(r.Context(), md), tokens); !ok {
+				errWriter.Write(w, r, connect.NewError(connect.CodeUnauthenticated, errUnauthenticated))
+				return
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// connectUnary mounts a unary method of the service as a Connect procedure
+func connectUnary[Req, Res any](mux *http.ServeMux, method string, fn func(context.Context, *Req) (*Res, error), opts ...connect.HandlerOption) {
+	procedure := "/" + ConnectServiceName + "/" + method
+
+	mux.Handle(procedure, connect.NewUnaryHandler(procedure, func(ctx context.Context, req *connect.Request[Req]) (*connect.Response[Res], error) {
+		res, err := fn(ctx, req.Msg)
+		if err != nil {
+			return nil, err
+		}
+
+		return connect.NewResponse(res), nil
+	}, opts...))
+}
+
+// connectInterceptor scopes the Connect requests like TenantInterceptor and
+// ActorInterceptor do with the gRPC ones, the headers are read as metadata
+type connectInterceptor struct {
+	tokens *token.Issuer
+}
+
+// WrapUnary ...
+func (ci *connectInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		ctx, err := headerContext(ctx, req.Header(), ci.tokens, methodName(req.Spec().Procedure), req.Any())
+		if err != nil {
+			return nil, connectTenantError(err)
+		}
+
+		res, err := next(ctx, req)
+		if err == nil {
+			res.Header().Set(RequestIDHeader, actor.FromContext(ctx).RequestID)
+		}
+
+		return res, err
+	}
+}
+
+// WrapStreamingClient ...
+func (ci *connectInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler ...
+func (ci *connectInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		ctx, err := headerContext(ctx, conn.RequestHeader(), ci.tokens, methodName(conn.Spec().Procedure), nil)
+		if err != nil {
+			return connectTenantError(err)
+		}
+		conn.ResponseHeader().Set(RequestIDHeader, actor.FromContext(ctx).RequestID)
+
+		return next(ctx, conn)
+	}
+}
+
+// headerContext scopes a context with the HTTP headers of a request, read as
+// gRPC metadata, see tenantContext for method and req
+func headerContext(ctx context.Context, header http.Header, tokens *token.Issuer, method string, req interface{}) (context.Context, error) {
+	md := metadata.MD{}
+	for name, values := range header {
+		md.Append(strings.ToLower(name), values...)
+	}
+
+	ctx, err := tenantContext(metadata.NewIncomingContext(ctx, md), tokens, method, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return consistencyContext(actorContext(ctx, tokens)), nil
+}
+
+// connectTenantError converts a error of tenantContext to a Connect error
+func connectTenantError(err error) error {
+	if err == errUnauthenticated {
+		return connect.NewError(connect.CodeUnauthenticated, err)
+	}
+
+	return connect.NewError(connect.CodePermissionDenied, err)
+}
@@ -0,0 +1,106 @@
+package users
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	pb "github.com/frperezr/microservices-demo/pb"
+	"github.com/frperezr/microservices-demo/src/users-api/service"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+// newTestConnectServer serves the Connect handler of the service over HTTP
+func newTestConnectServer(t *testing.T, userSvc *service.Users) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle(New(userSvc).ConnectHandler(userSvc.Tokens))
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// connectRequest returns a request sending the access token, if any
+func connectRequest[Req any](msg *Req, accessToken string) *connect.Request[Req] {
+	req := connect.NewRequest(msg)
+	if accessToken != "" {
+		req.Header().Set("Authorization", "Bearer "+accessToken)
+	}
+
+	return req
+}
+
+func TestConnectServesTheBrowserMethods(t *testing.T) {
+	userSvc := newTestService(t)
+	acme := newTestTenant(t, userSvc, "owner@acme.test", "acme")
+	srv := newTestConnectServer(t, userSvc)
+
+	authenticate := connect.NewClient[pb.AuthenticateRequest, pb.AuthenticateResponse](srv.Client(), srv.URL+"/pb.UserService/Authenticate")
+
+	auth, err := authenticate.CallUnary(context.Background(), connectRequest(&pb.AuthenticateRequest{
+		Email:          "owner@acme.test",
+		Password:       "correct horse battery staple",
+		OrganizationId: acme.org.ID,
+	}, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if auth.Msg.GetError() != nil || auth.Msg.GetAccessToken() == "" {
+		t.Fatalf("Authenticate = %v, want a access token", auth.Msg.GetError())
+	}
+
+	// gRPC-Web is served on the same path
+	getByID := connect.NewClient[pb.GetUserByIDRequest, pb.GetUserByIDResponse](srv.Client(), srv.URL+"/pb.UserService/GetByID", connect.WithGRPCWeb())
+
+	res, err := getByID.CallUnary(context.Background(), connectRequest(&pb.GetUserByIDRequest{Id: acme.owner.ID}, auth.Msg.GetAccessToken()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Msg.GetData().GetId() != acme.owner.ID {
+		t.Fatalf("GetByID = %v, want the owner", res.Msg.GetError())
+	}
+
+	if res.Header().Get(RequestIDHeader) == "" {
+		t.Fatalf("missing %v header", RequestIDHeader)
+	}
+}
+
+func TestConnectRejectsRequestsWithoutAToken(t *testing.T) {
+	userSvc := newTestService(t)
+	acme := newTestTenant(t, userSvc, "owner@acme.test", "acme")
+	srv := newTestConnectServer(t, userSvc)
+
+	getByID := connect.NewClient[pb.GetUserByIDRequest, pb.GetUserByIDResponse](srv.Client(), srv.URL+"/pb.UserService/GetByID")
+
+	for name, accessToken := range map[string]string{"without a token": "", "with a invalid token": "not-a-token"} {
+		_, err := getByID.CallUnary(context.Background(), connectRequest(&pb.GetUserByIDRequest{Id: acme.owner.ID}, accessToken))
+		if connect.CodeOf(err) != connect.CodeUnauthenticated {
+			t.Errorf("GetByID %v = %v, want %v", name, err, connect.CodeUnauthenticated)
+		}
+	}
+}
+
+func TestConnectDoesNotServeTheOtherMethods(t *testing.T) {
+	userSvc := newTestService(t)
+	acme := newTestTenant(t, userSvc, "owner@acme.test", "acme")
+	srv := newTestConnectServer(t, userSvc)
+
+	remove := connect.NewClient[pb.DeleteUserRequest, pb.DeleteUserResponse](srv.Client(), srv.URL+"/pb.UserService/Delete")
+
+	_, err := remove.CallUnary(context.Background(), connectRequest(&pb.DeleteUserRequest{UserId: acme.owner.ID}, acme.token))
+	if connect.CodeOf(err) != connect.CodeUnimplemented {
+		t.Fatalf("Delete = %v, want %v", err, connect.CodeUnimplemented)
+	}
+
+	u, err := userSvc.GetByID(tenant.WithSystem(context.Background()), acme.owner.ID)
+	if err != nil || u.DeletedAt != nil {
+		t.Fatalf("the owner was deleted over Connect")
+	}
+}
@@ -0,0 +1,36 @@
+package users
+
+import (
+	"github.com/frperezr/microservices-demo/src/users-api/consistency"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ReadPrimaryHeader is the metadata a caller sends to read from the primary
+// database, for example right after a write made by a previous request
+const ReadPrimaryHeader = "x-read-primary"
+
+// ConsistencyInterceptor makes every request read its own writes, the reads
+// after a write go to the primary database instead of a replica
+func ConsistencyInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(consistencyContext(ctx), req)
+}
+
+// ConsistencyStreamInterceptor is the ConsistencyInterceptor of the streaming RPCs
+func ConsistencyStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextStream{
+		ServerStream: ss,
+		ctx:          consistencyContext(ss.Context()),
+	})
+}
+
+func consistencyContext(ctx context.Context) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(ReadPrimaryHeader); len(values) > 0 && values[0] == "true" {
+			return consistency.Primary(ctx)
+		}
+	}
+
+	return consistency.WithSession(ctx)
+}
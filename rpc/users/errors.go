@@ -0,0 +1,58 @@
+package users
+
+import (
+	pb "github.com/frperezr/microservices-demo/pb"
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+// errorCode maps the errors of the users domain to the codes returned in pb.Error
+func errorCode(err error) int32 {
+	if _, ok := err.(*users.ValidationError); ok {
+		return 400
+	}
+
+	switch err {
+	case users.ErrInvalidToken, users.ErrInvalidMFACode, users.ErrMFANotEnabled, users.ErrInvalidOrgRole, users.ErrInvalidGroupMember, users.ErrInvalidWebhookURL, users.ErrBatchTooLarge, users.ErrInvalidIdempotencyKey:
+		return 400
+	case users.ErrInvalidCredentials:
+		return 401
+	case users.ErrEmailNotVerified, users.ErrNotMember, users.ErrPermissionDenied, tenant.ErrMissing, tenant.ErrMismatch:
+		return 403
+	case users.ErrEmailTaken, users.ErrEmailAlreadyVerified, users.ErrMFAAlreadyEnabled, users.ErrSlugTaken, users.ErrLastOwner, users.ErrGroupNameTaken, users.ErrGroupCycle, users.ErrBatchAborted, users.ErrIdempotencyKeyInProgress:
+		return 409
+	case users.ErrIdempotencyKeyReused:
+		return 422
+	case users.ErrAccountLocked:
+		return 423
+	case users.ErrTooManyAttempts:
+		return 429
+	case users.ErrUnavailable:
+		return 503
+	}
+
+	if err == users.ErrRoleNotFound || err == users.ErrOrganizationNotFound || err == users.ErrGroupNotFound || err == users.ErrWebhookNotFound || err == users.ErrDeliveryNotFound || err.Error() == "sql: no rows in result set" {
+		return 404
+	}
+
+	return 500
+}
+
+// fieldViolations returns the violations of a *users.ValidationError, nil for other errors
+func fieldViolations(err error) []*pb.FieldViolation {
+	verr, ok := err.(*users.ValidationError)
+	if !ok {
+		return nil
+	}
+
+	violations := make([]*pb.FieldViolation, 0, len(verr.Violations))
+	for _, v := range verr.Violations {
+		violations = append(violations, &pb.FieldViolation{
+			Field:       v.Field,
+			Rule:        v.Rule,
+			Description: v.Description,
+		})
+	}
+
+	return violations
+}
@@ -0,0 +1,321 @@
+package users
+
+import (
+	"fmt"
+	"log"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"golang.org/x/net/context"
+)
+
+// CreateGroup ...
+func (us *Service) CreateGroup(ctx context.Context, gr *pb.CreateGroupRequest) (*pb.CreateGroupResponse, error) {
+	data := gr.GetData()
+	log.Println(fmt.Sprintf("[User Service][CreateGroup][Request] organization_id = %v name = %v", data.GetOrganizationId(), data.GetName()))
+
+	if data.GetOrganizationId() == "" || data.GetName() == "" {
+		log.Println("[User Service][CreateGroup][Error] must provide a organization_id and name")
+		return &pb.CreateGroupResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a organization_id and name",
+			},
+		}, nil
+	}
+
+	group := new(users.Group).FromProto(data)
+
+	err := us.userSvc.CreateGroup(ctx, group)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][CreateGroup][Error] %v", err.Error()))
+		return &pb.CreateGroupResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][CreateGroup][Response] id = %v", group.ID))
+	return &pb.CreateGroupResponse{
+		Data:  group.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// GetGroup ...
+func (us *Service) GetGroup(ctx context.Context, gr *pb.GetGroupRequest) (*pb.GetGroupResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][GetGroup][Request] id = %v", gr.GetId()))
+
+	if gr.GetId() == "" {
+		log.Println("[User Service][GetGroup][Error] must provide a id")
+		return &pb.GetGroupResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a id",
+			},
+		}, nil
+	}
+
+	group, err := us.userSvc.GetGroup(ctx, gr.GetId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][GetGroup][Error] %v", err.Error()))
+		return &pb.GetGroupResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][GetGroup][Response] id = %v", group.ID))
+	return &pb.GetGroupResponse{
+		Data:  group.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// UpdateGroup ...
+func (us *Service) UpdateGroup(ctx context.Context, gr *pb.UpdateGroupRequest) (*pb.UpdateGroupResponse, error) {
+	data := gr.GetData()
+	log.Println(fmt.Sprintf("[User Service][UpdateGroup][Request] id = %v", data.GetId()))
+
+	if data.GetId() == "" {
+		log.Println("[User Service][UpdateGroup][Error] must provide a id")
+		return &pb.UpdateGroupResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a id",
+			},
+		}, nil
+	}
+
+	group := new(users.Group).FromProto(data)
+
+	err := us.userSvc.UpdateGroup(ctx, group)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][UpdateGroup][Error] %v", err.Error()))
+		return &pb.UpdateGroupResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][UpdateGroup][Response] id = %v", group.ID))
+	return &pb.UpdateGroupResponse{
+		Data:  group.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// DeleteGroup ...
+func (us *Service) DeleteGroup(ctx context.Context, gr *pb.DeleteGroupRequest) (*pb.DeleteGroupResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][DeleteGroup][Request] id = %v", gr.GetId()))
+
+	if gr.GetId() == "" {
+		log.Println("[User Service][DeleteGroup][Error] must provide a id")
+		return &pb.DeleteGroupResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a id",
+			},
+		}, nil
+	}
+
+	err := us.userSvc.DeleteGroup(ctx, gr.GetId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][DeleteGroup][Error] %v", err.Error()))
+		return &pb.DeleteGroupResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][DeleteGroup][Response] id = %v", gr.GetId()))
+	return &pb.DeleteGroupResponse{
+		Error: nil,
+	}, nil
+}
+
+// ListGroups returns the groups of a organization
+func (us *Service) ListGroups(ctx context.Context, gr *pb.ListGroupsRequest) (*pb.ListGroupsResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][ListGroups][Request] organization_id = %v", gr.GetOrganizationId()))
+
+	if gr.GetOrganizationId() == "" {
+		log.Println("[User Service][ListGroups][Error] must provide a organization_id")
+		return &pb.ListGroupsResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a organization_id",
+			},
+		}, nil
+	}
+
+	groups, err := us.userSvc.ListGroups(ctx, gr.GetOrganizationId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ListGroups][Error] %v", err.Error()))
+		return &pb.ListGroupsResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	data := make([]*pb.Group, 0, len(groups))
+	for _, group := range groups {
+		data = append(data, group.ToProto())
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ListGroups][Response] count = %v", len(data)))
+	return &pb.ListGroupsResponse{
+		Data:  data,
+		Error: nil,
+	}, nil
+}
+
+// AddGroupMember adds a user or a nested group to a group
+func (us *Service) AddGroupMember(ctx context.Context, gr *pb.AddGroupMemberRequest) (*pb.AddGroupMemberResponse, error) {
+	data := gr.GetData()
+	log.Println(fmt.Sprintf("[User Service][AddGroupMember][Request] group_id = %v user_id = %v member_group_id = %v", data.GetGroupId(), data.GetUserId(), data.GetMemberGroupId()))
+
+	if data.GetGroupId() == "" {
+		log.Println("[User Service][AddGroupMember][Error] must provide a group_id")
+		return &pb.AddGroupMemberResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a group_id",
+			},
+		}, nil
+	}
+
+	member := new(users.GroupMember).FromProto(data)
+
+	err := us.userSvc.AddGroupMember(ctx, member)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][AddGroupMember][Error] %v", err.Error()))
+		return &pb.AddGroupMemberResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][AddGroupMember][Response] group_id = %v", member.GroupID))
+	return &pb.AddGroupMemberResponse{
+		Data:  member.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// RemoveGroupMember ...
+func (us *Service) RemoveGroupMember(ctx context.Context, gr *pb.RemoveGroupMemberRequest) (*pb.RemoveGroupMemberResponse, error) {
+	data := gr.GetData()
+	log.Println(fmt.Sprintf("[User Service][RemoveGroupMember][Request] group_id = %v user_id = %v member_group_id = %v", data.GetGroupId(), data.GetUserId(), data.GetMemberGroupId()))
+
+	if data.GetGroupId() == "" {
+		log.Println("[User Service][RemoveGroupMember][Error] must provide a group_id")
+		return &pb.RemoveGroupMemberResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a group_id",
+			},
+		}, nil
+	}
+
+	err := us.userSvc.RemoveGroupMember(ctx, new(users.GroupMember).FromProto(data))
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][RemoveGroupMember][Error] %v", err.Error()))
+		return &pb.RemoveGroupMemberResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][RemoveGroupMember][Response] group_id = %v", data.GetGroupId()))
+	return &pb.RemoveGroupMemberResponse{
+		Error: nil,
+	}, nil
+}
+
+// ListGroupMembers returns the direct members of a group
+func (us *Service) ListGroupMembers(ctx context.Context, gr *pb.ListGroupMembersRequest) (*pb.ListGroupMembersResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][ListGroupMembers][Request] group_id = %v", gr.GetGroupId()))
+
+	if gr.GetGroupId() == "" {
+		log.Println("[User Service][ListGroupMembers][Error] must provide a group_id")
+		return &pb.ListGroupMembersResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a group_id",
+			},
+		}, nil
+	}
+
+	members, err := us.userSvc.ListGroupMembers(ctx, gr.GetGroupId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ListGroupMembers][Error] %v", err.Error()))
+		return &pb.ListGroupMembersResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	data := make([]*pb.GroupMember, 0, len(members))
+	for _, member := range members {
+		data = append(data, member.ToProto())
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ListGroupMembers][Response] count = %v", len(data)))
+	return &pb.ListGroupMembersResponse{
+		Data:  data,
+		Error: nil,
+	}, nil
+}
+
+// ListUserGroups returns the groups of a user including the ones inherited through nested groups
+func (us *Service) ListUserGroups(ctx context.Context, gr *pb.ListUserGroupsRequest) (*pb.ListUserGroupsResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][ListUserGroups][Request] user_id = %v", gr.GetUserId()))
+
+	if gr.GetUserId() == "" {
+		log.Println("[User Service][ListUserGroups][Error] must provide a user_id")
+		return &pb.ListUserGroupsResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a user_id",
+			},
+		}, nil
+	}
+
+	groups, err := us.userSvc.ListUserGroups(ctx, gr.GetUserId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ListUserGroups][Error] %v", err.Error()))
+		return &pb.ListUserGroupsResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	data := make([]*pb.Group, 0, len(groups))
+	for _, group := range groups {
+		data = append(data, group.ToProto())
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ListUserGroups][Response] count = %v", len(data)))
+	return &pb.ListUserGroupsResponse{
+		Data:  data,
+		Error: nil,
+	}, nil
+}
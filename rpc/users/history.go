@@ -0,0 +1,79 @@
+package users
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	"golang.org/x/net/context"
+)
+
+// GetUserAsOf returns the version of a user current at a unix time
+func (us *Service) GetUserAsOf(ctx context.Context, gr *pb.GetUserAsOfRequest) (*pb.GetUserAsOfResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][GetUserAsOf][Request] id = %v at = %v", gr.GetId(), gr.GetAt()))
+
+	if gr.GetId() == "" {
+		log.Println("[User Service][GetUserAsOf][Error] must provide a id")
+		return &pb.GetUserAsOfResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a id",
+			},
+		}, nil
+	}
+
+	version, err := us.userSvc.GetUserAsOf(ctx, gr.GetId(), time.Unix(gr.GetAt(), 0))
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][GetUserAsOf][Error] %v", err.Error()))
+		return &pb.GetUserAsOfResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][GetUserAsOf][Response] version = %v", version.Version))
+	return &pb.GetUserAsOfResponse{
+		Data:  version.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// ListUserVersions returns every version of a user, oldest first
+func (us *Service) ListUserVersions(ctx context.Context, gr *pb.ListUserVersionsRequest) (*pb.ListUserVersionsResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][ListUserVersions][Request] id = %v", gr.GetId()))
+
+	if gr.GetId() == "" {
+		log.Println("[User Service][ListUserVersions][Error] must provide a id")
+		return &pb.ListUserVersionsResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a id",
+			},
+		}, nil
+	}
+
+	versions, err := us.userSvc.ListUserVersions(ctx, gr.GetId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ListUserVersions][Error] %v", err.Error()))
+		return &pb.ListUserVersionsResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	data := make([]*pb.UserVersion, 0, len(versions))
+	for _, v := range versions {
+		data = append(data, v.ToProto())
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ListUserVersions][Response] count = %v", len(data)))
+	return &pb.ListUserVersionsResponse{
+		Data:  data,
+		Error: nil,
+	}, nil
+}
@@ -0,0 +1,29 @@
+package users
+
+import (
+	"net/http"
+
+	"github.com/frperezr/microservices-demo/src/users-api/actor"
+	"github.com/frperezr/microservices-demo/src/users-api/token"
+)
+
+// HTTPScope scopes the requests of HTTP handlers that call the users service
+// directly, like TenantInterceptor and ActorInterceptor do with gRPC requests.
+// Every request needs a access token for a organization.
+func HTTPScope(tokens *token.Issuer, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := headerContext(r.Context(), r.Header, tokens, "", nil)
+		if err == errUnauthenticated {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		w.Header().Set(RequestIDHeader, actor.FromContext(ctx).RequestID)
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,86 @@
+package users
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	"github.com/frperezr/microservices-demo/src/users-api/idempotency"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// IdempotencyKeyHeader is the metadata with the idempotency key of a mutating request
+const IdempotencyKeyHeader = "idempotency-key"
+
+// idempotent calls fn once per idempotency key of the request, retries with
+// the same key and request get the first response back. Responses with a
+// error code of 500 or more are not kept, so the request can be retried.
+// Without a key, or when Idempotency is not set, fn is always called.
+func idempotent[Req, Res any](ctx context.Context, us *Service, method string, req *Req, fn func(context.Context, *Req) (*Res, error), fail func(*pb.Error) *Res) (*Res, error) {
+	key := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(IdempotencyKeyHeader); len(values) > 0 {
+			key = values[0]
+		}
+	}
+
+	if key == "" || us.Idempotency == nil {
+		return fn(ctx, req)
+	}
+
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(any(req).(proto.Message))
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(append([]byte(method+"\x00"), body...))
+	requestHash := hex.EncodeToString(hash[:])
+
+	var (
+		res     *Res
+		callErr error
+	)
+
+	stored, replayed, err := us.Idempotency.Do(ctx, idempotency.Scope(ctx, requestHash), key, requestHash, func() ([]byte, bool, error) {
+		if res, callErr = fn(ctx, req); callErr != nil {
+			return nil, false, callErr
+		}
+
+		if e, ok := any(res).(interface{ GetError() *pb.Error }); ok && e.GetError().GetCode() >= 500 {
+			return nil, false, nil
+		}
+
+		// responses are built with ToProto, which leaves the password out
+		b, err := proto.Marshal(any(res).(proto.Message))
+		return b, err == nil, nil
+	})
+
+	if callErr != nil {
+		return nil, callErr
+	}
+
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][%v][Error] idempotency_key = %v %v", method, key, err.Error()))
+		return fail(&pb.Error{
+			Code:    errorCode(err),
+			Message: err.Error(),
+		}), nil
+	}
+
+	if !replayed {
+		return res, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][%v][Replay] idempotency_key = %v", method, key))
+
+	res = new(Res)
+	if err := proto.Unmarshal(stored, any(res).(proto.Message)); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,124 @@
+package users
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	"github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// ImportUsers creates the users sent on the stream, answering with the count
+// of imported, skipped and failed rows and the error of each failed row. The
+// dry_run of the first message checks the rows without importing them.
+func (us *Service) ImportUsers(stream pb.UserService_ImportUsersServer) error {
+	log.Println("[User Service][ImportUsers][Request]")
+
+	// the first message is read ahead to know if it is a dry run
+	head, err := stream.Recv()
+	if err == io.EOF {
+		return stream.SendAndClose(&pb.ImportUsersResponse{Errors: []*pb.ImportRowError{}})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	dryRun := head.GetDryRun()
+
+	var row int64
+	next := func() (int64, *users.User, error) {
+		gr := head
+		if gr == nil {
+			var err error
+			if gr, err = stream.Recv(); err != nil {
+				return 0, nil, err
+			}
+		}
+		head = nil
+
+		// rows are numbered by the client, or in order of arrival
+		row++
+		if gr.GetRow() > 0 {
+			row = gr.GetRow()
+		}
+
+		return row, &users.User{
+			Email:    gr.GetData().GetEmail(),
+			Name:     gr.GetData().GetName(),
+			LastName: gr.GetData().GetLastName(),
+			Password: gr.GetData().GetPassword(),
+		}, nil
+	}
+
+	result, err := us.userSvc.ImportUsers(stream.Context(), dryRun, next)
+
+	res := &pb.ImportUsersResponse{
+		Imported: int32(result.Imported),
+		Skipped:  int32(result.Skipped),
+		Failed:   int32(result.Failed),
+		LastRow:  result.LastRow,
+		Errors:   make([]*pb.ImportRowError, 0, len(result.Errors)),
+	}
+
+	for _, e := range result.Errors {
+		res.Errors = append(res.Errors, &pb.ImportRowError{
+			Row:   e.Row,
+			Email: e.Email,
+			Error: &pb.Error{
+				Code:       errorCode(e.Err),
+				Message:    e.Err.Error(),
+				Violations: fieldViolations(e.Err),
+			},
+		})
+	}
+
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ImportUsers][Error] %v", err.Error()))
+		res.Error = &pb.Error{
+			Code:    errorCode(err),
+			Message: err.Error(),
+		}
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ImportUsers][Response] dry_run = %v imported = %v skipped = %v failed = %v last_row = %v", dryRun, res.Imported, res.Skipped, res.Failed, res.LastRow))
+	return stream.SendAndClose(res)
+}
+
+// ExportUsers streams every user, in order of id, without their passwords. A
+// interrupted export continues after the id of the last user received.
+func (us *Service) ExportUsers(gr *pb.ExportUsersRequest, stream pb.UserService_ExportUsersServer) error {
+	log.Println(fmt.Sprintf("[User Service][ExportUsers][Request] organization_id = %v after_id = %v", gr.GetOrganizationId(), gr.GetAfterId()))
+
+	opts := &users.ExportOptions{
+		AfterID:        gr.GetAfterId(),
+		OrganizationID: gr.GetOrganizationId(),
+	}
+
+	count := 0
+
+	err := us.userSvc.ExportUsers(stream.Context(), opts, func(u *users.User) error {
+		data := u.ToProto()
+		data.Password = ""
+
+		count++
+		return stream.Send(&pb.ExportUsersResponse{
+			Data:  data,
+			Error: nil,
+		})
+	})
+
+	if err != nil && stream.Context().Err() == nil {
+		log.Println(fmt.Sprintf("[User Service][ExportUsers][Error] %v", err.Error()))
+		return stream.Send(&pb.ExportUsersResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		})
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ExportUsers][Response] count = %v", count))
+	return nil
+}
@@ -0,0 +1,42 @@
+package users
+
+import (
+	"fmt"
+	"log"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	"golang.org/x/net/context"
+)
+
+// Unlock clears the lock and failed logins of a user, it is meant for administrators
+func (us *Service) Unlock(ctx context.Context, gr *pb.UnlockUserRequest) (*pb.UnlockUserResponse, error) {
+	id := gr.GetUserId()
+	log.Println(fmt.Sprintf("[User Service][Unlock][Request] id = %v", id))
+
+	if id == "" {
+		log.Println("[User Service][Unlock][Error] must provide a user_id")
+		return &pb.UnlockUserResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a user_id",
+			},
+		}, nil
+	}
+
+	user, err := us.userSvc.Unlock(ctx, id)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][Unlock][Error] %v", err.Error()))
+		return &pb.UnlockUserResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][Unlock][Response] id = %v", id))
+	return &pb.UnlockUserResponse{
+		Data:  user.ToProto(),
+		Error: nil,
+	}, nil
+}
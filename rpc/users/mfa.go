@@ -0,0 +1,184 @@
+package users
+
+import (
+	"fmt"
+	"log"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"golang.org/x/net/context"
+)
+
+// Authenticate checks the email and password of a user, or completes the
+// second step with mfa_token and code when the user has MFA enabled. The
+// access token is scoped to organization_id, see TenantInterceptor.
+func (us *Service) Authenticate(ctx context.Context, gr *pb.AuthenticateRequest) (*pb.AuthenticateResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][Authenticate][Request] email = %v mfa = %v", gr.GetEmail(), gr.GetMfaToken() != ""))
+
+	var (
+		auth *users.Authentication
+		err  error
+	)
+
+	if gr.GetMfaToken() != "" {
+		auth, err = us.userSvc.AuthenticateMFA(ctx, gr.GetMfaToken(), gr.GetCode(), clientIP(ctx))
+	} else {
+		auth, err = us.userSvc.Authenticate(ctx, gr.GetEmail(), gr.GetPassword(), gr.GetOrganizationId(), clientIP(ctx))
+	}
+
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][Authenticate][Error] %v", err.Error()))
+		return &pb.AuthenticateResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	res := &pb.AuthenticateResponse{
+		Data:        auth.User.ToProto(),
+		AccessToken: auth.AccessToken,
+		ExpiresAt:   auth.ExpiresAt.Unix(),
+		MfaRequired: auth.MFARequired,
+		MfaToken:    auth.MFAToken,
+		Error:       nil,
+	}
+
+	log.Println(fmt.Sprintf("[User Service][Authenticate][Response] id = %v mfa_required = %v", auth.User.ID, auth.MFARequired))
+	return res, nil
+}
+
+// EnrollMFA ...
+func (us *Service) EnrollMFA(ctx context.Context, gr *pb.EnrollMFARequest) (*pb.EnrollMFAResponse, error) {
+	id := gr.GetUserId()
+	log.Println(fmt.Sprintf("[User Service][EnrollMFA][Request] id = %v", id))
+
+	if id == "" {
+		log.Println("[User Service][EnrollMFA][Error] must provide a user_id")
+		return &pb.EnrollMFAResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a user_id",
+			},
+		}, nil
+	}
+
+	enrollment, err := us.userSvc.EnrollMFA(ctx, id)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][EnrollMFA][Error] %v", err.Error()))
+		return &pb.EnrollMFAResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][EnrollMFA][Response] id = %v", id))
+	return &pb.EnrollMFAResponse{
+		Secret:     enrollment.Secret,
+		OtpauthUri: enrollment.OtpauthURI,
+		Error:      nil,
+	}, nil
+}
+
+// ConfirmMFA ...
+func (us *Service) ConfirmMFA(ctx context.Context, gr *pb.ConfirmMFARequest) (*pb.ConfirmMFAResponse, error) {
+	id := gr.GetUserId()
+	log.Println(fmt.Sprintf("[User Service][ConfirmMFA][Request] id = %v", id))
+
+	if id == "" || gr.GetCode() == "" {
+		log.Println("[User Service][ConfirmMFA][Error] must provide a user_id and code")
+		return &pb.ConfirmMFAResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a user_id and code",
+			},
+		}, nil
+	}
+
+	user, codes, err := us.userSvc.ConfirmMFA(ctx, id, gr.GetCode())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ConfirmMFA][Error] %v", err.Error()))
+		return &pb.ConfirmMFAResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ConfirmMFA][Response] id = %v", id))
+	return &pb.ConfirmMFAResponse{
+		Data:          user.ToProto(),
+		RecoveryCodes: codes,
+		Error:         nil,
+	}, nil
+}
+
+// DisableMFA ...
+func (us *Service) DisableMFA(ctx context.Context, gr *pb.DisableMFARequest) (*pb.DisableMFAResponse, error) {
+	id := gr.GetUserId()
+	log.Println(fmt.Sprintf("[User Service][DisableMFA][Request] id = %v", id))
+
+	if id == "" || gr.GetCode() == "" {
+		log.Println("[User Service][DisableMFA][Error] must provide a user_id and code")
+		return &pb.DisableMFAResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a user_id and code",
+			},
+		}, nil
+	}
+
+	user, err := us.userSvc.DisableMFA(ctx, id, gr.GetCode())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][DisableMFA][Error] %v", err.Error()))
+		return &pb.DisableMFAResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][DisableMFA][Response] id = %v", id))
+	return &pb.DisableMFAResponse{
+		Data:  user.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// ResetMFA ...
+func (us *Service) ResetMFA(ctx context.Context, gr *pb.ResetMFARequest) (*pb.ResetMFAResponse, error) {
+	id := gr.GetUserId()
+	log.Println(fmt.Sprintf("[User Service][ResetMFA][Request] id = %v", id))
+
+	if id == "" {
+		log.Println("[User Service][ResetMFA][Error] must provide a user_id")
+		return &pb.ResetMFAResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a user_id",
+			},
+		}, nil
+	}
+
+	user, err := us.userSvc.ResetMFA(ctx, id)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ResetMFA][Error] %v", err.Error()))
+		return &pb.ResetMFAResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ResetMFA][Response] id = %v", id))
+	return &pb.ResetMFAResponse{
+		Data:  user.ToProto(),
+		Error: nil,
+	}, nil
+}
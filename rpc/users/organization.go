@@ -0,0 +1,244 @@
+package users
+
+import (
+	"fmt"
+	"log"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"golang.org/x/net/context"
+)
+
+// CreateOrganization ...
+func (us *Service) CreateOrganization(ctx context.Context, gr *pb.CreateOrganizationRequest) (*pb.CreateOrganizationResponse, error) {
+	data := gr.GetData()
+	log.Println(fmt.Sprintf("[User Service][CreateOrganization][Request] slug = %v owner_id = %v", data.GetSlug(), gr.GetOwnerId()))
+
+	if data.GetName() == "" || data.GetSlug() == "" || gr.GetOwnerId() == "" {
+		log.Println("[User Service][CreateOrganization][Error] must provide a name, slug and owner_id")
+		return &pb.CreateOrganizationResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a name, slug and owner_id",
+			},
+		}, nil
+	}
+
+	org := &users.Organization{
+		Name: data.GetName(),
+		Slug: data.GetSlug(),
+	}
+
+	err := us.userSvc.CreateOrganization(ctx, org, gr.GetOwnerId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][CreateOrganization][Error] %v", err.Error()))
+		return &pb.CreateOrganizationResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][CreateOrganization][Response] id = %v", org.ID))
+	return &pb.CreateOrganizationResponse{
+		Data:  org.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// GetOrganization ...
+func (us *Service) GetOrganization(ctx context.Context, gr *pb.GetOrganizationRequest) (*pb.GetOrganizationResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][GetOrganization][Request] id = %v", gr.GetId()))
+
+	if gr.GetId() == "" {
+		log.Println("[User Service][GetOrganization][Error] must provide a id")
+		return &pb.GetOrganizationResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a id",
+			},
+		}, nil
+	}
+
+	org, err := us.userSvc.GetOrganization(ctx, gr.GetId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][GetOrganization][Error] %v", err.Error()))
+		return &pb.GetOrganizationResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][GetOrganization][Response] id = %v", org.ID))
+	return &pb.GetOrganizationResponse{
+		Data:  org.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// ListOrganizations returns the organizations a user is member of
+func (us *Service) ListOrganizations(ctx context.Context, gr *pb.ListOrganizationsRequest) (*pb.ListOrganizationsResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][ListOrganizations][Request] user_id = %v", gr.GetUserId()))
+
+	if gr.GetUserId() == "" {
+		log.Println("[User Service][ListOrganizations][Error] must provide a user_id")
+		return &pb.ListOrganizationsResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a user_id",
+			},
+		}, nil
+	}
+
+	orgs, err := us.userSvc.ListOrganizations(ctx, gr.GetUserId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ListOrganizations][Error] %v", err.Error()))
+		return &pb.ListOrganizationsResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	data := make([]*pb.Organization, 0, len(orgs))
+	for _, org := range orgs {
+		data = append(data, org.ToProto())
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ListOrganizations][Response] count = %v", len(data)))
+	return &pb.ListOrganizationsResponse{
+		Data:  data,
+		Error: nil,
+	}, nil
+}
+
+// SetMemberRole ...
+func (us *Service) SetMemberRole(ctx context.Context, gr *pb.SetMemberRoleRequest) (*pb.SetMemberRoleResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][SetMemberRole][Request] organization_id = %v user_id = %v role = %v", gr.GetOrganizationId(), gr.GetUserId(), gr.GetRole()))
+
+	if gr.GetOrganizationId() == "" || gr.GetUserId() == "" || gr.GetRole() == "" {
+		log.Println("[User Service][SetMemberRole][Error] must provide a organization_id, user_id and role")
+		return &pb.SetMemberRoleResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a organization_id, user_id and role",
+			},
+		}, nil
+	}
+
+	membership, err := us.userSvc.SetMemberRole(ctx, gr.GetOrganizationId(), gr.GetUserId(), gr.GetRole())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][SetMemberRole][Error] %v", err.Error()))
+		return &pb.SetMemberRoleResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][SetMemberRole][Response] role = %v", membership.Role))
+	return &pb.SetMemberRoleResponse{
+		Data:  membership.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// RemoveMember ...
+func (us *Service) RemoveMember(ctx context.Context, gr *pb.RemoveMemberRequest) (*pb.RemoveMemberResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][RemoveMember][Request] organization_id = %v user_id = %v", gr.GetOrganizationId(), gr.GetUserId()))
+
+	if gr.GetOrganizationId() == "" || gr.GetUserId() == "" {
+		log.Println("[User Service][RemoveMember][Error] must provide a organization_id and user_id")
+		return &pb.RemoveMemberResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a organization_id and user_id",
+			},
+		}, nil
+	}
+
+	err := us.userSvc.RemoveMember(ctx, gr.GetOrganizationId(), gr.GetUserId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][RemoveMember][Error] %v", err.Error()))
+		return &pb.RemoveMemberResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][RemoveMember][Response] user_id = %v", gr.GetUserId()))
+	return &pb.RemoveMemberResponse{
+		Error: nil,
+	}, nil
+}
+
+// InviteMember sends a invitation to join a organization to a email
+func (us *Service) InviteMember(ctx context.Context, gr *pb.InviteMemberRequest) (*pb.InviteMemberResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][InviteMember][Request] organization_id = %v email = %v role = %v", gr.GetOrganizationId(), gr.GetEmail(), gr.GetRole()))
+
+	if gr.GetOrganizationId() == "" || gr.GetEmail() == "" {
+		log.Println("[User Service][InviteMember][Error] must provide a organization_id and email")
+		return &pb.InviteMemberResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a organization_id and email",
+			},
+		}, nil
+	}
+
+	inv, err := us.userSvc.InviteMember(ctx, gr.GetOrganizationId(), gr.GetEmail(), gr.GetRole())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][InviteMember][Error] %v", err.Error()))
+		return &pb.InviteMemberResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][InviteMember][Response] id = %v", inv.ID))
+	return &pb.InviteMemberResponse{
+		Data:  inv.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// AcceptInvitation ...
+func (us *Service) AcceptInvitation(ctx context.Context, gr *pb.AcceptInvitationRequest) (*pb.AcceptInvitationResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][AcceptInvitation][Request] user_id = %v", gr.GetUserId()))
+
+	if gr.GetToken() == "" || gr.GetUserId() == "" {
+		log.Println("[User Service][AcceptInvitation][Error] must provide a token and user_id")
+		return &pb.AcceptInvitationResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a token and user_id",
+			},
+		}, nil
+	}
+
+	membership, err := us.userSvc.AcceptInvitation(ctx, gr.GetToken(), gr.GetUserId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][AcceptInvitation][Error] %v", err.Error()))
+		return &pb.AcceptInvitationResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][AcceptInvitation][Response] organization_id = %v", membership.OrganizationID))
+	return &pb.AcceptInvitationResponse{
+		Data:  membership.ToProto(),
+		Error: nil,
+	}, nil
+}
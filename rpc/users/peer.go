@@ -0,0 +1,23 @@
+package users
+
+import (
+	"net"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/peer"
+)
+
+// clientIP returns the address of the caller without the port
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
@@ -0,0 +1,171 @@
+package users
+
+import (
+	"fmt"
+	"log"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	"golang.org/x/net/context"
+)
+
+// ListRoles ...
+func (us *Service) ListRoles(ctx context.Context, gr *pb.ListRolesRequest) (*pb.ListRolesResponse, error) {
+	log.Println("[User Service][ListRoles][Request]")
+
+	roles, err := us.userSvc.ListRoles(ctx)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ListRoles][Error] %v", err.Error()))
+		return &pb.ListRolesResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	data := make([]*pb.Role, 0, len(roles))
+	for _, role := range roles {
+		data = append(data, role.ToProto())
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ListRoles][Response] count = %v", len(data)))
+	return &pb.ListRolesResponse{
+		Data:  data,
+		Error: nil,
+	}, nil
+}
+
+// ListUserRoles ...
+func (us *Service) ListUserRoles(ctx context.Context, gr *pb.ListUserRolesRequest) (*pb.ListUserRolesResponse, error) {
+	id := gr.GetUserId()
+	log.Println(fmt.Sprintf("[User Service][ListUserRoles][Request] id = %v", id))
+
+	if id == "" {
+		log.Println("[User Service][ListUserRoles][Error] must provide a user_id")
+		return &pb.ListUserRolesResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a user_id",
+			},
+		}, nil
+	}
+
+	user, err := us.userSvc.GetByID(ctx, id)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ListUserRoles][Error] %v", err.Error()))
+		return &pb.ListUserRolesResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ListUserRoles][Response] roles = %v", user.Roles))
+	return &pb.ListUserRolesResponse{
+		Roles: user.Roles,
+		Error: nil,
+	}, nil
+}
+
+// AssignRole ...
+func (us *Service) AssignRole(ctx context.Context, gr *pb.AssignRoleRequest) (*pb.AssignRoleResponse, error) {
+	id := gr.GetUserId()
+	role := gr.GetRole()
+	log.Println(fmt.Sprintf("[User Service][AssignRole][Request] id = %v role = %v", id, role))
+
+	if id == "" || role == "" {
+		log.Println("[User Service][AssignRole][Error] must provide a user_id and role")
+		return &pb.AssignRoleResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a user_id and role",
+			},
+		}, nil
+	}
+
+	user, err := us.userSvc.AssignRole(ctx, id, role)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][AssignRole][Error] %v", err.Error()))
+		return &pb.AssignRoleResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][AssignRole][Response] roles = %v", user.Roles))
+	return &pb.AssignRoleResponse{
+		Data:  user.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// RevokeRole ...
+func (us *Service) RevokeRole(ctx context.Context, gr *pb.RevokeRoleRequest) (*pb.RevokeRoleResponse, error) {
+	id := gr.GetUserId()
+	role := gr.GetRole()
+	log.Println(fmt.Sprintf("[User Service][RevokeRole][Request] id = %v role = %v", id, role))
+
+	if id == "" || role == "" {
+		log.Println("[User Service][RevokeRole][Error] must provide a user_id and role")
+		return &pb.RevokeRoleResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a user_id and role",
+			},
+		}, nil
+	}
+
+	user, err := us.userSvc.RevokeRole(ctx, id, role)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][RevokeRole][Error] %v", err.Error()))
+		return &pb.RevokeRoleResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][RevokeRole][Response] roles = %v", user.Roles))
+	return &pb.RevokeRoleResponse{
+		Data:  user.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// CheckPermission lets other services ask whether a user is allowed to do something
+func (us *Service) CheckPermission(ctx context.Context, gr *pb.CheckPermissionRequest) (*pb.CheckPermissionResponse, error) {
+	id := gr.GetUserId()
+	permission := gr.GetPermission()
+	log.Println(fmt.Sprintf("[User Service][CheckPermission][Request] id = %v permission = %v", id, permission))
+
+	if id == "" || permission == "" {
+		log.Println("[User Service][CheckPermission][Error] must provide a user_id and permission")
+		return &pb.CheckPermissionResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a user_id and permission",
+			},
+		}, nil
+	}
+
+	allowed, err := us.userSvc.CheckPermission(ctx, id, permission)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][CheckPermission][Error] %v", err.Error()))
+		return &pb.CheckPermissionResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][CheckPermission][Response] allowed = %v", allowed))
+	return &pb.CheckPermissionResponse{
+		Allowed: allowed,
+		Error:   nil,
+	}, nil
+}
@@ -0,0 +1,148 @@
+package users
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/frperezr/microservices-demo/src/users-api/token"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// errUnauthenticated is returned when a request needs a access token and has no valid one
+	errUnauthenticated = errors.New("missing or invalid access token")
+
+	// errNotSelf is returned when a request on the own user names another user
+	errNotSelf = errors.New("the request is not for the user of the access token")
+)
+
+// publicMethods are called before having a access token, they run in the
+// system scope unless a token for a organization is sent
+var publicMethods = map[string]bool{
+	"Authenticate":       true,
+	"Create":             true,
+	"VerifyEmail":        true,
+	"ResendVerification": true,
+	"ConfirmEmailChange": true,
+	"RevertEmailChange":  true,
+}
+
+// selfMethods act on the user of the access token, which may not belong to
+// any organization yet, they run in the system scope
+var selfMethods = map[string]bool{
+	"EnrollMFA":          true,
+	"ConfirmMFA":         true,
+	"DisableMFA":         true,
+	"ListOrganizations":  true,
+	"AcceptInvitation":   true,
+	"CreateOrganization": true,
+}
+
+// TenantInterceptor scopes every request to the organization of the access
+// token sent as "authorization: Bearer <token>", requests without a token for
+// a organization are rejected. The exceptions are the publicMethods and the
+// selfMethods, whose user_id or owner_id must be the user of the token. The
+// system scope is left to callers in the same process.
+func TenantInterceptor(tokens *token.Issuer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := tenantContext(ctx, tokens, methodName(info.FullMethod), req)
+		if err != nil {
+			return nil, tenantStatus(err)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// TenantStreamInterceptor is the TenantInterceptor of the streaming RPCs,
+// every one of them needs a token for a organization
+func TenantStreamInterceptor(tokens *token.Issuer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := tenantContext(ss.Context(), tokens, methodName(info.FullMethod), nil)
+		if err != nil {
+			return tenantStatus(err)
+		}
+
+		return handler(srv, &contextStream{
+			ServerStream: ss,
+			ctx:          ctx,
+		})
+	}
+}
+
+// userRequest is implemented by the requests of the selfMethods on a user
+type userRequest interface {
+	GetUserId() string
+}
+
+// ownerRequest is implemented by CreateOrganizationRequest
+type ownerRequest interface {
+	GetOwnerId() string
+}
+
+// tenantContext scopes the context of a request to method, see TenantInterceptor
+func tenantContext(ctx context.Context, tokens *token.Issuer, method string, req interface{}) (context.Context, error) {
+	claims, ok := accessClaims(ctx, tokens)
+
+	switch {
+	case publicMethods[method]:
+		if ok && claims.Organization != "" {
+			return tenant.WithID(ctx, claims.Organization), nil
+		}
+		return tenant.WithSystem(ctx), nil
+
+	case selfMethods[method]:
+		if !ok {
+			return nil, errUnauthenticated
+		}
+
+		if r, isUser := req.(userRequest); isUser && r.GetUserId() != claims.Subject {
+			return nil, errNotSelf
+		}
+
+		if r, isOwner := req.(ownerRequest); isOwner && r.GetOwnerId() != claims.Subject {
+			return nil, errNotSelf
+		}
+
+		return tenant.WithSystem(ctx), nil
+	}
+
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	if claims.Organization == "" {
+		return nil, tenant.ErrMissing
+	}
+
+	return tenant.WithID(ctx, claims.Organization), nil
+}
+
+// tenantStatus converts a error of tenantContext to a gRPC status
+func tenantStatus(err error) error {
+	if err == errUnauthenticated {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return status.Error(codes.PermissionDenied, err.Error())
+}
+
+// methodName returns the method of a full method name like /pb.UserService/GetByID
+func methodName(fullMethod string) string {
+	return fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+}
+
+// contextStream replaces the context of a stream
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context ...
+func (ts *contextStream) Context() context.Context {
+	return ts.ctx
+}
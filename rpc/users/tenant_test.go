@@ -0,0 +1,182 @@
+package users
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCrossTenantRequestsFail(t *testing.T) {
+	userSvc := newTestService(t)
+	client := newTestClient(t, userSvc)
+
+	acme := newTestTenant(t, userSvc, "owner@acme.com", "acme")
+	globex := newTestTenant(t, userSvc, "owner@globex.com", "globex")
+
+	ctx := withToken(acme.token)
+
+	own, err := client.GetByID(ctx, &pb.GetUserByIDRequest{Id: acme.owner.ID})
+	if err != nil || own.GetError() != nil {
+		t.Fatalf("get own user = %v, %v", own.GetError(), err)
+	}
+
+	get, err := client.GetByID(ctx, &pb.GetUserByIDRequest{Id: globex.owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if get.GetError().GetCode() != 404 {
+		t.Errorf("get user of another tenant = %v, want code 404", get)
+	}
+
+	list, err := client.List(ctx, &pb.ListUsersRequest{Limit: 10})
+	if err != nil || list.GetError() != nil {
+		t.Fatalf("list = %v, %v", list.GetError(), err)
+	}
+	for _, u := range list.GetData() {
+		if u.GetId() != acme.owner.ID {
+			t.Errorf("list returned %v of another tenant", u.GetEmail())
+		}
+	}
+
+	update, err := client.Update(ctx, &pb.UpdateUserRequest{Data: &pb.User{Id: globex.owner.ID, Name: "Mallory"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.GetError() == nil {
+		t.Errorf("update user of another tenant = %v, want a error", update)
+	}
+
+	del, err := client.Delete(ctx, &pb.DeleteUserRequest{UserId: globex.owner.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if del.GetError() == nil {
+		t.Errorf("delete user of another tenant = %v, want a error", del)
+	}
+
+	stored, err := userSvc.GetByID(tenant.WithSystem(context.Background()), globex.owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Name != "Owner" || stored.DeletedAt != nil {
+		t.Errorf("user of another tenant was changed: name = %v, deleted at = %v", stored.Name, stored.DeletedAt)
+	}
+
+	// a token is only issued for organizations of the user
+	auth, err := client.Authenticate(context.Background(), &pb.AuthenticateRequest{
+		Email:          acme.owner.Email,
+		Password:       "correct horse battery staple",
+		OrganizationId: globex.org.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.GetError().GetCode() != 403 || auth.GetAccessToken() != "" {
+		t.Errorf("authenticate for another organization = %v, want code 403", auth)
+	}
+}
+
+func TestRequestsWithoutATenantAreRejected(t *testing.T) {
+	userSvc := newTestService(t)
+	client := newTestClient(t, userSvc)
+
+	acme := newTestTenant(t, userSvc, "owner@acme.com", "acme")
+
+	auth, err := client.Authenticate(context.Background(), &pb.AuthenticateRequest{
+		Email:    acme.owner.Email,
+		Password: "correct horse battery staple",
+	})
+	if err != nil || auth.GetError() != nil {
+		t.Fatalf("authenticate without a organization = %v, %v", auth.GetError(), err)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		code codes.Code
+	}{
+		{"no token", context.Background(), codes.Unauthenticated},
+		{"invalid token", withToken("not a token"), codes.Unauthenticated},
+		{"token without a organization", withToken(auth.GetAccessToken()), codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		_, err := client.GetByID(tt.ctx, &pb.GetUserByIDRequest{Id: acme.owner.ID})
+		if status.Code(err) != tt.code {
+			t.Errorf("get with %v = %v, want %v", tt.name, err, tt.code)
+		}
+
+		stream, err := client.ExportUsers(tt.ctx, &pb.ExportUsersRequest{})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != tt.code {
+			t.Errorf("export with %v = %v, want %v", tt.name, err, tt.code)
+		}
+	}
+
+	// the methods on the own user accept a token without a organization
+	enroll, err := client.EnrollMFA(withToken(auth.GetAccessToken()), &pb.EnrollMFARequest{UserId: acme.owner.ID})
+	if err != nil || enroll.GetError() != nil {
+		t.Fatalf("enroll own user = %v, %v", enroll.GetError(), err)
+	}
+
+	// but only for that user
+	other := newTestTenant(t, userSvc, "owner@globex.com", "globex")
+
+	_, err = client.EnrollMFA(withToken(auth.GetAccessToken()), &pb.EnrollMFARequest{UserId: other.owner.ID})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("enroll another user = %v, want %v", err, codes.PermissionDenied)
+	}
+
+	// users can still sign up without a token
+	create, err := client.Create(context.Background(), &pb.CreateUserRequest{Data: &pb.User{
+		Email: "new@example.com", Name: "New", LastName: "User", Password: "correct horse battery staple",
+	}})
+	if err != nil || create.GetError() != nil {
+		t.Fatalf("create without a token = %v, %v", create.GetError(), err)
+	}
+}
+
+func TestMembersCannotChangeOtherMembers(t *testing.T) {
+	userSvc := newTestService(t)
+	client := newTestClient(t, userSvc)
+	acme := newTestTenant(t, userSvc, "owner@acme.test", "acme")
+
+	member := &user.User{Email: "member@acme.test", Name: "Mallory", LastName: "Acme", Password: "correct horse battery staple"}
+	if err := userSvc.Create(tenant.WithID(context.Background(), acme.org.ID), member); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := client.Authenticate(context.Background(), &pb.AuthenticateRequest{Email: member.Email, Password: "correct horse battery staple", OrganizationId: acme.org.ID})
+	if err != nil || auth.GetError() != nil {
+		t.Fatalf("Authenticate = %v, %v", auth.GetError(), err)
+	}
+
+	ctx := withToken(auth.GetAccessToken())
+
+	update, err := client.Update(ctx, &pb.UpdateUserRequest{Data: &pb.User{Id: acme.owner.ID, Password: "attacker chosen passphrase"}})
+	if err != nil || update.GetError().GetCode() != 403 {
+		t.Fatalf("Update of the owner = %v, %v, want code 403", update.GetError(), err)
+	}
+
+	del, err := client.Delete(ctx, &pb.DeleteUserRequest{UserId: acme.owner.ID})
+	if err != nil || del.GetError().GetCode() != 403 {
+		t.Fatalf("Delete of the owner = %v, %v, want code 403", del.GetError(), err)
+	}
+
+	owner, err := client.Authenticate(context.Background(), &pb.AuthenticateRequest{Email: acme.owner.Email, Password: "correct horse battery staple", OrganizationId: acme.org.ID})
+	if err != nil || owner.GetError() != nil {
+		t.Fatalf("Authenticate of the owner = %v, %v, want the password unchanged", owner.GetError(), err)
+	}
+
+	self, err := client.Update(ctx, &pb.UpdateUserRequest{Data: &pb.User{Id: member.ID, Name: "Eve"}})
+	if err != nil || self.GetError() != nil {
+		t.Fatalf("Update of the member by themselves = %v, %v", self.GetError(), err)
+	}
+}
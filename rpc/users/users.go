@@ -3,11 +3,11 @@ package users
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	pb "github.com/frperezr/microservices-demo/pb"
 	"github.com/frperezr/microservices-demo/src/users-api"
-	"github.com/frperezr/microservices-demo/src/users-api/database"
-	"github.com/frperezr/microservices-demo/src/users-api/service"
+	"github.com/frperezr/microservices-demo/src/users-api/idempotency"
 	"golang.org/x/net/context"
 )
 
@@ -16,12 +16,16 @@ var _ pb.UserServiceServer = (*Service)(nil)
 // Service ...
 type Service struct {
 	userSvc users.Service
+
+	// Idempotency makes the retries of Create, Update and Delete with the
+	// same idempotency-key metadata return the first response
+	Idempotency *idempotency.Keys
 }
 
 // New ...
-func New(store database.Store) *Service {
+func New(userSvc users.Service) *Service {
 	return &Service{
-		userSvc: service.New(store),
+		userSvc: userSvc,
 	}
 }
 
@@ -41,7 +45,7 @@ func (us *Service) GetByID(ctx context.Context, gr *pb.GetUserByIDRequest) (*pb.
 		}, nil
 	}
 
-	user, err := us.userSvc.GetByID(id)
+	user, err := us.userSvc.GetByID(ctx, id)
 	if err != nil {
 		log.Println(fmt.Sprintf("[User Service][GetById][Error] %v", err.Error()))
 		if err.Error() == "sql: no rows in result set" {
@@ -63,6 +67,17 @@ func (us *Service) GetByID(ctx context.Context, gr *pb.GetUserByIDRequest) (*pb.
 		}, nil
 	}
 
+	if gr.GetRequireVerified() && !user.IsEmailVerified() {
+		log.Println(fmt.Sprintf("[User Service][GetById][Error] %v", users.ErrEmailNotVerified))
+		return &pb.GetUserByIDResponse{
+			Data: nil,
+			Error: &pb.Error{
+				Code:    403,
+				Message: users.ErrEmailNotVerified.Error(),
+			},
+		}, nil
+	}
+
 	res := &pb.GetUserByIDResponse{
 		Data:  user.ToProto(),
 		Error: nil,
@@ -88,7 +103,17 @@ func (us *Service) GetByEmail(ctx context.Context, gr *pb.GetUserByEmailRequest)
 		}, nil
 	}
 
-	user, err := us.userSvc.GetByEmail(email)
+	var (
+		user *users.User
+		err  error
+	)
+
+	if orgID := gr.GetOrganizationId(); orgID != "" {
+		user, err = us.userSvc.GetMemberByEmail(ctx, orgID, email)
+	} else {
+		user, err = us.userSvc.GetByEmail(ctx, email)
+	}
+
 	if err != nil {
 		log.Println(fmt.Sprintf("[User Service][GetByEmail][Error] %v", err.Error()))
 		if err.Error() == "sql: no rows in result set" {
@@ -110,6 +135,17 @@ func (us *Service) GetByEmail(ctx context.Context, gr *pb.GetUserByEmailRequest)
 		}, nil
 	}
 
+	if gr.GetRequireVerified() && !user.IsEmailVerified() {
+		log.Println(fmt.Sprintf("[User Service][GetByEmail][Error] %v", users.ErrEmailNotVerified))
+		return &pb.GetUserByEmailResponse{
+			Data: nil,
+			Error: &pb.Error{
+				Code:    403,
+				Message: users.ErrEmailNotVerified.Error(),
+			},
+		}, nil
+	}
+
 	res := &pb.GetUserByEmailResponse{
 		Data:  user.ToProto(),
 		Error: nil,
@@ -121,6 +157,12 @@ func (us *Service) GetByEmail(ctx context.Context, gr *pb.GetUserByEmailRequest)
 
 // Create ...
 func (us *Service) Create(ctx context.Context, gr *pb.CreateUserRequest) (*pb.CreateUserResponse, error) {
+	return idempotent(ctx, us, "Create", gr, us.create, func(e *pb.Error) *pb.CreateUserResponse {
+		return &pb.CreateUserResponse{Error: e}
+	})
+}
+
+func (us *Service) create(ctx context.Context, gr *pb.CreateUserRequest) (*pb.CreateUserResponse, error) {
 	email := gr.GetData().GetEmail()
 	log.Println(fmt.Sprintf("[User Service][Create][Request] email = %v", email))
 
@@ -135,7 +177,7 @@ func (us *Service) Create(ctx context.Context, gr *pb.CreateUserRequest) (*pb.Cr
 		}, nil
 	}
 
-	_, err := us.userSvc.GetByEmail(email)
+	_, err := us.userSvc.GetByEmail(ctx, email)
 	if err != nil {
 
 		name := gr.GetData().GetName()
@@ -181,13 +223,14 @@ func (us *Service) Create(ctx context.Context, gr *pb.CreateUserRequest) (*pb.Cr
 			Password: password,
 		}
 
-		if err := us.userSvc.Create(user); err != nil {
+		if err := us.userSvc.Create(ctx, user); err != nil {
 			log.Println(fmt.Sprintf("[User Service][Create][Error] %v", err.Error()))
 			return &pb.CreateUserResponse{
 				Data: nil,
 				Error: &pb.Error{
-					Code:    500,
-					Message: err.Error(),
+					Code:       errorCode(err),
+					Message:    err.Error(),
+					Violations: fieldViolations(err),
 				},
 			}, nil
 		}
@@ -214,6 +257,12 @@ func (us *Service) Create(ctx context.Context, gr *pb.CreateUserRequest) (*pb.Cr
 
 // Update ...
 func (us *Service) Update(ctx context.Context, gr *pb.UpdateUserRequest) (*pb.UpdateUserResponse, error) {
+	return idempotent(ctx, us, "Update", gr, us.update, func(e *pb.Error) *pb.UpdateUserResponse {
+		return &pb.UpdateUserResponse{Error: e}
+	})
+}
+
+func (us *Service) update(ctx context.Context, gr *pb.UpdateUserRequest) (*pb.UpdateUserResponse, error) {
 	id := gr.GetData().GetId()
 	log.Println(fmt.Sprintf("[User Service][Update][Request] id = %v", id))
 
@@ -228,7 +277,7 @@ func (us *Service) Update(ctx context.Context, gr *pb.UpdateUserRequest) (*pb.Up
 		}, nil
 	}
 
-	user, err := us.userSvc.GetByID(id)
+	user, err := us.userSvc.GetByID(ctx, id)
 	if err != nil {
 		log.Println(fmt.Sprintf("[User Service][Update][Error] err = %v", err.Error()))
 
@@ -251,40 +300,52 @@ func (us *Service) Update(ctx context.Context, gr *pb.UpdateUserRequest) (*pb.Up
 		}, nil
 	}
 
-	email := gr.GetData().GetEmail()
-	if email != "" {
-		user.Email = email
-	}
+	var pendingEmail string
 
-	name := gr.GetData().GetName()
-	if name != "" {
-		user.Name = name
-	}
+	email := gr.GetData().GetEmail()
+	if email != "" && strings.ToLower(email) != user.Email {
+		change, err := us.userSvc.RequestEmailChange(ctx, user, email)
+		if err != nil {
+			log.Println(fmt.Sprintf("[User Service][Update][Error] err = %v", err.Error()))
+			return &pb.UpdateUserResponse{
+				Data: nil,
+				Error: &pb.Error{
+					Code:    errorCode(err),
+					Message: err.Error(),
+				},
+			}, nil
+		}
 
-	lastName := gr.GetData().GetLastName()
-	if lastName != "" {
-		user.LastName = lastName
+		pendingEmail = change.NewEmail
 	}
 
-	password := gr.GetData().GetPassword()
-	if password != "" {
-		user.Password = password
+	// only the fields of the request are changed, the stored password is a
+	// hash that must not be hashed again
+	changes := &users.User{
+		ID:       user.ID,
+		Name:     gr.GetData().GetName(),
+		LastName: gr.GetData().GetLastName(),
+		Password: gr.GetData().GetPassword(),
 	}
 
-	if err := us.userSvc.Update(user); err != nil {
+	if err := us.userSvc.Update(ctx, changes); err != nil {
 		log.Println(fmt.Sprintf("[User Service][Update][Error] err = %v", err.Error()))
 		return &pb.UpdateUserResponse{
 			Data: nil,
 			Error: &pb.Error{
-				Code:    500,
-				Message: err.Error(),
+				Code:       errorCode(err),
+				Message:    err.Error(),
+				Violations: fieldViolations(err),
 			},
 		}, nil
 	}
 
+	changes.Roles = user.Roles
+
 	res := &pb.UpdateUserResponse{
-		Data:  user.ToProto(),
-		Error: nil,
+		Data:         changes.ToProto(),
+		PendingEmail: pendingEmail,
+		Error:        nil,
 	}
 
 	log.Println(fmt.Sprintf("[User Service][Update][Response] %v", res))
@@ -293,10 +354,16 @@ func (us *Service) Update(ctx context.Context, gr *pb.UpdateUserRequest) (*pb.Up
 
 // Delete ...
 func (us *Service) Delete(ctx context.Context, gr *pb.DeleteUserRequest) (*pb.DeleteUserResponse, error) {
+	return idempotent(ctx, us, "Delete", gr, us.delete, func(e *pb.Error) *pb.DeleteUserResponse {
+		return &pb.DeleteUserResponse{Error: e}
+	})
+}
+
+func (us *Service) delete(ctx context.Context, gr *pb.DeleteUserRequest) (*pb.DeleteUserResponse, error) {
 	id := gr.GetUserId()
 	log.Println(fmt.Sprintf("[User Service][Delete][Request] id = %v", id))
 
-	user, err := us.userSvc.GetByID(id)
+	user, err := us.userSvc.GetByID(ctx, id)
 	if err != nil {
 		log.Println(fmt.Sprintf("[User Service][Delete][Error] err = %v", err.Error()))
 		return &pb.DeleteUserResponse{
@@ -308,12 +375,12 @@ func (us *Service) Delete(ctx context.Context, gr *pb.DeleteUserRequest) (*pb.De
 		}, nil
 	}
 
-	if err := us.userSvc.Delete(user.ID); err != nil {
+	if err := us.userSvc.Delete(ctx, user.ID); err != nil {
 		log.Println(fmt.Sprintf("[User Service][Delete][Error] err = %v", err.Error()))
 		return &pb.DeleteUserResponse{
 			Data: nil,
 			Error: &pb.Error{
-				Code:    500,
+				Code:    errorCode(err),
 				Message: err.Error(),
 			},
 		}, nil
@@ -327,3 +394,250 @@ func (us *Service) Delete(ctx context.Context, gr *pb.DeleteUserRequest) (*pb.De
 	log.Println(fmt.Sprintf("[User Service][Delete][Response] %v", res))
 	return res, nil
 }
+
+// Restore undoes the deletion of a user
+func (us *Service) Restore(ctx context.Context, gr *pb.RestoreUserRequest) (*pb.RestoreUserResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][Restore][Request] id = %v", gr.GetUserId()))
+
+	if gr.GetUserId() == "" {
+		log.Println("[User Service][Restore][Error] must provide a user_id")
+		return &pb.RestoreUserResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a user_id",
+			},
+		}, nil
+	}
+
+	user, err := us.userSvc.Restore(ctx, gr.GetUserId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][Restore][Error] %v", err.Error()))
+		return &pb.RestoreUserResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][Restore][Response] id = %v", user.ID))
+	return &pb.RestoreUserResponse{
+		Data:  user.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// List ...
+func (us *Service) List(ctx context.Context, gr *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][List][Request] limit = %v offset = %v verified = %v", gr.GetLimit(), gr.GetOffset(), gr.GetVerified()))
+
+	opts := &users.ListOptions{
+		Limit:          uint64(gr.GetLimit()),
+		Offset:         uint64(gr.GetOffset()),
+		OrganizationID: gr.GetOrganizationId(),
+	}
+
+	switch gr.GetVerified() {
+	case pb.VerifiedFilter_VERIFIED:
+		verified := true
+		opts.Verified = &verified
+	case pb.VerifiedFilter_UNVERIFIED:
+		verified := false
+		opts.Verified = &verified
+	}
+
+	list, err := us.userSvc.List(ctx, opts)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][List][Error] %v", err.Error()))
+		return &pb.ListUsersResponse{
+			Data: nil,
+			Error: &pb.Error{
+				Code:    500,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	data := make([]*pb.User, 0, len(list))
+	for _, user := range list {
+		data = append(data, user.ToProto())
+	}
+
+	res := &pb.ListUsersResponse{
+		Data:  data,
+		Error: nil,
+	}
+
+	log.Println(fmt.Sprintf("[User Service][List][Response] count = %v", len(data)))
+	return res, nil
+}
+
+// VerifyEmail ...
+func (us *Service) VerifyEmail(ctx context.Context, gr *pb.VerifyEmailRequest) (*pb.VerifyEmailResponse, error) {
+	log.Println("[User Service][VerifyEmail][Request]")
+
+	token := gr.GetToken()
+	if token == "" {
+		log.Println("[User Service][VerifyEmail][Error] must provide a token")
+		return &pb.VerifyEmailResponse{
+			Data: nil,
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a token",
+			},
+		}, nil
+	}
+
+	user, err := us.userSvc.VerifyEmail(ctx, token)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][VerifyEmail][Error] %v", err.Error()))
+		if err == users.ErrInvalidToken {
+			return &pb.VerifyEmailResponse{
+				Data: nil,
+				Error: &pb.Error{
+					Code:    400,
+					Message: err.Error(),
+				},
+			}, nil
+		}
+
+		return &pb.VerifyEmailResponse{
+			Data: nil,
+			Error: &pb.Error{
+				Code:    500,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	res := &pb.VerifyEmailResponse{
+		Data:  user.ToProto(),
+		Error: nil,
+	}
+
+	log.Println(fmt.Sprintf("[User Service][VerifyEmail][Response] id = %v", user.ID))
+	return res, nil
+}
+
+// ResendVerification ...
+func (us *Service) ResendVerification(ctx context.Context, gr *pb.ResendVerificationRequest) (*pb.ResendVerificationResponse, error) {
+	email := gr.GetEmail()
+	log.Println(fmt.Sprintf("[User Service][ResendVerification][Request] email = %v", email))
+
+	if email == "" {
+		log.Println("[User Service][ResendVerification][Error] must provide a email")
+		return &pb.ResendVerificationResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a email",
+			},
+		}, nil
+	}
+
+	if err := us.userSvc.ResendVerification(ctx, email); err != nil {
+		log.Println(fmt.Sprintf("[User Service][ResendVerification][Error] %v", err.Error()))
+		if err.Error() == "sql: no rows in result set" {
+			return &pb.ResendVerificationResponse{
+				Error: &pb.Error{
+					Code:    404,
+					Message: fmt.Sprintf("user with email %v not found", email),
+				},
+			}, nil
+		}
+
+		if err == users.ErrEmailAlreadyVerified {
+			return &pb.ResendVerificationResponse{
+				Error: &pb.Error{
+					Code:    409,
+					Message: err.Error(),
+				},
+			}, nil
+		}
+
+		return &pb.ResendVerificationResponse{
+			Error: &pb.Error{
+				Code:    500,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println("[User Service][ResendVerification][Response] sent")
+	return &pb.ResendVerificationResponse{}, nil
+}
+
+// ConfirmEmailChange ...
+func (us *Service) ConfirmEmailChange(ctx context.Context, gr *pb.ConfirmEmailChangeRequest) (*pb.ConfirmEmailChangeResponse, error) {
+	log.Println("[User Service][ConfirmEmailChange][Request]")
+
+	token := gr.GetToken()
+	if token == "" {
+		log.Println("[User Service][ConfirmEmailChange][Error] must provide a token")
+		return &pb.ConfirmEmailChangeResponse{
+			Data: nil,
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a token",
+			},
+		}, nil
+	}
+
+	user, err := us.userSvc.ConfirmEmailChange(ctx, token)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ConfirmEmailChange][Error] %v", err.Error()))
+
+		return &pb.ConfirmEmailChangeResponse{
+			Data: nil,
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	res := &pb.ConfirmEmailChangeResponse{
+		Data:  user.ToProto(),
+		Error: nil,
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ConfirmEmailChange][Response] id = %v", user.ID))
+	return res, nil
+}
+
+// RevertEmailChange ...
+func (us *Service) RevertEmailChange(ctx context.Context, gr *pb.RevertEmailChangeRequest) (*pb.RevertEmailChangeResponse, error) {
+	log.Println("[User Service][RevertEmailChange][Request]")
+
+	token := gr.GetToken()
+	if token == "" {
+		log.Println("[User Service][RevertEmailChange][Error] must provide a token")
+		return &pb.RevertEmailChangeResponse{
+			Data: nil,
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a token",
+			},
+		}, nil
+	}
+
+	user, err := us.userSvc.RevertEmailChange(ctx, token)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][RevertEmailChange][Error] %v", err.Error()))
+
+		return &pb.RevertEmailChangeResponse{
+			Data: nil,
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	res := &pb.RevertEmailChangeResponse{
+		Data:  user.ToProto(),
+		Error: nil,
+	}
+
+	log.Println(fmt.Sprintf("[User Service][RevertEmailChange][Response] id = %v", user.ID))
+	return res, nil
+}
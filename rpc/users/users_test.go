@@ -0,0 +1,135 @@
+package users
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/database/sqlite"
+	"github.com/frperezr/microservices-demo/src/users-api/encryption"
+	"github.com/frperezr/microservices-demo/src/users-api/notifier"
+	"github.com/frperezr/microservices-demo/src/users-api/password"
+	"github.com/frperezr/microservices-demo/src/users-api/service"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/frperezr/microservices-demo/src/users-api/token"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testTenant is a organization of the tests with its owner
+type testTenant struct {
+	org   *user.Organization
+	owner *user.User
+	token string
+}
+
+// newTestService returns the users service on a new SQLite database
+func newTestService(t *testing.T) *service.Users {
+	t.Helper()
+
+	password.HashCost = bcrypt.MinCost
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Store.Close() })
+
+	cipher, err := encryption.NewAESGCM(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userSvc := service.New(store, notifier.NewLog("http://localhost"))
+	userSvc.Tokens = token.NewIssuer("users-api", []byte("secret"))
+	userSvc.Cipher = cipher
+	userSvc.WebhookCipher = cipher
+
+	return userSvc
+}
+
+// newTestTenant creates a organization owned by a new user with the email
+func newTestTenant(t *testing.T, userSvc *service.Users, email, slug string) *testTenant {
+	t.Helper()
+
+	ctx := tenant.WithSystem(context.Background())
+
+	owner := &user.User{Email: email, Name: "Owner", LastName: slug, Password: "correct horse battery staple"}
+	if err := userSvc.Create(ctx, owner); err != nil {
+		t.Fatal(err)
+	}
+
+	org := &user.Organization{Name: slug, Slug: slug}
+	if err := userSvc.CreateOrganization(ctx, org, owner.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := userSvc.Authenticate(ctx, email, "correct horse battery staple", org.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testTenant{org: org, owner: owner, token: auth.AccessToken}
+}
+
+// newTestClient serves the service over gRPC with the interceptors of the server
+func newTestClient(t *testing.T, userSvc *service.Users) pb.UserServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(TenantInterceptor(userSvc.Tokens), ActorInterceptor(userSvc.Tokens), ConsistencyInterceptor),
+		grpc.ChainStreamInterceptor(TenantStreamInterceptor(userSvc.Tokens), ActorStreamInterceptor(userSvc.Tokens), ConsistencyStreamInterceptor),
+	)
+	pb.RegisterUserServiceServer(server, New(userSvc))
+
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewUserServiceClient(conn)
+}
+
+// withToken returns a context sending the access token
+func withToken(accessToken string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+accessToken)
+}
+
+func TestUpdateKeepsThePassword(t *testing.T) {
+	userSvc := newTestService(t)
+	client := newTestClient(t, userSvc)
+	acme := newTestTenant(t, userSvc, "owner@acme.test", "acme")
+
+	update, err := client.Update(withToken(acme.token), &pb.UpdateUserRequest{Data: &pb.User{Id: acme.owner.ID, Name: "Ada"}})
+	if err != nil || update.GetError() != nil {
+		t.Fatalf("Update = %v, %v", update.GetError(), err)
+	}
+
+	if update.GetData().GetName() != "Ada" || update.GetData().GetLastName() != "acme" {
+		t.Fatalf("Update = %v, want only the name changed", update.GetData())
+	}
+
+	auth, err := client.Authenticate(context.Background(), &pb.AuthenticateRequest{
+		Email:          acme.owner.Email,
+		Password:       "correct horse battery staple",
+		OrganizationId: acme.org.ID,
+	})
+	if err != nil || auth.GetError() != nil {
+		t.Fatalf("Authenticate after a rename = %v, %v, want the password unchanged", auth.GetError(), err)
+	}
+}
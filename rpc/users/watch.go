@@ -0,0 +1,135 @@
+package users
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	"github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// errInvalidResumeToken ...
+var errInvalidResumeToken = errors.New("invalid resume token")
+
+// WatchUsers streams the changes of the users from the ones made after the
+// call, or from the first one with replay. A client that reconnects sends the
+// token of the last change it received to continue after it.
+func (us *Service) WatchUsers(gr *pb.WatchUsersRequest, stream pb.UserService_WatchUsersServer) error {
+	log.Println(fmt.Sprintf("[User Service][WatchUsers][Request] user_ids = %v types = %v resume_token = %v replay = %v", gr.GetUserIds(), gr.GetTypes(), gr.GetResumeToken(), gr.GetReplay()))
+
+	afterTxID, afterID, err := decodeResumeToken(gr.GetResumeToken())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][WatchUsers][Error] %v", err.Error()))
+		return stream.Send(&pb.WatchUsersResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: err.Error(),
+			},
+		})
+	}
+
+	if gr.GetResumeToken() == "" && !gr.GetReplay() {
+		afterTxID, afterID, err = us.userSvc.EventsHead(stream.Context())
+		if err != nil {
+			log.Println(fmt.Sprintf("[User Service][WatchUsers][Error] %v", err.Error()))
+			return stream.Send(&pb.WatchUsersResponse{
+				Error: &pb.Error{
+					Code:    errorCode(err),
+					Message: err.Error(),
+				},
+			})
+		}
+	}
+
+	filter := &users.EventFilter{
+		AfterTxID: afterTxID,
+		AfterID:   afterID,
+		UserIDs:   gr.GetUserIds(),
+		Types:     gr.GetTypes(),
+	}
+
+	err = us.userSvc.WatchUsers(stream.Context(), filter, func(e *users.Event) error {
+		change, err := userChange(e)
+		if err != nil {
+			return err
+		}
+
+		return stream.Send(&pb.WatchUsersResponse{
+			Data:  change,
+			Error: nil,
+		})
+	})
+
+	if err != nil && stream.Context().Err() == nil {
+		log.Println(fmt.Sprintf("[User Service][WatchUsers][Error] %v", err.Error()))
+		return stream.Send(&pb.WatchUsersResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		})
+	}
+
+	log.Println("[User Service][WatchUsers][Response] stream closed")
+	return nil
+}
+
+func userChange(e *users.Event) (*pb.UserChange, error) {
+	before, after, err := e.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	change := &pb.UserChange{
+		Token:     encodeResumeToken(e.TxID, e.ID),
+		Type:      e.Type,
+		UserId:    e.UserID,
+		After:     after.ToProto(),
+		CreatedAt: e.CreatedAt.Unix(),
+	}
+
+	if before != nil {
+		change.Before = before.ToProto()
+	}
+
+	return change, nil
+}
+
+// encodeResumeToken hides the outbox position so clients treat it as opaque
+func encodeResumeToken(txID, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("outbox:" + strconv.FormatInt(txID, 10) + ":" + strconv.FormatInt(id, 10)))
+}
+
+// decodeResumeToken returns the outbox position of the token, 0 for a empty
+// token
+func decodeResumeToken(token string) (int64, int64, error) {
+	if token == "" {
+		return 0, 0, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || !strings.HasPrefix(string(b), "outbox:") {
+		return 0, 0, errInvalidResumeToken
+	}
+
+	parts := strings.Split(strings.TrimPrefix(string(b), "outbox:"), ":")
+	if len(parts) != 2 {
+		return 0, 0, errInvalidResumeToken
+	}
+
+	txID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || txID < 0 {
+		return 0, 0, errInvalidResumeToken
+	}
+
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || id < 0 {
+		return 0, 0, errInvalidResumeToken
+	}
+
+	return txID, id, nil
+}
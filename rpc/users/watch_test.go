@@ -0,0 +1,108 @@
+package users
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/actor"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+func TestResumeToken(t *testing.T) {
+	txID, id, err := decodeResumeToken(encodeResumeToken(812, 35))
+	if err != nil || txID != 812 || id != 35 {
+		t.Fatalf("decodeResumeToken = %v, %v, %v, want 812, 35", txID, id, err)
+	}
+
+	for _, token := range []string{"not base64!", base64.RawURLEncoding.EncodeToString([]byte("outbox:35")), base64.RawURLEncoding.EncodeToString([]byte("outbox:1:2:3")), base64.RawURLEncoding.EncodeToString([]byte("outbox:-1:2"))} {
+		if _, _, err := decodeResumeToken(token); err != errInvalidResumeToken {
+			t.Errorf("decodeResumeToken(%q) = %v, want %v", token, err, errInvalidResumeToken)
+		}
+	}
+}
+
+func TestWatchUsersResumesAfterTheToken(t *testing.T) {
+	userSvc := newTestService(t)
+	client := newTestClient(t, userSvc)
+	acme := newTestTenant(t, userSvc, "owner@acme.test", "acme")
+
+	ctx := actor.With(tenant.WithID(context.Background(), acme.org.ID), actor.Actor{UserID: acme.owner.ID})
+	if err := userSvc.Update(ctx, &user.User{ID: acme.owner.ID, Name: "Renamed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	first := watchChanges(t, client, &pb.WatchUsersRequest{Replay: true}, acme.token, 2)
+	resumed := watchChanges(t, client, &pb.WatchUsersRequest{ResumeToken: first[0].GetToken()}, acme.token, 1)
+
+	if resumed[0].GetToken() != first[1].GetToken() {
+		t.Fatalf("resumed at %v %v, want the change after the token", resumed[0].GetType(), resumed[0].GetToken())
+	}
+}
+
+func TestWatchUsersStartsAfterTheLastChange(t *testing.T) {
+	userSvc := newTestService(t)
+	userSvc.WatchInterval = 20 * time.Millisecond
+	client := newTestClient(t, userSvc)
+	acme := newTestTenant(t, userSvc, "owner@acme.test", "acme")
+
+	ctx := actor.With(tenant.WithID(context.Background(), acme.org.ID), actor.Actor{UserID: acme.owner.ID})
+	if err := userSvc.Update(ctx, &user.User{ID: acme.owner.ID, Name: "Renamed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// the stream starts at some point after the call, so the changes go on
+	// until one of them is received
+	go func() {
+		for i := 1; ; i++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(50 * time.Millisecond):
+				userSvc.Update(ctx, &user.User{ID: acme.owner.ID, Name: fmt.Sprintf("Live %v", i)})
+			}
+		}
+	}()
+
+	changes := watchChanges(t, client, &pb.WatchUsersRequest{}, acme.token, 1)
+	if !strings.HasPrefix(changes[0].GetAfter().GetName(), "Live") {
+		t.Fatalf("first change is %v to %v, want one made after the call", changes[0].GetType(), changes[0].GetAfter().GetName())
+	}
+}
+
+// watchChanges returns the first n changes of WatchUsers
+func watchChanges(t *testing.T, client pb.UserServiceClient, req *pb.WatchUsersRequest, accessToken string, n int) []*pb.UserChange {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(withToken(accessToken), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchUsers(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []*pb.UserChange
+	for len(changes) < n {
+		res, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.GetError() != nil {
+			t.Fatal(res.GetError().GetMessage())
+		}
+
+		changes = append(changes, res.GetData())
+	}
+
+	return changes
+}
@@ -0,0 +1,289 @@
+package users
+
+import (
+	"fmt"
+	"log"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"golang.org/x/net/context"
+)
+
+// CreateWebhook subscribes a url to the user events of a organization, the secret to verify the signatures is only returned here
+func (us *Service) CreateWebhook(ctx context.Context, gr *pb.CreateWebhookRequest) (*pb.CreateWebhookResponse, error) {
+	data := gr.GetData()
+	log.Println(fmt.Sprintf("[User Service][CreateWebhook][Request] organization_id = %v url = %v", data.GetOrganizationId(), data.GetUrl()))
+
+	if data.GetOrganizationId() == "" || data.GetUrl() == "" {
+		log.Println("[User Service][CreateWebhook][Error] must provide a organization_id and url")
+		return &pb.CreateWebhookResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a organization_id and url",
+			},
+		}, nil
+	}
+
+	hook := new(users.Webhook).FromProto(data)
+
+	secret, err := us.userSvc.CreateWebhook(ctx, hook)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][CreateWebhook][Error] %v", err.Error()))
+		return &pb.CreateWebhookResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	res := hook.ToProto()
+	res.Secret = secret
+
+	log.Println(fmt.Sprintf("[User Service][CreateWebhook][Response] id = %v", hook.ID))
+	return &pb.CreateWebhookResponse{
+		Data:  res,
+		Error: nil,
+	}, nil
+}
+
+// GetWebhook ...
+func (us *Service) GetWebhook(ctx context.Context, gr *pb.GetWebhookRequest) (*pb.GetWebhookResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][GetWebhook][Request] id = %v", gr.GetId()))
+
+	if gr.GetId() == "" {
+		log.Println("[User Service][GetWebhook][Error] must provide a id")
+		return &pb.GetWebhookResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a id",
+			},
+		}, nil
+	}
+
+	hook, err := us.userSvc.GetWebhook(ctx, gr.GetId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][GetWebhook][Error] %v", err.Error()))
+		return &pb.GetWebhookResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][GetWebhook][Response] id = %v", hook.ID))
+	return &pb.GetWebhookResponse{
+		Data:  hook.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// ListWebhooks returns the webhooks of a organization
+func (us *Service) ListWebhooks(ctx context.Context, gr *pb.ListWebhooksRequest) (*pb.ListWebhooksResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][ListWebhooks][Request] organization_id = %v", gr.GetOrganizationId()))
+
+	if gr.GetOrganizationId() == "" {
+		log.Println("[User Service][ListWebhooks][Error] must provide a organization_id")
+		return &pb.ListWebhooksResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a organization_id",
+			},
+		}, nil
+	}
+
+	hooks, err := us.userSvc.ListWebhooks(ctx, gr.GetOrganizationId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ListWebhooks][Error] %v", err.Error()))
+		return &pb.ListWebhooksResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	data := make([]*pb.Webhook, 0, len(hooks))
+	for _, hook := range hooks {
+		data = append(data, hook.ToProto())
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ListWebhooks][Response] count = %v", len(data)))
+	return &pb.ListWebhooksResponse{
+		Data:  data,
+		Error: nil,
+	}, nil
+}
+
+// UpdateWebhook replaces the event types and active flag of a webhook, and its url when given
+func (us *Service) UpdateWebhook(ctx context.Context, gr *pb.UpdateWebhookRequest) (*pb.UpdateWebhookResponse, error) {
+	data := gr.GetData()
+	log.Println(fmt.Sprintf("[User Service][UpdateWebhook][Request] id = %v active = %v", data.GetId(), data.GetActive()))
+
+	if data.GetId() == "" {
+		log.Println("[User Service][UpdateWebhook][Error] must provide a id")
+		return &pb.UpdateWebhookResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a id",
+			},
+		}, nil
+	}
+
+	hook := new(users.Webhook).FromProto(data)
+
+	err := us.userSvc.UpdateWebhook(ctx, hook)
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][UpdateWebhook][Error] %v", err.Error()))
+		return &pb.UpdateWebhookResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][UpdateWebhook][Response] id = %v", hook.ID))
+	return &pb.UpdateWebhookResponse{
+		Data:  hook.ToProto(),
+		Error: nil,
+	}, nil
+}
+
+// DeleteWebhook ...
+func (us *Service) DeleteWebhook(ctx context.Context, gr *pb.DeleteWebhookRequest) (*pb.DeleteWebhookResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][DeleteWebhook][Request] id = %v", gr.GetId()))
+
+	if gr.GetId() == "" {
+		log.Println("[User Service][DeleteWebhook][Error] must provide a id")
+		return &pb.DeleteWebhookResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a id",
+			},
+		}, nil
+	}
+
+	err := us.userSvc.DeleteWebhook(ctx, gr.GetId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][DeleteWebhook][Error] %v", err.Error()))
+		return &pb.DeleteWebhookResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][DeleteWebhook][Response] id = %v", gr.GetId()))
+	return &pb.DeleteWebhookResponse{
+		Error: nil,
+	}, nil
+}
+
+// ListWebhookDeliveries returns the deliveries of a webhook, optionally only those with a status
+func (us *Service) ListWebhookDeliveries(ctx context.Context, gr *pb.ListWebhookDeliveriesRequest) (*pb.ListWebhookDeliveriesResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][ListWebhookDeliveries][Request] webhook_id = %v status = %v", gr.GetWebhookId(), gr.GetStatus()))
+
+	if gr.GetWebhookId() == "" {
+		log.Println("[User Service][ListWebhookDeliveries][Error] must provide a webhook_id")
+		return &pb.ListWebhookDeliveriesResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a webhook_id",
+			},
+		}, nil
+	}
+
+	deliveries, err := us.userSvc.ListWebhookDeliveries(ctx, gr.GetWebhookId(), gr.GetStatus())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ListWebhookDeliveries][Error] %v", err.Error()))
+		return &pb.ListWebhookDeliveriesResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	data := make([]*pb.WebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		data = append(data, d.ToProto())
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ListWebhookDeliveries][Response] count = %v", len(data)))
+	return &pb.ListWebhookDeliveriesResponse{
+		Data:  data,
+		Error: nil,
+	}, nil
+}
+
+// ListWebhookAttempts returns the requests made for a delivery
+func (us *Service) ListWebhookAttempts(ctx context.Context, gr *pb.ListWebhookAttemptsRequest) (*pb.ListWebhookAttemptsResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][ListWebhookAttempts][Request] delivery_id = %v", gr.GetDeliveryId()))
+
+	if gr.GetDeliveryId() == "" {
+		log.Println("[User Service][ListWebhookAttempts][Error] must provide a delivery_id")
+		return &pb.ListWebhookAttemptsResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a delivery_id",
+			},
+		}, nil
+	}
+
+	attempts, err := us.userSvc.ListWebhookAttempts(ctx, gr.GetDeliveryId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ListWebhookAttempts][Error] %v", err.Error()))
+		return &pb.ListWebhookAttemptsResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	data := make([]*pb.WebhookAttempt, 0, len(attempts))
+	for _, a := range attempts {
+		data = append(data, a.ToProto())
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ListWebhookAttempts][Response] count = %v", len(data)))
+	return &pb.ListWebhookAttemptsResponse{
+		Data:  data,
+		Error: nil,
+	}, nil
+}
+
+// ReplayWebhookDelivery sends a delivery again, including dead ones
+func (us *Service) ReplayWebhookDelivery(ctx context.Context, gr *pb.ReplayWebhookDeliveryRequest) (*pb.ReplayWebhookDeliveryResponse, error) {
+	log.Println(fmt.Sprintf("[User Service][ReplayWebhookDelivery][Request] delivery_id = %v", gr.GetDeliveryId()))
+
+	if gr.GetDeliveryId() == "" {
+		log.Println("[User Service][ReplayWebhookDelivery][Error] must provide a delivery_id")
+		return &pb.ReplayWebhookDeliveryResponse{
+			Error: &pb.Error{
+				Code:    400,
+				Message: "must provide a delivery_id",
+			},
+		}, nil
+	}
+
+	d, err := us.userSvc.ReplayWebhookDelivery(ctx, gr.GetDeliveryId())
+	if err != nil {
+		log.Println(fmt.Sprintf("[User Service][ReplayWebhookDelivery][Error] %v", err.Error()))
+		return &pb.ReplayWebhookDeliveryResponse{
+			Error: &pb.Error{
+				Code:    errorCode(err),
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	log.Println(fmt.Sprintf("[User Service][ReplayWebhookDelivery][Response] status = %v", d.Status))
+	return &pb.ReplayWebhookDeliveryResponse{
+		Data:  d.ToProto(),
+		Error: nil,
+	}, nil
+}
@@ -0,0 +1,13 @@
+package service
+
+import (
+	"context"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// ListAuditEvents returns the audit chain of the user, oldest first. The chain
+// is not verified here, see user.VerifyAuditChain.
+func (us *Users) ListAuditEvents(ctx context.Context, userID string) ([]*user.AuditEvent, error) {
+	return us.Store.ListAuditEvents(ctx, userID)
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/consistency"
+	"github.com/frperezr/microservices-demo/src/users-api/password"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+var (
+	// DefaultAccountLockout locks a account for 1 minute after 5 failures, up to 1 hour
+	DefaultAccountLockout = user.LockoutPolicy{
+		Threshold:    5,
+		Window:       15 * time.Minute,
+		BaseDuration: time.Minute,
+		MaxDuration:  time.Hour,
+	}
+
+	// DefaultIPLockout blocks a address for 1 minute after 20 failures, up to 1 hour
+	DefaultIPLockout = user.LockoutPolicy{
+		Threshold:    20,
+		Window:       15 * time.Minute,
+		BaseDuration: time.Minute,
+		MaxDuration:  time.Hour,
+	}
+
+	// missingUserHash is checked when the email is not registered, so the time
+	// of a failed login does not tell whether the email exists
+	missingUserHash, _ = password.Hash("missing user")
+)
+
+// Authenticate checks the credentials of the user. If the user has MFA enabled
+// the result only carries a MFA token to be used with AuthenticateMFA.
+// Failures are counted per account and per client ip to throttle guessing.
+// The access token is scoped to the organization orgID, which the user must
+// be a member of, or to no organization when it is empty.
+func (us *Users) Authenticate(ctx context.Context, email, pass, orgID, ip string) (*user.Authentication, error) {
+	if email == "" || pass == "" {
+		return nil, user.ErrInvalidCredentials
+	}
+
+	// the lockout state is read from the primary, a cached or replicated
+	// copy could miss the last failures
+	ctx = consistency.Primary(ctx)
+
+	if err := us.checkIP(ctx, ip); err != nil {
+		return nil, err
+	}
+
+	u, err := us.Store.GetByEmail(ctx, strings.ToLower(email))
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			password.Matches(missingUserHash, pass)
+			us.recordFailure(ctx, nil, ip)
+			return nil, user.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if u.IsLocked(time.Now()) {
+		return nil, user.ErrAccountLocked
+	}
+
+	if !password.Matches(u.Password, pass) {
+		us.recordFailure(ctx, u, ip)
+		return nil, user.ErrInvalidCredentials
+	}
+
+	if err := us.checkMembership(ctx, orgID, u.ID); err != nil {
+		return nil, err
+	}
+
+	if u.IsMFAEnabled() {
+		mfaToken, expiresAt, err := us.Tokens.IssueMFA(u, orgID)
+		if err != nil {
+			return nil, err
+		}
+
+		return &user.Authentication{
+			User:        u,
+			ExpiresAt:   expiresAt,
+			MFARequired: true,
+			MFAToken:    mfaToken,
+		}, nil
+	}
+
+	return us.authenticated(ctx, u, orgID)
+}
+
+// AuthenticateMFA completes the authentication with a TOTP or recovery code
+func (us *Users) AuthenticateMFA(ctx context.Context, mfaToken, code, ip string) (*user.Authentication, error) {
+	ctx = consistency.Primary(ctx)
+
+	if err := us.checkIP(ctx, ip); err != nil {
+		return nil, err
+	}
+
+	claims, err := us.Tokens.ParseMFA(mfaToken)
+	if err != nil {
+		return nil, user.ErrInvalidCredentials
+	}
+
+	u, err := us.Store.GetByID(ctx, claims.Subject)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return nil, user.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if u.IsLocked(time.Now()) {
+		return nil, user.ErrAccountLocked
+	}
+
+	if err := us.verifyMFACode(ctx, u, code); err != nil {
+		if err == user.ErrInvalidMFACode {
+			us.recordFailure(ctx, u, ip)
+		}
+		return nil, err
+	}
+
+	// the user may have left the organization since the first step
+	if err := us.checkMembership(ctx, claims.Organization, u.ID); err != nil {
+		return nil, err
+	}
+
+	return us.authenticated(ctx, u, claims.Organization)
+}
+
+// Unlock clears the failed logins and the lock of the user
+func (us *Users) Unlock(ctx context.Context, userID string) (*user.User, error) {
+	if err := us.authorize(ctx, user.PermissionUnlockUsers); err != nil {
+		return nil, err
+	}
+
+	return us.Store.ResetLoginFailures(ctx, userID)
+}
+
+func (us *Users) authenticated(ctx context.Context, u *user.User, orgID string) (*user.Authentication, error) {
+	if u.FailedLoginAttempts > 0 || u.LockedUntil != nil {
+		reset, err := us.Store.ResetLoginFailures(ctx, u.ID)
+		if err != nil {
+			return nil, err
+		}
+		u = reset
+	}
+
+	if err := us.loadRoles(ctx, u); err != nil {
+		return nil, err
+	}
+
+	accessToken, expiresAt, err := us.Tokens.IssueAccess(u, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.Authentication{
+		User:        u,
+		AccessToken: accessToken,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// checkMembership fails with user.ErrNotMember unless the user belongs to the
+// organization, there is nothing to check without one
+func (us *Users) checkMembership(ctx context.Context, orgID, userID string) error {
+	if orgID == "" {
+		return nil
+	}
+
+	_, err := us.Store.GetMembership(tenant.WithSystem(ctx), orgID, userID)
+	return err
+}
+
+func (us *Users) checkIP(ctx context.Context, ip string) error {
+	if ip == "" {
+		return nil
+	}
+
+	blockedUntil, err := us.Store.GetIPBlockedUntil(ctx, ip)
+	if err != nil {
+		return err
+	}
+
+	if blockedUntil != nil && blockedUntil.After(time.Now()) {
+		return user.ErrTooManyAttempts
+	}
+
+	return nil
+}
+
+// recordFailure counts a failed login for the user, if known, and the ip.
+// Errors are only logged since the caller already fails the authentication.
+func (us *Users) recordFailure(ctx context.Context, u *user.User, ip string) {
+	now := time.Now()
+
+	if u != nil {
+		failures, err := us.Store.RecordLoginFailure(ctx, u.ID, now, now.Add(-us.AccountLockout.Window))
+		if err != nil {
+			log.Println(fmt.Sprintf("[Users][Authenticate][Error] recording login failure: %v", err))
+		} else if d := us.AccountLockout.LockDuration(failures); d > 0 {
+			if err := us.Store.LockUser(ctx, u.ID, now.Add(d)); err != nil {
+				log.Println(fmt.Sprintf("[Users][Authenticate][Error] locking user: %v", err))
+			}
+		}
+	}
+
+	if ip != "" {
+		failures, err := us.Store.RecordIPFailure(ctx, ip, now, now.Add(-us.IPLockout.Window))
+		if err != nil {
+			log.Println(fmt.Sprintf("[Users][Authenticate][Error] recording ip failure: %v", err))
+		} else if d := us.IPLockout.LockDuration(failures); d > 0 {
+			if err := us.Store.BlockIP(ctx, ip, now.Add(d)); err != nil {
+				log.Println(fmt.Sprintf("[Users][Authenticate][Error] blocking ip: %v", err))
+			}
+		}
+	}
+}
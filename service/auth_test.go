@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/database/cache"
+)
+
+func TestAuthenticateReadsTheLockoutFromThePrimary(t *testing.T) {
+	us, ctx := newTestUsers(t)
+
+	primary := us.Store
+	us.Store = cache.NewStore(primary, cache.NewLRU(100))
+
+	u := createTestUser(t, us, ctx, "ada@example.com")
+
+	// cache the user, then lock it as another instance would, without
+	// going through this cache
+	if _, err := us.Store.GetByEmail(ctx, "ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := primary.LockUser(ctx, u.ID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := us.Authenticate(ctx, "ada@example.com", "correct horse battery staple", "", ""); err != user.ErrAccountLocked {
+		t.Fatalf("authenticate = %v, want %v", err, user.ErrAccountLocked)
+	}
+}
+
+func TestAuthenticateLocksTheAccount(t *testing.T) {
+	us, ctx := newTestUsers(t)
+
+	createTestUser(t, us, ctx, "ada@example.com")
+
+	for i := 0; i < us.AccountLockout.Threshold; i++ {
+		if _, err := us.Authenticate(ctx, "ada@example.com", "wrong password", "", ""); err != user.ErrInvalidCredentials {
+			t.Fatalf("attempt %v = %v, want %v", i, err, user.ErrInvalidCredentials)
+		}
+	}
+
+	if _, err := us.Authenticate(ctx, "ada@example.com", "correct horse battery staple", "", ""); err != user.ErrAccountLocked {
+		t.Fatalf("authenticate = %v, want %v", err, user.ErrAccountLocked)
+	}
+}
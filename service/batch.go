@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// BatchGetUsers returns the users found with the ids, in the order of the
+// ids, and the ids that were not found. Repeated ids are returned once.
+func (us *Users) BatchGetUsers(ctx context.Context, ids []string) ([]*user.User, []string, error) {
+	unique := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	if len(unique) > user.MaxBatchSize {
+		return nil, nil, user.ErrBatchTooLarge
+	}
+
+	if len(unique) == 0 {
+		return []*user.User{}, []string{}, nil
+	}
+
+	uu, err := us.GetByIDs(ctx, unique)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byID := make(map[string]*user.User, len(uu))
+	for _, u := range uu {
+		byID[u.ID] = u
+	}
+
+	found := make([]*user.User, 0, len(uu))
+	missing := make([]string, 0)
+
+	for _, id := range unique {
+		if u, ok := byID[id]; ok {
+			found = append(found, u)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	return found, missing, nil
+}
+
+// BatchCreateUsers creates the users, returning the error of each one, nil
+// for the created users. With atomic set the users are only created if all
+// of them can be, otherwise the failed ones are skipped.
+func (us *Users) BatchCreateUsers(ctx context.Context, uu []*user.User, atomic bool) ([]error, error) {
+	if len(uu) > user.MaxBatchSize {
+		return nil, user.ErrBatchTooLarge
+	}
+
+	errs := make([]error, len(uu))
+	valid := make([]*user.User, 0, len(uu))
+	index := make([]int, 0, len(uu))
+
+	for i, u := range uu {
+		if err := us.validatePassword(u.Password, u); err != nil {
+			errs[i] = err
+			continue
+		}
+
+		valid = append(valid, u)
+		index = append(index, i)
+	}
+
+	if len(valid) < len(uu) && atomic {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = user.ErrBatchAborted
+			}
+		}
+		return errs, nil
+	}
+
+	if err := hashPasswords(ctx, valid); err != nil {
+		return nil, err
+	}
+
+	created, err := us.Store.BatchCreate(ctx, valid, atomic)
+	if err != nil {
+		return nil, err
+	}
+
+	for j, i := range index {
+		if errs[i] = created[j]; errs[i] != nil {
+			continue
+		}
+
+		if err := us.sendEmailVerification(ctx, uu[i]); err != nil {
+			log.Println(fmt.Sprintf("[Users][BatchCreateUsers][Error] sending email verification: %v", err))
+		}
+	}
+
+	return errs, nil
+}
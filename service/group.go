@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+// CreateGroup ...
+func (us *Users) CreateGroup(ctx context.Context, g *user.Group) error {
+	ctx, err := tenant.Narrow(ctx, g.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	return us.Groups.CreateGroup(ctx, g)
+}
+
+// GetGroup ...
+func (us *Users) GetGroup(ctx context.Context, id string) (*user.Group, error) {
+	return us.Groups.GetGroup(ctx, id)
+}
+
+// UpdateGroup ...
+func (us *Users) UpdateGroup(ctx context.Context, g *user.Group) error {
+	return us.Groups.UpdateGroup(ctx, g)
+}
+
+// DeleteGroup ...
+func (us *Users) DeleteGroup(ctx context.Context, id string) error {
+	return us.Groups.DeleteGroup(ctx, id)
+}
+
+// ListGroups ...
+func (us *Users) ListGroups(ctx context.Context, orgID string) ([]*user.Group, error) {
+	ctx, err := tenant.Narrow(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return us.Groups.ListGroups(ctx, orgID)
+}
+
+// AddGroupMember adds a user or a nested group to the group, users must be
+// members of the organization of the group.
+func (us *Users) AddGroupMember(ctx context.Context, m *user.GroupMember) error {
+	if (m.UserID == "") == (m.MemberGroupID == "") {
+		return user.ErrInvalidGroupMember
+	}
+
+	g, err := us.Groups.GetGroup(ctx, m.GroupID)
+	if err != nil {
+		return err
+	}
+
+	if m.UserID != "" {
+		scoped, err := tenant.Narrow(ctx, g.OrganizationID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := us.Store.GetByID(scoped, m.UserID); err != nil {
+			if err == sql.ErrNoRows {
+				return user.ErrNotMember
+			}
+			return err
+		}
+	}
+
+	return us.Groups.AddGroupMember(ctx, m)
+}
+
+// RemoveGroupMember ...
+func (us *Users) RemoveGroupMember(ctx context.Context, m *user.GroupMember) error {
+	return us.Groups.RemoveGroupMember(ctx, m)
+}
+
+// ListGroupMembers returns the direct members of the group
+func (us *Users) ListGroupMembers(ctx context.Context, groupID string) ([]*user.GroupMember, error) {
+	if _, err := us.Groups.GetGroup(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	return us.Groups.ListGroupMembers(ctx, groupID)
+}
+
+// ListUserGroups returns the effective groups of the user, including the ones
+// inherited through nested groups
+func (us *Users) ListUserGroups(ctx context.Context, userID string) ([]*user.Group, error) {
+	return us.Groups.ListUserGroups(ctx, userID)
+}
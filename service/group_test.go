@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/database"
+	"github.com/frperezr/microservices-demo/src/users-api/database/memory"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+// groupStores are the stores the group tests run against, the memory store
+// must behave like the database
+var groupStores = map[string]func(us *Users) database.GroupStore{
+	"memory": func(us *Users) database.GroupStore { return memory.NewGroupStore() },
+	"sqlite": func(us *Users) database.GroupStore { return us.Store },
+}
+
+// newTestOrganization creates a organization owned by a new user, returning
+// the context of its tenant
+func newTestOrganization(t *testing.T, us *Users, ctx context.Context, slug string) (*user.Organization, *user.User, context.Context) {
+	t.Helper()
+
+	owner := createTestUser(t, us, ctx, "owner@"+slug+".com")
+
+	org := &user.Organization{Name: slug, Slug: slug}
+	if err := us.CreateOrganization(ctx, org, owner.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	return org, owner, tenant.WithID(context.Background(), org.ID)
+}
+
+func createTestGroup(t *testing.T, us *Users, ctx context.Context, orgID, name string) *user.Group {
+	t.Helper()
+
+	g := &user.Group{OrganizationID: orgID, Name: name}
+	if err := us.CreateGroup(ctx, g); err != nil {
+		t.Fatal(err)
+	}
+
+	return g
+}
+
+func groupNames(gg []*user.Group) []string {
+	names := make([]string, 0, len(gg))
+	for _, g := range gg {
+		names = append(names, g.Name)
+	}
+	return names
+}
+
+func TestNestedGroups(t *testing.T) {
+	for name, groups := range groupStores {
+		t.Run(name, func(t *testing.T) {
+			us, ctx := newTestUsers(t)
+			us.Groups = groups(us)
+
+			org, owner, orgCtx := newTestOrganization(t, us, ctx, "acme")
+
+			engineering := createTestGroup(t, us, orgCtx, org.ID, "engineering")
+			backend := createTestGroup(t, us, orgCtx, org.ID, "backend")
+			storage := createTestGroup(t, us, orgCtx, org.ID, "storage")
+
+			for _, m := range []*user.GroupMember{
+				{GroupID: engineering.ID, MemberGroupID: backend.ID},
+				{GroupID: backend.ID, MemberGroupID: storage.ID},
+				{GroupID: storage.ID, UserID: owner.ID},
+			} {
+				if err := us.AddGroupMember(orgCtx, m); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			gg, err := us.ListUserGroups(orgCtx, owner.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := groupNames(gg); len(names) != 3 || names[0] != "backend" || names[1] != "engineering" || names[2] != "storage" {
+				t.Errorf("groups = %v, want [backend engineering storage]", names)
+			}
+
+			for _, m := range []*user.GroupMember{
+				{GroupID: storage.ID, MemberGroupID: engineering.ID},
+				{GroupID: backend.ID, MemberGroupID: backend.ID},
+			} {
+				if err := us.AddGroupMember(orgCtx, m); err != user.ErrGroupCycle {
+					t.Errorf("add %v to %v = %v, want %v", m.MemberGroupID, m.GroupID, err, user.ErrGroupCycle)
+				}
+			}
+
+			if err := us.AddGroupMember(orgCtx, &user.GroupMember{GroupID: engineering.ID}); err != user.ErrInvalidGroupMember {
+				t.Errorf("add nothing = %v, want %v", err, user.ErrInvalidGroupMember)
+			}
+
+			if err := us.RemoveGroupMember(orgCtx, &user.GroupMember{GroupID: engineering.ID, MemberGroupID: backend.ID}); err != nil {
+				t.Fatal(err)
+			}
+
+			gg, err = us.ListUserGroups(orgCtx, owner.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := groupNames(gg); len(names) != 2 {
+				t.Errorf("groups after removing the nesting = %v, want [backend storage]", names)
+			}
+
+			// engineering no longer contains storage, so it can be nested in it
+			if err := us.AddGroupMember(orgCtx, &user.GroupMember{GroupID: storage.ID, MemberGroupID: engineering.ID}); err != nil {
+				t.Errorf("add engineering to storage = %v", err)
+			}
+		})
+	}
+}
+
+func TestGroupsAreScopedToTheirOrganization(t *testing.T) {
+	for name, groups := range groupStores {
+		t.Run(name, func(t *testing.T) {
+			us, ctx := newTestUsers(t)
+			us.Groups = groups(us)
+
+			acme, _, acmeCtx := newTestOrganization(t, us, ctx, "acme")
+			globex, outsider, globexCtx := newTestOrganization(t, us, ctx, "globex")
+
+			staff := createTestGroup(t, us, acmeCtx, acme.ID, "staff")
+			other := createTestGroup(t, us, globexCtx, globex.ID, "staff")
+
+			if _, err := us.GetGroup(globexCtx, staff.ID); err != user.ErrGroupNotFound {
+				t.Errorf("get group of another organization = %v, want %v", err, user.ErrGroupNotFound)
+			}
+
+			if err := us.AddGroupMember(acmeCtx, &user.GroupMember{GroupID: staff.ID, MemberGroupID: other.ID}); err != user.ErrGroupNotFound {
+				t.Errorf("nest group of another organization = %v, want %v", err, user.ErrGroupNotFound)
+			}
+
+			if err := us.AddGroupMember(acmeCtx, &user.GroupMember{GroupID: staff.ID, UserID: outsider.ID}); err != user.ErrNotMember {
+				t.Errorf("add user of another organization = %v, want %v", err, user.ErrNotMember)
+			}
+
+			if err := us.CreateGroup(acmeCtx, &user.Group{OrganizationID: acme.ID, Name: "staff"}); err != user.ErrGroupNameTaken {
+				t.Errorf("create group with a taken name = %v, want %v", err, user.ErrGroupNameTaken)
+			}
+
+			gg, err := us.ListGroups(acmeCtx, acme.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(gg) != 1 || gg[0].ID != staff.ID {
+				t.Errorf("groups = %v, want [staff]", groupNames(gg))
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+)
+
+// GetUserAsOf ...
+func (us *Users) GetUserAsOf(ctx context.Context, id string, at time.Time) (*user.UserVersion, error) {
+	return us.Store.GetUserAsOf(ctx, id, at)
+}
+
+// ListUserVersions ...
+func (us *Users) ListUserVersions(ctx context.Context, id string) ([]*user.UserVersion, error) {
+	return us.Store.ListUserVersions(ctx, id)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+// errMissingImportField ...
+var errMissingImportField = errors.New("must provide a email, name, last_name and password")
+
+// ImportUsers reads the rows with next until it returns io.EOF and imports
+// them in batches of user.ImportBatchSize. Rows that break the password
+// policy or repeat a email fail, users that already exist are skipped. With
+// dryRun every row is checked but nothing is imported.
+//
+// The result is returned along with the error that stopped the import, the
+// batches before LastRow are committed.
+func (us *Users) ImportUsers(ctx context.Context, dryRun bool, next func() (int64, *user.User, error)) (*user.ImportResult, error) {
+	result := &user.ImportResult{Errors: make([]*user.ImportError, 0)}
+	seen := make(map[string]bool)
+
+	rows := make([]int64, 0, user.ImportBatchSize)
+	uu := make([]*user.User, 0, user.ImportBatchSize)
+
+	fail := func(row int64, u *user.User, err error) {
+		result.Failed++
+		result.Errors = append(result.Errors, &user.ImportError{Row: row, Email: u.Email, Err: err})
+	}
+
+	flush := func() error {
+		if len(uu) == 0 {
+			return nil
+		}
+
+		// a dry run is rolled back, it does not need to pay for the hashes
+		if !dryRun {
+			if err := hashPasswords(ctx, uu); err != nil {
+				return err
+			}
+		}
+
+		errs, err := us.Store.ImportUsers(ctx, uu, dryRun)
+		if err != nil {
+			return err
+		}
+
+		for i, err := range errs {
+			switch err {
+			case nil:
+				result.Imported++
+			case user.ErrEmailTaken:
+				result.Skipped++
+			default:
+				fail(rows[i], uu[i], err)
+			}
+		}
+
+		result.LastRow = rows[len(rows)-1]
+		rows, uu = rows[:0], uu[:0]
+		return nil
+	}
+
+	for {
+		row, u, err := next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return result, err
+		}
+
+		if u.Email == "" || u.Name == "" || u.LastName == "" || u.Password == "" {
+			fail(row, u, errMissingImportField)
+			continue
+		}
+
+		if err := us.validatePassword(u.Password, u); err != nil {
+			fail(row, u, err)
+			continue
+		}
+
+		email := strings.ToLower(u.Email)
+
+		if seen[email] {
+			fail(row, u, user.ErrDuplicateImportEmail)
+			continue
+		}
+		seen[email] = true
+
+		rows, uu = append(rows, row), append(uu, u)
+
+		if len(uu) == user.ImportBatchSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, flush()
+}
+
+// ExportUsers calls fn with every user, in order of id, reading them in
+// batches of user.ExportBatchSize
+func (us *Users) ExportUsers(ctx context.Context, opts *user.ExportOptions, fn func(*user.User) error) error {
+	if opts == nil {
+		return errors.New("must provide export options")
+	}
+
+	ctx, err := tenant.Narrow(ctx, opts.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	afterID := opts.AfterID
+
+	for {
+		uu, err := us.Store.ExportUsers(ctx, afterID, user.ExportBatchSize)
+		if err != nil {
+			return err
+		}
+
+		if err := us.loadRoles(ctx, uu...); err != nil {
+			return err
+		}
+
+		for _, u := range uu {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+
+		if len(uu) < user.ExportBatchSize {
+			return nil
+		}
+
+		afterID = uu[len(uu)-1].ID
+	}
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/totp"
+)
+
+// DefaultRecoveryCodes is the number of recovery codes generated when MFA is confirmed
+const DefaultRecoveryCodes = 10
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollMFA starts the TOTP enrollment of the user, it must be confirmed with ConfirmMFA
+func (us *Users) EnrollMFA(ctx context.Context, userID string) (*user.MFAEnrollment, error) {
+	u, err := us.Store.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.IsMFAEnabled() {
+		return nil, user.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := us.Cipher.Encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := us.Store.SaveMFA(ctx, &user.MFA{UserID: u.ID, Secret: encrypted}); err != nil {
+		return nil, err
+	}
+
+	return &user.MFAEnrollment{
+		Secret:     totp.EncodeSecret(secret),
+		OtpauthURI: us.TOTP.URI(secret, u.Email),
+	}, nil
+}
+
+// ConfirmMFA enables MFA once the user proves the authenticator app works,
+// returning the recovery codes in plain text for the only time.
+func (us *Users) ConfirmMFA(ctx context.Context, userID, code string) (*user.User, []string, error) {
+	m, err := us.Store.GetMFA(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if m.ConfirmedAt != nil {
+		return nil, nil, user.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := us.Cipher.Decrypt(m.Secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	step, ok := us.TOTP.Validate(secret, code, m.LastUsedStep)
+	if !ok {
+		return nil, nil, user.ErrInvalidMFACode
+	}
+
+	codes := make([]string, 0, us.RecoveryCodes)
+	hashes := make([]string, 0, us.RecoveryCodes)
+	for i := 0; i < us.RecoveryCodes; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	u, err := us.Store.ConfirmMFA(ctx, userID, step, hashes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return u, codes, nil
+}
+
+// DisableMFA turns off MFA after checking a TOTP or recovery code
+func (us *Users) DisableMFA(ctx context.Context, userID, code string) (*user.User, error) {
+	u, err := us.Store.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := us.verifyMFACode(ctx, u, code); err != nil {
+		return nil, err
+	}
+
+	return us.Store.DeleteMFA(ctx, userID)
+}
+
+// ResetMFA turns off MFA without a code, it is meant for administrators
+// helping users that lost both their device and recovery codes.
+func (us *Users) ResetMFA(ctx context.Context, userID string) (*user.User, error) {
+	if err := us.authorize(ctx, user.PermissionResetMFA); err != nil {
+		return nil, err
+	}
+
+	if _, err := us.Store.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return us.Store.DeleteMFA(ctx, userID)
+}
+
+// verifyMFACode accepts a TOTP code of the current time window or an unused recovery code
+func (us *Users) verifyMFACode(ctx context.Context, u *user.User, code string) error {
+	if !u.IsMFAEnabled() {
+		return user.ErrMFANotEnabled
+	}
+
+	m, err := us.Store.GetMFA(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) != us.TOTP.Digits {
+		return us.Store.UseRecoveryCode(ctx, u.ID, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	secret, err := us.Cipher.Decrypt(m.Secret)
+	if err != nil {
+		return err
+	}
+
+	step, ok := us.TOTP.Validate(secret, code, m.LastUsedStep)
+	if !ok {
+		return user.ErrInvalidMFACode
+	}
+
+	return us.Store.UseMFAStep(ctx, u.ID, step)
+}
+
+// newRecoveryCode returns a code formatted as xxxxx-xxxxx
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.Replace(code, "-", "", -1)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+)
+
+func TestMFA(t *testing.T) {
+	us, ctx := newTestUsers(t)
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	us.TOTP.Now = func() time.Time { return now }
+	us.Tokens.Now = func() time.Time { return now }
+
+	u := createTestUser(t, us, ctx, "ada@example.com")
+
+	enrollment, err := us.EnrollMFA(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := func(at time.Time) string {
+		return us.TOTP.Code(secret, us.TOTP.Step(at))
+	}
+
+	if _, _, err := us.ConfirmMFA(ctx, u.ID, code(now.Add(time.Hour))); err != user.ErrInvalidMFACode {
+		t.Fatalf("confirm with a code of a hour later = %v, want %v", err, user.ErrInvalidMFACode)
+	}
+
+	confirmed, recoveryCodes, err := us.ConfirmMFA(ctx, u.ID, code(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !confirmed.IsMFAEnabled() || len(recoveryCodes) != us.RecoveryCodes {
+		t.Fatalf("mfa enabled = %v with %v recovery codes", confirmed.IsMFAEnabled(), len(recoveryCodes))
+	}
+
+	auth, err := us.Authenticate(ctx, "ada@example.com", "correct horse battery staple", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !auth.MFARequired || auth.AccessToken != "" {
+		t.Fatalf("mfa required = %v, access token = %q", auth.MFARequired, auth.AccessToken)
+	}
+
+	// the code used to confirm can not be used again
+	if _, err := us.AuthenticateMFA(ctx, auth.MFAToken, code(now), ""); err != user.ErrInvalidMFACode {
+		t.Fatalf("authenticate with a used code = %v, want %v", err, user.ErrInvalidMFACode)
+	}
+
+	now = now.Add(30 * time.Second)
+
+	done, err := us.AuthenticateMFA(ctx, auth.MFAToken, code(now), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if done.AccessToken == "" {
+		t.Fatal("no access token after the second step")
+	}
+
+	// recovery codes work once
+	auth, err = us.Authenticate(ctx, "ada@example.com", "correct horse battery staple", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := us.AuthenticateMFA(ctx, auth.MFAToken, recoveryCodes[0], ""); err != nil {
+		t.Fatalf("authenticate with a recovery code: %v", err)
+	}
+
+	if _, err := us.AuthenticateMFA(ctx, auth.MFAToken, recoveryCodes[0], ""); err != user.ErrInvalidMFACode {
+		t.Fatalf("authenticate with a used recovery code = %v, want %v", err, user.ErrInvalidMFACode)
+	}
+
+	// the second step must be completed before the mfa token expires
+	now = now.Add(us.Tokens.MFATTL + time.Minute)
+
+	if _, err := us.AuthenticateMFA(ctx, auth.MFAToken, code(now), ""); err != user.ErrInvalidCredentials {
+		t.Fatalf("authenticate with a expired mfa token = %v, want %v", err, user.ErrInvalidCredentials)
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/actor"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+// DefaultInvitationTTL is the time a invitation can be accepted
+const DefaultInvitationTTL = 7 * 24 * time.Hour
+
+// CreateOrganization creates the organization with the given user as its owner
+func (us *Users) CreateOrganization(ctx context.Context, o *user.Organization, ownerID string) error {
+	if _, err := us.Store.GetByID(ctx, ownerID); err != nil {
+		return err
+	}
+
+	// organizations are global, the caller becomes owner of a new tenant
+	return us.Store.CreateOrganization(tenant.WithSystem(ctx), o, ownerID)
+}
+
+// GetOrganization ...
+func (us *Users) GetOrganization(ctx context.Context, id string) (*user.Organization, error) {
+	ctx, err := tenant.Narrow(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return us.Store.GetOrganization(ctx, id)
+}
+
+// ListOrganizations ...
+func (us *Users) ListOrganizations(ctx context.Context, userID string) ([]*user.Organization, error) {
+	return us.Store.ListOrganizations(ctx, userID)
+}
+
+// GetMemberByEmail returns the user with the email only if it belongs to the organization
+func (us *Users) GetMemberByEmail(ctx context.Context, orgID, email string) (*user.User, error) {
+	ctx, err := tenant.Narrow(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return us.GetByEmail(ctx, email)
+}
+
+// SetMemberRole ...
+func (us *Users) SetMemberRole(ctx context.Context, orgID, userID, role string) (*user.Membership, error) {
+	if !user.IsValidOrgRole(role) {
+		return nil, user.ErrInvalidOrgRole
+	}
+
+	if err := us.authorizeMembers(ctx, orgID, userID, role); err != nil {
+		return nil, err
+	}
+
+	ctx, err := tenant.Narrow(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return us.Store.SetMemberRole(ctx, orgID, userID, role)
+}
+
+// RemoveMember ...
+func (us *Users) RemoveMember(ctx context.Context, orgID, userID string) error {
+	if err := us.authorizeMembers(ctx, orgID, userID, ""); err != nil {
+		return err
+	}
+
+	ctx, err := tenant.Narrow(ctx, orgID)
+	if err != nil {
+		return err
+	}
+
+	return us.Store.RemoveMember(ctx, orgID, userID)
+}
+
+// InviteMember sends a invitation to join the organization to the email, on
+// behalf of the acting user
+func (us *Users) InviteMember(ctx context.Context, orgID, email, role string) (*user.Invitation, error) {
+	if role == "" {
+		role = user.OrgRoleMember
+	}
+
+	if !user.IsValidOrgRole(role) {
+		return nil, user.ErrInvalidOrgRole
+	}
+
+	if err := us.authorizeMembers(ctx, orgID, "", role); err != nil {
+		return nil, err
+	}
+
+	ctx, err := tenant.Narrow(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := us.Store.GetOrganization(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &user.Invitation{
+		OrganizationID: org.ID,
+		Email:          strings.ToLower(email),
+		Role:           role,
+		TokenHash:      hash,
+		ExpiresAt:      time.Now().Add(us.InvitationTTL),
+	}
+
+	if invitedBy := actor.FromContext(ctx).UserID; invitedBy != "" {
+		inv.InvitedBy = &invitedBy
+	}
+
+	if err := us.Store.CreateInvitation(ctx, inv); err != nil {
+		return nil, err
+	}
+
+	if us.Notifier != nil {
+		if err := us.Notifier.SendInvitation(inv, org, token); err != nil {
+			return nil, err
+		}
+	}
+
+	return inv, nil
+}
+
+// AcceptInvitation adds the user to the organization of the invitation
+func (us *Users) AcceptInvitation(ctx context.Context, token, userID string) (*user.Membership, error) {
+	// the user is not a member of the organization yet, so no tenant can see
+	// both rows. The token and the invited email are what bind them.
+	return us.Store.AcceptInvitation(tenant.WithSystem(ctx), hashToken(token), userID)
+}
+
+// authorizeMembers fails with user.ErrPermissionDenied unless the acting user
+// is a owner or admin of the organization. Giving the owner role to userID,
+// or changing a member that is a owner, takes a owner. A empty role removes
+// the member and a empty userID is a new member. Contexts without a acting
+// user are only allowed in the system scope.
+func (us *Users) authorizeMembers(ctx context.Context, orgID, userID, role string) error {
+	actorID := actor.FromContext(ctx).UserID
+	if actorID == "" {
+		if tenant.IsSystem(ctx) {
+			return nil
+		}
+		return user.ErrPermissionDenied
+	}
+
+	ctx, err := tenant.Narrow(ctx, orgID)
+	if err != nil {
+		return err
+	}
+
+	m, err := us.Store.GetMembership(ctx, orgID, actorID)
+	if err == user.ErrNotMember {
+		return user.ErrPermissionDenied
+	} else if err != nil {
+		return err
+	}
+
+	switch m.Role {
+	case user.OrgRoleOwner:
+		return nil
+	case user.OrgRoleAdmin:
+		if role == user.OrgRoleOwner {
+			return user.ErrPermissionDenied
+		}
+	default:
+		return user.ErrPermissionDenied
+	}
+
+	if userID == "" {
+		return nil
+	}
+
+	target, err := us.Store.GetMembership(ctx, orgID, userID)
+	if err == user.ErrNotMember {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if target.Role == user.OrgRoleOwner {
+		return user.ErrPermissionDenied
+	}
+
+	return nil
+}
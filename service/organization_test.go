@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/actor"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+func TestOnlyOwnersAndAdminsChangeMembers(t *testing.T) {
+	us, ctx := newTestUsers(t)
+
+	owner := createTestUser(t, us, ctx, "owner@example.com")
+	stranger := createTestUser(t, us, ctx, "stranger@example.com")
+
+	org := &user.Organization{Name: "Acme", Slug: "acme"}
+	if err := us.CreateOrganization(ctx, org, owner.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	inOrg := tenant.WithID(context.Background(), org.ID)
+	admin := createTestUser(t, us, inOrg, "admin@example.com")
+	member := createTestUser(t, us, inOrg, "member@example.com")
+	target := createTestUser(t, us, inOrg, "target@example.com")
+
+	// in-process callers run in the system scope without a actor
+	if _, err := us.SetMemberRole(ctx, org.ID, admin.ID, user.OrgRoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	as := func(u *user.User) context.Context {
+		return actor.With(inOrg, actor.Actor{UserID: u.ID})
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		call func(ctx context.Context) error
+		err  error
+	}{
+		{"member invites", as(member), func(ctx context.Context) error {
+			_, err := us.InviteMember(ctx, org.ID, "grace@example.com", user.OrgRoleMember)
+			return err
+		}, user.ErrPermissionDenied},
+		{"member changes a role", as(member), func(ctx context.Context) error {
+			_, err := us.SetMemberRole(ctx, org.ID, member.ID, user.OrgRoleOwner)
+			return err
+		}, user.ErrPermissionDenied},
+		{"member removes", as(member), func(ctx context.Context) error { return us.RemoveMember(ctx, org.ID, target.ID) }, user.ErrPermissionDenied},
+		{"stranger invites", actor.With(ctx, actor.Actor{UserID: stranger.ID}), func(ctx context.Context) error {
+			_, err := us.InviteMember(ctx, org.ID, "grace@example.com", user.OrgRoleMember)
+			return err
+		}, user.ErrPermissionDenied},
+		{"admin invites a owner", as(admin), func(ctx context.Context) error {
+			_, err := us.InviteMember(ctx, org.ID, "grace@example.com", user.OrgRoleOwner)
+			return err
+		}, user.ErrPermissionDenied},
+		{"admin promotes to owner", as(admin), func(ctx context.Context) error {
+			_, err := us.SetMemberRole(ctx, org.ID, admin.ID, user.OrgRoleOwner)
+			return err
+		}, user.ErrPermissionDenied},
+		{"admin demotes the owner", as(admin), func(ctx context.Context) error {
+			_, err := us.SetMemberRole(ctx, org.ID, owner.ID, user.OrgRoleMember)
+			return err
+		}, user.ErrPermissionDenied},
+		{"admin removes the owner", as(admin), func(ctx context.Context) error { return us.RemoveMember(ctx, org.ID, owner.ID) }, user.ErrPermissionDenied},
+		{"admin invites", as(admin), func(ctx context.Context) error {
+			_, err := us.InviteMember(ctx, org.ID, "grace@example.com", user.OrgRoleMember)
+			return err
+		}, nil},
+		{"admin promotes to admin", as(admin), func(ctx context.Context) error {
+			_, err := us.SetMemberRole(ctx, org.ID, member.ID, user.OrgRoleAdmin)
+			return err
+		}, nil},
+		{"admin removes", as(admin), func(ctx context.Context) error { return us.RemoveMember(ctx, org.ID, target.ID) }, nil},
+		{"last owner demotes themselves", as(owner), func(ctx context.Context) error {
+			_, err := us.SetMemberRole(ctx, org.ID, owner.ID, user.OrgRoleAdmin)
+			return err
+		}, user.ErrLastOwner},
+		{"last owner leaves", as(owner), func(ctx context.Context) error { return us.RemoveMember(ctx, org.ID, owner.ID) }, user.ErrLastOwner},
+		{"owner removes a admin", as(owner), func(ctx context.Context) error { return us.RemoveMember(ctx, org.ID, admin.ID) }, nil},
+	}
+
+	for _, tt := range tests {
+		if err := tt.call(tt.ctx); err != tt.err {
+			t.Errorf("%v = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestInvitationsAreSentByTheActor(t *testing.T) {
+	us, ctx := newTestUsers(t)
+
+	owner := createTestUser(t, us, ctx, "owner@example.com")
+
+	org := &user.Organization{Name: "Acme", Slug: "acme"}
+	if err := us.CreateOrganization(ctx, org, owner.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := us.InviteMember(actor.With(ctx, actor.Actor{UserID: owner.ID}), org.ID, "grace@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inv.InvitedBy == nil || *inv.InvitedBy != owner.ID {
+		t.Fatalf("invited by = %v, want %v", inv.InvitedBy, owner.ID)
+	}
+}
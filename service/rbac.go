@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/actor"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+// ListRoles ...
+func (us *Users) ListRoles(ctx context.Context) ([]*user.Role, error) {
+	return us.Store.ListRoles(ctx)
+}
+
+// AssignRole ...
+func (us *Users) AssignRole(ctx context.Context, userID, role string) (*user.User, error) {
+	if err := us.authorize(ctx, user.PermissionAssignRoles); err != nil {
+		return nil, err
+	}
+
+	u, err := us.Store.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := us.Store.AssignRole(ctx, u.ID, role); err != nil {
+		return nil, err
+	}
+
+	return u, us.loadRoles(ctx, u)
+}
+
+// RevokeRole ...
+func (us *Users) RevokeRole(ctx context.Context, userID, role string) (*user.User, error) {
+	if err := us.authorize(ctx, user.PermissionAssignRoles); err != nil {
+		return nil, err
+	}
+
+	u, err := us.Store.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := us.Store.RevokeRole(ctx, u.ID, role); err != nil {
+		return nil, err
+	}
+
+	return u, us.loadRoles(ctx, u)
+}
+
+// CheckPermission reports whether any role of the user grants the permission
+func (us *Users) CheckPermission(ctx context.Context, userID, permission string) (bool, error) {
+	return us.Store.HasPermission(ctx, userID, permission)
+}
+
+// authorize fails with user.ErrPermissionDenied unless a role of the acting
+// user grants the permission. Contexts without a acting user are only
+// allowed in the system scope, which is kept for in-process callers.
+func (us *Users) authorize(ctx context.Context, permission string) error {
+	userID := actor.FromContext(ctx).UserID
+	if userID == "" {
+		if tenant.IsSystem(ctx) {
+			return nil
+		}
+		return user.ErrPermissionDenied
+	}
+
+	allowed, err := us.Store.HasPermission(ctx, userID, permission)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		return user.ErrPermissionDenied
+	}
+
+	return nil
+}
+
+// authorizeWrite is authorize for a change to the user, the acting user can
+// also change themselves with user.PermissionWriteProfile
+func (us *Users) authorizeWrite(ctx context.Context, userID string) error {
+	if a := actor.FromContext(ctx).UserID; a != "" && a == userID {
+		if err := us.authorize(ctx, user.PermissionWriteProfile); err != user.ErrPermissionDenied {
+			return err
+		}
+	}
+
+	return us.authorize(ctx, user.PermissionWriteUsers)
+}
+
+// loadRoles fills the roles of the users with a single query
+func (us *Users) loadRoles(ctx context.Context, uu ...*user.User) error {
+	ids := make([]string, 0, len(uu))
+	for _, u := range uu {
+		ids = append(ids, u.ID)
+	}
+
+	roles, err := us.Store.GetUserRoles(ctx, ids...)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range uu {
+		u.Roles = roles[u.ID]
+		if u.Roles == nil {
+			u.Roles = []string{}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/actor"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+func TestCreateAssignsTheDefaultRole(t *testing.T) {
+	us, ctx := newTestUsers(t)
+
+	u := createTestUser(t, us, ctx, "ada@example.com")
+	if len(u.Roles) != 1 || u.Roles[0] != user.DefaultRole {
+		t.Fatalf("roles = %v, want [%v]", u.Roles, user.DefaultRole)
+	}
+
+	stored, err := us.GetByID(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stored.Roles) != 1 || stored.Roles[0] != user.DefaultRole {
+		t.Fatalf("stored roles = %v, want [%v]", stored.Roles, user.DefaultRole)
+	}
+
+	grace := &user.User{Email: "grace@example.com", Name: "Grace", LastName: "Hopper", Password: "correct horse battery staple"}
+
+	errs, err := us.BatchCreateUsers(ctx, []*user.User{grace}, false)
+	if err != nil || errs[0] != nil {
+		t.Fatalf("batch create = %v, %v", errs, err)
+	}
+
+	roles, err := us.Store.GetUserRoles(ctx, grace.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(roles[grace.ID]) != 1 || roles[grace.ID][0] != user.DefaultRole {
+		t.Fatalf("batch roles = %v, want [%v]", roles[grace.ID], user.DefaultRole)
+	}
+}
+
+func TestPermissionsAreCheckedAgainstTheActor(t *testing.T) {
+	us, ctx := newTestUsers(t)
+
+	admin := createTestUser(t, us, ctx, "admin@example.com")
+	support := createTestUser(t, us, ctx, "support@example.com")
+	member := createTestUser(t, us, ctx, "member@example.com")
+	target := createTestUser(t, us, ctx, "target@example.com")
+
+	// in-process callers run in the system scope without a actor
+	if _, err := us.AssignRole(ctx, admin.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := us.AssignRole(ctx, support.ID, "support"); err != nil {
+		t.Fatal(err)
+	}
+
+	as := func(u *user.User) context.Context {
+		return actor.With(ctx, actor.Actor{UserID: u.ID})
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		call func(ctx context.Context) error
+		err  error
+	}{
+		{"member assigns", as(member), func(ctx context.Context) error { _, err := us.AssignRole(ctx, member.ID, "admin"); return err }, user.ErrPermissionDenied},
+		{"member revokes", as(member), func(ctx context.Context) error { _, err := us.RevokeRole(ctx, target.ID, user.DefaultRole); return err }, user.ErrPermissionDenied},
+		{"member unlocks", as(member), func(ctx context.Context) error { _, err := us.Unlock(ctx, target.ID); return err }, user.ErrPermissionDenied},
+		{"member resets mfa", as(member), func(ctx context.Context) error { _, err := us.ResetMFA(ctx, target.ID); return err }, user.ErrPermissionDenied},
+		{"support assigns", as(support), func(ctx context.Context) error { _, err := us.AssignRole(ctx, support.ID, "admin"); return err }, user.ErrPermissionDenied},
+		{"support unlocks", as(support), func(ctx context.Context) error { _, err := us.Unlock(ctx, target.ID); return err }, nil},
+		{"support resets mfa", as(support), func(ctx context.Context) error { _, err := us.ResetMFA(ctx, target.ID); return err }, nil},
+		{"admin assigns", as(admin), func(ctx context.Context) error { _, err := us.AssignRole(ctx, target.ID, "support"); return err }, nil},
+		{"admin revokes", as(admin), func(ctx context.Context) error { _, err := us.RevokeRole(ctx, target.ID, "support"); return err }, nil},
+		{"member updates another user", as(member), func(ctx context.Context) error {
+			return us.Update(ctx, &user.User{ID: target.ID, Password: "attacker chosen passphrase"})
+		}, user.ErrPermissionDenied},
+		{"member changes the email of another user", as(member), func(ctx context.Context) error {
+			_, err := us.RequestEmailChange(ctx, target, "mallory@example.com")
+			return err
+		}, user.ErrPermissionDenied},
+		{"member deletes another user", as(member), func(ctx context.Context) error { return us.Delete(ctx, target.ID) }, user.ErrPermissionDenied},
+		{"member deletes themselves", as(member), func(ctx context.Context) error { return us.Delete(ctx, member.ID) }, user.ErrPermissionDenied},
+		{"member restores", as(member), func(ctx context.Context) error { _, err := us.Restore(ctx, target.ID); return err }, user.ErrPermissionDenied},
+		{"support updates another user", as(support), func(ctx context.Context) error { return us.Update(ctx, &user.User{ID: target.ID, Name: "Grace"}) }, user.ErrPermissionDenied},
+		{"member updates themselves", as(member), func(ctx context.Context) error { return us.Update(ctx, &user.User{ID: member.ID, Name: "Grace"}) }, nil},
+		{"admin updates another user", as(admin), func(ctx context.Context) error { return us.Update(ctx, &user.User{ID: target.ID, Name: "Grace"}) }, nil},
+		{"admin deletes", as(admin), func(ctx context.Context) error { return us.Delete(ctx, target.ID) }, nil},
+		{"admin restores", as(admin), func(ctx context.Context) error { _, err := us.Restore(ctx, target.ID); return err }, nil},
+	}
+
+	for _, tt := range tests {
+		if err := tt.call(tt.ctx); err != tt.err {
+			t.Errorf("%v = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	noActor := actor.With(context.Background(), actor.Actor{})
+	if _, err := us.Unlock(noActor, target.ID); err != user.ErrPermissionDenied {
+		t.Errorf("unlock without a actor outside the system scope = %v, want %v", err, user.ErrPermissionDenied)
+	}
+}
+
+func TestWebhooksTakeThePermissionToWriteThem(t *testing.T) {
+	us, ctx := newTestUsers(t)
+	us.WebhookCipher = us.Cipher
+
+	owner := createTestUser(t, us, ctx, "owner@example.com")
+
+	org := &user.Organization{Name: "Acme", Slug: "acme"}
+	if err := us.CreateOrganization(ctx, org, owner.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	inOrg := actor.With(tenant.WithID(context.Background(), org.ID), actor.Actor{UserID: owner.ID})
+
+	hook := &user.Webhook{OrganizationID: org.ID, URL: "https://hooks.acme.test"}
+	if _, err := us.CreateWebhook(inOrg, hook); err != user.ErrPermissionDenied {
+		t.Fatalf("CreateWebhook without the permission = %v, want %v", err, user.ErrPermissionDenied)
+	}
+
+	if _, err := us.CreateWebhook(ctx, hook); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := us.UpdateWebhook(inOrg, &user.Webhook{ID: hook.ID}); err != user.ErrPermissionDenied {
+		t.Fatalf("UpdateWebhook without the permission = %v, want %v", err, user.ErrPermissionDenied)
+	}
+
+	if err := us.DeleteWebhook(inOrg, hook.ID); err != user.ErrPermissionDenied {
+		t.Fatalf("DeleteWebhook without the permission = %v, want %v", err, user.ErrPermissionDenied)
+	}
+
+	if _, err := us.ReplayWebhookDelivery(inOrg, "00000000-0000-0000-0000-000000000000"); err != user.ErrPermissionDenied {
+		t.Fatalf("ReplayWebhookDelivery without the permission = %v, want %v", err, user.ErrPermissionDenied)
+	}
+
+	// admins of the organization manage its webhooks
+	if err := us.Store.AssignRole(tenant.WithID(ctx, org.ID), owner.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := us.UpdateWebhook(inOrg, &user.Webhook{ID: hook.ID, Active: false}); err != nil {
+		t.Fatalf("UpdateWebhook with the permission = %v", err)
+	}
+
+	if err := us.DeleteWebhook(inOrg, hook.ID); err != nil {
+		t.Fatalf("DeleteWebhook with the permission = %v", err)
+	}
+}
@@ -1,43 +1,344 @@
 package service
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"time"
+
 	user "github.com/frperezr/microservices-demo/src/users-api"
 	"github.com/frperezr/microservices-demo/src/users-api/database"
+	"github.com/frperezr/microservices-demo/src/users-api/encryption"
+	"github.com/frperezr/microservices-demo/src/users-api/password"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/frperezr/microservices-demo/src/users-api/token"
+	"github.com/frperezr/microservices-demo/src/users-api/totp"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// DefaultVerificationTTL is the time a email verification token is valid
+	DefaultVerificationTTL = 24 * time.Hour
+
+	// DefaultEmailChangeTTL is the time a email change can be confirmed
+	DefaultEmailChangeTTL = 24 * time.Hour
+
+	// DefaultEmailChangeRevertTTL is the time a email change can be reverted from the old address
+	DefaultEmailChangeRevertTTL = 7 * 24 * time.Hour
 )
 
 // New ...
-func New(store database.Store) *Users {
+func New(store database.Store, notifier user.Notifier) *Users {
 	return &Users{
-		Store: store,
+		Store:                store,
+		Groups:               store,
+		Notifier:             notifier,
+		VerificationTTL:      DefaultVerificationTTL,
+		EmailChangeTTL:       DefaultEmailChangeTTL,
+		EmailChangeRevertTTL: DefaultEmailChangeRevertTTL,
+		TOTP:                 totp.New("users-api"),
+		RecoveryCodes:        DefaultRecoveryCodes,
+		AccountLockout:       DefaultAccountLockout,
+		IPLockout:            DefaultIPLockout,
+		PasswordPolicy:       password.DefaultPolicy(),
+		InvitationTTL:        DefaultInvitationTTL,
+		WatchInterval:        DefaultWatchInterval,
 	}
 }
 
 // Users ...
 type Users struct {
-	Store database.Store
+	Store                database.Store
+	Groups               database.GroupStore
+	Notifier             user.Notifier
+	VerificationTTL      time.Duration
+	EmailChangeTTL       time.Duration
+	EmailChangeRevertTTL time.Duration
+	InvitationTTL        time.Duration
+
+	Tokens        *token.Issuer
+	TOTP          *totp.TOTP
+	Cipher        *encryption.AESGCM
+	RecoveryCodes int
+
+	// WebhookCipher encrypts the signing secrets of the webhooks, its key is
+	// not the one of Cipher so a leak of one does not expose the other
+	WebhookCipher *encryption.AESGCM
+
+	AccountLockout user.LockoutPolicy
+	IPLockout      user.LockoutPolicy
+
+	PasswordPolicy *password.Policy
+
+	// Notifications wakes up WatchUsers on new events, without it the
+	// outbox is read every WatchInterval
+	Notifications database.Notifications
+	WatchInterval time.Duration
 }
 
 // GetByID ...
-func (us *Users) GetByID(id string) (*user.User, error) {
-	return us.Store.GetByID(id)
+func (us *Users) GetByID(ctx context.Context, id string) (*user.User, error) {
+	u, err := us.Store.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return u, us.loadRoles(ctx, u)
+}
+
+// GetByIDs returns the users found with the ids, in any order
+func (us *Users) GetByIDs(ctx context.Context, ids []string) ([]*user.User, error) {
+	uu, err := us.Store.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return uu, us.loadRoles(ctx, uu...)
 }
 
 // GetByEmail ...
-func (us *Users) GetByEmail(email string) (*user.User, error) {
-	return us.Store.GetByEmail(email)
+func (us *Users) GetByEmail(ctx context.Context, email string) (*user.User, error) {
+	u, err := us.Store.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return u, us.loadRoles(ctx, u)
 }
 
 // Create ...
-func (us *Users) Create(u *user.User) error {
-	return us.Store.Create(u)
+func (us *Users) Create(ctx context.Context, u *user.User) error {
+	if err := us.validatePassword(u.Password, u); err != nil {
+		return err
+	}
+
+	if err := hashPassword(u); err != nil {
+		return err
+	}
+
+	if err := us.Store.Create(ctx, u); err != nil {
+		return err
+	}
+
+	// the user can always ask for a new token, so a failed delivery must not fail the creation
+	if err := us.sendEmailVerification(ctx, u); err != nil {
+		log.Println(fmt.Sprintf("[Users][Create][Error] sending email verification: %v", err))
+	}
+
+	return nil
 }
 
-// Update ...
-func (us *Users) Update(u *user.User) error {
-	return us.Store.Update(u)
+// Update applies the fields set in u to the user, except for the email which
+// can only be changed through RequestEmailChange. u.Password is the new
+// password in plain text, u is filled with the updated user.
+func (us *Users) Update(ctx context.Context, u *user.User) error {
+	if err := us.authorizeWrite(ctx, u.ID); err != nil {
+		return err
+	}
+
+	prev, err := us.Store.GetByID(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+
+	u.Email = prev.Email
+
+	if u.Password != "" {
+		if err := us.validatePassword(u.Password, prev); err != nil {
+			return err
+		}
+
+		if err := hashPassword(u); err != nil {
+			return err
+		}
+	}
+
+	return us.Store.Update(ctx, u)
 }
 
 // Delete ...
-func (us *Users) Delete(id string) error {
-	return us.Store.Delete(id)
+func (us *Users) Delete(ctx context.Context, id string) error {
+	if err := us.authorize(ctx, user.PermissionDeleteUsers); err != nil {
+		return err
+	}
+
+	return us.Store.Delete(ctx, id)
+}
+
+// Restore ...
+func (us *Users) Restore(ctx context.Context, id string) (*user.User, error) {
+	if err := us.authorize(ctx, user.PermissionDeleteUsers); err != nil {
+		return nil, err
+	}
+
+	u, err := us.Store.Restore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return u, us.loadRoles(ctx, u)
+}
+
+// List ...
+func (us *Users) List(ctx context.Context, opts *user.ListOptions) ([]*user.User, error) {
+	if opts != nil {
+		var err error
+		if ctx, err = tenant.Narrow(ctx, opts.OrganizationID); err != nil {
+			return nil, err
+		}
+	}
+
+	uu, err := us.Store.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return uu, us.loadRoles(ctx, uu...)
+}
+
+// VerifyEmail ...
+func (us *Users) VerifyEmail(ctx context.Context, token string) (*user.User, error) {
+	return us.Store.VerifyEmail(ctx, hashToken(token))
+}
+
+// ResendVerification ...
+func (us *Users) ResendVerification(ctx context.Context, email string) error {
+	u, err := us.Store.GetByEmail(ctx, strings.ToLower(email))
+	if err != nil {
+		return err
+	}
+
+	if u.IsEmailVerified() {
+		return user.ErrEmailAlreadyVerified
+	}
+
+	return us.sendEmailVerification(ctx, u)
+}
+
+// validatePassword returns a *user.ValidationError listing every rule of the policy the password breaks
+func (us *Users) validatePassword(password string, u *user.User) error {
+	if us.PasswordPolicy == nil {
+		return nil
+	}
+
+	if violations := us.PasswordPolicy.Validate(password, u); len(violations) > 0 {
+		return &user.ValidationError{Violations: violations}
+	}
+
+	return nil
+}
+
+func (us *Users) sendEmailVerification(ctx context.Context, u *user.User) error {
+	token, hash, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	v := &user.EmailVerification{
+		UserID:    u.ID,
+		Email:     u.Email,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(us.VerificationTTL),
+	}
+
+	if err := us.Store.CreateEmailVerification(ctx, v); err != nil {
+		return err
+	}
+
+	if us.Notifier == nil {
+		return nil
+	}
+
+	return us.Notifier.SendEmailVerification(u, token)
+}
+
+// RequestEmailChange stages the change of the email of the user, it is applied
+// once the token sent to the new address is confirmed.
+func (us *Users) RequestEmailChange(ctx context.Context, u *user.User, email string) (*user.EmailChange, error) {
+	if err := us.authorizeWrite(ctx, u.ID); err != nil {
+		return nil, err
+	}
+
+	email = strings.ToLower(email)
+
+	if _, err := us.Store.GetByEmail(ctx, email); err == nil {
+		return nil, user.ErrEmailTaken
+	} else if err.Error() != "sql: no rows in result set" {
+		return nil, err
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	revertToken, revertHash, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	c := &user.EmailChange{
+		UserID:          u.ID,
+		OldEmail:        u.Email,
+		NewEmail:        email,
+		TokenHash:       hash,
+		RevertTokenHash: revertHash,
+		ExpiresAt:       now.Add(us.EmailChangeTTL),
+		RevertExpiresAt: now.Add(us.EmailChangeRevertTTL),
+	}
+
+	if err := us.Store.CreateEmailChange(ctx, c); err != nil {
+		return nil, err
+	}
+
+	if us.Notifier != nil {
+		if err := us.Notifier.SendEmailChangeConfirmation(u, email, token); err != nil {
+			return nil, err
+		}
+
+		if err := us.Notifier.SendEmailChangeNotice(u, email, revertToken); err != nil {
+			log.Println(fmt.Sprintf("[Users][RequestEmailChange][Error] sending email change notice: %v", err))
+		}
+	}
+
+	return c, nil
+}
+
+// ConfirmEmailChange ...
+func (us *Users) ConfirmEmailChange(ctx context.Context, token string) (*user.User, error) {
+	return us.Store.ConfirmEmailChange(ctx, hashToken(token))
+}
+
+// RevertEmailChange ...
+func (us *Users) RevertEmailChange(ctx context.Context, token string) (*user.User, error) {
+	return us.Store.RevertEmailChange(ctx, hashToken(token))
+}
+
+// hashPassword replaces the password of the user with its hash, see password.Hash
+func hashPassword(u *user.User) error {
+	hash, err := password.Hash(u.Password)
+	if err != nil {
+		return err
+	}
+
+	u.Password = hash
+	return nil
+}
+
+// hashPasswords hashes the passwords of the users in parallel, bcrypt is slow on purpose
+func hashPasswords(ctx context.Context, uu []*user.User) error {
+	g, _ := errgroup.WithContext(ctx)
+	g.SetLimit(runtime.GOMAXPROCS(0))
+
+	for _, u := range uu {
+		u := u
+		g.Go(func() error {
+			return hashPassword(u)
+		})
+	}
+
+	return g.Wait()
 }
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/database/sqlite"
+	"github.com/frperezr/microservices-demo/src/users-api/encryption"
+	"github.com/frperezr/microservices-demo/src/users-api/notifier"
+	"github.com/frperezr/microservices-demo/src/users-api/password"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"github.com/frperezr/microservices-demo/src/users-api/token"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestUsers returns the service on a new SQLite database and a context
+// in the system scope
+func newTestUsers(t *testing.T) (*Users, context.Context) {
+	t.Helper()
+
+	password.HashCost = bcrypt.MinCost
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Store.Close() })
+
+	cipher, err := encryption.NewAESGCM(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	us := New(store, notifier.NewLog("http://localhost"))
+	us.Tokens = token.NewIssuer("users-api", []byte("secret"))
+	us.Cipher = cipher
+
+	return us, tenant.WithSystem(context.Background())
+}
+
+// createTestUser creates a user with the password "correct horse battery staple"
+func createTestUser(t *testing.T, us *Users, ctx context.Context, email string) *user.User {
+	t.Helper()
+
+	u := &user.User{Email: email, Name: "Ada", LastName: "Lovelace", Password: "correct horse battery staple"}
+	if err := us.Create(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+
+	return u
+}
+
+func TestCreateHashesThePassword(t *testing.T) {
+	us, ctx := newTestUsers(t)
+
+	u := createTestUser(t, us, ctx, "ada@example.com")
+
+	stored, err := us.Store.GetByID(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Password == "correct horse battery staple" || !password.Matches(stored.Password, "correct horse battery staple") {
+		t.Fatalf("stored password = %v, want the hash of the password", stored.Password)
+	}
+
+	if u.ToProto().Password != "" {
+		t.Error("the password is returned")
+	}
+
+	if _, err := us.Authenticate(ctx, "ada@example.com", "correct horse battery staple", "", ""); err != nil {
+		t.Errorf("authenticate: %v", err)
+	}
+
+	if _, err := us.Authenticate(ctx, "ada@example.com", stored.Password, "", ""); err != user.ErrInvalidCredentials {
+		t.Errorf("authenticate with the hash = %v, want %v", err, user.ErrInvalidCredentials)
+	}
+}
+
+func TestUpdateHashesThePassword(t *testing.T) {
+	us, ctx := newTestUsers(t)
+
+	u := createTestUser(t, us, ctx, "ada@example.com")
+
+	if err := us.Update(ctx, &user.User{ID: u.ID, Name: "Ada", LastName: "Lovelace", Password: "analytical engine notes"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := us.Authenticate(ctx, "ada@example.com", "analytical engine notes", "", ""); err != nil {
+		t.Errorf("authenticate with the new password: %v", err)
+	}
+
+	if _, err := us.Authenticate(ctx, "ada@example.com", "correct horse battery staple", "", ""); err != user.ErrInvalidCredentials {
+		t.Errorf("authenticate with the old password = %v, want %v", err, user.ErrInvalidCredentials)
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+)
+
+const (
+	// DefaultWatchInterval is the time between reads of the outbox when no notification arrives
+	DefaultWatchInterval = 5 * time.Second
+
+	// DefaultWatchBatchSize is the number of events read from the outbox at once
+	DefaultWatchBatchSize = 100
+)
+
+// EventsHead returns the position of the last event, WatchUsers from it only
+// sends the events that come after
+func (us *Users) EventsHead(ctx context.Context) (int64, int64, error) {
+	return us.Store.EventsHead(ctx)
+}
+
+// WatchUsers sends the events matching the filter to fn, starting after
+// filter.AfterTxID and filter.AfterID, until the context is canceled or fn fails.
+func (us *Users) WatchUsers(ctx context.Context, filter *user.EventFilter, fn func(*user.Event) error) error {
+	f := *filter
+	if f.Limit == 0 {
+		f.Limit = DefaultWatchBatchSize
+	}
+
+	var wake <-chan struct{}
+	if us.Notifications != nil {
+		ch, cancel := us.Notifications.Subscribe()
+		defer cancel()
+		wake = ch
+	}
+
+	interval := us.WatchInterval
+	if interval == 0 {
+		interval = DefaultWatchInterval
+	}
+
+	for {
+		ee, err := us.Store.ListEvents(ctx, &f)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range ee {
+			if err := fn(e); err != nil {
+				return err
+			}
+			f.AfterTxID, f.AfterID = e.TxID, e.ID
+		}
+
+		if uint64(len(ee)) == f.Limit {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wake:
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+// CreateWebhook subscribes the url to the events of the members of the
+// organization, returning the signing secret which is only shown once.
+// New webhooks are active, UpdateWebhook pauses them.
+func (us *Users) CreateWebhook(ctx context.Context, w *user.Webhook) (string, error) {
+	if err := validateWebhookURL(w.URL); err != nil {
+		return "", err
+	}
+
+	if err := us.authorize(ctx, user.PermissionWriteWebhooks); err != nil {
+		return "", err
+	}
+
+	ctx, err := tenant.Narrow(ctx, w.OrganizationID)
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	secret := "whsec_" + hex.EncodeToString(b)
+
+	encrypted, err := us.WebhookCipher.Encrypt([]byte(secret))
+	if err != nil {
+		return "", err
+	}
+	w.Secret = encrypted
+	w.Active = true
+
+	if err := us.Store.CreateWebhook(ctx, w); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// GetWebhook ...
+func (us *Users) GetWebhook(ctx context.Context, id string) (*user.Webhook, error) {
+	return us.Store.GetWebhook(ctx, id)
+}
+
+// ListWebhooks ...
+func (us *Users) ListWebhooks(ctx context.Context, orgID string) ([]*user.Webhook, error) {
+	ctx, err := tenant.Narrow(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return us.Store.ListWebhooks(ctx, orgID)
+}
+
+// UpdateWebhook ...
+func (us *Users) UpdateWebhook(ctx context.Context, w *user.Webhook) error {
+	if err := us.authorize(ctx, user.PermissionWriteWebhooks); err != nil {
+		return err
+	}
+
+	if w.URL != "" {
+		if err := validateWebhookURL(w.URL); err != nil {
+			return err
+		}
+	}
+
+	return us.Store.UpdateWebhook(ctx, w)
+}
+
+// DeleteWebhook ...
+func (us *Users) DeleteWebhook(ctx context.Context, id string) error {
+	if err := us.authorize(ctx, user.PermissionWriteWebhooks); err != nil {
+		return err
+	}
+
+	return us.Store.DeleteWebhook(ctx, id)
+}
+
+// ListWebhookDeliveries ...
+func (us *Users) ListWebhookDeliveries(ctx context.Context, webhookID, status string) ([]*user.WebhookDelivery, error) {
+	return us.Store.ListWebhookDeliveries(ctx, webhookID, status)
+}
+
+// ListWebhookAttempts ...
+func (us *Users) ListWebhookAttempts(ctx context.Context, deliveryID string) ([]*user.WebhookAttempt, error) {
+	return us.Store.ListWebhookAttempts(ctx, deliveryID)
+}
+
+// ReplayWebhookDelivery sends the delivery again, also when it succeeded or is dead
+func (us *Users) ReplayWebhookDelivery(ctx context.Context, id string) (*user.WebhookDelivery, error) {
+	if err := us.authorize(ctx, user.PermissionWriteWebhooks); err != nil {
+		return nil, err
+	}
+
+	return us.Store.ReplayWebhookDelivery(ctx, id)
+}
+
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return user.ErrInvalidWebhookURL
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrMissing is returned by the stores when the context has no tenant and is not a system context
+	ErrMissing = errors.New("missing tenant in context")
+
+	// ErrMismatch is returned when a request targets a tenant different from the one of the caller
+	ErrMismatch = errors.New("tenant mismatch")
+)
+
+type contextKey int
+
+const (
+	idKey contextKey = iota
+	systemKey
+)
+
+// WithID returns a context scoped to the organization with the given id
+func WithID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, systemKey, false)
+	return context.WithValue(ctx, idKey, id)
+}
+
+// WithSystem returns a context allowed to work across every tenant. It must
+// only be used for operations that are global by nature, like creating a
+// organization or requests of internal callers without a tenant.
+func WithSystem(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, idKey, "")
+	return context.WithValue(ctx, systemKey, true)
+}
+
+// FromContext returns the tenant of the context, if any
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(idKey).(string)
+	return id, ok && id != ""
+}
+
+// IsSystem reports whether the context was created with WithSystem
+func IsSystem(ctx context.Context) bool {
+	system, _ := ctx.Value(systemKey).(bool)
+	return system
+}
+
+// Narrow scopes the context to the given tenant, failing if it is already
+// scoped to a different one. A empty id returns the context as it is.
+func Narrow(ctx context.Context, id string) (context.Context, error) {
+	if id == "" {
+		return ctx, nil
+	}
+
+	if current, ok := FromContext(ctx); ok && current != id {
+		return nil, ErrMismatch
+	}
+
+	return WithID(ctx, id), nil
+}
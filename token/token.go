@@ -0,0 +1,123 @@
+package token
+
+import (
+	"errors"
+	"time"
+
+	user "github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultAccessTTL is the lifetime of the access tokens
+	DefaultAccessTTL = time.Hour
+
+	// DefaultMFATTL is the time the user has to complete the second authentication step
+	DefaultMFATTL = 5 * time.Minute
+
+	typeAccess = "access"
+	typeMFA    = "mfa"
+)
+
+// ErrInvalidToken is returned when a token can not be parsed, has a wrong signature or expired
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims ...
+type Claims struct {
+	Type  string   `json:"typ"`
+	Email string   `json:"email,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+
+	// Organization is the tenant the requests made with the token are scoped to
+	Organization string `json:"org,omitempty"`
+
+	jwt.RegisteredClaims
+}
+
+// Issuer signs and parses the tokens of the service using HMAC-SHA256
+type Issuer struct {
+	Name      string
+	Secret    []byte
+	AccessTTL time.Duration
+	MFATTL    time.Duration
+
+	// Now is the clock used to set and validate expirations, it can be replaced in tests
+	Now func() time.Time
+}
+
+// NewIssuer ...
+func NewIssuer(name string, secret []byte) *Issuer {
+	return &Issuer{
+		Name:      name,
+		Secret:    secret,
+		AccessTTL: DefaultAccessTTL,
+		MFATTL:    DefaultMFATTL,
+		Now:       time.Now,
+	}
+}
+
+// IssueAccess returns a token proving the user was fully authenticated, for
+// the organization orgID or none when it is empty
+func (i *Issuer) IssueAccess(u *user.User, orgID string) (string, time.Time, error) {
+	return i.issue(typeAccess, u, u.Roles, orgID, i.AccessTTL)
+}
+
+// IssueMFA returns a short lived token proving the user passed the password
+// check, the access token issued after it is for the same organization
+func (i *Issuer) IssueMFA(u *user.User, orgID string) (string, time.Time, error) {
+	return i.issue(typeMFA, u, nil, orgID, i.MFATTL)
+}
+
+// ParseAccess ...
+func (i *Issuer) ParseAccess(token string) (*Claims, error) {
+	return i.parse(typeAccess, token)
+}
+
+// ParseMFA ...
+func (i *Issuer) ParseMFA(token string) (*Claims, error) {
+	return i.parse(typeMFA, token)
+}
+
+func (i *Issuer) issue(typ string, u *user.User, roles []string, orgID string, ttl time.Duration) (string, time.Time, error) {
+	now := i.Now()
+	expiresAt := now.Add(ttl)
+
+	claims := &Claims{
+		Type:         typ,
+		Email:        u.Email,
+		Roles:        roles,
+		Organization: orgID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    i.Name,
+			Subject:   u.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(i.Secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signed, expiresAt, nil
+}
+
+func (i *Issuer) parse(typ string, token string) (*Claims, error) {
+	claims := &Claims{}
+
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return i.Secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(i.Name),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(i.Now),
+	)
+
+	if err != nil || claims.Type != typ {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,127 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDigits is the length of the generated codes
+	DefaultDigits = 6
+
+	// DefaultPeriod is the time step of RFC 6238
+	DefaultPeriod = 30 * time.Second
+
+	// DefaultSkew is the number of steps accepted before and after the current one
+	DefaultSkew = 1
+
+	secretSize = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP generates and validates RFC 6238 time based one-time passwords using HMAC-SHA1
+type TOTP struct {
+	Issuer string
+	Digits int
+	Period time.Duration
+	Skew   int64
+
+	// Now is the clock used to compute the current step, it can be replaced in tests
+	Now func() time.Time
+}
+
+// New ...
+func New(issuer string) *TOTP {
+	return &TOTP{
+		Issuer: issuer,
+		Digits: DefaultDigits,
+		Period: DefaultPeriod,
+		Skew:   DefaultSkew,
+		Now:    time.Now,
+	}
+}
+
+// GenerateSecret returns a new random secret
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeSecret returns the base32 representation of the secret used by authenticator apps
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+// URI returns the otpauth:// URI to be rendered as a QR code by the client
+func (t *TOTP) URI(secret []byte, account string) string {
+	label := url.PathEscape(t.Issuer + ":" + account)
+
+	params := url.Values{}
+	params.Set("secret", EncodeSecret(secret))
+	params.Set("issuer", t.Issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", t.Digits))
+	params.Set("period", fmt.Sprintf("%d", int64(t.Period/time.Second)))
+
+	return fmt.Sprintf("otpauth://totp/%v?%v", label, params.Encode())
+}
+
+// Step returns the time step for the given time
+func (t *TOTP) Step(at time.Time) int64 {
+	return at.Unix() / int64(t.Period/time.Second)
+}
+
+// Code returns the code for the given step
+func (t *TOTP) Code(secret []byte, step int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < t.Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", t.Digits, value%mod)
+}
+
+// Validate checks the code against the steps around the current time and
+// returns the matched step. Steps lower or equal than lastStep are rejected
+// so a code can not be used twice.
+func (t *TOTP) Validate(secret []byte, code string, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != t.Digits {
+		return 0, false
+	}
+
+	current := t.Step(t.Now())
+	for step := current - t.Skew; step <= current+t.Skew; step++ {
+		if step <= lastStep {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(t.Code(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
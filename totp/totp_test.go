@@ -0,0 +1,69 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// the SHA-1 vectors of RFC 6238 appendix B
+func TestCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	tt := []struct {
+		at   int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	totp := New("test")
+	totp.Digits = 8
+
+	for _, tc := range tt {
+		if code := totp.Code(secret, totp.Step(time.Unix(tc.at, 0))); code != tc.code {
+			t.Errorf("code at %v = %v, want %v", tc.at, code, tc.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+
+	totp := New("test")
+	totp.Now = func() time.Time { return now }
+
+	current := totp.Step(now)
+
+	tt := []struct {
+		name     string
+		step     int64
+		lastStep int64
+		ok       bool
+	}{
+		{"current step", current, 0, true},
+		{"previous step within skew", current - 1, 0, true},
+		{"next step within skew", current + 1, 0, true},
+		{"step outside skew", current + 2, 0, false},
+		{"step already used", current, current, false},
+		{"earlier than the last step used", current - 1, current, false},
+	}
+
+	for _, tc := range tt {
+		step, ok := totp.Validate(secret, totp.Code(secret, tc.step), tc.lastStep)
+		if ok != tc.ok {
+			t.Errorf("%v: ok = %v, want %v", tc.name, ok, tc.ok)
+		}
+		if ok && step != tc.step {
+			t.Errorf("%v: step = %v, want %v", tc.name, step, tc.step)
+		}
+	}
+
+	if _, ok := totp.Validate(secret, "12345", 0); ok {
+		t.Error("a code of the wrong length was accepted")
+	}
+}
@@ -0,0 +1,31 @@
+package users
+
+import (
+	"time"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+)
+
+// UserVersion is the state of a user between ValidFrom and ValidTo, ValidTo
+// is nil for the current version. Passwords are not part of the history.
+type UserVersion struct {
+	Version int64 `json:"version" db:"version"`
+	User
+	ValidFrom time.Time  `json:"valid_from" db:"valid_from"`
+	ValidTo   *time.Time `json:"valid_to" db:"valid_to"`
+}
+
+// ToProto ...
+func (v *UserVersion) ToProto() *pb.UserVersion {
+	res := &pb.UserVersion{
+		Version:   v.Version,
+		Data:      v.User.ToProto(),
+		ValidFrom: v.ValidFrom.Unix(),
+	}
+
+	if v.ValidTo != nil {
+		res.ValidTo = v.ValidTo.Unix()
+	}
+
+	return res
+}
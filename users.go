@@ -1,6 +1,7 @@
 package users
 
 import (
+	"context"
 	"time"
 
 	pb "github.com/frperezr/microservices-demo/pb"
@@ -16,32 +17,148 @@ type User struct {
 	CreatedAt time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
 	DeletedAt *time.Time `json:"deleted_at" db:"deleted_at"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at" db:"email_verified_at"`
+	MFAEnabledAt    *time.Time `json:"mfa_enabled_at" db:"mfa_enabled_at"`
+
+	FailedLoginAttempts int        `json:"failed_login_attempts" db:"failed_login_attempts"`
+	LastFailedLoginAt   *time.Time `json:"last_failed_login_at" db:"last_failed_login_at"`
+	LockedUntil         *time.Time `json:"locked_until" db:"locked_until"`
+
+	// Roles are loaded by the service, they are not a column of users
+	Roles []string `json:"roles" db:"-"`
+}
+
+// IsEmailVerified reports whether the current email of the user was confirmed
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// IsMFAEnabled reports whether the user must provide a second factor to authenticate
+func (u *User) IsMFAEnabled() bool {
+	return u.MFAEnabledAt != nil
+}
+
+// ListOptions ...
+type ListOptions struct {
+	Limit  uint64
+	Offset uint64
+
+	// Verified filters users by email verification status, nil means any
+	Verified *bool
+
+	// OrganizationID scopes the list to the members of the organization
+	OrganizationID string
 }
 
 // Service ...
 type Service interface {
-	GetByID(id string) (*User, error)
-	GetByEmail(email string) (*User, error)
-	Create(*User) error
-	Update(*User) error
-	Delete(id string) error
+	GetByID(ctx context.Context, id string) (*User, error)
+	GetByIDs(ctx context.Context, ids []string) ([]*User, error)
+	BatchGetUsers(ctx context.Context, ids []string) ([]*User, []string, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	Create(ctx context.Context, u *User) error
+	BatchCreateUsers(ctx context.Context, uu []*User, atomic bool) ([]error, error)
+	ImportUsers(ctx context.Context, dryRun bool, next func() (int64, *User, error)) (*ImportResult, error)
+	ExportUsers(ctx context.Context, opts *ExportOptions, fn func(*User) error) error
+	Update(ctx context.Context, u *User) error
+	Delete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) (*User, error)
+	WatchUsers(ctx context.Context, f *EventFilter, fn func(*Event) error) error
+	EventsHead(ctx context.Context) (int64, int64, error)
+	ListAuditEvents(ctx context.Context, userID string) ([]*AuditEvent, error)
+	GetUserAsOf(ctx context.Context, id string, at time.Time) (*UserVersion, error)
+	ListUserVersions(ctx context.Context, id string) ([]*UserVersion, error)
+	List(ctx context.Context, opts *ListOptions) ([]*User, error)
+
+	VerifyEmail(ctx context.Context, token string) (*User, error)
+	ResendVerification(ctx context.Context, email string) error
+
+	RequestEmailChange(ctx context.Context, u *User, email string) (*EmailChange, error)
+	ConfirmEmailChange(ctx context.Context, token string) (*User, error)
+	RevertEmailChange(ctx context.Context, token string) (*User, error)
+
+	Authenticate(ctx context.Context, email, password, orgID, ip string) (*Authentication, error)
+	AuthenticateMFA(ctx context.Context, mfaToken, code, ip string) (*Authentication, error)
+	Unlock(ctx context.Context, userID string) (*User, error)
+
+	ListRoles(ctx context.Context) ([]*Role, error)
+	AssignRole(ctx context.Context, userID, role string) (*User, error)
+	RevokeRole(ctx context.Context, userID, role string) (*User, error)
+	CheckPermission(ctx context.Context, userID, permission string) (bool, error)
+
+	CreateOrganization(ctx context.Context, o *Organization, ownerID string) error
+	GetOrganization(ctx context.Context, id string) (*Organization, error)
+	ListOrganizations(ctx context.Context, userID string) ([]*Organization, error)
+	GetMemberByEmail(ctx context.Context, orgID, email string) (*User, error)
+	SetMemberRole(ctx context.Context, orgID, userID, role string) (*Membership, error)
+	RemoveMember(ctx context.Context, orgID, userID string) error
+	InviteMember(ctx context.Context, orgID, email, role string) (*Invitation, error)
+	AcceptInvitation(ctx context.Context, token, userID string) (*Membership, error)
+
+	CreateGroup(ctx context.Context, g *Group) error
+	GetGroup(ctx context.Context, id string) (*Group, error)
+	UpdateGroup(ctx context.Context, g *Group) error
+	DeleteGroup(ctx context.Context, id string) error
+	ListGroups(ctx context.Context, orgID string) ([]*Group, error)
+	AddGroupMember(ctx context.Context, m *GroupMember) error
+	RemoveGroupMember(ctx context.Context, m *GroupMember) error
+	ListGroupMembers(ctx context.Context, groupID string) ([]*GroupMember, error)
+	ListUserGroups(ctx context.Context, userID string) ([]*Group, error)
+
+	CreateWebhook(ctx context.Context, w *Webhook) (string, error)
+	GetWebhook(ctx context.Context, id string) (*Webhook, error)
+	ListWebhooks(ctx context.Context, orgID string) ([]*Webhook, error)
+	UpdateWebhook(ctx context.Context, w *Webhook) error
+	DeleteWebhook(ctx context.Context, id string) error
+	ListWebhookDeliveries(ctx context.Context, webhookID, status string) ([]*WebhookDelivery, error)
+	ListWebhookAttempts(ctx context.Context, deliveryID string) ([]*WebhookAttempt, error)
+	ReplayWebhookDelivery(ctx context.Context, id string) (*WebhookDelivery, error)
+
+	EnrollMFA(ctx context.Context, userID string) (*MFAEnrollment, error)
+	ConfirmMFA(ctx context.Context, userID, code string) (*User, []string, error)
+	DisableMFA(ctx context.Context, userID, code string) (*User, error)
+	ResetMFA(ctx context.Context, userID string) (*User, error)
 }
 
-// ToProto ...
+// ToProto returns the user without its password
 func (u *User) ToProto() *pb.User {
+	var emailVerifiedAt int64
+	if u.EmailVerifiedAt != nil {
+		emailVerifiedAt = u.EmailVerifiedAt.Unix()
+	}
+
+	var lockedUntil int64
+	if u.IsLocked(time.Now()) {
+		lockedUntil = u.LockedUntil.Unix()
+	}
+
 	return &pb.User{
 		Id:        u.ID,
 		Email:     u.Email,
 		Name:      u.Name,
 		LastName:  u.LastName,
-		Password:  u.Password,
 		CreatedAt: u.CreatedAt.Unix(),
 		UpdatedAt: u.UpdatedAt.Unix(),
+
+		EmailVerifiedAt: emailVerifiedAt,
+		MfaEnabled:      u.IsMFAEnabled(),
+
+		FailedLoginAttempts: int32(u.FailedLoginAttempts),
+		LockedUntil:         lockedUntil,
+
+		Roles: u.Roles,
 	}
 }
 
 // FromProto ...
 func (u *User) FromProto(uu *pb.User) *User {
+	var emailVerifiedAt *time.Time
+	if uu.EmailVerifiedAt != 0 {
+		t := time.Unix(uu.EmailVerifiedAt, 0)
+		emailVerifiedAt = &t
+	}
+
 	return &User{
 		ID:        uu.Id,
 		Email:     uu.Email,
@@ -50,5 +167,9 @@ func (u *User) FromProto(uu *pb.User) *User {
 		Password:  uu.Password,
 		CreatedAt: time.Unix(uu.CreatedAt, 0),
 		UpdatedAt: time.Unix(uu.UpdatedAt, 0),
+
+		EmailVerifiedAt: emailVerifiedAt,
+
+		Roles: uu.Roles,
 	}
 }
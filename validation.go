@@ -0,0 +1,28 @@
+package users
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldViolation describes a rule a field of a request does not satisfy
+type FieldViolation struct {
+	Field       string `json:"field"`
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+}
+
+// ValidationError lists every violation found, not only the first one
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+// Error ...
+func (e *ValidationError) Error() string {
+	descriptions := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		descriptions = append(descriptions, fmt.Sprintf("%v: %v", v.Field, v.Description))
+	}
+
+	return "invalid request: " + strings.Join(descriptions, ", ")
+}
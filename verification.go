@@ -0,0 +1,42 @@
+package users
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned when a token does not exist, was already used or expired
+	ErrInvalidToken = errors.New("invalid or expired token")
+
+	// ErrEmailNotVerified is returned when a verified email is required
+	ErrEmailNotVerified = errors.New("email not verified")
+
+	// ErrEmailAlreadyVerified is returned when asking to verify an already verified email
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+)
+
+// EmailVerification is a pending confirmation of the email of a user.
+// Only the sha256 hash of the token is stored, the plain token is sent to the user.
+type EmailVerification struct {
+	ID        string     `json:"id" db:"id"`
+	UserID    string     `json:"user_id" db:"user_id"`
+	Email     string     `json:"email" db:"email"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Notifier delivers messages to the users
+type Notifier interface {
+	SendEmailVerification(u *User, token string) error
+
+	// SendEmailChangeConfirmation is sent to the new address
+	SendEmailChangeConfirmation(u *User, newEmail, token string) error
+	// SendEmailChangeNotice is sent to the old address
+	SendEmailChangeNotice(u *User, newEmail, revertToken string) error
+
+	// SendInvitation is sent to the invited email
+	SendInvitation(inv *Invitation, org *Organization, token string) error
+}
@@ -0,0 +1,133 @@
+package users
+
+import (
+	"errors"
+	"time"
+
+	pb "github.com/frperezr/microservices-demo/pb"
+)
+
+// Status of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryDead      = "dead"
+)
+
+var (
+	// ErrWebhookNotFound ...
+	ErrWebhookNotFound = errors.New("webhook not found")
+
+	// ErrDeliveryNotFound ...
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+	// ErrInvalidWebhookURL ...
+	ErrInvalidWebhookURL = errors.New("webhook url must be a absolute http or https url")
+)
+
+// Webhook is a endpoint of a organization that receives the events of its
+// members, EventTypes empty means every type. Secret is stored encrypted.
+type Webhook struct {
+	ID             string    `json:"id" db:"id"`
+	OrganizationID string    `json:"organization_id" db:"organization_id"`
+	URL            string    `json:"url" db:"url"`
+	EventTypes     []string  `json:"event_types" db:"-"`
+	Active         bool      `json:"active" db:"active"`
+	Secret         []byte    `json:"-" db:"secret"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// WebhookDelivery is a event waiting to be, or already, delivered to a webhook
+type WebhookDelivery struct {
+	ID             string    `json:"id" db:"id"`
+	WebhookID      string    `json:"webhook_id" db:"webhook_id"`
+	EventID        int64     `json:"event_id" db:"event_id"`
+	EventType      string    `json:"event_type" db:"event_type"`
+	Status         string    `json:"status" db:"status"`
+	Attempts       int       `json:"attempts" db:"attempts"`
+	NextAttemptAt  time.Time `json:"next_attempt_at" db:"next_attempt_at"`
+	LastStatusCode *int      `json:"last_status_code" db:"last_status_code"`
+	LastError      *string   `json:"last_error" db:"last_error"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// WebhookAttempt is a single request made for a delivery
+type WebhookAttempt struct {
+	ID         string    `json:"id" db:"id"`
+	DeliveryID string    `json:"delivery_id" db:"delivery_id"`
+	StatusCode *int      `json:"status_code" db:"status_code"`
+	Error      *string   `json:"error" db:"error"`
+	DurationMS int64     `json:"duration_ms" db:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// ToProto ...
+func (w *Webhook) ToProto() *pb.Webhook {
+	return &pb.Webhook{
+		Id:             w.ID,
+		OrganizationId: w.OrganizationID,
+		Url:            w.URL,
+		EventTypes:     w.EventTypes,
+		Active:         w.Active,
+		CreatedAt:      w.CreatedAt.Unix(),
+		UpdatedAt:      w.UpdatedAt.Unix(),
+	}
+}
+
+// FromProto ...
+func (w *Webhook) FromProto(pw *pb.Webhook) *Webhook {
+	return &Webhook{
+		ID:             pw.Id,
+		OrganizationID: pw.OrganizationId,
+		URL:            pw.Url,
+		EventTypes:     pw.EventTypes,
+		Active:         pw.Active,
+	}
+}
+
+// ToProto ...
+func (d *WebhookDelivery) ToProto() *pb.WebhookDelivery {
+	res := &pb.WebhookDelivery{
+		Id:            d.ID,
+		WebhookId:     d.WebhookID,
+		EventId:       d.EventID,
+		EventType:     d.EventType,
+		Status:        d.Status,
+		Attempts:      int32(d.Attempts),
+		NextAttemptAt: d.NextAttemptAt.Unix(),
+		CreatedAt:     d.CreatedAt.Unix(),
+		UpdatedAt:     d.UpdatedAt.Unix(),
+	}
+
+	if d.LastStatusCode != nil {
+		res.LastStatusCode = int32(*d.LastStatusCode)
+	}
+
+	if d.LastError != nil {
+		res.LastError = *d.LastError
+	}
+
+	return res
+}
+
+// ToProto ...
+func (a *WebhookAttempt) ToProto() *pb.WebhookAttempt {
+	res := &pb.WebhookAttempt{
+		Id:         a.ID,
+		DeliveryId: a.DeliveryID,
+		DurationMs: a.DurationMS,
+		CreatedAt:  a.CreatedAt.Unix(),
+	}
+
+	if a.StatusCode != nil {
+		res.StatusCode = int32(*a.StatusCode)
+	}
+
+	if a.Error != nil {
+		res.Error = *a.Error
+	}
+
+	return res
+}
@@ -0,0 +1,31 @@
+package webhook
+
+import (
+	"context"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+// Queue stores the deliveries of the events
+type Queue interface {
+	EnqueueWebhookDeliveries(ctx context.Context, e *users.Event) (int, error)
+}
+
+// Dispatcher is a outbox.Sink that queues a delivery of each event for the
+// webhooks subscribed to it, the Worker sends them later
+type Dispatcher struct {
+	Queue Queue
+}
+
+// NewDispatcher ...
+func NewDispatcher(queue Queue) *Dispatcher {
+	return &Dispatcher{Queue: queue}
+}
+
+// Publish ...
+func (d *Dispatcher) Publish(ctx context.Context, e *users.Event) error {
+	// webhooks of every organization of the user get the event
+	_, err := d.Queue.EnqueueWebhookDeliveries(tenant.WithSystem(ctx), e)
+	return err
+}
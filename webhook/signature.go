@@ -0,0 +1,66 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// DefaultTolerance is how old a delivery can be for Verify to accept it
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	// ErrInvalidSignature ...
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+
+	// ErrExpiredTimestamp is returned for deliveries older than the tolerance, they may be replayed
+	ErrExpiredTimestamp = errors.New("webhook: timestamp outside of tolerance")
+)
+
+// Sign returns the signature header of a body sent at timestamp, a HMAC-SHA256
+// of "<timestamp>.<body>" keyed with the secret of the webhook
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a received delivery,
+// it is meant for receivers written in Go
+func Verify(secret []byte, timestamp, signature string, body []byte, tolerance time.Duration, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if d := now.Sub(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+		return ErrExpiredTimestamp
+	}
+
+	expected := Sign(secret, ts, body)
+
+	// a rotated secret may add more than one signature separated by commas
+	for _, sig := range strings.Split(signature, ",") {
+		if hmac.Equal([]byte(strings.TrimSpace(sig)), []byte(expected)) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
@@ -0,0 +1,226 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/encryption"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+)
+
+const (
+	// DefaultMaxAttempts is the number of failed attempts before a delivery is dead
+	DefaultMaxAttempts = 10
+
+	// DefaultBaseDelay is the wait after the first failed attempt, it doubles after each one
+	DefaultBaseDelay = 30 * time.Second
+
+	// DefaultMaxDelay caps the wait between attempts
+	DefaultMaxDelay = 6 * time.Hour
+
+	// DefaultLease is the time a claimed delivery is hidden from other workers
+	DefaultLease = time.Minute
+
+	// DefaultInterval is the time the worker waits when no delivery is due
+	DefaultInterval = 5 * time.Second
+
+	// DefaultBatchSize is the number of deliveries claimed at once
+	DefaultBatchSize = 20
+)
+
+// errInactive is recorded when the webhook was disabled after the delivery was queued
+var errInactive = errors.New("webhook is not active")
+
+// Store is what the worker needs of the users store
+type Store interface {
+	GetWebhook(ctx context.Context, id string) (*users.Webhook, error)
+	GetEvent(ctx context.Context, id int64) (*users.Event, error)
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*users.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, d *users.WebhookDelivery, a *users.WebhookAttempt) error
+}
+
+// Worker sends the queued deliveries, retrying failures with exponential
+// backoff until MaxAttempts, when the delivery is left dead for a replay
+type Worker struct {
+	Store  Store
+	Cipher *encryption.AESGCM
+	Client *http.Client
+
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Lease       time.Duration
+	Interval    time.Duration
+	BatchSize   int
+
+	Now func() time.Time
+}
+
+// NewWorker ...
+func NewWorker(store Store, cipher *encryption.AESGCM) *Worker {
+	return &Worker{
+		Store:       store,
+		Cipher:      cipher,
+		Client:      NewClient(),
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   DefaultBaseDelay,
+		MaxDelay:    DefaultMaxDelay,
+		Lease:       DefaultLease,
+		Interval:    DefaultInterval,
+		BatchSize:   DefaultBatchSize,
+		Now:         time.Now,
+	}
+}
+
+// Run sends deliveries until the context is canceled
+func (w *Worker) Run(ctx context.Context) error {
+	for {
+		n, err := w.Flush(ctx)
+		if err != nil {
+			log.Println(fmt.Sprintf("[User Service][Webhooks][Error] %v", err.Error()))
+		}
+
+		if err == nil && n == w.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(w.Interval):
+		}
+	}
+}
+
+// Flush attempts a single batch of due deliveries and returns its size
+func (w *Worker) Flush(ctx context.Context) (int, error) {
+	// deliveries of every organization are sent by the same workers
+	ctx = tenant.WithSystem(ctx)
+
+	dd, err := w.Store.ClaimWebhookDeliveries(ctx, w.BatchSize, w.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range dd {
+		if err := w.attempt(ctx, d); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(dd), nil
+}
+
+// Delay returns the wait after the given number of failed attempts
+func (w *Worker) Delay(attempts int) time.Duration {
+	d := w.BaseDelay
+	for i := 1; i < attempts && d < w.MaxDelay; i++ {
+		d *= 2
+	}
+
+	if d > w.MaxDelay {
+		d = w.MaxDelay
+	}
+
+	return d
+}
+
+func (w *Worker) attempt(ctx context.Context, d *users.WebhookDelivery) error {
+	a := &users.WebhookAttempt{DeliveryID: d.ID}
+	start := w.Now()
+
+	status, err := w.send(ctx, d)
+	a.DurationMS = w.Now().Sub(start).Milliseconds()
+
+	if status != 0 {
+		a.StatusCode = &status
+	}
+
+	d.Attempts++
+	d.LastStatusCode = a.StatusCode
+	d.LastError = nil
+
+	switch {
+	case err == nil:
+		d.Status = users.DeliverySucceeded
+	case err == errInactive || d.Attempts >= w.MaxAttempts:
+		d.Status = users.DeliveryDead
+	default:
+		d.Status = users.DeliveryPending
+		d.NextAttemptAt = w.Now().Add(w.Delay(d.Attempts))
+	}
+
+	if err != nil {
+		msg := err.Error()
+		a.Error = &msg
+		d.LastError = &msg
+	}
+
+	return w.Store.RecordWebhookAttempt(ctx, d, a)
+}
+
+// send makes the request of the delivery, any response other than 2xx is a error
+func (w *Worker) send(ctx context.Context, d *users.WebhookDelivery) (int, error) {
+	hook, err := w.Store.GetWebhook(ctx, d.WebhookID)
+	if err != nil {
+		return 0, err
+	}
+
+	if !hook.Active {
+		return 0, errInactive
+	}
+
+	e, err := w.Store.GetEvent(ctx, d.EventID)
+	if err != nil {
+		return 0, err
+	}
+
+	secret, err := w.Cipher.Decrypt(hook.Secret)
+	if err != nil {
+		return 0, err
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := w.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "users-api-webhooks")
+	req.Header.Set(HeaderID, hook.ID)
+	req.Header.Set(HeaderDelivery, d.ID)
+	req.Header.Set(HeaderEvent, e.Type)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+
+	res, err := w.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// drain so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("receiver responded %v", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
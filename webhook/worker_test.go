@@ -0,0 +1,247 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frperezr/microservices-demo/src/users-api"
+	"github.com/frperezr/microservices-demo/src/users-api/database/sqlite"
+	"github.com/frperezr/microservices-demo/src/users-api/encryption"
+	"github.com/frperezr/microservices-demo/src/users-api/notifier"
+	"github.com/frperezr/microservices-demo/src/users-api/password"
+	"github.com/frperezr/microservices-demo/src/users-api/service"
+	"github.com/frperezr/microservices-demo/src/users-api/tenant"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testHook is a webhook of a new organization with a delivery of the
+// user.created event of its owner queued
+type testHook struct {
+	store   *sqlite.UserStore
+	userSvc *service.Users
+	hook    *users.Webhook
+	secret  string
+}
+
+// newTestCipher returns a cipher whose key is filled with b
+func newTestCipher(t *testing.T, b byte) *encryption.AESGCM {
+	t.Helper()
+
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = b
+	}
+
+	cipher, err := encryption.NewAESGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cipher
+}
+
+// newTestHook subscribes url to the user.created events of a new organization,
+// encrypting its secret with cipher, and queues the delivery of its owner
+func newTestHook(t *testing.T, url string, cipher *encryption.AESGCM) *testHook {
+	t.Helper()
+
+	password.HashCost = bcrypt.MinCost
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Store.Close() })
+
+	userSvc := service.New(store, notifier.NewLog("http://localhost"))
+	userSvc.Cipher = newTestCipher(t, 1)
+	userSvc.WebhookCipher = cipher
+
+	ctx := tenant.WithSystem(context.Background())
+
+	owner := &users.User{Email: "owner@acme.test", Name: "Owner", LastName: "Acme", Password: "correct horse battery staple"}
+	if err := userSvc.Create(ctx, owner); err != nil {
+		t.Fatal(err)
+	}
+
+	org := &users.Organization{Name: "Acme", Slug: "acme"}
+	if err := userSvc.CreateOrganization(ctx, org, owner.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	hook := &users.Webhook{OrganizationID: org.ID, URL: url, EventTypes: []string{users.EventUserCreated}}
+	secret, err := userSvc.CreateWebhook(ctx, hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := store.ListEvents(ctx, &users.EventFilter{UserIDs: []string{owner.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range events {
+		if err := NewDispatcher(store).Publish(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &testHook{store: store, userSvc: userSvc, hook: hook, secret: secret}
+}
+
+// delivery returns the only delivery of the webhook
+func (th *testHook) delivery(t *testing.T) *users.WebhookDelivery {
+	t.Helper()
+
+	dd, err := th.store.ListWebhookDeliveries(tenant.WithSystem(context.Background()), th.hook.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dd) != 1 {
+		t.Fatalf("got %v deliveries, want 1", len(dd))
+	}
+
+	return dd[0]
+}
+
+func TestWorkerSignsTheDeliveries(t *testing.T) {
+	received := make(chan error, 1)
+
+	var th *testHook
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if r.Header.Get(HeaderEvent) != users.EventUserCreated {
+			t.Errorf("%v = %q, want %q", HeaderEvent, r.Header.Get(HeaderEvent), users.EventUserCreated)
+		}
+
+		received <- Verify([]byte(th.secret), r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body, DefaultTolerance, time.Now())
+	}))
+	defer receiver.Close()
+
+	cipher := newTestCipher(t, 2)
+	th = newTestHook(t, receiver.URL, cipher)
+
+	worker := NewWorker(th.store, cipher)
+	// the receiver listens on loopback
+	worker.Client = receiver.Client()
+
+	if n, err := worker.Flush(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Flush = %v, %v, want 1 delivery", n, err)
+	}
+
+	if err := <-received; err != nil {
+		t.Fatalf("Verify = %v", err)
+	}
+
+	if d := th.delivery(t); d.Status != users.DeliverySucceeded || d.Attempts != 1 {
+		t.Fatalf("delivery is %v after %v attempts, want %v after 1", d.Status, d.Attempts, users.DeliverySucceeded)
+	}
+}
+
+func TestWebhookSecretsAreNotEncryptedWithTheMFAKey(t *testing.T) {
+	th := newTestHook(t, "https://hooks.acme.test", newTestCipher(t, 2))
+
+	hook, err := th.store.GetWebhook(tenant.WithSystem(context.Background()), th.hook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := th.userSvc.Cipher.Decrypt(hook.Secret); err == nil {
+		t.Fatal("the secret was decrypted with the MFA key")
+	}
+
+	secret, err := th.userSvc.WebhookCipher.Decrypt(hook.Secret)
+	if err != nil || string(secret) != th.secret {
+		t.Fatalf("Decrypt = %q, %v, want the secret of the webhook", secret, err)
+	}
+}
+
+func TestWorkerRetriesFailedDeliveries(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	cipher := newTestCipher(t, 2)
+	th := newTestHook(t, receiver.URL, cipher)
+
+	worker := NewWorker(th.store, cipher)
+	worker.Client = receiver.Client()
+
+	if _, err := worker.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	d := th.delivery(t)
+	if d.Status != users.DeliveryPending || d.Attempts != 1 {
+		t.Fatalf("delivery is %v after %v attempts, want %v after 1", d.Status, d.Attempts, users.DeliveryPending)
+	}
+
+	if d.LastStatusCode == nil || *d.LastStatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("last status code = %v, want %v", d.LastStatusCode, http.StatusServiceUnavailable)
+	}
+
+	if !d.NextAttemptAt.After(time.Now().Add(worker.BaseDelay / 2)) {
+		t.Fatalf("next attempt at %v, want it after the backoff", d.NextAttemptAt)
+	}
+}
+
+func TestWorkerRefusesPrivateAddresses(t *testing.T) {
+	called := make(chan struct{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called <- struct{}{}
+	}))
+	defer receiver.Close()
+
+	cipher := newTestCipher(t, 2)
+	// names are refused by the address they resolve to
+	th := newTestHook(t, strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1), cipher)
+
+	if _, err := NewWorker(th.store, cipher).Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-called:
+		t.Fatal("the delivery was posted to a loopback address")
+	default:
+	}
+
+	d := th.delivery(t)
+	if d.Status != users.DeliveryPending || d.LastError == nil || !strings.Contains(*d.LastError, ErrBlockedAddress.Error()) {
+		t.Fatalf("delivery is %v with error %v, want a attempt refused with %v", d.Status, d.LastError, ErrBlockedAddress)
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	for _, tt := range []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::ffff:127.0.0.1", false},
+	} {
+		if got := isPublic(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublic(%v) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}